@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/dansackett/dns-client/dnsclient"
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// runCheck compares a certificate, SSH host key or certificate authority with
+// the TLSA, SSHFP or CAA records published for a domain, exiting with a
+// non-zero status when they do not agree:
+//
+//     check tlsa -domain example.com -port 443 -cert chain.pem
+//     check sshfp -domain host.example.com -key /etc/ssh/ssh_host_ed25519_key.pub
+//     check caa -domain www.example.com -ca letsencrypt.org
+func runCheck(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("error: %v", "expected 'tlsa', 'sshfp' or 'caa' to check")
+	}
+
+	kind := args[0]
+
+	fs := flag.NewFlagSet("check "+kind, flag.ExitOnError)
+	domain := fs.String("domain", "", "Domain the records are published for. This is required.")
+	serverAddr := fs.String("server-addr", "8.8.8.8:53", "IP and Port for the DNS server to query.")
+	timeout := fs.Duration("timeout", dnsclient.DefaultTimeout, "How long to wait for a response before retrying.")
+	useTCP := fs.Bool("tcp", false, "Send the queries over TCP instead of UDP.")
+
+	var check func(*dnsclient.Client, string) bool
+
+	switch kind {
+	case "tlsa":
+		port := fs.Uint("port", 443, "Port of the service the certificate is used by.")
+		proto := fs.String("proto", "tcp", "Transport protocol of the service.")
+		certFile := fs.String("cert", "", "PEM file of the certificate, followed by the rest of its chain. This is required.")
+		check = func(client *dnsclient.Client, name string) bool {
+			return checkTLSA(client, fmt.Sprintf("_%d._%s.%s", *port, *proto, name), *certFile)
+		}
+	case "sshfp":
+		keyFile := fs.String("key", "", "Public host key file or known_hosts file. This is required.")
+		check = func(client *dnsclient.Client, name string) bool {
+			return checkSSHFP(client, name, *keyFile)
+		}
+	case "caa":
+		ca := fs.String("ca", "", "Domain identifying the certificate authority, such as letsencrypt.org. This is required.")
+		wildcard := fs.Bool("wildcard", false, "Check issuance of a wildcard certificate for the domain.")
+		check = func(client *dnsclient.Client, name string) bool {
+			return checkCAA(client, name, *ca, *wildcard)
+		}
+	default:
+		log.Fatalf("error: unknown check '%s', expected 'tlsa', 'sshfp' or 'caa'", kind)
+	}
+
+	fs.Parse(args[1:])
+
+	if *domain == "" {
+		log.Fatalf("error: %v", "'domain' is required")
+	}
+
+	client := dnsclient.New(*serverAddr)
+	client.Timeout = *timeout
+	client.ForceTCP = *useTCP
+
+	if !check(client, dnsmsg.Fqdn(*domain)) {
+		os.Exit(1)
+	}
+}
+
+// checkTLSA verifies the certificate chain in certFile against each TLSA
+// record at name, succeeding when any of them matches as RFC 6698 asks
+func checkTLSA(client *dnsclient.Client, name, certFile string) bool {
+	if certFile == "" {
+		log.Fatalf("error: %v", "'cert' is required")
+	}
+
+	chain, err := dnsmsg.LoadCertificates(certFile)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	rrs := lookupForCheck(client, name, dnsmsg.RecordTypeTLSA)
+
+	matched := false
+
+	for _, rr := range rrs {
+		tlsa, ok := rr.RDATA.(*dnsmsg.RDataTLSA)
+		if !ok {
+			fmt.Printf("%s TLSA: the record has no RDATA\n", rr.NAME)
+			continue
+		}
+
+		if err := tlsa.VerifyCertificate(chain, nil); err != nil {
+			fmt.Printf("%s TLSA %s: %v\n", rr.NAME, tlsa, err)
+			continue
+		}
+
+		fmt.Printf("%s TLSA %s: matches\n", rr.NAME, tlsa)
+		matched = true
+	}
+
+	if !matched {
+		// Show the record which would match the certificate as it is served
+		expected, err := dnsmsg.NewTLSA(chain[0], dnsmsg.TLSAUsageDANEEE, dnsmsg.TLSASelectorSPKI, dnsmsg.TLSAMatchingSHA256)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+
+		fmt.Printf("No TLSA record matches %s, the certificate would match:\n%s IN TLSA %s\n", certFile, name, expected)
+	}
+
+	return matched
+}
+
+// checkSSHFP compares the fingerprints of the host keys in keyFile with the
+// SSHFP records at name. Every key needs a matching record.
+func checkSSHFP(client *dnsclient.Client, name, keyFile string) bool {
+	if keyFile == "" {
+		log.Fatalf("error: %v", "'key' is required")
+	}
+
+	keys, err := dnsmsg.LoadSSHHostKeys(keyFile)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	rrs := lookupForCheck(client, name, dnsmsg.RecordTypeSSHFP)
+
+	ok := true
+
+	for _, key := range keys {
+		var matching []string
+
+		for _, rr := range rrs {
+			if sshfp, isSSHFP := rr.RDATA.(*dnsmsg.RDataSSHFP); isSSHFP && sshfp.Matches(key) {
+				matching = append(matching, sshfp.String())
+			}
+		}
+
+		if len(matching) > 0 {
+			fmt.Printf("%s key matches SSHFP %s\n", key.Type(), strings.Join(matching, ", "))
+			continue
+		}
+
+		ok = false
+
+		expected, err := key.SSHFP(dnsmsg.SSHFPTypeSHA256)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+
+		fmt.Printf("%s key matches no SSHFP record, it would match:\n%s IN SSHFP %s\n", key.Type(), name, expected)
+	}
+
+	return ok
+}
+
+// checkCAA finds the CAA records governing name and reports if they allow the
+// certificate authority ca to issue for it
+func checkCAA(client *dnsclient.Client, name, ca string, wildcard bool) bool {
+	if ca == "" {
+		log.Fatalf("error: %v", "'ca' is required")
+	}
+
+	owner, records, err := client.LookupCAA(context.Background(), name)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	if owner != "" {
+		for _, r := range records {
+			fmt.Printf("%s CAA %s\n", owner, r)
+		}
+	}
+
+	permitted, reason := dnsmsg.CAAPermits(records, ca, wildcard)
+
+	verdict := "may not"
+	if permitted {
+		verdict = "may"
+	}
+
+	subject := name
+	if wildcard {
+		subject = "*." + name
+	}
+
+	fmt.Printf("%s %s issue for %s: %s\n", ca, verdict, subject, reason)
+
+	return permitted
+}
+
+// lookupForCheck fetches the records a check compares against, failing when
+// there are none
+func lookupForCheck(client *dnsclient.Client, name string, typ dnsmsg.RecordType) []dnsmsg.RR {
+	rrs, err := client.Lookup(context.Background(), name, typ)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	if len(rrs) == 0 {
+		log.Fatalf("error: no %s records found for %s", dnsmsg.RecordTypeString(typ), name)
+	}
+
+	return rrs
+}
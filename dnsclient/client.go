@@ -0,0 +1,344 @@
+// Package dnsclient sends DNS messages to a server and validates the
+// responses it gets back.
+package dnsclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+const (
+	maxUDPMsgSize = 512
+
+	// DefaultTimeout is how long each attempt waits for a response when the
+	// Client does not set a Timeout
+	DefaultTimeout = 5 * time.Second
+
+	// DefaultRetries is the number of times a UDP query is resent after a
+	// timeout by clients created with New
+	DefaultRetries = 2
+)
+
+// These are the errors returned when a response does not belong to the query
+// that was sent
+var (
+	ErrIDMismatch       = errors.New("Response ID does not match the query ID")
+	ErrNotResponse      = errors.New("Message received is not a response")
+	ErrQuestionMismatch = errors.New("Response question does not match the query question")
+)
+
+// Client holds connection and config information
+type Client struct {
+	// IP and Port for the DNS server to query such as "8.8.8.8:53"
+	Server string
+
+	// How long to wait for a response to each attempt. DefaultTimeout is used
+	// when this is zero.
+	Timeout time.Duration
+
+	// The number of times a UDP query is resent when no response arrives in
+	// time. TCP queries are not retried.
+	Retries int
+
+	// Send every query over TCP rather than UDP
+	ForceTCP bool
+
+	// The key every query is signed with using TSIG. Responses must be signed
+	// with the same key or an error is returned. Queries are not signed when
+	// this is nil.
+	TSIG *dnsmsg.TSIGKey
+}
+
+// New creates a new Client for the server at addr using the default timeout
+// and retries
+func New(addr string) *Client {
+	return &Client{
+		Server:  addr,
+		Timeout: DefaultTimeout,
+		Retries: DefaultRetries,
+	}
+}
+
+// Exchange sends a message to the server and returns the decoded response
+// along with the round trip time. The response must carry the query ID, have
+// the QR bit set and echo the question asked or an error is returned.
+func (c *Client) Exchange(ctx context.Context, m *dnsmsg.Message) (*dnsmsg.Message, time.Duration, error) {
+	resp, info, err := c.ExchangeWithInfo(ctx, m)
+
+	return resp, info.QueryTime, err
+}
+
+// ExchangeWithInfo is like Exchange but returns all of the details about how
+// the response was received which are useful when presenting it.
+//
+// Queries are sent over UDP unless TCP is forced, and a response with the TC
+// bit set is retried over TCP since the server could not fit the full answer
+// in a UDP datagram.
+func (c *Client) ExchangeWithInfo(ctx context.Context, m *dnsmsg.Message) (*dnsmsg.Message, dnsmsg.QueryInfo, error) {
+	info := dnsmsg.QueryInfo{Server: c.Server}
+
+	msgBytes, requestMAC, err := c.encode(m)
+	if err != nil {
+		return nil, info, err
+	}
+
+	var resp *dnsmsg.Message
+
+	startQueryTime := time.Now()
+
+	if c.ForceTCP {
+		info.Network = "tcp"
+		resp, info.Size, err = c.exchangeTCP(ctx, m, msgBytes, requestMAC)
+	} else {
+		info.Network = "udp"
+		resp, info.Size, err = c.exchangeUDP(ctx, m, msgBytes, requestMAC)
+
+		if err == nil && resp.Header.TC == 1 {
+			info.Network = "tcp"
+			resp, info.Size, err = c.exchangeTCP(ctx, m, msgBytes, requestMAC)
+		}
+	}
+
+	info.QueryTime = time.Since(startQueryTime)
+	info.When = time.Now()
+
+	return resp, info, err
+}
+
+// encode translates a message for sending, signing it when the client has a
+// TSIG key. The MAC of the signature is returned to verify the response with.
+func (c *Client) encode(m *dnsmsg.Message) ([]byte, []byte, error) {
+	msgBytes, err := m.Encode()
+	if err != nil || c.TSIG == nil {
+		return msgBytes, nil, err
+	}
+
+	return c.TSIG.Sign(msgBytes, nil)
+}
+
+// exchangeUDP sends the query over UDP, resending it after each timeout until
+// the retries are used up
+func (c *Client) exchangeUDP(ctx context.Context, m *dnsmsg.Message, msgBytes, requestMAC []byte) (*dnsmsg.Message, int, error) {
+	// A server may send a response as large as the payload size we advertise
+	// with EDNS so the buffer needs to be able to hold it.
+	bufSize := maxUDPMsgSize
+	if e := m.EDNS(); e != nil && int(e.UDPSize) > bufSize {
+		bufSize = int(e.UDPSize)
+	}
+
+	var err error
+
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		var resp *dnsmsg.Message
+		var size int
+
+		resp, size, err = c.attemptUDP(ctx, m, msgBytes, requestMAC, bufSize)
+		if err == nil {
+			return resp, size, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+
+		// The read may time out at the context deadline a moment before the
+		// context is marked done, and retrying then only fails to dial
+		if ctxDeadline, ok := ctx.Deadline(); ok && !time.Now().Before(ctxDeadline) {
+			return nil, 0, context.DeadlineExceeded
+		}
+
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			return nil, 0, err
+		}
+	}
+
+	return nil, 0, err
+}
+
+func (c *Client) attemptUDP(ctx context.Context, m *dnsmsg.Message, msgBytes, requestMAC []byte, bufSize int) (*dnsmsg.Message, int, error) {
+	conn, err := c.dial(ctx, "udp")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer conn.Close()
+
+	if _, err = conn.Write(msgBytes); err != nil {
+		return nil, 0, err
+	}
+
+	respBuf := make([]byte, bufSize)
+
+	for {
+		n, err := conn.Read(respBuf)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		h := new(dnsmsg.Header)
+		if _, err := dnsmsg.DecodeHeader(respBuf[:n], 0, h); err != nil {
+			continue
+		}
+
+		// Anyone can send us a datagram so replies to other queries are
+		// ignored rather than failing the exchange.
+		if h.ID != m.Header.ID {
+			continue
+		}
+
+		// A truncated response may end part way through a record so only the
+		// header is kept. The caller retries the query over TCP.
+		if h.TC == 1 {
+			return &dnsmsg.Message{Header: *h}, n, nil
+		}
+
+		resp, err := c.decodeResponse(m, respBuf[:n], requestMAC)
+
+		return resp, n, err
+	}
+}
+
+// exchangeTCP sends the query over a new TCP connection
+func (c *Client) exchangeTCP(ctx context.Context, m *dnsmsg.Message, msgBytes, requestMAC []byte) (*dnsmsg.Message, int, error) {
+	conn, err := c.dial(ctx, "tcp")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer conn.Close()
+
+	if err = dnsmsg.WriteTCPMessage(conn, msgBytes); err != nil {
+		return nil, 0, err
+	}
+
+	respBytes, err := dnsmsg.ReadTCPMessage(conn)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := c.decodeResponse(m, respBytes, requestMAC)
+
+	return resp, len(respBytes), err
+}
+
+// dial connects to the server with a deadline set from the timeout or the
+// context, whichever is sooner. The connection is unblocked if the context is
+// cancelled while it is in use.
+func (c *Client) dial(ctx context.Context, network string) (net.Conn, error) {
+	deadline := c.deadline(ctx)
+
+	dialer := net.Dialer{Deadline: deadline}
+
+	conn, err := dialer.DialContext(ctx, network, c.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &ctxConn{Conn: conn, done: watchContext(ctx, conn)}, nil
+}
+
+// deadline returns when the current attempt times out, which is the timeout
+// from now or the context deadline, whichever is sooner
+func (c *Client) deadline(ctx context.Context) time.Time {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	return deadline
+}
+
+// ctxConn stops watching the context for cancellation once it is closed
+type ctxConn struct {
+	net.Conn
+	done chan struct{}
+}
+
+func (c *ctxConn) Close() error {
+	close(c.done)
+	return c.Conn.Close()
+}
+
+// watchContext expires the deadline on conn when ctx is done so any blocked
+// reads or writes return. Closing the returned channel stops the watch.
+func watchContext(ctx context.Context, conn net.Conn) chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	return done
+}
+
+// decodeResponse decodes the response bytes and checks they answer the query.
+// When the query was signed the response must be signed over its MAC.
+func (c *Client) decodeResponse(query *dnsmsg.Message, data, requestMAC []byte) (*dnsmsg.Message, error) {
+	resp := new(dnsmsg.Message)
+
+	if _, err := dnsmsg.DecodeMessage(data, resp); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateResponse(query, resp); err != nil {
+		return resp, err
+	}
+
+	if c.TSIG != nil {
+		if _, err := c.TSIG.Verify(data, requestMAC); err != nil {
+			return resp, err
+		}
+	}
+
+	return resp, nil
+}
+
+// ValidateResponse checks that resp is a response to query. The ID must match,
+// the QR bit must be set and the question must be echoed back. Servers may
+// leave the question out of a response reporting an error.
+func ValidateResponse(query, resp *dnsmsg.Message) error {
+	if resp.Header.ID != query.Header.ID {
+		return ErrIDMismatch
+	}
+
+	if resp.Header.QR != dnsmsg.QRTypeResponse {
+		return ErrNotResponse
+	}
+
+	if len(resp.Questions) == 0 && resp.Header.RCODE != dnsmsg.ResponseCodeNoError {
+		return nil
+	}
+
+	if len(resp.Questions) != len(query.Questions) {
+		return ErrQuestionMismatch
+	}
+
+	for i, q := range query.Questions {
+		r := resp.Questions[i]
+
+		if !strings.EqualFold(dnsmsg.Fqdn(q.QNAME), dnsmsg.Fqdn(r.QNAME)) || q.QTYPE != r.QTYPE || q.QCLASS != r.QCLASS {
+			return ErrQuestionMismatch
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,408 @@
+package dnsclient
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// testServer stands in for a DNS server on the loopback address, answering
+// UDP and TCP queries on the same port
+type testServer struct {
+	udp net.PacketConn
+	tcp net.Listener
+
+	// The handlers build the responses to each query, which are sent in
+	// order. A UDP query is dropped when there are none and a TCP connection
+	// is closed once they are sent.
+	udpHandler func(query *dnsmsg.Message, n int) []*dnsmsg.Message
+	tcpHandler func(query *dnsmsg.Message) []*dnsmsg.Message
+
+	mu         sync.Mutex
+	udpQueries int
+	tcpQueries int
+}
+
+func newTestServer(t *testing.T, udpHandler func(*dnsmsg.Message, int) []*dnsmsg.Message, tcpHandler func(*dnsmsg.Message) []*dnsmsg.Message) *testServer {
+	t.Helper()
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		t.Fatal(err)
+	}
+
+	s := &testServer{
+		udp:        udp,
+		tcp:        tcp,
+		udpHandler: udpHandler,
+		tcpHandler: tcpHandler,
+	}
+
+	go s.serveUDP()
+	go s.serveTCP()
+
+	return s
+}
+
+func (s *testServer) close() {
+	s.udp.Close()
+	s.tcp.Close()
+}
+
+func (s *testServer) addr() string {
+	return s.udp.LocalAddr().String()
+}
+
+// counts returns the number of queries received over UDP and TCP
+func (s *testServer) counts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.udpQueries, s.tcpQueries
+}
+
+func (s *testServer) serveUDP() {
+	buf := make([]byte, 4096)
+
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		query := new(dnsmsg.Message)
+		if _, err := dnsmsg.DecodeMessage(buf[:n], query); err != nil {
+			continue
+		}
+
+		s.mu.Lock()
+		s.udpQueries++
+		count := s.udpQueries
+		s.mu.Unlock()
+
+		if s.udpHandler == nil {
+			continue
+		}
+
+		for _, resp := range s.udpHandler(query, count) {
+			data, err := resp.Encode()
+			if err != nil {
+				continue
+			}
+
+			s.udp.WriteTo(data, addr)
+		}
+	}
+}
+
+func (s *testServer) serveTCP() {
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+
+			data, err := dnsmsg.ReadTCPMessage(conn)
+			if err != nil {
+				return
+			}
+
+			query := new(dnsmsg.Message)
+			if _, err := dnsmsg.DecodeMessage(data, query); err != nil {
+				return
+			}
+
+			s.mu.Lock()
+			s.tcpQueries++
+			s.mu.Unlock()
+
+			if s.tcpHandler == nil {
+				return
+			}
+
+			for _, resp := range s.tcpHandler(query) {
+				if data, err = resp.Encode(); err != nil {
+					return
+				}
+
+				if err = dnsmsg.WriteTCPMessage(conn, data); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// reply builds a response to the query holding the records given
+func reply(query *dnsmsg.Message, records ...dnsmsg.RR) *dnsmsg.Message {
+	resp := &dnsmsg.Message{
+		Header:    query.Header,
+		Questions: query.Questions,
+		Answers:   records,
+	}
+
+	resp.Header.QR = dnsmsg.QRTypeResponse
+
+	return resp
+}
+
+// a returns an A record for name holding the IPv4 address ip
+func a(t *testing.T, name, ip string) dnsmsg.RR {
+	t.Helper()
+
+	rdata, err := dnsmsg.NewRDataA(net.ParseIP(ip).To4())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dnsmsg.RR{NAME: name, TYPE: dnsmsg.RecordTypeA, CLASS: dnsmsg.RecordClassIN, TTL: 300, RDATA: rdata}
+}
+
+// txt returns a TXT record for name holding the text given
+func txt(t *testing.T, name, text string) dnsmsg.RR {
+	t.Helper()
+
+	return record(t, name+` 300 IN TXT "`+text+`"`)
+}
+
+func TestExchangeRetries(t *testing.T) {
+	tests := []struct {
+		name    string
+		drops   int
+		retries int
+		ok      bool
+	}{
+		{"first attempt answered", 0, 2, true},
+		{"answered after a retry", 1, 2, true},
+		{"answered on the last retry", 2, 2, true},
+		{"retries used up", 3, 2, false},
+		{"no retries", 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(query *dnsmsg.Message, n int) []*dnsmsg.Message {
+				if n <= tt.drops {
+					return nil
+				}
+
+				return []*dnsmsg.Message{reply(query, a(t, "www.example.com.", "192.0.2.1"))}
+			}, nil)
+			defer s.close()
+
+			c := New(s.addr())
+			c.Timeout = 100 * time.Millisecond
+			c.Retries = tt.retries
+
+			resp, info, err := c.ExchangeWithInfo(context.Background(), dnsmsg.NewQuery("www.example.com.", dnsmsg.RecordTypeA))
+
+			udpQueries, tcpQueries := s.counts()
+
+			want := tt.retries + 1
+			if tt.ok {
+				want = tt.drops + 1
+			}
+
+			if udpQueries != want || tcpQueries != 0 {
+				t.Errorf("server received %d UDP and %d TCP queries, want %d and 0", udpQueries, tcpQueries, want)
+			}
+
+			if !tt.ok {
+				if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+					t.Errorf("error = %v, want a timeout", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+
+			if info.Network != "udp" || len(resp.Answers) != 1 {
+				t.Errorf("received %d answers over %s, want 1 over udp", len(resp.Answers), info.Network)
+			}
+		})
+	}
+}
+
+func TestExchangeTruncated(t *testing.T) {
+	s := newTestServer(t, func(query *dnsmsg.Message, n int) []*dnsmsg.Message {
+		resp := reply(query)
+		resp.Header.TC = 1
+
+		return []*dnsmsg.Message{resp}
+	}, func(query *dnsmsg.Message) []*dnsmsg.Message {
+		return []*dnsmsg.Message{reply(query,
+			txt(t, "example.com.", "first"),
+			txt(t, "example.com.", "second"),
+		)}
+	})
+	defer s.close()
+
+	c := New(s.addr())
+	c.Timeout = time.Second
+
+	resp, info, err := c.ExchangeWithInfo(context.Background(), dnsmsg.NewQuery("example.com.", dnsmsg.RecordTypeTXT))
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	if udpQueries, tcpQueries := s.counts(); udpQueries != 1 || tcpQueries != 1 {
+		t.Errorf("server received %d UDP and %d TCP queries, want 1 of each", udpQueries, tcpQueries)
+	}
+
+	if info.Network != "tcp" {
+		t.Errorf("network = %s, want tcp", info.Network)
+	}
+
+	if resp.Header.TC != 0 || len(resp.Answers) != 2 {
+		t.Errorf("response has TC %d and %d answers, want 0 and 2", resp.Header.TC, len(resp.Answers))
+	}
+}
+
+func TestExchangeForceTCP(t *testing.T) {
+	s := newTestServer(t, nil, func(query *dnsmsg.Message) []*dnsmsg.Message {
+		return []*dnsmsg.Message{reply(query, a(t, "www.example.com.", "192.0.2.1"))}
+	})
+	defer s.close()
+
+	c := New(s.addr())
+	c.Timeout = time.Second
+	c.ForceTCP = true
+
+	_, info, err := c.ExchangeWithInfo(context.Background(), dnsmsg.NewQuery("www.example.com.", dnsmsg.RecordTypeA))
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	if udpQueries, tcpQueries := s.counts(); udpQueries != 0 || tcpQueries != 1 || info.Network != "tcp" {
+		t.Errorf("server received %d UDP and %d TCP queries, want 0 and 1", udpQueries, tcpQueries)
+	}
+}
+
+// A response larger than 512 octets arrives whole over UDP when the query
+// advertises a larger payload size with EDNS
+func TestExchangeEDNSPayloadSize(t *testing.T) {
+	s := newTestServer(t, func(query *dnsmsg.Message, n int) []*dnsmsg.Message {
+		resp := reply(query)
+
+		for i := 0; i < 8; i++ {
+			resp.Answers = append(resp.Answers, txt(t, "example.com.", strings.Repeat("x", 100)))
+		}
+
+		return []*dnsmsg.Message{resp}
+	}, nil)
+	defer s.close()
+
+	c := New(s.addr())
+	c.Timeout = time.Second
+
+	m := dnsmsg.NewQuery("example.com.", dnsmsg.RecordTypeTXT)
+	m.SetEDNS(dnsmsg.EDNS{UDPSize: dnsmsg.DefaultEDNSUDPSize})
+
+	resp, info, err := c.ExchangeWithInfo(context.Background(), m)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	if info.Network != "udp" || info.Size <= 512 || len(resp.Answers) != 8 {
+		t.Errorf("received %d octets holding %d answers over %s, want 8 answers over udp", info.Size, len(resp.Answers), info.Network)
+	}
+}
+
+func TestExchangeIgnoresOtherIDs(t *testing.T) {
+	s := newTestServer(t, func(query *dnsmsg.Message, n int) []*dnsmsg.Message {
+		other := reply(query, a(t, "www.example.com.", "203.0.113.1"))
+		other.Header.ID++
+
+		return []*dnsmsg.Message{other, reply(query, a(t, "www.example.com.", "192.0.2.1"))}
+	}, nil)
+	defer s.close()
+
+	c := New(s.addr())
+	c.Timeout = time.Second
+
+	resp, _, err := c.Exchange(context.Background(), dnsmsg.NewQuery("www.example.com.", dnsmsg.RecordTypeA))
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	if udpQueries, _ := s.counts(); udpQueries != 1 {
+		t.Errorf("server received %d UDP queries, want 1", udpQueries)
+	}
+
+	if len(resp.Answers) != 1 || resp.Answers[0].RDATA.String() != "192.0.2.1" {
+		t.Errorf("answers = %v, want the one to our query", resp.Answers)
+	}
+}
+
+func TestExchangeContextCancelled(t *testing.T) {
+	s := newTestServer(t, nil, nil)
+	defer s.close()
+
+	c := New(s.addr())
+	c.Timeout = time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	_, _, err := c.Exchange(ctx, dnsmsg.NewQuery("www.example.com.", dnsmsg.RecordTypeA))
+	if err != context.DeadlineExceeded {
+		t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if elapsed := time.Since(start); elapsed > c.Timeout {
+		t.Errorf("Exchange returned after %s, want before the %s timeout", elapsed, c.Timeout)
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	query := dnsmsg.NewQuery("www.example.com.", dnsmsg.RecordTypeA)
+
+	tests := []struct {
+		name   string
+		modify func(resp *dnsmsg.Message)
+		want   error
+	}{
+		{"matching", func(resp *dnsmsg.Message) {}, nil},
+		{"name case differs", func(resp *dnsmsg.Message) { resp.Questions[0].QNAME = "WWW.Example.COM." }, nil},
+		{"other ID", func(resp *dnsmsg.Message) { resp.Header.ID++ }, ErrIDMismatch},
+		{"not a response", func(resp *dnsmsg.Message) { resp.Header.QR = dnsmsg.QRTypeQuery }, ErrNotResponse},
+		{"other name", func(resp *dnsmsg.Message) { resp.Questions[0].QNAME = "mail.example.com." }, ErrQuestionMismatch},
+		{"other type", func(resp *dnsmsg.Message) { resp.Questions[0].QTYPE = dnsmsg.RecordTypeAAAA }, ErrQuestionMismatch},
+		{"no question", func(resp *dnsmsg.Message) { resp.Questions = nil }, ErrQuestionMismatch},
+		{"no question with an error", func(resp *dnsmsg.Message) {
+			resp.Questions = nil
+			resp.Header.RCODE = dnsmsg.ResponseCodeFormatError
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := reply(query)
+			resp.Questions = append([]dnsmsg.Question{}, query.Questions...)
+			tt.modify(resp)
+
+			if err := ValidateResponse(query, resp); err != tt.want {
+				t.Errorf("ValidateResponse = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
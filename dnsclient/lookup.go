@@ -0,0 +1,139 @@
+package dnsclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// Lookup asks for the records of type typ at name and returns those in the
+// answer, following any CNAME records which lead away from name. An error is
+// returned when the response code is not NOERROR.
+func (c *Client) Lookup(ctx context.Context, name string, typ dnsmsg.RecordType) ([]dnsmsg.RR, error) {
+	name = dnsmsg.Fqdn(name)
+
+	resp, _, err := c.Exchange(ctx, dnsmsg.NewQuery(name, typ))
+	if err != nil {
+		return nil, err
+	}
+
+	if rcode := resp.ResponseCode(); rcode != dnsmsg.ResponseCodeNoError {
+		return nil, fmt.Errorf("%s lookup for %s was answered with %s", dnsmsg.RecordTypeString(typ), name, dnsmsg.ResponseCodeToStrMap[rcode])
+	}
+
+	return answersFor(resp.Answers, name, typ), nil
+}
+
+// LookupSRV finds the servers offering a service over a protocol at name, such
+// as "sip" over "tcp" at example.com, by asking for the SRV records of
+// _sip._tcp.example.com. When service and proto are both empty name is looked
+// up as given. The records are returned in the order they should be tried, see
+// dnsmsg.SortSRV. dnsmsg.ErrServiceUnavailable is returned when the domain
+// says it does not offer the service.
+func (c *Client) LookupSRV(ctx context.Context, service, proto, name string) ([]*dnsmsg.RDataSRV, error) {
+	qname := dnsmsg.Fqdn(name)
+
+	if service != "" || proto != "" {
+		qname = "_" + strings.TrimPrefix(service, "_") + "._" + strings.TrimPrefix(proto, "_") + "." + qname
+	}
+
+	rrs, err := c.Lookup(ctx, qname, dnsmsg.RecordTypeSRV)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*dnsmsg.RDataSRV
+
+	// Records without RDATA have no server to offer
+	for _, rr := range rrs {
+		if srv, ok := rr.RDATA.(*dnsmsg.RDataSRV); ok {
+			records = append(records, srv)
+		}
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("No SRV records found for %s", qname)
+	}
+
+	if len(records) == 1 && records[0].Target() == "." {
+		return nil, dnsmsg.ErrServiceUnavailable
+	}
+
+	dnsmsg.SortSRV(records)
+
+	return records, nil
+}
+
+// answersFor returns the records of type typ owned by name in answers,
+// following any CNAME records which lead away from it
+func answersFor(answers []dnsmsg.RR, name string, typ dnsmsg.RecordType) []dnsmsg.RR {
+	var records []dnsmsg.RR
+
+	// Each CNAME moves the lookup along, so a chain can be no longer than the
+	// answers holding it
+	for range answers {
+		next := ""
+
+		for _, rr := range answers {
+			if !strings.EqualFold(dnsmsg.Fqdn(rr.NAME), name) {
+				continue
+			}
+
+			if rr.TYPE == typ {
+				records = append(records, rr)
+			} else if cname, ok := rr.RDATA.(*dnsmsg.RDataCNAME); ok {
+				next = dnsmsg.Fqdn(cname.Domain())
+			}
+		}
+
+		if len(records) > 0 || next == "" {
+			break
+		}
+
+		name = next
+	}
+
+	return records
+}
+
+// LookupCAA finds the CAA records which govern the issuance of certificates
+// for name. Starting at name each domain up to the root is asked in turn and
+// the records of the first one to have any are returned along with that
+// domain, see RFC 8659 section 3. No records and an empty domain are returned
+// when none of them restrict issuance.
+func (c *Client) LookupCAA(ctx context.Context, name string) (string, []*dnsmsg.RDataCAA, error) {
+	for domain := dnsmsg.Fqdn(name); domain != "."; domain = dnsmsg.ParentName(domain) {
+		resp, _, err := c.Exchange(ctx, dnsmsg.NewQuery(domain, dnsmsg.RecordTypeCAA))
+		if err != nil {
+			return "", nil, err
+		}
+
+		// Certificate authorities must not issue when the lookup fails, so
+		// only a missing name moves on to the parent
+		rcode := resp.ResponseCode()
+		if rcode != dnsmsg.ResponseCodeNoError && rcode != dnsmsg.ResponseCodeNameError {
+			return "", nil, fmt.Errorf("CAA lookup for %s was answered with %s", domain, dnsmsg.ResponseCodeToStrMap[rcode])
+		}
+
+		var records []*dnsmsg.RDataCAA
+
+		// Skipping a record could allow issuance it forbids, so a record
+		// which cannot be read fails the lookup
+		for _, rr := range answersFor(resp.Answers, domain, dnsmsg.RecordTypeCAA) {
+			caa, ok := rr.RDATA.(*dnsmsg.RDataCAA)
+			if !ok {
+				return "", nil, fmt.Errorf("CAA record of %s has no RDATA", domain)
+			}
+
+			records = append(records, caa)
+		}
+
+		if len(records) > 0 {
+			return domain, records, nil
+		}
+	}
+
+	return "", nil, nil
+}
@@ -0,0 +1,151 @@
+package dnsclient
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+func TestLookupSRV(t *testing.T) {
+	answers := map[string][]string{
+		"_sip._tcp.example.com.": {
+			"_sip._tcp.example.com. 300 IN SRV 20 0 5060 backup.example.com.",
+			"_sip._tcp.example.com. 300 IN SRV 10 0 5060 sip.example.com.",
+		},
+		"_ldap._tcp.example.com.": {
+			"_ldap._tcp.example.com. 300 IN CNAME _ldap._tcp.example.net.",
+			"_ldap._tcp.example.net. 300 IN SRV 10 0 389 ldap.example.net.",
+		},
+		"_imap._tcp.example.com.": {"_imap._tcp.example.com. 300 IN SRV 0 0 0 ."},
+		"_xmpp._tcp.example.com.": {"_xmpp._tcp.example.com. 300 IN TXT \"not here\""},
+	}
+
+	s := newTestServer(t, func(query *dnsmsg.Message, n int) []*dnsmsg.Message {
+		rrs, ok := answers[query.Questions[0].QNAME]
+
+		resp := reply(query)
+		if !ok {
+			resp.Header.RCODE = dnsmsg.ResponseCodeNameError
+		}
+
+		for _, s := range rrs {
+			resp.Answers = append(resp.Answers, record(t, s))
+		}
+
+		return []*dnsmsg.Message{resp}
+	}, nil)
+	defer s.close()
+
+	c := New(s.addr())
+	c.Timeout = time.Second
+
+	tests := []struct {
+		service, proto, name string
+		want                 []string
+		err                  error
+	}{
+		{"sip", "tcp", "example.com", []string{"10 0 5060 sip.example.com.", "20 0 5060 backup.example.com."}, nil},
+		{"_sip", "_tcp", "example.com.", []string{"10 0 5060 sip.example.com.", "20 0 5060 backup.example.com."}, nil},
+		{"", "", "_sip._tcp.example.com", []string{"10 0 5060 sip.example.com.", "20 0 5060 backup.example.com."}, nil},
+		{"ldap", "tcp", "example.com", []string{"10 0 389 ldap.example.net."}, nil},
+		{"imap", "tcp", "example.com", nil, dnsmsg.ErrServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		records, err := c.LookupSRV(context.Background(), tt.service, tt.proto, tt.name)
+		if err != tt.err {
+			t.Errorf("LookupSRV(%q, %q, %q) error = %v, want %v", tt.service, tt.proto, tt.name, err, tt.err)
+			continue
+		}
+
+		var got []string
+		for _, srv := range records {
+			got = append(got, srv.String())
+		}
+
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("LookupSRV(%q, %q, %q) = %q, want %q", tt.service, tt.proto, tt.name, got, tt.want)
+		}
+	}
+
+	// Names without SRV records and names which do not exist are errors
+	for _, service := range []string{"xmpp", "ftp"} {
+		if records, err := c.LookupSRV(context.Background(), service, "tcp", "example.com"); err == nil || err == dnsmsg.ErrServiceUnavailable {
+			t.Errorf("LookupSRV of %s = %v, %v, want an error", service, records, err)
+		}
+	}
+}
+
+func TestLookupCAA(t *testing.T) {
+	answers := map[string][]string{
+		"example.com.": {
+			`example.com. 300 IN CAA 0 issue "ca.example.net"`,
+			`example.com. 300 IN CAA 0 iodef "mailto:security@example.com"`,
+		},
+		"sub.example.com.": {},
+		"alias.example.org.": {
+			"alias.example.org. 300 IN CNAME target.example.net.",
+			`target.example.net. 300 IN CAA 0 issue ";"`,
+		},
+	}
+
+	s := newTestServer(t, func(query *dnsmsg.Message, n int) []*dnsmsg.Message {
+		name := query.Questions[0].QNAME
+
+		resp := reply(query)
+
+		switch rrs, ok := answers[name]; {
+		case strings.HasSuffix(name, "broken.example.com."):
+			resp.Header.RCODE = dnsmsg.ResponseCodeServerFailure
+		case !ok:
+			resp.Header.RCODE = dnsmsg.ResponseCodeNameError
+		default:
+			for _, s := range rrs {
+				resp.Answers = append(resp.Answers, record(t, s))
+			}
+		}
+
+		return []*dnsmsg.Message{resp}
+	}, nil)
+	defer s.close()
+
+	c := New(s.addr())
+	c.Timeout = time.Second
+
+	// Each domain up to the root is asked in turn until one has records
+	tests := []struct {
+		name   string
+		domain string
+		want   []string
+	}{
+		{"example.com", "example.com.", []string{`0 issue "ca.example.net"`, `0 iodef "mailto:security@example.com"`}},
+		{"www.sub.example.com", "example.com.", []string{`0 issue "ca.example.net"`, `0 iodef "mailto:security@example.com"`}},
+		{"alias.example.org", "alias.example.org.", []string{`0 issue ";"`}},
+		{"www.example.org", "", nil},
+	}
+
+	for _, tt := range tests {
+		domain, records, err := c.LookupCAA(context.Background(), tt.name)
+		if err != nil {
+			t.Errorf("LookupCAA(%q): %v", tt.name, err)
+			continue
+		}
+
+		var got []string
+		for _, caa := range records {
+			got = append(got, caa.String())
+		}
+
+		if domain != tt.domain || strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("LookupCAA(%q) = %s %q, want %s %q", tt.name, domain, got, tt.domain, tt.want)
+		}
+	}
+
+	// A failed lookup forbids issuance rather than moving on to the parent
+	if _, _, err := c.LookupCAA(context.Background(), "www.broken.example.com"); err == nil {
+		t.Error("LookupCAA succeeded after a server failure")
+	}
+}
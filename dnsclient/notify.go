@@ -0,0 +1,32 @@
+package dnsclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// Notify tells a secondary server that zone has changed so it checks for a new
+// version straight away rather than waiting for its refresh timer, as
+// described in RFC 1996. The current SOA record of the zone is sent along as a
+// hint. An error is returned if the server does not acknowledge the
+// notification.
+func (c *Client) Notify(ctx context.Context, zone string, soa dnsmsg.RR) error {
+	m := dnsmsg.NewQuery(dnsmsg.Fqdn(zone), dnsmsg.RecordTypeSOA)
+	m.Header.OPCODE = dnsmsg.OpcodeNotify
+	m.Header.AA = 1
+	m.Header.RD = 0
+	m.Answers = []dnsmsg.RR{soa}
+
+	resp, _, err := c.Exchange(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	if rcode := resp.ResponseCode(); rcode != dnsmsg.ResponseCodeNoError {
+		return fmt.Errorf("NOTIFY for %s was answered with %s", m.Questions[0].QNAME, dnsmsg.ResponseCodeToStrMap[rcode])
+	}
+
+	return nil
+}
@@ -0,0 +1,331 @@
+package dnsclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// These are the errors returned when a zone transfer is not bracketed by the
+// SOA record of the zone as described in RFC 5936 section 2.2
+var (
+	ErrTransferNoSOA       = errors.New("Zone transfer did not start with the SOA record of the zone")
+	ErrTransferSOAMismatch = errors.New("Zone transfer did not end with the SOA record it started with")
+)
+
+// AXFR requests a full transfer of zone from the server. The transfer always
+// happens over TCP and is streamed across as many messages as the server
+// needs. It is complete once the SOA record it started with is seen again. The
+// records of the zone are returned with the SOA record first and the closing
+// SOA record left off.
+func (c *Client) AXFR(ctx context.Context, zone string) ([]dnsmsg.RR, dnsmsg.QueryInfo, error) {
+	m := dnsmsg.NewQuery(dnsmsg.Fqdn(zone), dnsmsg.RecordTypeAXFR)
+	m.Header.RD = 0
+
+	rrs, info, err := c.transfer(ctx, m, axfrComplete)
+	if err != nil {
+		return nil, info, err
+	}
+
+	return rrs[:len(rrs)-1], info, nil
+}
+
+// axfrComplete checks the records received so far are bracketed by the SOA
+// record of the zone, reporting true once the closing SOA record arrives
+func axfrComplete(rrs []dnsmsg.RR) (bool, error) {
+	if len(rrs) == 0 {
+		return false, nil
+	}
+
+	first, ok := rrs[0].RDATA.(*dnsmsg.RDataSOA)
+	if !ok {
+		return false, ErrTransferNoSOA
+	}
+
+	// A zone only holds one SOA record so the next one must end the transfer
+	for i, rr := range rrs[1:] {
+		soa, ok := rr.RDATA.(*dnsmsg.RDataSOA)
+		if !ok {
+			continue
+		}
+
+		if i+2 != len(rrs) || soa.Serial() != first.Serial() || !strings.EqualFold(rr.NAME, rrs[0].NAME) {
+			return false, ErrTransferSOAMismatch
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// transfer sends a zone transfer request over TCP and reads response messages
+// until complete reports that the records received hold the whole transfer.
+// Each message must arrive within the timeout of the one before it. When the
+// request is signed with TSIG, the signatures of the response messages must
+// carry on from one another up to the last message.
+func (c *Client) transfer(ctx context.Context, m *dnsmsg.Message, complete func([]dnsmsg.RR) (bool, error)) ([]dnsmsg.RR, dnsmsg.QueryInfo, error) {
+	info := dnsmsg.QueryInfo{Server: c.Server, Network: "tcp"}
+
+	msgBytes, requestMAC, err := c.encode(m)
+	if err != nil {
+		return nil, info, err
+	}
+
+	var stream *dnsmsg.TSIGStream
+	if c.TSIG != nil {
+		stream = dnsmsg.NewTSIGStream(c.TSIG, requestMAC)
+	}
+
+	startQueryTime := time.Now()
+
+	conn, err := c.dial(ctx, "tcp")
+	if err != nil {
+		return nil, info, err
+	}
+
+	defer conn.Close()
+
+	if err = dnsmsg.WriteTCPMessage(conn, msgBytes); err != nil {
+		return nil, info, err
+	}
+
+	var rrs []dnsmsg.RR
+
+	for {
+		respBytes, err := dnsmsg.ReadTCPMessage(conn)
+		if err != nil {
+			return rrs, info, err
+		}
+
+		info.Size += len(respBytes)
+
+		resp := new(dnsmsg.Message)
+		if _, err := dnsmsg.DecodeMessage(respBytes, resp); err != nil {
+			return rrs, info, err
+		}
+
+		if err := validateTransferResponse(m, resp); err != nil {
+			return rrs, info, err
+		}
+
+		if stream != nil {
+			if err := stream.Verify(respBytes); err != nil {
+				return rrs, info, err
+			}
+		}
+
+		if rcode := resp.ResponseCode(); rcode != dnsmsg.ResponseCodeNoError {
+			return rrs, info, fmt.Errorf("Zone transfer failed with %s", dnsmsg.ResponseCodeToStrMap[rcode])
+		}
+
+		rrs = append(rrs, resp.Answers...)
+
+		done, err := complete(rrs)
+		if err != nil {
+			return rrs, info, err
+		}
+
+		if done && stream != nil {
+			if err := stream.Done(); err != nil {
+				return rrs, info, err
+			}
+		}
+
+		if done {
+			info.QueryTime = time.Since(startQueryTime)
+			info.When = time.Now()
+
+			return rrs, info, nil
+		}
+
+		if ctx.Err() != nil {
+			return rrs, info, ctx.Err()
+		}
+
+		if err = conn.SetDeadline(c.deadline(ctx)); err != nil {
+			return rrs, info, err
+		}
+	}
+}
+
+// validateTransferResponse checks that a message belongs to a zone transfer.
+// Only the first message of a transfer has to echo the question so it may be
+// left out of the rest. See RFC 5936 section 2.2.1
+func validateTransferResponse(query, resp *dnsmsg.Message) error {
+	if len(resp.Questions) > 0 {
+		return ValidateResponse(query, resp)
+	}
+
+	if resp.Header.ID != query.Header.ID {
+		return ErrIDMismatch
+	}
+
+	if resp.Header.QR != dnsmsg.QRTypeResponse {
+		return ErrNotResponse
+	}
+
+	return nil
+}
+
+// ZoneDiff holds the records deleted from and added to a zone when it moved
+// from one version to the next
+type ZoneDiff struct {
+	FromSerial uint32
+	ToSerial   uint32
+	Deleted    []dnsmsg.RR
+	Added      []dnsmsg.RR
+}
+
+// IXFRResult is the outcome of an incremental zone transfer
+type IXFRResult struct {
+	// The SOA record of the current version of the zone
+	SOA dnsmsg.RR
+
+	// The changes leading from the version the client holds to the current
+	// version, oldest first. This is empty when the client is up to date.
+	Diffs []ZoneDiff
+
+	// Set when the server sent the whole zone rather than the changes, which
+	// it may do when it no longer has a record of them
+	Full bool
+
+	// The records of the zone with the SOA record first when Full is set
+	Zone []dnsmsg.RR
+}
+
+// IXFR requests the changes made to zone since the version with the given
+// serial as described in RFC 1995. The serial is sent in an SOA record in the
+// authority section of the request. Servers may answer with the changes, with
+// only their SOA record when the serial is current or with the whole zone as
+// they would for AXFR.
+func (c *Client) IXFR(ctx context.Context, zone string, serial uint32) (*IXFRResult, dnsmsg.QueryInfo, error) {
+	zone = dnsmsg.Fqdn(zone)
+
+	soa, err := dnsmsg.ParseRR(fmt.Sprintf("%s 0 IN SOA . . %d 0 0 0 0", zone, serial))
+	if err != nil {
+		return nil, dnsmsg.QueryInfo{}, err
+	}
+
+	m := dnsmsg.NewQuery(zone, dnsmsg.RecordTypeIXFR)
+	m.Header.RD = 0
+	m.Authority = []dnsmsg.RR{soa}
+
+	complete := func(rrs []dnsmsg.RR) (bool, error) {
+		return ixfrComplete(rrs, serial)
+	}
+
+	rrs, info, err := c.transfer(ctx, m, complete)
+	if err != nil {
+		return nil, info, err
+	}
+
+	return newIXFRResult(rrs), info, nil
+}
+
+// isIncremental checks if the records of a transfer hold a list of changes
+// rather than the whole zone. Incremental transfers follow the opening SOA
+// record with the SOA record of an older version.
+func isIncremental(rrs []dnsmsg.RR) bool {
+	if len(rrs) < 2 {
+		return false
+	}
+
+	first := rrs[0].RDATA.(*dnsmsg.RDataSOA)
+	next, ok := rrs[1].RDATA.(*dnsmsg.RDataSOA)
+
+	return ok && next.Serial() != first.Serial()
+}
+
+// ixfrComplete reports true once the records received hold a whole
+// incremental transfer. Each change is a sequence of the old SOA record
+// followed by the records deleted, then the new SOA record followed by the
+// records added. The transfer ends with the current SOA record in place of
+// the next change.
+func ixfrComplete(rrs []dnsmsg.RR, serial uint32) (bool, error) {
+	if len(rrs) == 0 {
+		return false, nil
+	}
+
+	first, ok := rrs[0].RDATA.(*dnsmsg.RDataSOA)
+	if !ok {
+		return false, ErrTransferNoSOA
+	}
+
+	// A lone SOA record which is not newer than the version we hold tells us
+	// it is current. Serials wrap around so they are compared as described in
+	// RFC 1982.
+	if len(rrs) == 1 {
+		return dnsmsg.CompareSerials(first.Serial(), serial) <= 0, nil
+	}
+
+	if !isIncremental(rrs) {
+		return axfrComplete(rrs)
+	}
+
+	soas := 0
+
+	for i, rr := range rrs[1:] {
+		soa, ok := rr.RDATA.(*dnsmsg.RDataSOA)
+		if !ok {
+			continue
+		}
+
+		if soas > 0 && soas%2 == 0 && soa.Serial() == first.Serial() {
+			if i+2 != len(rrs) {
+				return false, ErrTransferSOAMismatch
+			}
+
+			return true, nil
+		}
+
+		soas++
+	}
+
+	return false, nil
+}
+
+// newIXFRResult splits the records of a complete incremental transfer into
+// the changes between each version
+func newIXFRResult(rrs []dnsmsg.RR) *IXFRResult {
+	result := &IXFRResult{SOA: rrs[0]}
+
+	if len(rrs) == 1 {
+		return result
+	}
+
+	if !isIncremental(rrs) {
+		result.Full = true
+		result.Zone = rrs[:len(rrs)-1]
+
+		return result
+	}
+
+	var diff *ZoneDiff
+
+	adding := false
+
+	for _, rr := range rrs[1 : len(rrs)-1] {
+		soa, ok := rr.RDATA.(*dnsmsg.RDataSOA)
+
+		switch {
+		case ok && (diff == nil || adding):
+			result.Diffs = append(result.Diffs, ZoneDiff{FromSerial: soa.Serial()})
+			diff = &result.Diffs[len(result.Diffs)-1]
+			adding = false
+		case ok:
+			diff.ToSerial = soa.Serial()
+			adding = true
+		case adding:
+			diff.Added = append(diff.Added, rr)
+		default:
+			diff.Deleted = append(diff.Deleted, rr)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,260 @@
+package dnsclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// record parses a record in master file format
+func record(t *testing.T, s string) dnsmsg.RR {
+	t.Helper()
+
+	rr, err := dnsmsg.ParseRR(s)
+	if err != nil {
+		t.Fatalf("ParseRR(%q): %v", s, err)
+	}
+
+	return rr
+}
+
+// soa returns the SOA record of example.com. with the serial given
+func soa(t *testing.T, serial string) dnsmsg.RR {
+	return record(t, "example.com. 3600 IN SOA ns1.example.com. host.example.com. "+serial+" 7200 3600 1209600 300")
+}
+
+// stream splits records into messages of at most n records each. Only the
+// first message echoes the question.
+func stream(query *dnsmsg.Message, n int, records ...dnsmsg.RR) []*dnsmsg.Message {
+	var msgs []*dnsmsg.Message
+
+	for len(records) > 0 {
+		size := n
+		if size > len(records) {
+			size = len(records)
+		}
+
+		resp := reply(query, records[:size]...)
+		if len(msgs) > 0 {
+			resp.Questions = nil
+		}
+
+		msgs = append(msgs, resp)
+		records = records[size:]
+	}
+
+	return msgs
+}
+
+func TestAXFR(t *testing.T) {
+	zone := []dnsmsg.RR{
+		soa(t, "2024010101"),
+		record(t, "example.com. 3600 IN NS ns1.example.com."),
+		record(t, "ns1.example.com. 300 IN A 192.0.2.1"),
+		record(t, "www.example.com. 300 IN A 192.0.2.2"),
+		record(t, "www.example.com. 300 IN AAAA 2001:db8::2"),
+	}
+
+	// Records after the closing SOA record are never read
+	sent := append(append([]dnsmsg.RR{}, zone...), soa(t, "2024010101"), a(t, "late.example.com.", "192.0.2.9"))
+
+	s := newTestServer(t, nil, func(query *dnsmsg.Message) []*dnsmsg.Message {
+		if query.Questions[0].QTYPE != dnsmsg.RecordTypeAXFR || query.Header.RD != 0 {
+			return []*dnsmsg.Message{}
+		}
+
+		return stream(query, 2, sent...)
+	})
+	defer s.close()
+
+	c := New(s.addr())
+	c.Timeout = time.Second
+
+	rrs, info, err := c.AXFR(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("AXFR: %v", err)
+	}
+
+	if info.Network != "tcp" {
+		t.Errorf("network = %s, want tcp", info.Network)
+	}
+
+	if len(rrs) != len(zone) {
+		t.Fatalf("AXFR returned %d records, want %d", len(rrs), len(zone))
+	}
+
+	for i := range zone {
+		if rrs[i].String() != zone[i].String() {
+			t.Errorf("record %d = %s, want %s", i, &rrs[i], &zone[i])
+		}
+	}
+}
+
+func TestAXFRErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		answer func(t *testing.T, query *dnsmsg.Message) []*dnsmsg.Message
+		want   error
+	}{
+		{"no opening SOA", func(t *testing.T, query *dnsmsg.Message) []*dnsmsg.Message {
+			return stream(query, 1, a(t, "www.example.com.", "192.0.2.1"), soa(t, "1"))
+		}, ErrTransferNoSOA},
+		{"other serial", func(t *testing.T, query *dnsmsg.Message) []*dnsmsg.Message {
+			return stream(query, 1, soa(t, "1"), a(t, "www.example.com.", "192.0.2.1"), soa(t, "2"))
+		}, ErrTransferSOAMismatch},
+		{"other ID", func(t *testing.T, query *dnsmsg.Message) []*dnsmsg.Message {
+			msgs := stream(query, 1, soa(t, "1"), soa(t, "1"))
+			msgs[1].Header.ID++
+
+			return msgs
+		}, ErrIDMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil, func(query *dnsmsg.Message) []*dnsmsg.Message {
+				return tt.answer(t, query)
+			})
+			defer s.close()
+
+			c := New(s.addr())
+			c.Timeout = time.Second
+
+			if _, _, err := c.AXFR(context.Background(), "example.com."); err != tt.want {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAXFRRefused(t *testing.T) {
+	s := newTestServer(t, nil, func(query *dnsmsg.Message) []*dnsmsg.Message {
+		resp := reply(query)
+		resp.Header.RCODE = dnsmsg.ResponseCodeRefused
+
+		return []*dnsmsg.Message{resp}
+	})
+	defer s.close()
+
+	c := New(s.addr())
+	c.Timeout = time.Second
+
+	if _, _, err := c.AXFR(context.Background(), "example.com."); err == nil {
+		t.Error("AXFR succeeded after the server refused it")
+	}
+}
+
+// A connection closed before the closing SOA record leaves the transfer
+// incomplete
+func TestAXFRIncomplete(t *testing.T) {
+	s := newTestServer(t, nil, func(query *dnsmsg.Message) []*dnsmsg.Message {
+		return stream(query, 1, soa(t, "1"), a(t, "www.example.com.", "192.0.2.1"))
+	})
+	defer s.close()
+
+	c := New(s.addr())
+	c.Timeout = time.Second
+
+	if _, _, err := c.AXFR(context.Background(), "example.com."); err == nil {
+		t.Error("AXFR succeeded without the closing SOA record")
+	}
+}
+
+func TestIXFR(t *testing.T) {
+	www := a(t, "www.example.com.", "192.0.2.2")
+	moved := a(t, "www.example.com.", "192.0.2.3")
+	mail := a(t, "mail.example.com.", "192.0.2.25")
+
+	tests := []struct {
+		name string
+		sent func(t *testing.T) []dnsmsg.RR
+		want IXFRResult
+	}{
+		{"changes", func(t *testing.T) []dnsmsg.RR {
+			return []dnsmsg.RR{
+				soa(t, "3"),
+				soa(t, "1"), www, soa(t, "2"), moved,
+				soa(t, "2"), soa(t, "3"), mail,
+				soa(t, "3"),
+			}
+		}, IXFRResult{Diffs: []ZoneDiff{
+			{FromSerial: 1, ToSerial: 2, Deleted: []dnsmsg.RR{www}, Added: []dnsmsg.RR{moved}},
+			{FromSerial: 2, ToSerial: 3, Added: []dnsmsg.RR{mail}},
+		}}},
+		{"up to date", func(t *testing.T) []dnsmsg.RR {
+			return []dnsmsg.RR{soa(t, "1")}
+		}, IXFRResult{}},
+		{"whole zone", func(t *testing.T) []dnsmsg.RR {
+			return []dnsmsg.RR{soa(t, "3"), moved, mail, soa(t, "3")}
+		}, IXFRResult{Full: true, Zone: []dnsmsg.RR{moved, mail}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := tt.sent(t)
+
+			s := newTestServer(t, nil, func(query *dnsmsg.Message) []*dnsmsg.Message {
+				// The version the client holds is given in the authority section
+				if len(query.Authority) != 1 || query.Authority[0].RDATA.(*dnsmsg.RDataSOA).Serial() != 1 {
+					return nil
+				}
+
+				return stream(query, 3, sent...)
+			})
+			defer s.close()
+
+			c := New(s.addr())
+			c.Timeout = time.Second
+
+			result, _, err := c.IXFR(context.Background(), "example.com.", 1)
+			if err != nil {
+				t.Fatalf("IXFR: %v", err)
+			}
+
+			if result.SOA.String() != sent[0].String() {
+				t.Errorf("SOA = %s, want %s", &result.SOA, &sent[0])
+			}
+
+			if result.Full != tt.want.Full || len(result.Diffs) != len(tt.want.Diffs) {
+				t.Fatalf("result has full %v and %d diffs, want %v and %d", result.Full, len(result.Diffs), tt.want.Full, len(tt.want.Diffs))
+			}
+
+			if tt.want.Full {
+				// The opening SOA record leads the zone
+				if got, want := recordStrings(result.Zone[1:]), recordStrings(tt.want.Zone); got != want {
+					t.Errorf("zone = %s, want %s", got, want)
+				}
+			}
+
+			for i, want := range tt.want.Diffs {
+				got := result.Diffs[i]
+
+				if got.FromSerial != want.FromSerial || got.ToSerial != want.ToSerial {
+					t.Errorf("diff %d is from %d to %d, want %d to %d", i, got.FromSerial, got.ToSerial, want.FromSerial, want.ToSerial)
+				}
+
+				if recordStrings(got.Deleted) != recordStrings(want.Deleted) || recordStrings(got.Added) != recordStrings(want.Added) {
+					t.Errorf("diff %d deletes %s and adds %s, want %s and %s", i,
+						recordStrings(got.Deleted), recordStrings(got.Added), recordStrings(want.Deleted), recordStrings(want.Added))
+				}
+			}
+		})
+	}
+}
+
+// recordStrings presents records on a single line
+func recordStrings(rrs []dnsmsg.RR) string {
+	s := "["
+
+	for i := range rrs {
+		if i > 0 {
+			s += "; "
+		}
+
+		s += rrs[i].String()
+	}
+
+	return s + "]"
+}
@@ -0,0 +1,95 @@
+package dnsmsg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Pointers only have 14 bits to hold the offset they point to. See RFC 1035
+// section 4.1.4
+const maxCompressionOffset = 0x3FFF
+
+// compressionMap tracks the offset in a message of every domain name suffix
+// which has already been written. When the same suffix appears again it can
+// be replaced with a pointer to the earlier occurrence:
+//
+//     +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//     | 1  1|                OFFSET                   |
+//     +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//
+// Suffixes are stored lowercased since domain names compare case insensitively.
+type compressionMap map[string]int
+
+// compressibleRData is implemented by RDATA which holds domain names that
+// RFC 1035 allows to be compressed. The RDATA is written directly into the
+// message buffer so pointers can reference offsets within the message.
+type compressibleRData interface {
+	encodeTo(buf *bytes.Buffer, compression compressionMap) error
+}
+
+// writeDomainName writes the labels for name into buf. If compression is not
+// nil, the longest suffix of name already present in the message is replaced
+// with a pointer and any new suffixes are recorded for later names.
+func writeDomainName(buf *bytes.Buffer, name string, compression compressionMap) error {
+	labels, err := splitLabels(name)
+	if err != nil {
+		return err
+	}
+
+	// +1 for the null label of the root
+	wireLen := 1
+
+	for _, label := range labels {
+		if len(label) == 0 {
+			return errors.New("Malformed label found, must not be 0 length")
+		}
+
+		if len(label) > maxLabelOctets {
+			return fmt.Errorf("Label '%s' exceeds %d octets", label, maxLabelOctets)
+		}
+
+		wireLen += len(label) + 1
+	}
+
+	if wireLen > maxDomainNameWireOctets {
+		return errors.New("Domains exceed max size for field")
+	}
+
+	for i, label := range labels {
+		if compression != nil {
+			suffix := compressionKey(labels[i:])
+
+			if offset, ok := compression[suffix]; ok {
+				binary.Write(buf, binary.BigEndian, uint16(0xC000|offset))
+				return nil
+			}
+
+			if buf.Len() <= maxCompressionOffset {
+				compression[suffix] = buf.Len()
+			}
+		}
+
+		buf.WriteByte(uint8(len(label)))
+		buf.WriteString(label)
+	}
+
+	buf.WriteByte(0x00)
+
+	return nil
+}
+
+// compressionKey identifies a domain name suffix in a compressionMap. The
+// labels are escaped so periods within a label cannot be confused with the
+// separators between them.
+func compressionKey(labels []string) string {
+	escaped := make([]string, len(labels))
+
+	for i, label := range labels {
+		escaped[i] = escapeLabel([]byte(toLowerASCII(label)))
+	}
+
+	return strings.Join(escaped, ".")
+}
@@ -1,4 +1,4 @@
-package main
+package dnsmsg
 
 type (
 	// QRType is used in the header denoting whether we have a Query or Response
@@ -13,8 +13,19 @@ type (
 	// Opcode indicates the type of query being done in the header
 	Opcode byte
 
-	// ResponseCode indicates the type of response returned from the server
-	ResponseCode byte
+	// ResponseCode indicates the type of response returned from the server. The
+	// header only holds the lower 4 bits, EDNS extends it to 12 bits.
+	ResponseCode uint16
+
+	// EDNSOptionCode identifies the type of an option carried in an OPT record
+	EDNSOptionCode uint16
+
+	// DNSSECAlgorithm identifies the algorithm of a DNSKEY and the signatures
+	// made with it
+	DNSSECAlgorithm uint8
+
+	// DigestType identifies the hash used for the digest of a DS record
+	DigestType uint8
 )
 
 // These are all of the different constants used in the application
@@ -112,11 +123,14 @@ const (
 	RecordClassCS       RecordClass = 2
 	RecordClassCH       RecordClass = 3
 	RecordClassHS       RecordClass = 4
+	RecordClassNone     RecordClass = 254
 	RecordClassWildcard RecordClass = 255
 
 	OpcodeQuery  Opcode = 0
 	OpcodeIQuery Opcode = 1
 	OpcodeStatus Opcode = 2
+	OpcodeNotify Opcode = 4
+	OpcodeUpdate Opcode = 5
 
 	ResponseCodeNoError        ResponseCode = 0
 	ResponseCodeFormatError    ResponseCode = 1
@@ -124,4 +138,94 @@ const (
 	ResponseCodeNameError      ResponseCode = 3
 	ResponseCodeNotImplemented ResponseCode = 4
 	ResponseCodeRefused        ResponseCode = 5
+	ResponseCodeYXDomain       ResponseCode = 6
+	ResponseCodeYXRRSet        ResponseCode = 7
+	ResponseCodeNXRRSet        ResponseCode = 8
+	ResponseCodeNotAuth        ResponseCode = 9
+	ResponseCodeNotZone        ResponseCode = 10
+	ResponseCodeBadVersion     ResponseCode = 16 // requires EDNS
+	ResponseCodeBadSig         ResponseCode = 16 // TSIG error, shares BADVERS
+	ResponseCodeBadKey         ResponseCode = 17 // TSIG error
+	ResponseCodeBadTime        ResponseCode = 18 // TSIG error
+	ResponseCodeBadTrunc       ResponseCode = 22 // TSIG error
+
+	EDNSOptionCodeLLQ          EDNSOptionCode = 1
+	EDNSOptionCodeUL           EDNSOptionCode = 2
+	EDNSOptionCodeNSID         EDNSOptionCode = 3
+	EDNSOptionCodeDAU          EDNSOptionCode = 5
+	EDNSOptionCodeDHU          EDNSOptionCode = 6
+	EDNSOptionCodeN3U          EDNSOptionCode = 7
+	EDNSOptionCodeClientSubnet EDNSOptionCode = 8
+	EDNSOptionCodeExpire       EDNSOptionCode = 9
+	EDNSOptionCodeCookie       EDNSOptionCode = 10
+	EDNSOptionCodeKeepalive    EDNSOptionCode = 11
+	EDNSOptionCodePadding      EDNSOptionCode = 12
+	EDNSOptionCodeChain        EDNSOptionCode = 13
+	EDNSOptionCodeKeyTag       EDNSOptionCode = 14
+	EDNSOptionCodeExtendedErr  EDNSOptionCode = 15
+
+	AlgorithmRSAMD5           DNSSECAlgorithm = 1 // deprecated
+	AlgorithmDSA              DNSSECAlgorithm = 3 // deprecated
+	AlgorithmRSASHA1          DNSSECAlgorithm = 5
+	AlgorithmDSANSEC3SHA1     DNSSECAlgorithm = 6 // deprecated
+	AlgorithmRSASHA1NSEC3SHA1 DNSSECAlgorithm = 7
+	AlgorithmRSASHA256        DNSSECAlgorithm = 8
+	AlgorithmRSASHA512        DNSSECAlgorithm = 10
+	AlgorithmECCGOST          DNSSECAlgorithm = 12 // deprecated
+	AlgorithmECDSAP256SHA256  DNSSECAlgorithm = 13
+	AlgorithmECDSAP384SHA384  DNSSECAlgorithm = 14
+	AlgorithmED25519          DNSSECAlgorithm = 15
+	AlgorithmED448            DNSSECAlgorithm = 16
+
+	DigestTypeSHA1   DigestType = 1
+	DigestTypeSHA256 DigestType = 2
+	DigestTypeGOST   DigestType = 3 // deprecated
+	DigestTypeSHA384 DigestType = 4
+
+	// DNSKEYFlagZone marks a key used to sign the records of a zone
+	DNSKEYFlagZone uint16 = 0x0100
+
+	// DNSKEYFlagRevoke marks a key which has been revoked, see RFC 5011
+	DNSKEYFlagRevoke uint16 = 0x0080
+
+	// DNSKEYFlagSEP marks a key as a secure entry point to the zone, which is
+	// usually the key signing key referred to by the DS record in the parent
+	DNSKEYFlagSEP uint16 = 0x0001
+
+	// NSEC3FlagOptOut marks an NSEC3 record which may cover unsigned
+	// delegations, see RFC 5155 section 6
+	NSEC3FlagOptOut uint8 = 0x01
+
+	// NSEC3HashSHA1 is the only hash algorithm defined for NSEC3
+	NSEC3HashSHA1 uint8 = 1
+
+	// The certificate usages of TLSA and SMIMEA records, see RFC 7218
+	TLSAUsagePKIXTA uint8 = 0
+	TLSAUsagePKIXEE uint8 = 1
+	TLSAUsageDANETA uint8 = 2
+	TLSAUsageDANEEE uint8 = 3
+
+	// The parts of a certificate TLSA and SMIMEA records are matched against
+	TLSASelectorCert uint8 = 0
+	TLSASelectorSPKI uint8 = 1
+
+	// How TLSA and SMIMEA records hold the selected data
+	TLSAMatchingFull   uint8 = 0
+	TLSAMatchingSHA256 uint8 = 1
+	TLSAMatchingSHA512 uint8 = 2
+
+	// The SSH host key algorithms of SSHFP records, see RFC 4255 and RFC 7479
+	SSHFPAlgorithmRSA     uint8 = 1
+	SSHFPAlgorithmDSA     uint8 = 2
+	SSHFPAlgorithmECDSA   uint8 = 3
+	SSHFPAlgorithmEd25519 uint8 = 4
+	SSHFPAlgorithmEd448   uint8 = 6
+
+	// The hashes SSHFP fingerprints are made with
+	SSHFPTypeSHA1   uint8 = 1
+	SSHFPTypeSHA256 uint8 = 2
+
+	// CAAFlagCritical marks a CAA property which a certificate authority must
+	// understand before issuing, see RFC 8659 section 4.1
+	CAAFlagCritical uint8 = 0x80
 )
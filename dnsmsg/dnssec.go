@@ -0,0 +1,413 @@
+package dnsmsg
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A signature is made over the RRSIG RDATA without the signature followed by
+// each record of the RRset in canonical form, see RFC 4034 section 3.1.8.1:
+//
+//     signature = sign(RRSIG_RDATA | RR(1) | RR(2)... )
+//
+// where each RR is
+//
+//     owner | type | class | original TTL | RDLENGTH | RDATA
+//
+// with the owner name and the names in RDATA lowercased and uncompressed, and
+// the records sorted by their canonical RDATA.
+
+// These are the errors returned when an RRset cannot be verified
+var (
+	ErrUnsupportedAlgorithm = errors.New("DNSSEC algorithm is not supported")
+	ErrUnsupportedDigest    = errors.New("DS digest type is not supported")
+	ErrBadPublicKey         = errors.New("DNSKEY holds a malformed public key")
+	ErrKeyMismatch          = errors.New("DNSKEY does not match the algorithm and key tag of the RRSIG")
+	ErrRRsetMismatch        = errors.New("Records do not form the RRset covered by the RRSIG")
+	ErrSignatureMismatch    = errors.New("RRSIG does not match the RRset")
+)
+
+// Verify checks the signature over rrset was made by key. The RRset must hold
+// every record of the type covered which has the same owner and class. The
+// validity period is not checked, see ValidAt.
+func (r *RDataRRSIG) Verify(key *RDataDNSKEY, rrset []RR) error {
+	if key.algorithm != r.algorithm || key.KeyTag() != r.keyTag || key.protocol != 3 || key.flags&DNSKEYFlagZone == 0 {
+		return ErrKeyMismatch
+	}
+
+	data, err := r.signedData(rrset)
+	if err != nil {
+		return err
+	}
+
+	return verifySignature(r.algorithm, key.publicKey, data, r.signature)
+}
+
+// ValidAt reports if t falls within the validity period of the signature. The
+// times wrap around every 136 years so are compared using serial number
+// arithmetic, see RFC 4034 section 3.1.5.
+func (r *RDataRRSIG) ValidAt(t time.Time) bool {
+	now := uint32(t.Unix())
+
+	return CompareSerials(now, r.inception) >= 0 && CompareSerials(now, r.expiration) <= 0
+}
+
+// signedData builds the data the signature is made over
+func (r *RDataRRSIG) signedData(rrset []RR) ([]byte, error) {
+	if len(rrset) == 0 {
+		return nil, ErrRRsetMismatch
+	}
+
+	for _, rr := range rrset {
+		if rr.TYPE != r.typeCovered || rr.CLASS != rrset[0].CLASS || !strings.EqualFold(Fqdn(rr.NAME), Fqdn(rrset[0].NAME)) {
+			return nil, ErrRRsetMismatch
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := r.writeFields(&buf); err != nil {
+		return nil, err
+	}
+
+	// The signer's name follows the 18 octets of fixed fields
+	lowerWireName(buf.Bytes()[18:])
+
+	owner, err := r.canonicalOwner(rrset[0].NAME)
+	if err != nil {
+		return nil, err
+	}
+
+	rdatas := make([][]byte, 0, len(rrset))
+
+	for _, rr := range rrset {
+		rdata, err := canonicalRData(rr)
+		if err != nil {
+			return nil, err
+		}
+
+		rdatas = append(rdatas, rdata)
+	}
+
+	sort.Slice(rdatas, func(i, j int) bool {
+		return bytes.Compare(rdatas[i], rdatas[j]) < 0
+	})
+
+	for i, rdata := range rdatas {
+		// Duplicate records are only included once
+		if i > 0 && bytes.Equal(rdata, rdatas[i-1]) {
+			continue
+		}
+
+		buf.Write(owner)
+		binary.Write(&buf, binary.BigEndian, r.typeCovered)
+		binary.Write(&buf, binary.BigEndian, rrset[0].CLASS)
+		binary.Write(&buf, binary.BigEndian, r.originalTTL)
+		binary.Write(&buf, binary.BigEndian, uint16(len(rdata)))
+		buf.Write(rdata)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// canonicalOwner encodes the lowercased owner name the signature was made
+// over. When the owner has more labels than the RRSIG says were signed the
+// records were expanded from a wildcard, so the wildcard is restored.
+func (r *RDataRRSIG) canonicalOwner(name string) ([]byte, error) {
+	owner, err := encodeDomainName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	lowerWireName(owner)
+
+	extra := CountLabels(name) - int(r.labels)
+	if extra < 0 {
+		return nil, ErrRRsetMismatch
+	}
+
+	if extra == 0 {
+		return owner, nil
+	}
+
+	for i := 0; i < extra; i++ {
+		owner = owner[owner[0]+1:]
+	}
+
+	return append([]byte{1, '*'}, owner...), nil
+}
+
+// canonicalRData encodes the RDATA of a record with the domain names it holds
+// lowercased, for the types listed in RFC 4034 section 6.2 as amended by RFC
+// 6840 section 5.1. Names are never compressed when the RDATA is encoded on
+// its own and the length octets of labels are never ASCII letters, so the
+// octets holding names can be lowercased as they are.
+func canonicalRData(rr RR) ([]byte, error) {
+	rdata, err := rr.RDATA.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := 0, len(rdata)
+
+	switch rr.TYPE {
+	case RecordTypeNS, RecordTypeMD, RecordTypeMF, RecordTypeCNAME, RecordTypeMB, RecordTypeMG,
+		RecordTypeMR, RecordTypePTR, RecordTypeMINFO, RecordTypeRP, RecordTypeDNAME:
+	case RecordTypeMX, RecordTypeAFSDB, RecordTypeRT, RecordTypeKX, RecordTypePX:
+		start = 2
+	case RecordTypeSRV:
+		start = 6
+	case RecordTypeSOA:
+		end -= 20
+	case RecordTypeNAPTR:
+		// The replacement follows the order, preference and three
+		// character-strings
+		start = 4
+		for i := 0; i < 3 && start < end; i++ {
+			start += int(rdata[start]) + 1
+		}
+	default:
+		return rdata, nil
+	}
+
+	if start < end {
+		lowerWireName(rdata[start:end])
+	}
+
+	return rdata, nil
+}
+
+// lowerWireName lowercases the ASCII letters of names in wire format
+func lowerWireName(name []byte) {
+	for i, c := range name {
+		if c >= 'A' && c <= 'Z' {
+			name[i] = c + ('a' - 'A')
+		}
+	}
+}
+
+// verifySignature checks sig was made over data with the public key of the
+// given algorithm
+func verifySignature(algorithm DNSSECAlgorithm, publicKey, data, sig []byte) error {
+	switch algorithm {
+	case AlgorithmRSASHA1, AlgorithmRSASHA1NSEC3SHA1, AlgorithmRSASHA256, AlgorithmRSASHA512:
+		pub, err := parseRSAPublicKey(publicKey)
+		if err != nil {
+			return err
+		}
+
+		hash := algorithmHash(algorithm)
+		h := hash.New()
+		h.Write(data)
+
+		if err := rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), sig); err != nil {
+			return ErrSignatureMismatch
+		}
+
+	case AlgorithmECDSAP256SHA256, AlgorithmECDSAP384SHA384:
+		curve := elliptic.P256()
+		if algorithm == AlgorithmECDSAP384SHA384 {
+			curve = elliptic.P384()
+		}
+
+		// The key is the point as X | Y and the signature is R | S, each
+		// the size of the curve, see RFC 6605 section 4
+		size := (curve.Params().BitSize + 7) / 8
+
+		if len(publicKey) != 2*size {
+			return ErrBadPublicKey
+		}
+
+		if len(sig) != 2*size {
+			return ErrSignatureMismatch
+		}
+
+		pub := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(publicKey[:size]),
+			Y:     new(big.Int).SetBytes(publicKey[size:]),
+		}
+
+		hash := algorithmHash(algorithm)
+		h := hash.New()
+		h.Write(data)
+
+		if !ecdsa.Verify(pub, h.Sum(nil), new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])) {
+			return ErrSignatureMismatch
+		}
+
+	case AlgorithmED25519:
+		if len(publicKey) != ed25519.PublicKeySize {
+			return ErrBadPublicKey
+		}
+
+		if !ed25519.Verify(ed25519.PublicKey(publicKey), data, sig) {
+			return ErrSignatureMismatch
+		}
+
+	default:
+		return ErrUnsupportedAlgorithm
+	}
+
+	return nil
+}
+
+// algorithmHash returns the hash used by an RSA or ECDSA algorithm
+func algorithmHash(algorithm DNSSECAlgorithm) crypto.Hash {
+	switch algorithm {
+	case AlgorithmRSASHA1, AlgorithmRSASHA1NSEC3SHA1:
+		return crypto.SHA1
+	case AlgorithmRSASHA512:
+		return crypto.SHA512
+	case AlgorithmECDSAP384SHA384:
+		return crypto.SHA384
+	default:
+		return crypto.SHA256
+	}
+}
+
+// SupportsAlgorithm reports if signatures made with the algorithm can be
+// verified
+func SupportsAlgorithm(algorithm DNSSECAlgorithm) bool {
+	switch algorithm {
+	case AlgorithmRSASHA1, AlgorithmRSASHA1NSEC3SHA1, AlgorithmRSASHA256, AlgorithmRSASHA512,
+		AlgorithmECDSAP256SHA256, AlgorithmECDSAP384SHA384, AlgorithmED25519:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseRSAPublicKey unpacks an RSA key in the format of RFC 3110 section 2:
+// the length of the exponent in one octet, or in two octets after a zero
+// octet, followed by the exponent and then the modulus
+func parseRSAPublicKey(data []byte) (*rsa.PublicKey, error) {
+	if len(data) < 3 {
+		return nil, ErrBadPublicKey
+	}
+
+	expLen, offset := int(data[0]), 1
+
+	if expLen == 0 {
+		expLen, offset = int(binary.BigEndian.Uint16(data[1:])), 3
+	}
+
+	if expLen == 0 || expLen > 4 || offset+expLen >= len(data) {
+		return nil, ErrBadPublicKey
+	}
+
+	exponent := new(big.Int).SetBytes(data[offset : offset+expLen])
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(data[offset+expLen:]),
+		E: int(exponent.Int64()),
+	}, nil
+}
+
+// ToDS computes the DS record referring to this key when it is owned by
+// owner, which is the digest of the canonical owner name followed by the
+// DNSKEY RDATA, see RFC 4034 section 5.1.4
+func (r *RDataDNSKEY) ToDS(owner string, digestType DigestType) (*RDataDS, error) {
+	ownerWire, err := encodeDomainName(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	lowerWireName(ownerWire)
+
+	rdata, _ := r.Encode()
+	data := append(ownerWire, rdata...)
+
+	var digest []byte
+
+	switch digestType {
+	case DigestTypeSHA1:
+		sum := sha1.Sum(data)
+		digest = sum[:]
+	case DigestTypeSHA256:
+		sum := sha256.Sum256(data)
+		digest = sum[:]
+	case DigestTypeSHA384:
+		sum := sha512.Sum384(data)
+		digest = sum[:]
+	default:
+		return nil, ErrUnsupportedDigest
+	}
+
+	return &RDataDS{
+		keyTag:     r.KeyTag(),
+		algorithm:  r.algorithm,
+		digestType: digestType,
+		digest:     digest,
+	}, nil
+}
+
+// Matches reports if the DS record refers to key when it is owned by owner
+func (r *RDataDS) Matches(owner string, key *RDataDNSKEY) bool {
+	if r.keyTag != key.KeyTag() || r.algorithm != key.algorithm {
+		return false
+	}
+
+	ds, err := key.ToDS(owner, r.digestType)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(ds.digest, r.digest)
+}
+
+// HashName computes the NSEC3 hash of a name, which is SHA-1 applied to the
+// canonical wire form of the name and the salt, then iterations more times to
+// the previous hash and the salt, see RFC 5155 section 5
+func HashName(name string, iterations uint16, salt []byte) ([]byte, error) {
+	wire, err := encodeDomainName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	lowerWireName(wire)
+
+	h := sha1.New()
+	h.Write(wire)
+	h.Write(salt)
+	digest := h.Sum(nil)
+
+	for i := 0; i < int(iterations); i++ {
+		h.Reset()
+		h.Write(digest)
+		h.Write(salt)
+		digest = h.Sum(nil)
+	}
+
+	return digest, nil
+}
+
+// HashedOwner decodes the hash held in the first label of the owner name of
+// an NSEC3 record
+func HashedOwner(owner string) ([]byte, error) {
+	label := owner
+	if i := strings.Index(owner, "."); i >= 0 {
+		label = owner[:i]
+	}
+
+	hash, err := base32Hex.DecodeString(strings.ToUpper(label))
+	if err != nil {
+		return nil, fmt.Errorf("NSEC3 owner %s does not start with a hash: %v", owner, err)
+	}
+
+	return hash, nil
+}
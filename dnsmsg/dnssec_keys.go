@@ -0,0 +1,445 @@
+package dnsmsg
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Signing keys are kept in the pair of files written by BIND's dnssec-keygen,
+// named after the owner, algorithm and key tag as K<owner>+<alg>+<tag>. The
+// .key file holds the DNSKEY record and the .private file the private key:
+//
+//     Private-key-format: v1.3
+//     Algorithm: 13 (ECDSAP256SHA256)
+//     PrivateKey: GU6SnQ/Ou+xC5RumuIUIuJZteXT2z0O/ok1s38Et6mQ=
+//
+// RSA keys list each part of the key in its own field instead of PrivateKey.
+
+// privateKeyFormat is the version of the .private file format written
+const privateKeyFormat = "v1.3"
+
+// rsaKeyFields are the fields of an RSA private key in the order written
+var rsaKeyFields = []string{"Modulus", "PublicExponent", "PrivateExponent", "Prime1", "Prime2", "Exponent1", "Exponent2", "Coefficient"}
+
+// SigningKey is a DNSSEC key pair which signs the RRsets of the zone owning
+// the public key
+type SigningKey struct {
+	owner  string
+	dnskey *RDataDNSKEY
+	signer crypto.Signer
+}
+
+// GenerateSigningKey creates a new key for the zone named owner. Key signing
+// keys carry DNSKEYFlagSEP in flags along with DNSKEYFlagZone.
+func GenerateSigningKey(owner string, algorithm DNSSECAlgorithm, flags uint16) (*SigningKey, error) {
+	var signer crypto.Signer
+	var err error
+
+	switch algorithm {
+	case AlgorithmRSASHA1, AlgorithmRSASHA1NSEC3SHA1, AlgorithmRSASHA256, AlgorithmRSASHA512:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmECDSAP256SHA256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmECDSAP384SHA384:
+		signer, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case AlgorithmED25519:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newSigningKey(owner, algorithm, flags, signer)
+}
+
+// newSigningKey builds the DNSKEY holding the public half of signer
+func newSigningKey(owner string, algorithm DNSSECAlgorithm, flags uint16, signer crypto.Signer) (*SigningKey, error) {
+	var publicKey []byte
+
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey:
+		// The exponent is short enough for its length to take a single
+		// octet, see RFC 3110 section 2
+		exponent := big.NewInt(int64(pub.E)).Bytes()
+		publicKey = append([]byte{byte(len(exponent))}, exponent...)
+		publicKey = append(publicKey, pub.N.Bytes()...)
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		publicKey = append(padBytes(pub.X.Bytes(), size), padBytes(pub.Y.Bytes(), size)...)
+	case ed25519.PublicKey:
+		publicKey = append([]byte{}, pub...)
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	return &SigningKey{
+		owner:  strings.ToLower(Fqdn(owner)),
+		signer: signer,
+		dnskey: &RDataDNSKEY{
+			flags:     flags,
+			protocol:  3,
+			algorithm: algorithm,
+			publicKey: publicKey,
+		},
+	}, nil
+}
+
+// LoadSigningKey reads a key from the .key and .private files written by
+// dnssec-keygen. The path may name either file or leave off the extension.
+func LoadSigningKey(path string) (*SigningKey, error) {
+	base := strings.TrimSuffix(strings.TrimSuffix(path, ".key"), ".private")
+
+	f, err := os.Open(base + ".key")
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	// dnssec-keygen leaves the TTL out of the DNSKEY record
+	rrs, err := ParseZone(io.MultiReader(strings.NewReader("$TTL 3600\n"), f), ".")
+	if err != nil {
+		return nil, fmt.Errorf("%s.key: %v", base, err)
+	}
+
+	var public *RR
+
+	for i := range rrs {
+		if rrs[i].TYPE == RecordTypeDNSKEY {
+			public = &rrs[i]
+			break
+		}
+	}
+
+	if public == nil {
+		return nil, fmt.Errorf("%s.key: Expected a DNSKEY record", base)
+	}
+
+	fields, err := readPrivateKeyFile(base + ".private")
+	if err != nil {
+		return nil, err
+	}
+
+	dnskey := public.RDATA.(*RDataDNSKEY)
+
+	signer, err := decodePrivateKey(dnskey.algorithm, fields)
+	if err != nil {
+		return nil, fmt.Errorf("%s.private: %v", base, err)
+	}
+
+	key, err := newSigningKey(public.NAME, dnskey.algorithm, dnskey.flags, signer)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(key.dnskey.publicKey, dnskey.publicKey) {
+		return nil, fmt.Errorf("%s: Private key does not match the DNSKEY record", base)
+	}
+
+	return key, nil
+}
+
+// readPrivateKeyFile reads the fields of a .private file
+func readPrivateKeyFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s: Malformed line '%s'", path, line)
+		}
+
+		fields[parts[0]] = strings.TrimSpace(parts[1])
+	}
+
+	if !strings.HasPrefix(fields["Private-key-format"], "v1.") {
+		return nil, fmt.Errorf("%s: Unsupported private key format '%s'", path, fields["Private-key-format"])
+	}
+
+	return fields, nil
+}
+
+// decodePrivateKey builds the private key of an algorithm from the fields of
+// a .private file
+func decodePrivateKey(algorithm DNSSECAlgorithm, fields map[string]string) (crypto.Signer, error) {
+	values := make(map[string]*big.Int)
+
+	for name, value := range fields {
+		if name == "Private-key-format" || name == "Algorithm" {
+			continue
+		}
+
+		raw, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+
+		values[name] = new(big.Int).SetBytes(raw)
+	}
+
+	switch algorithm {
+	case AlgorithmRSASHA1, AlgorithmRSASHA1NSEC3SHA1, AlgorithmRSASHA256, AlgorithmRSASHA512:
+		for _, name := range rsaKeyFields[:5] {
+			if values[name] == nil {
+				return nil, fmt.Errorf("Missing %s field of RSA key", name)
+			}
+		}
+
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: values["Modulus"], E: int(values["PublicExponent"].Int64())},
+			D:         values["PrivateExponent"],
+			Primes:    []*big.Int{values["Prime1"], values["Prime2"]},
+		}
+
+		if err := key.Validate(); err != nil {
+			return nil, err
+		}
+
+		key.Precompute()
+
+		return key, nil
+
+	case AlgorithmECDSAP256SHA256, AlgorithmECDSAP384SHA384:
+		d := values["PrivateKey"]
+		if d == nil {
+			return nil, errors.New("Missing PrivateKey field")
+		}
+
+		curve := elliptic.P256()
+		if algorithm == AlgorithmECDSAP384SHA384 {
+			curve = elliptic.P384()
+		}
+
+		key := &ecdsa.PrivateKey{D: d}
+		key.Curve = curve
+		key.X, key.Y = curve.ScalarBaseMult(d.Bytes())
+
+		return key, nil
+
+	case AlgorithmED25519:
+		seed, err := base64.StdEncoding.DecodeString(fields["PrivateKey"])
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, errors.New("Malformed PrivateKey field")
+		}
+
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+
+	return nil, ErrUnsupportedAlgorithm
+}
+
+// WriteFiles writes the key to a pair of .key and .private files in dir named
+// as dnssec-keygen does, returning the path without the extension. The
+// private key file is only readable by its owner.
+func (k *SigningKey) WriteFiles(dir string) (string, error) {
+	base := filepath.Join(dir, k.FileName())
+
+	kind := "zone-signing"
+	if k.dnskey.flags&DNSKEYFlagSEP != 0 {
+		kind = "key-signing"
+	}
+
+	public := k.DNSKEY(3600)
+
+	keyFile := fmt.Sprintf("; This is a %s key, keyid %d, for %s\n%s IN DNSKEY %s\n",
+		kind, k.KeyTag(), k.owner, k.owner, public.RDATA)
+
+	if err := ioutil.WriteFile(base+".key", []byte(keyFile), 0644); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "Private-key-format: %s\n", privateKeyFormat)
+	fmt.Fprintf(&buf, "Algorithm: %d (%s)\n", k.dnskey.algorithm, DNSSECAlgorithmToStrMap[k.dnskey.algorithm])
+
+	b64 := base64.StdEncoding.EncodeToString
+
+	switch priv := k.signer.(type) {
+	case *rsa.PrivateKey:
+		values := []*big.Int{priv.N, big.NewInt(int64(priv.E)), priv.D, priv.Primes[0], priv.Primes[1],
+			priv.Precomputed.Dp, priv.Precomputed.Dq, priv.Precomputed.Qinv}
+
+		for i, name := range rsaKeyFields {
+			fmt.Fprintf(&buf, "%s: %s\n", name, b64(values[i].Bytes()))
+		}
+
+	case *ecdsa.PrivateKey:
+		d := padBytes(priv.D.Bytes(), (priv.Curve.Params().BitSize+7)/8)
+		fmt.Fprintf(&buf, "PrivateKey: %s\n", b64(d))
+
+	case ed25519.PrivateKey:
+		fmt.Fprintf(&buf, "PrivateKey: %s\n", b64(priv.Seed()))
+	}
+
+	fmt.Fprintf(&buf, "Created: %s\n", time.Now().UTC().Format(sigTimeFormat))
+
+	if err := ioutil.WriteFile(base+".private", buf.Bytes(), 0600); err != nil {
+		os.Remove(base + ".key")
+		return "", err
+	}
+
+	return base, nil
+}
+
+// FileName returns the name dnssec-keygen gives the files of this key, without
+// an extension
+func (k *SigningKey) FileName() string {
+	return fmt.Sprintf("K%s+%03d+%05d", k.owner, k.dnskey.algorithm, k.KeyTag())
+}
+
+// Owner returns the name of the zone the key belongs to
+func (k *SigningKey) Owner() string {
+	return k.owner
+}
+
+// KeyTag returns the tag identifying the key in RRSIG and DS records
+func (k *SigningKey) KeyTag() uint16 {
+	return k.dnskey.KeyTag()
+}
+
+// IsKSK reports if the key is a key signing key, marked by the SEP flag
+func (k *SigningKey) IsKSK() bool {
+	return k.dnskey.flags&DNSKEYFlagSEP != 0
+}
+
+// DNSKEY returns the DNSKEY record publishing the key
+func (k *SigningKey) DNSKEY(ttl uint32) RR {
+	return RR{
+		NAME:  k.owner,
+		TYPE:  RecordTypeDNSKEY,
+		CLASS: RecordClassIN,
+		TTL:   ttl,
+		RDATA: k.dnskey,
+	}
+}
+
+// DS returns the DS record the parent zone publishes to refer to the key
+func (k *SigningKey) DS(digestType DigestType) (RR, error) {
+	ds, err := k.dnskey.ToDS(k.owner, digestType)
+	if err != nil {
+		return RR{}, err
+	}
+
+	return RR{
+		NAME:  k.owner,
+		TYPE:  RecordTypeDS,
+		CLASS: RecordClassIN,
+		TTL:   3600,
+		RDATA: ds,
+	}, nil
+}
+
+// Sign creates the RRSIG record over rrset, which must hold every record of
+// one type owned by a name in the key's zone. The signature is valid from
+// inception until expiration.
+func (k *SigningKey) Sign(rrset []RR, inception, expiration time.Time) (RR, error) {
+	if len(rrset) == 0 {
+		return RR{}, ErrRRsetMismatch
+	}
+
+	owner := rrset[0].NAME
+
+	if !IsSubDomain(k.owner, owner) {
+		return RR{}, fmt.Errorf("%s is not within the zone %s of the key", owner, k.owner)
+	}
+
+	// The wildcard label is left out so the signature also covers the
+	// names expanded from it, see RFC 4034 section 3.1.3
+	labels := CountLabels(owner)
+	if strings.HasPrefix(owner, "*.") {
+		labels--
+	}
+
+	sig := &RDataRRSIG{
+		typeCovered: rrset[0].TYPE,
+		algorithm:   k.dnskey.algorithm,
+		labels:      uint8(labels),
+		originalTTL: rrset[0].TTL,
+		expiration:  uint32(expiration.Unix()),
+		inception:   uint32(inception.Unix()),
+		keyTag:      k.KeyTag(),
+		signerName:  k.owner,
+	}
+
+	data, err := sig.signedData(rrset)
+	if err != nil {
+		return RR{}, err
+	}
+
+	switch priv := k.signer.(type) {
+	case *rsa.PrivateKey:
+		hash := algorithmHash(k.dnskey.algorithm)
+		h := hash.New()
+		h.Write(data)
+
+		sig.signature, err = rsa.SignPKCS1v15(rand.Reader, priv, hash, h.Sum(nil))
+
+	case *ecdsa.PrivateKey:
+		hash := algorithmHash(k.dnskey.algorithm)
+		h := hash.New()
+		h.Write(data)
+
+		var r, s *big.Int
+
+		r, s, err = ecdsa.Sign(rand.Reader, priv, h.Sum(nil))
+		if err == nil {
+			size := (priv.Curve.Params().BitSize + 7) / 8
+			sig.signature = append(padBytes(r.Bytes(), size), padBytes(s.Bytes(), size)...)
+		}
+
+	case ed25519.PrivateKey:
+		sig.signature = ed25519.Sign(priv, data)
+	}
+
+	if err != nil {
+		return RR{}, err
+	}
+
+	return RR{
+		NAME:  owner,
+		TYPE:  RecordTypeRRSIG,
+		CLASS: rrset[0].CLASS,
+		TTL:   rrset[0].TTL,
+		RDATA: sig,
+	}, nil
+}
+
+// padBytes left pads a big-endian number with zeros to size octets
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+
+	return append(make([]byte, size-len(b)), b...)
+}
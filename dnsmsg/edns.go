@@ -0,0 +1,208 @@
+package dnsmsg
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// DefaultEDNSUDPSize is the UDP payload size advertised when one is not
+	// given. It avoids IP fragmentation on the vast majority of networks.
+	DefaultEDNSUDPSize = 1232
+
+	// EDNSFlagDO is the DNSSEC OK bit which asks a server to include DNSSEC
+	// records in its response. See RFC 3225
+	EDNSFlagDO uint16 = 0x8000
+)
+
+// EDNSOption is a single option carried in the RDATA of an OPT record:
+//
+//                 +0 (MSB)                            +1 (LSB)
+//     +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+//  0: |                          OPTION-CODE                          |
+//     +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+//  2: |                         OPTION-LENGTH                         |
+//     +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+//  4: |                                                               |
+//     /                          OPTION-DATA                          /
+//     /                                                               /
+//     +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+type EDNSOption struct {
+	Code EDNSOptionCode
+	Data []byte
+}
+
+func (o EDNSOption) String() string {
+	name, ok := EDNSOptionCodeToStrMap[o.Code]
+	if !ok {
+		name = fmt.Sprintf("OPTION%d", o.Code)
+	}
+
+	return fmt.Sprintf("%s: %s", name, hex.EncodeToString(o.Data))
+}
+
+// EDNS holds the information carried by an OPT pseudo-RR as described in
+// RFC 6891. Rather than describing a resource, the OPT record reuses the RR
+// fields to extend the message header:
+//
+//     - NAME is always the root domain
+//     - CLASS is the UDP payload size the sender is able to receive
+//     - TTL holds the extended RCODE, EDNS version and flags
+//     - RDATA holds a list of options
+//
+// The TTL field is laid out as:
+//
+//                 +0 (MSB)                            +1 (LSB)
+//     +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+//  0: |         EXTENDED-RCODE        |            VERSION            |
+//     +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+//  2: | DO|                           Z                               |
+//     +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+type EDNS struct {
+	// The largest UDP payload the sender of the message can reassemble
+	UDPSize uint16
+
+	// The upper 8 bits of the 12 bit response code. The lower 4 bits are
+	// carried in the message header.
+	ExtendedRCODE uint8
+
+	// The version of EDNS the sender implements
+	Version uint8
+
+	// The DO bit followed by 15 reserved bits
+	Flags uint16
+
+	// The options in the RDATA of the record
+	Options []EDNSOption
+}
+
+// DO reports if the DNSSEC OK bit is set
+func (e EDNS) DO() bool {
+	return e.Flags&EDNSFlagDO != 0
+}
+
+// RR packs the EDNS information into an OPT pseudo-RR suitable for the
+// additional section of a message
+func (e EDNS) RR() RR {
+	return RR{
+		NAME:  ".",
+		TYPE:  RecordTypeOPT,
+		CLASS: RecordClass(e.UDPSize),
+		TTL:   uint32(e.ExtendedRCODE)<<24 | uint32(e.Version)<<16 | uint32(e.Flags),
+		RDATA: &RDataOPT{options: e.Options},
+	}
+}
+
+// NewEDNSFromRR unpacks the EDNS information held by an OPT pseudo-RR
+func NewEDNSFromRR(rr RR) (*EDNS, error) {
+	if rr.TYPE != RecordTypeOPT {
+		return nil, fmt.Errorf("Cannot read EDNS from a %s record", RecordTypeString(rr.TYPE))
+	}
+
+	e := &EDNS{
+		UDPSize:       uint16(rr.CLASS),
+		ExtendedRCODE: uint8(rr.TTL >> 24),
+		Version:       uint8(rr.TTL >> 16),
+		Flags:         uint16(rr.TTL),
+	}
+
+	if opt, ok := rr.RDATA.(*RDataOPT); ok {
+		e.Options = opt.options
+	}
+
+	return e, nil
+}
+
+func (e EDNS) String() string {
+	var sb strings.Builder
+
+	flags := ""
+	if e.DO() {
+		flags = "do"
+	}
+
+	sb.WriteString(fmt.Sprintf("EDNS: version: %d, flags: %s; udp: %d", e.Version, flags, e.UDPSize))
+
+	for _, option := range e.Options {
+		sb.WriteString(fmt.Sprintf("\n%s", option))
+	}
+
+	return sb.String()
+}
+
+// EDNS returns the information held by the OPT record in the additional
+// section of the message or nil if there is not one
+func (m *Message) EDNS() *EDNS {
+	for _, rr := range m.Additional {
+		if rr.TYPE == RecordTypeOPT {
+			e, _ := NewEDNSFromRR(rr)
+			return e
+		}
+	}
+
+	return nil
+}
+
+// SetEDNS adds an OPT record to the additional section of the message,
+// replacing one which is already present
+func (m *Message) SetEDNS(e EDNS) {
+	var additional []RR
+
+	for _, rr := range m.Additional {
+		if rr.TYPE != RecordTypeOPT {
+			additional = append(additional, rr)
+		}
+	}
+
+	m.Additional = append(additional, e.RR())
+}
+
+// ResponseCode returns the full response code of the message, combining the
+// 4 bits in the header with the extended bits from EDNS when present
+func (m *Message) ResponseCode() ResponseCode {
+	rcode := m.Header.RCODE
+
+	if e := m.EDNS(); e != nil {
+		rcode |= ResponseCode(e.ExtendedRCODE) << 4
+	}
+
+	return rcode
+}
+
+// decodeEDNSOptions reads the list of options held in the RDATA of an OPT
+// record
+func decodeEDNSOptions(data []byte) ([]EDNSOption, error) {
+	var options []EDNSOption
+
+	offset := 0
+
+	for offset < len(data) {
+		var code, length uint16
+		var err error
+
+		code, offset, err = decodeUint16(data, offset)
+		if err != nil {
+			return options, err
+		}
+
+		length, offset, err = decodeUint16(data, offset)
+		if err != nil {
+			return options, err
+		}
+
+		if offset+int(length) > len(data) {
+			return options, errors.New("Error unpacking EDNS option: Overflow")
+		}
+
+		options = append(options, EDNSOption{
+			Code: EDNSOptionCode(code),
+			Data: append([]byte{}, data[offset:offset+int(length)]...),
+		})
+
+		offset += int(length)
+	}
+
+	return options, nil
+}
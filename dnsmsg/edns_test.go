@@ -0,0 +1,96 @@
+package dnsmsg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEDNSRoundTrip(t *testing.T) {
+	want := EDNS{
+		UDPSize: DefaultEDNSUDPSize,
+		Version: 0,
+		Flags:   EDNSFlagDO,
+		Options: []EDNSOption{
+			{Code: EDNSOptionCodeNSID, Data: []byte{}},
+			{Code: EDNSOptionCodeClientSubnet, Data: []byte{0, 1, 24, 0, 192, 0, 2}},
+		},
+	}
+
+	m := Message{
+		Header:     Header{ID: 5, QR: QRTypeResponse, OPCODE: OpcodeQuery},
+		Questions:  []Question{{QNAME: "www.example.com.", QTYPE: RecordTypeA, QCLASS: RecordClassIN}},
+		Answers:    []RR{roundTripRecords[0]},
+		Additional: []RR{roundTripRecords[1]},
+	}
+
+	m.SetEDNS(EDNS{UDPSize: 512})
+	m.SetEDNS(want)
+
+	if len(m.Additional) != 2 {
+		t.Fatalf("additional section holds %d records after SetEDNS twice, want 2", len(m.Additional))
+	}
+
+	data, err := m.Encode()
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	got := Message{}
+	if _, err := DecodeMessage(data, &got); err != nil {
+		t.Fatalf("DecodeMessage: %v", err)
+	}
+
+	e := got.EDNS()
+	if e == nil {
+		t.Fatal("decoded message has no EDNS")
+	}
+
+	if !reflect.DeepEqual(*e, want) {
+		t.Errorf("EDNS = %+v, want %+v", *e, want)
+	}
+
+	if !e.DO() {
+		t.Error("DO bit is not set")
+	}
+}
+
+func TestEDNSResponseCode(t *testing.T) {
+	m := Message{Header: Header{RCODE: ResponseCodeNameError}}
+
+	if rcode := m.ResponseCode(); rcode != ResponseCodeNameError {
+		t.Errorf("ResponseCode without EDNS = %d, want %d", rcode, ResponseCodeNameError)
+	}
+
+	m.Header.RCODE = 0
+	m.SetEDNS(EDNS{UDPSize: DefaultEDNSUDPSize, ExtendedRCODE: 1})
+
+	if rcode := m.ResponseCode(); rcode != ResponseCodeBadVersion {
+		t.Errorf("ResponseCode = %d, want %d", rcode, ResponseCodeBadVersion)
+	}
+}
+
+func TestDecodeEDNSOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []EDNSOption
+		ok   bool
+	}{
+		{"empty", nil, nil, true},
+		{"one option", []byte{0, 3, 0, 2, 'n', 's'}, []EDNSOption{{Code: EDNSOptionCodeNSID, Data: []byte("ns")}}, true},
+		{"data past the end", []byte{0, 3, 0, 3, 'n', 's'}, nil, false},
+		{"short header", []byte{0, 3, 0}, nil, false},
+	}
+
+	for _, tt := range tests {
+		got, err := decodeEDNSOptions(tt.data)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: error = %v, want ok %v", tt.name, err, tt.ok)
+			continue
+		}
+
+		if tt.ok && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: options = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package dnsmsg
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QueryInfo holds the details of an exchange with a DNS server which are not
+// part of the message on the wire but are useful when presenting it.
+type QueryInfo struct {
+	// The address of the server the message was received from
+	Server string
+
+	// The network the message was received over such as "udp" or "tcp"
+	Network string
+
+	// The time it took for the server to respond to the query
+	QueryTime time.Duration
+
+	// The number of bytes received for the message
+	Size int
+
+	// The time the message was received
+	When time.Time
+}
+
+// Format renders a Message in a dig-esque format using the query details
+// given in info rather than any global state.
+func Format(m *Message, info QueryInfo) string {
+	var sb strings.Builder
+
+	domain := ""
+	recordType := ""
+
+	if len(m.Questions) > 0 {
+		domain = m.Questions[0].QNAME
+		recordType = RecordTypeString(m.Questions[0].QTYPE)
+	}
+
+	sb.WriteString(fmt.Sprintf("\n> [ Simple DNS Client ] >>> %s %s", domain, recordType))
+	sb.WriteString(m.String())
+	sb.WriteString(info.String())
+
+	return sb.String()
+}
+
+// String renders the query details shown after a response
+func (info QueryInfo) String() string {
+	var sb strings.Builder
+
+	currentTime := info.When.Format(time.RFC1123)
+
+	sb.WriteString(fmt.Sprintf("\n> Query time: %s", info.QueryTime))
+	if info.Network != "" {
+		sb.WriteString(fmt.Sprintf("\n> Server: %s (%s)", info.Server, info.Network))
+	} else {
+		sb.WriteString(fmt.Sprintf("\n> Server: %s", info.Server))
+	}
+	sb.WriteString(fmt.Sprintf("\n> When: %s", currentTime))
+	sb.WriteString(fmt.Sprintf("\n> Msg Size: rcvd %d", info.Size))
+
+	return sb.String()
+}
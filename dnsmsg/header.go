@@ -1,4 +1,4 @@
-package main
+package dnsmsg
 
 import (
 	"bytes"
@@ -9,6 +9,18 @@ import (
 
 const maxHeaderSize = 12
 
+// These are the bits of Z which DNSSEC gave a meaning to, see RFC 4035 section
+// 3.2
+const (
+	// ZFlagAD is the Authentic Data bit a validating resolver sets in
+	// responses it has validated
+	ZFlagAD byte = 0x2
+
+	// ZFlagCD is the Checking Disabled bit which asks a validating resolver
+	// to return data even when it does not validate
+	ZFlagCD byte = 0x1
+)
+
 // Header -- The header contains the following fields:
 //
 //                                     1  1  1  1  1  1
@@ -62,7 +74,8 @@ type Header struct {
 	// denotes whether recursive query support is available in the name server.
 	RA byte
 
-	// Reserved for future use. Must be zero in all queries and responses.
+	// Reserved for future use. Must be zero in all queries and responses
+	// apart from the ZFlagAD and ZFlagCD bits.
 	Z byte
 
 	// Response code - this 4 bit field is set as part of responses.
@@ -105,7 +118,8 @@ func (h Header) Encode() ([]byte, error) {
 	resBytes2 := setBitsAtIdx(h.RA, 0, 1)
 	// Z should always be 0 for future use
 	resBytes2 |= setBitsAtIdx(h.Z, 1, 3)
-	resBytes2 |= setBitsAtIdx(byte(h.RCODE), 4, 4)
+	// Only the lower 4 bits fit in the header, the rest are carried by EDNS
+	resBytes2 |= setBitsAtIdx(byte(h.RCODE)&makeOctetMask(4), 4, 4)
 
 	buf.WriteByte(resBytes2)
 
@@ -1,4 +1,4 @@
-package main
+package dnsmsg
 
 // NOTE: borrowed from: https://github.com/miekg/dns/blob/master/msg.go
 
@@ -1,4 +1,10 @@
-package main
+package dnsmsg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 // RecordTypeStrToRecordTypeMap allows a TYPE string to be converted to the RecordType value
 var RecordTypeStrToRecordTypeMap = map[string]RecordType{
@@ -227,35 +233,15 @@ var ObsoleteRecordTypes = []RecordType{
 var NotImplementedRecordTypes = []RecordType{
 	RecordTypeAFSDB,
 	RecordTypeLOC,
-	RecordTypeSRV,
-	RecordTypeNAPTR,
 	RecordTypeKX,
 	RecordTypeCERT,
 	RecordTypeDNAME,
-	RecordTypeOPT,
-	RecordTypeDS,
-	RecordTypeSSHFP,
 	RecordTypeIPSECKEY,
-	RecordTypeRRSIG,
-	RecordTypeNSEC,
-	RecordTypeDNSKEY,
 	RecordTypeDHCID,
-	RecordTypeNSEC3,
-	RecordTypeNSEC3PARAM,
-	RecordTypeTLSA,
-	RecordTypeSMIMEA,
 	RecordTypeHIP,
-	RecordTypeCDS,
-	RecordTypeCDNSKEY,
-	RecordTypeOPENPGPKEY,
 	RecordTypeCSYNC,
 	RecordTypeTKEY,
-	RecordTypeTSIG,
-	RecordTypeIXFR,
-	RecordTypeAXFR,
 	RecordTypeWildcard,
-	RecordTypeURI,
-	RecordTypeCAA,
 	RecordTypeTA,
 	RecordTypeDLV,
 }
@@ -265,6 +251,8 @@ var RecordClassToStrMap = map[RecordClass]string{
 	RecordClassIN:       "IN",
 	RecordClassCS:       "CS",
 	RecordClassCH:       "CH",
+	RecordClassHS:       "HS",
+	RecordClassNone:     "NONE",
 	RecordClassWildcard: "*",
 }
 
@@ -273,6 +261,8 @@ var OpcodeToStrMap = map[Opcode]string{
 	OpcodeQuery:  "QUERY",
 	OpcodeIQuery: "IQUERY",
 	OpcodeStatus: "STATUS",
+	OpcodeNotify: "NOTIFY",
+	OpcodeUpdate: "UPDATE",
 }
 
 // ResponseCodeToStrMap gets a string representation for a ResponseCode
@@ -283,6 +273,83 @@ var ResponseCodeToStrMap = map[ResponseCode]string{
 	ResponseCodeNameError:      "NAME ERROR",
 	ResponseCodeNotImplemented: "NOT IMPLEMENTED",
 	ResponseCodeRefused:        "REFUSED",
+	ResponseCodeYXDomain:       "YXDOMAIN",
+	ResponseCodeYXRRSet:        "YXRRSET",
+	ResponseCodeNXRRSet:        "NXRRSET",
+	ResponseCodeNotAuth:        "NOT AUTHORITATIVE",
+	ResponseCodeNotZone:        "NOT ZONE",
+	ResponseCodeBadVersion:     "BAD VERSION",
+	ResponseCodeBadKey:         "BAD KEY",
+	ResponseCodeBadTime:        "BAD TIME",
+	ResponseCodeBadTrunc:       "BAD TRUNCATION",
+}
+
+// EDNSOptionCodeToStrMap gets a string representation for an EDNSOptionCode
+var EDNSOptionCodeToStrMap = map[EDNSOptionCode]string{
+	EDNSOptionCodeLLQ:          "LLQ",
+	EDNSOptionCodeUL:           "UL",
+	EDNSOptionCodeNSID:         "NSID",
+	EDNSOptionCodeDAU:          "DAU",
+	EDNSOptionCodeDHU:          "DHU",
+	EDNSOptionCodeN3U:          "N3U",
+	EDNSOptionCodeClientSubnet: "CLIENT-SUBNET",
+	EDNSOptionCodeExpire:       "EXPIRE",
+	EDNSOptionCodeCookie:       "COOKIE",
+	EDNSOptionCodeKeepalive:    "TCP-KEEPALIVE",
+	EDNSOptionCodePadding:      "PADDING",
+	EDNSOptionCodeChain:        "CHAIN",
+	EDNSOptionCodeKeyTag:       "KEY-TAG",
+	EDNSOptionCodeExtendedErr:  "EDE",
+}
+
+// DNSSECAlgorithmToStrMap gets the mnemonic for a DNSSECAlgorithm
+var DNSSECAlgorithmToStrMap = map[DNSSECAlgorithm]string{
+	AlgorithmRSAMD5:           "RSAMD5",
+	AlgorithmDSA:              "DSA",
+	AlgorithmRSASHA1:          "RSASHA1",
+	AlgorithmDSANSEC3SHA1:     "DSA-NSEC3-SHA1",
+	AlgorithmRSASHA1NSEC3SHA1: "RSASHA1-NSEC3-SHA1",
+	AlgorithmRSASHA256:        "RSASHA256",
+	AlgorithmRSASHA512:        "RSASHA512",
+	AlgorithmECCGOST:          "ECC-GOST",
+	AlgorithmECDSAP256SHA256:  "ECDSAP256SHA256",
+	AlgorithmECDSAP384SHA384:  "ECDSAP384SHA384",
+	AlgorithmED25519:          "ED25519",
+	AlgorithmED448:            "ED448",
+}
+
+// DigestTypeToStrMap gets the mnemonic for a DigestType
+var DigestTypeToStrMap = map[DigestType]string{
+	DigestTypeSHA1:   "SHA-1",
+	DigestTypeSHA256: "SHA-256",
+	DigestTypeGOST:   "GOST R 34.11-94",
+	DigestTypeSHA384: "SHA-384",
+}
+
+// RecordTypeString names a record type, falling back to the generic TYPE<n>
+// form from RFC 3597 for types without a mnemonic
+func RecordTypeString(t RecordType) string {
+	if s, ok := RecordTypeToStrMap[t]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("TYPE%d", t)
+}
+
+// ParseRecordType reads a record type given either by its mnemonic or in the
+// generic TYPE<n> form
+func ParseRecordType(s string) (RecordType, error) {
+	if t, ok := RecordTypeStrToRecordTypeMap[strings.ToUpper(s)]; ok {
+		return t, nil
+	}
+
+	if len(s) > 4 && strings.EqualFold(s[:4], "TYPE") {
+		if n, err := strconv.ParseUint(s[4:], 10, 16); err == nil {
+			return RecordType(n), nil
+		}
+	}
+
+	return 0, fmt.Errorf("Unknown record type '%s'", s)
 }
 
 // IsRecordTypeNotImplemented checks if the RecordType is a supported operation
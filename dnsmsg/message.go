@@ -1,29 +1,68 @@
-package main
+// Package dnsmsg implements the encoding and decoding of DNS messages as
+// described in RFC 1035 so they can be sent to and read from DNS servers.
+package dnsmsg
 
 import (
 	"bytes"
 	"fmt"
 	"strings"
-	"time"
 )
 
 // Message is a request or response to / from a DNS Server
 type Message struct {
-	queryTime  time.Duration
-	bytesRead  int
 	Header     Header
 	Questions  []Question
 	Answers    []RR
 	Authority  []RR
 	Additional []RR
+
+	// Domain names are compressed when encoding unless this is set. Writing
+	// every name in full can make the encoded bytes easier to debug.
+	DisableCompression bool
+}
+
+// NewQuery creates a Message with a random ID asking a single question for
+// the records of type typ held by name in the IN class. Recursion is desired
+// by default.
+func NewQuery(name string, typ RecordType) *Message {
+	return &Message{
+		Header: Header{
+			ID:      GenerateRandID(),
+			QR:      QRTypeQuery,
+			OPCODE:  OpcodeQuery,
+			QDCOUNT: 1,
+			RD:      1,
+		},
+		Questions: []Question{
+			Question{
+				QNAME:  name,
+				QTYPE:  typ,
+				QCLASS: RecordClassIN,
+			},
+		},
+	}
 }
 
-// Encode converts a message object into a DNS-safe message for a server
+// Encode converts a message object into a DNS-safe message for a server. A
+// single compression map is kept across all of the sections so any domain
+// name can point back to an earlier one, see RFC 1035 section 4.1.4.
 func (m Message) Encode() ([]byte, error) {
 	var err error
 	var data bytes.Buffer
 
-	hBytes, err := m.Header.Encode()
+	var compression compressionMap
+	if !m.DisableCompression {
+		compression = make(compressionMap)
+	}
+
+	// The section counts always reflect the records being encoded
+	header := m.Header
+	header.QDCOUNT = uint16(len(m.Questions))
+	header.ANCOUNT = uint16(len(m.Answers))
+	header.NSCOUNT = uint16(len(m.Authority))
+	header.ARCOUNT = uint16(len(m.Additional))
+
+	hBytes, err := header.Encode()
 
 	if err != nil {
 		return hBytes, err
@@ -32,55 +71,37 @@ func (m Message) Encode() ([]byte, error) {
 	data.Write(hBytes)
 
 	for _, question := range m.Questions {
-		qBytes, err := question.Encode()
-
-		if err != nil {
-			return append(data.Bytes(), qBytes...), err
+		if err = question.encodeTo(&data, compression); err != nil {
+			return data.Bytes(), err
 		}
-
-		data.Write(qBytes)
 	}
 
 	for _, answer := range m.Answers {
-		anBytes, err := answer.Encode()
-
-		if err != nil {
-			return append(data.Bytes(), anBytes...), err
+		if err = answer.encodeTo(&data, compression); err != nil {
+			return data.Bytes(), err
 		}
-
-		data.Write(anBytes)
 	}
 
 	for _, authority := range m.Authority {
-		authBytes, err := authority.Encode()
-
-		if err != nil {
-			return append(data.Bytes(), authBytes...), err
+		if err = authority.encodeTo(&data, compression); err != nil {
+			return data.Bytes(), err
 		}
-
-		data.Write(authBytes)
 	}
 
 	for _, additional := range m.Additional {
-		addBytes, err := additional.Encode()
-
-		if err != nil {
-			return append(data.Bytes(), addBytes...), err
+		if err = additional.encodeTo(&data, compression); err != nil {
+			return data.Bytes(), err
 		}
-
-		data.Write(addBytes)
 	}
 
 	return data.Bytes(), err
 }
 
 // DecodeMessage decodes a message returned from the DNS server
-func DecodeMessage(data []byte, m *Message, queryTime time.Duration) (int, error) {
+func DecodeMessage(data []byte, m *Message) (int, error) {
 	var err error
 	var bytesRead int
 
-	m.queryTime = queryTime
-
 	//-------------------------------------------------------------------------
 	// 1. Decode the header and set it
 	//-------------------------------------------------------------------------
@@ -154,36 +175,34 @@ func DecodeMessage(data []byte, m *Message, queryTime time.Duration) (int, error
 		m.Additional = append(m.Additional, *rr)
 	}
 
-	m.bytesRead = bytesRead
-
 	return bytesRead, err
 }
 
+// String makes the header summary and each section of the message printable
 func (m *Message) String() string {
 	var sb strings.Builder
 
-	domain := *domainFlagVal
-	recordType := *recordTypeFlagVal
-	dnsServerAddr := *dnsServerAddrFlagVal
-	queryTime := m.queryTime
-	bytesRead := m.bytesRead
-	currentTime := time.Now().Format(time.RFC1123)
-
 	id := m.Header.ID
 	opcode := OpcodeToStrMap[m.Header.OPCODE]
-	responseCode := ResponseCodeToStrMap[m.Header.RCODE]
+	responseCode := ResponseCodeToStrMap[m.ResponseCode()]
+	edns := m.EDNS()
 
 	numQuestions := len(m.Questions)
 	numAnswers := len(m.Answers)
 	numAuthority := len(m.Authority)
 	numAdditional := len(m.Additional)
 
-	sb.WriteString(fmt.Sprintf("\n> [ Simple DNS Client ] >>> %s %s", domain, recordType))
+	// UPDATE messages give the sections a different meaning, see RFC 2136
+	sections := [4]string{"QUESTION", "ANSWER", "AUTHORITY", "ADDITIONAL"}
+	if m.Header.OPCODE == OpcodeUpdate {
+		sections = [4]string{"ZONE", "PREREQUISITE", "UPDATE", "ADDITIONAL"}
+	}
+
 	sb.WriteString(fmt.Sprintf("\n> ID: %d, opcode: %s, status: %s", id, opcode, responseCode))
 	sb.WriteString(fmt.Sprintf("\n> QUERY: %d, ANSWER: %d, AUTHORITY: %d, ADDITIONAL: %d,", numQuestions, numAnswers, numAuthority, numAdditional))
 
 	if numQuestions > 0 {
-		sb.WriteString(fmt.Sprintf("\n\n> QUESTION SECTION:\n"))
+		sb.WriteString(fmt.Sprintf("\n\n> %s SECTION:\n", sections[0]))
 
 		for _, question := range m.Questions {
 			sb.WriteString(fmt.Sprintf("%s\n", question.String()))
@@ -191,7 +210,7 @@ func (m *Message) String() string {
 	}
 
 	if numAnswers > 0 {
-		sb.WriteString(fmt.Sprintf("\n> ANSWER SECTION:\n"))
+		sb.WriteString(fmt.Sprintf("\n> %s SECTION:\n", sections[1]))
 
 		for _, answer := range m.Answers {
 			sb.WriteString(fmt.Sprintf("%s\n", answer.String()))
@@ -199,25 +218,32 @@ func (m *Message) String() string {
 	}
 
 	if numAuthority > 0 {
-		sb.WriteString(fmt.Sprintf("\n> AUTHORITY SECTION:\n"))
+		sb.WriteString(fmt.Sprintf("\n> %s SECTION:\n", sections[2]))
 
 		for _, authority := range m.Authority {
 			sb.WriteString(fmt.Sprintf("%s\n", authority.String()))
 		}
 	}
 
+	if edns != nil {
+		sb.WriteString(fmt.Sprintf("\n> OPT PSEUDOSECTION:\n"))
+		sb.WriteString(fmt.Sprintf("%s\n", edns))
+
+		// The OPT record is shown above rather than with the other records
+		numAdditional--
+	}
+
 	if numAdditional > 0 {
-		sb.WriteString(fmt.Sprintf("\n> ADDITIONAL SECTION:\n"))
+		sb.WriteString(fmt.Sprintf("\n> %s SECTION:\n", sections[3]))
 
 		for _, additional := range m.Additional {
+			if additional.TYPE == RecordTypeOPT {
+				continue
+			}
+
 			sb.WriteString(fmt.Sprintf("%s\n", additional.String()))
 		}
 	}
 
-	sb.WriteString(fmt.Sprintf("\n> Query time: %s", queryTime))
-	sb.WriteString(fmt.Sprintf("\n> Server: %s", dnsServerAddr))
-	sb.WriteString(fmt.Sprintf("\n> When: %s", currentTime))
-	sb.WriteString(fmt.Sprintf("\n> Msg Size: rcvd %d", bytesRead))
-
 	return sb.String()
 }
@@ -0,0 +1,342 @@
+package dnsmsg
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// roundTripRecords holds a record of each type with an encoder
+var roundTripRecords = []RR{
+	{NAME: "www.example.com.", TYPE: RecordTypeA, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataA{ipAddr: net.ParseIP("192.0.2.1")}},
+	{NAME: "www.example.com.", TYPE: RecordTypeAAAA, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataAAAA{ipAddr: net.ParseIP("2001:db8::1")}},
+	{NAME: "alias.example.com.", TYPE: RecordTypeCNAME, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataCNAME{domain: "www.example.com."}},
+	{NAME: "example.com.", TYPE: RecordTypeNS, CLASS: RecordClassIN, TTL: 3600,
+		RDATA: &RDataNS{domain: "ns1.example.com."}},
+	{NAME: "example.com.", TYPE: RecordTypeSOA, CLASS: RecordClassIN, TTL: 3600,
+		RDATA: &RDataSOA{mname: "ns1.example.com.", rname: "hostmaster.example.com.", serial: 2024010101,
+			refresh: 7200, retry: 3600, expire: 1209600, minimum: 300}},
+	{NAME: "example.com.", TYPE: RecordTypeMX, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataMX{preference: 10, exchange: "mail.example.com."}},
+	{NAME: "1.2.0.192.in-addr.arpa.", TYPE: RecordTypePTR, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataPTR{domain: "www.example.com."}},
+	{NAME: "example.com.", TYPE: RecordTypeTXT, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataTXT{txt: []string{"v=spf1 -all", "a second string", ""}}},
+	{NAME: "example.com.", TYPE: RecordTypeDNSKEY, CLASS: RecordClassIN, TTL: 3600,
+		RDATA: &RDataDNSKEY{flags: 257, protocol: 3, algorithm: AlgorithmED25519, publicKey: []byte{1, 2, 3, 4, 5, 6, 7, 8}}},
+	{NAME: "example.com.", TYPE: RecordTypeDS, CLASS: RecordClassIN, TTL: 3600,
+		RDATA: &RDataDS{keyTag: 12345, algorithm: AlgorithmED25519, digestType: DigestTypeSHA256, digest: bytes.Repeat([]byte{0xab}, 32)}},
+	{NAME: "www.example.com.", TYPE: RecordTypeRRSIG, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataRRSIG{typeCovered: RecordTypeA, algorithm: AlgorithmED25519, labels: 3, originalTTL: 300,
+			expiration: 1735689600, inception: 1704067200, keyTag: 12345, signerName: "example.com.", signature: []byte{9, 8, 7, 6}}},
+	{NAME: "www.example.com.", TYPE: RecordTypeNSEC, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataNSEC{nextDomain: "zzz.example.com.", types: []RecordType{RecordTypeA, RecordTypeAAAA, RecordTypeRRSIG, RecordTypeNSEC, RecordTypeCAA}}},
+	{NAME: "2vptu5timamqttgl4luu9kg21e0aor3s.example.com.", TYPE: RecordTypeNSEC3, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataNSEC3{hashAlgorithm: 1, flags: 1, iterations: 0, salt: []byte{0xaa, 0xbb},
+			nextHashedOwner: bytes.Repeat([]byte{0x42}, 20), types: []RecordType{RecordTypeA, RecordTypeRRSIG}}},
+	{NAME: "example.com.", TYPE: RecordTypeNSEC3PARAM, CLASS: RecordClassIN, TTL: 0,
+		RDATA: &RDataNSEC3PARAM{hashAlgorithm: 1, iterations: 0, salt: []byte{}}},
+	{NAME: "_sip._tcp.example.com.", TYPE: RecordTypeSRV, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataSRV{priority: 10, weight: 60, port: 5060, target: "sip.example.com."}},
+	{NAME: "example.com.", TYPE: RecordTypeNAPTR, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataNAPTR{order: 100, preference: 10, flags: "u", service: "E2U+sip", regexp: "!^.*$!sip:info@example.com!", replacement: "."}},
+	{NAME: "_http._tcp.example.com.", TYPE: RecordTypeURI, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataURI{priority: 10, weight: 1, target: "https://www.example.com/"}},
+	{NAME: "example.com.", TYPE: RecordTypeCAA, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataCAA{flags: 128, tag: "issue", value: "ca.example.net; account=230123"}},
+	{NAME: "_443._tcp.www.example.com.", TYPE: RecordTypeTLSA, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataTLSA{usage: 3, selector: 1, matchingType: 1, data: bytes.Repeat([]byte{0xcd}, 32)}},
+	{NAME: "_smimecert.example.com.", TYPE: RecordTypeSMIMEA, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataTLSA{usage: 3, selector: 0, matchingType: 0, data: []byte{1, 2, 3}}},
+	{NAME: "host.example.com.", TYPE: RecordTypeSSHFP, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataSSHFP{algorithm: 4, fpType: 2, fingerprint: bytes.Repeat([]byte{0xef}, 32)}},
+	{NAME: "c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._openpgpkey.example.com.", TYPE: RecordTypeOPENPGPKEY, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataOPENPGPKEY{key: []byte{0x99, 1, 2, 3}}},
+
+	// Types without a decoder keep their RDATA as received
+	{NAME: "www.example.com.", TYPE: 65, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataUnknown{qType: 65, data: []byte{0, 1, 0, 0, 3, 0, 0}}},
+	{NAME: "old.example.com.", TYPE: RecordTypeHINFO, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataUnknown{qType: RecordTypeHINFO, data: []byte{3, 'A', 'M', 'D', 3, 'L', 'N', 'X'}}},
+	{NAME: "empty.example.com.", TYPE: 1234, CLASS: RecordClassIN, TTL: 300,
+		RDATA: &RDataUnknown{qType: 1234}},
+}
+
+// roundTrip encodes m, decodes it again and checks every section survived.
+// The encoded bytes are returned.
+func roundTrip(t *testing.T, m Message) []byte {
+	t.Helper()
+
+	data, err := m.Encode()
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	got := Message{}
+
+	n, err := DecodeMessage(data, &got)
+	if err != nil {
+		t.Fatalf("DecodeMessage: %v", err)
+	}
+
+	if n != len(data) {
+		t.Errorf("DecodeMessage read %d octets of %d", n, len(data))
+	}
+
+	want := m.Header
+	want.QDCOUNT = uint16(len(m.Questions))
+	want.ANCOUNT = uint16(len(m.Answers))
+	want.NSCOUNT = uint16(len(m.Authority))
+	want.ARCOUNT = uint16(len(m.Additional))
+
+	if got.Header != want {
+		t.Errorf("header = %+v, want %+v", got.Header, want)
+	}
+
+	if !reflect.DeepEqual(got.Questions, m.Questions) {
+		t.Errorf("questions = %v, want %v", got.Questions, m.Questions)
+	}
+
+	sections := []struct {
+		name      string
+		got, want []RR
+	}{
+		{"answer", got.Answers, m.Answers},
+		{"authority", got.Authority, m.Authority},
+		{"additional", got.Additional, m.Additional},
+	}
+
+	for _, section := range sections {
+		if len(section.got) != len(section.want) {
+			t.Errorf("%s section holds %d records, want %d", section.name, len(section.got), len(section.want))
+			continue
+		}
+
+		for i, rr := range section.got {
+			compareRR(t, rr, section.want[i], m.DisableCompression)
+		}
+	}
+
+	return data
+}
+
+// compareRR checks a decoded record matches the one encoded, down to the
+// octets of its RDATA. RDLENGTH is only known in advance when the names in
+// the RDATA were not compressed.
+func compareRR(t *testing.T, got, want RR, uncompressed bool) {
+	t.Helper()
+
+	if got.NAME != want.NAME || got.TYPE != want.TYPE || got.CLASS != want.CLASS || got.TTL != want.TTL {
+		t.Errorf("record = %s, want %s", &got, &want)
+		return
+	}
+
+	gotData, err := got.RDATA.Encode()
+	if err != nil {
+		t.Errorf("%s: encoding decoded RDATA: %v", &want, err)
+		return
+	}
+
+	wantData, err := want.RDATA.Encode()
+	if err != nil {
+		t.Errorf("%s: encoding RDATA: %v", &want, err)
+		return
+	}
+
+	if !bytes.Equal(gotData, wantData) {
+		t.Errorf("%s: RDATA = %x, want %x", &want, gotData, wantData)
+	}
+
+	if uncompressed && int(got.RDLENGTH) != len(wantData) {
+		t.Errorf("%s: RDLENGTH = %d, want %d", &want, got.RDLENGTH, len(wantData))
+	}
+
+	if got.RDATA.String() != want.RDATA.String() {
+		t.Errorf("RDATA = %s, want %s", got.RDATA, want.RDATA)
+	}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	for _, rr := range roundTripRecords {
+		rr := rr
+
+		t.Run(RecordTypeString(rr.TYPE), func(t *testing.T) {
+			for _, disable := range []bool{false, true} {
+				roundTrip(t, Message{
+					Header: Header{
+						ID:     0xbeef,
+						QR:     QRTypeResponse,
+						OPCODE: OpcodeQuery,
+						AA:     1,
+						RD:     1,
+						RA:     1,
+					},
+					Questions:          []Question{{QNAME: rr.NAME, QTYPE: rr.TYPE, QCLASS: RecordClassIN}},
+					Answers:            []RR{rr},
+					DisableCompression: disable,
+				})
+			}
+		})
+	}
+}
+
+func TestMessageRoundTripSections(t *testing.T) {
+	m := Message{
+		Header: Header{ID: 1, QR: QRTypeResponse, OPCODE: OpcodeQuery, RCODE: ResponseCodeNameError},
+		Questions: []Question{
+			{QNAME: "nothing.example.com.", QTYPE: RecordTypeMX, QCLASS: RecordClassIN},
+		},
+		Authority:  []RR{roundTripRecords[4], roundTripRecords[3]},
+		Additional: []RR{roundTripRecords[0], roundTripRecords[1]},
+	}
+
+	roundTrip(t, m)
+}
+
+func TestEncodeNilRData(t *testing.T) {
+	m := Message{
+		Header:  Header{ID: 2, QR: QRTypeResponse},
+		Answers: []RR{{NAME: "example.com.", TYPE: RecordTypeA, CLASS: RecordClassIN}},
+	}
+
+	if _, err := m.Encode(); err == nil {
+		t.Error("Encode succeeded for a record without RDATA")
+	}
+}
+
+func TestCompression(t *testing.T) {
+	m := Message{
+		Header:    Header{ID: 3, QR: QRTypeResponse, OPCODE: OpcodeQuery},
+		Questions: []Question{{QNAME: "www.example.com.", QTYPE: RecordTypeMX, QCLASS: RecordClassIN}},
+		Answers: []RR{
+			{NAME: "www.example.com.", TYPE: RecordTypeCNAME, CLASS: RecordClassIN, TTL: 300,
+				RDATA: &RDataCNAME{domain: "mail.example.com."}},
+			{NAME: "mail.example.com.", TYPE: RecordTypeMX, CLASS: RecordClassIN, TTL: 300,
+				RDATA: &RDataMX{preference: 10, exchange: "mx1.mail.example.com."}},
+			{NAME: "mail.example.com.", TYPE: RecordTypeMX, CLASS: RecordClassIN, TTL: 300,
+				RDATA: &RDataMX{preference: 20, exchange: "mx2.mail.example.com."}},
+			{NAME: "mail.example.com.", TYPE: RecordTypeSOA, CLASS: RecordClassIN, TTL: 300,
+				RDATA: &RDataSOA{mname: "ns1.example.com.", rname: "hostmaster.example.com.", serial: 1,
+					refresh: 2, retry: 3, expire: 4, minimum: 5}},
+		},
+	}
+
+	compressed := roundTrip(t, m)
+
+	m.DisableCompression = true
+	full := roundTrip(t, m)
+
+	if len(compressed) >= len(full) {
+		t.Errorf("compressed message is %d octets, not shorter than the %d uncompressed", len(compressed), len(full))
+	}
+
+	// Every name after the question ends in a pointer back to an earlier one
+	if pointers := bytes.Count(compressed, []byte{0xc0}); pointers < len(m.Answers) {
+		t.Errorf("compressed message holds %d pointers, want at least %d", pointers, len(m.Answers))
+	}
+
+	if bytes.Contains(full, []byte{0xc0, 0x0c}) {
+		t.Error("uncompressed message holds a pointer to the question")
+	}
+}
+
+func TestDecodeCompressionPointers(t *testing.T) {
+	header := []byte{0x12, 0x34, 0x81, 0x80, 0, 1, 0, 1, 0, 0, 0, 0}
+	question := []byte{3, 'w', 'w', 'w', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 0, 5, 0, 1}
+
+	tests := []struct {
+		name   string
+		answer []byte
+		want   string
+		ok     bool
+	}{
+		{
+			name:   "owner and target point into the question",
+			answer: []byte{0xc0, 0x0c, 0, 5, 0, 1, 0, 0, 0, 60, 0, 7, 4, 'm', 'a', 'i', 'l', 0xc0, 0x10},
+			want:   "mail.example.com.",
+			ok:     true,
+		},
+		{
+			name:   "pointer to itself",
+			answer: []byte{0xc0, 0x21, 0, 5, 0, 1, 0, 0, 0, 60, 0, 2, 0xc0, 0x0c},
+		},
+		{
+			name:   "pointer past the end",
+			answer: []byte{0xc0, 0xff, 0, 5, 0, 1, 0, 0, 0, 60, 0, 2, 0xc0, 0x0c},
+		},
+		{
+			name:   "pointers forming a loop",
+			answer: []byte{0xc0, 0x0c, 0, 5, 0, 1, 0, 0, 0, 60, 0, 4, 0xc0, 0x2f, 0xc0, 0x2d},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append(append(append([]byte{}, header...), question...), tt.answer...)
+
+			m := Message{}
+			_, err := DecodeMessage(data, &m)
+
+			if !tt.ok {
+				if err == nil {
+					t.Fatalf("DecodeMessage succeeded, want an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("DecodeMessage: %v", err)
+			}
+
+			cname, ok := m.Answers[0].RDATA.(*RDataCNAME)
+			if !ok || m.Answers[0].NAME != "www.example.com." || cname.Domain() != tt.want {
+				t.Errorf("answer = %s, want www.example.com. CNAME %s", &m.Answers[0], tt.want)
+			}
+		})
+	}
+}
+
+// RDATA of the wrong length for its type is an error rather than read past
+func TestDecodeRDataLength(t *testing.T) {
+	for _, typ := range []RecordType{RecordTypeA, RecordTypeAAAA} {
+		for _, length := range []int{0, 3, 17} {
+			m := Message{
+				Header:    Header{ID: 5, QR: QRTypeResponse, OPCODE: OpcodeQuery},
+				Questions: []Question{{QNAME: "www.example.com.", QTYPE: typ, QCLASS: RecordClassIN}},
+				Answers: []RR{{NAME: "www.example.com.", TYPE: typ, CLASS: RecordClassIN, TTL: 300,
+					RDATA: &RDataUnknown{qType: typ, data: make([]byte, length)}}},
+			}
+
+			data, err := m.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := DecodeMessage(data, &Message{}); err == nil {
+				t.Errorf("DecodeMessage of %s with %d octets of RDATA succeeded", RecordTypeString(typ), length)
+			}
+		}
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	m := Message{
+		Header:    Header{ID: 4, QR: QRTypeResponse, OPCODE: OpcodeQuery},
+		Questions: []Question{{QNAME: "example.com.", QTYPE: RecordTypeA, QCLASS: RecordClassIN}},
+		Answers:   roundTripRecords,
+	}
+
+	data := roundTrip(t, m)
+
+	// Every prefix of the message stops short of a record the header counts
+	for i := 0; i < len(data); i++ {
+		if _, err := DecodeMessage(data[:i], &Message{}); err == nil {
+			t.Errorf("DecodeMessage of the first %d of %d octets succeeded, want an error", i, len(data))
+		}
+	}
+}
@@ -1,16 +1,12 @@
-package main
+package dnsmsg
 
 import (
 	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"strings"
 )
 
-// based on a domain name minimum number of labels
-const minimumQnameLen = 2
-
 // Question -- The question section is used to carry the "question" in most
 // queries, i.e., the parameters that define what is being asked.  The section
 // contains QDCOUNT (usually 1) entries, each of the following format:
@@ -46,30 +42,30 @@ type Question struct {
 
 // Encode translates a Question into a byte array suitable for a DNS server
 func (q Question) Encode() ([]byte, error) {
-	var err error
 	var buf bytes.Buffer
 
-	labels := strings.Split(q.QNAME, ".")
-
-	if len(labels) < minimumQnameLen {
-		return buf.Bytes(), errors.New("Malformed QName field")
-	}
+	err := q.encodeTo(&buf, nil)
 
-	for _, label := range labels {
-		if len(label) == 0 {
-			return buf.Bytes(), errors.New("Malformed label found, must not be 0 length")
-		}
+	return buf.Bytes(), err
+}
 
-		buf.WriteByte(uint8(len(label)))
-		buf.Write([]byte(label))
+// encodeTo writes the Question into a message buffer, compressing QNAME when
+// a compression map is given
+func (q Question) encodeTo(buf *bytes.Buffer, compression compressionMap) error {
+	// The root and top level domains are valid questions, so only a name
+	// which was never filled in is refused
+	if q.QNAME == "" {
+		return errors.New("Malformed QName field")
 	}
 
-	buf.WriteByte(0x00)
+	if err := writeDomainName(buf, q.QNAME, compression); err != nil {
+		return err
+	}
 
-	binary.Write(&buf, binary.BigEndian, q.QTYPE)
-	binary.Write(&buf, binary.BigEndian, q.QCLASS)
+	binary.Write(buf, binary.BigEndian, q.QTYPE)
+	binary.Write(buf, binary.BigEndian, q.QCLASS)
 
-	return buf.Bytes(), err
+	return nil
 }
 
 // DecodeQuestion translates a byte slice to a Question object
@@ -105,7 +101,7 @@ func DecodeQuestion(data []byte, bytesRead int, q *Question) (int, error) {
 func (q *Question) String() string {
 	name := q.QNAME
 	class := RecordClassToStrMap[q.QCLASS]
-	typ := RecordTypeToStrMap[q.QTYPE]
+	typ := RecordTypeString(q.QTYPE)
 
 	return fmt.Sprintf("%s\t\t\t%s\t%s", name, class, typ)
 }
@@ -1,8 +1,11 @@
-package main
+package dnsmsg
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 )
 
 // RR is a Resource Record and is the response given for a DNS Question
@@ -59,17 +62,66 @@ type RR struct {
 	RDATA ResourceDataField
 }
 
-// Encode translates an RR to a byte slice for sending as a DNS message.
-// @TODO implement this method...
+// Encode translates an RR to a byte slice for sending as a DNS message. The
+// RDLENGTH field is computed from the encoded RDATA rather than trusted.
 func (rr *RR) Encode() ([]byte, error) {
-	return []byte{}, errors.New("RR encoding not implemented")
+	var buf bytes.Buffer
+
+	err := rr.encodeTo(&buf, nil)
+
+	return buf.Bytes(), err
+}
+
+// encodeTo writes the RR into a message buffer. When a compression map is
+// given, the owner name and any domain names in RDATA which may be compressed
+// are replaced by pointers to earlier occurrences in the message.
+func (rr *RR) encodeTo(buf *bytes.Buffer, compression compressionMap) error {
+	if rr.RDATA == nil {
+		return errors.New("Cannot encode RR with nil RDATA")
+	}
+
+	if err := writeDomainName(buf, rr.NAME, compression); err != nil {
+		return err
+	}
+
+	binary.Write(buf, binary.BigEndian, rr.TYPE)
+	binary.Write(buf, binary.BigEndian, rr.CLASS)
+	binary.Write(buf, binary.BigEndian, rr.TTL)
+
+	// RDLENGTH is filled in once the RDATA has been written
+	rdLengthOffset := buf.Len()
+	binary.Write(buf, binary.BigEndian, uint16(0))
+
+	if rData, ok := rr.RDATA.(compressibleRData); ok {
+		if err := rData.encodeTo(buf, compression); err != nil {
+			return err
+		}
+	} else {
+		rData, err := rr.RDATA.Encode()
+		if err != nil {
+			return err
+		}
+
+		buf.Write(rData)
+	}
+
+	rdLength := buf.Len() - rdLengthOffset - 2
+
+	if rdLength > math.MaxUint16 {
+		return fmt.Errorf("RDATA length %d exceeds the maximum of %d", rdLength, math.MaxUint16)
+	}
+
+	rr.RDLENGTH = uint16(rdLength)
+	binary.BigEndian.PutUint16(buf.Bytes()[rdLengthOffset:], rr.RDLENGTH)
+
+	return nil
 }
 
 func (rr *RR) String() string {
 	name := rr.NAME
 	ttl := rr.TTL
 	class := RecordClassToStrMap[rr.CLASS]
-	typ := RecordTypeToStrMap[rr.TYPE]
+	typ := RecordTypeString(rr.TYPE)
 	rData := rr.RDATA
 
 	return fmt.Sprintf("%s\t\t%d\t%s\t%s\t%s", name, ttl, class, typ, rData)
@@ -112,6 +164,19 @@ func DecodeRR(data []byte, bytesRead int, rr *RR) (int, error) {
 		return bytesRead, err
 	}
 
+	if bytesRead+int(rr.RDLENGTH) > len(data) {
+		return bytesRead, errors.New("Error unpacking RDATA: Overflow")
+	}
+
+	// The prerequisites and deletions of UPDATE messages use records of
+	// class ANY or NONE without RDATA to refer to a whole RRset or name so
+	// there is nothing for the type to decode, see RFC 2136 section 2.4.
+	// Records of any other class must decode as their type.
+	if rr.RDLENGTH == 0 && rr.TYPE != RecordTypeOPT && (rr.CLASS == RecordClassWildcard || rr.CLASS == RecordClassNone) {
+		rr.RDATA = &RDataEmpty{}
+		return bytesRead, nil
+	}
+
 	rr.RDATA, err = getResourceDataFieldForResourceType(rr.TYPE, data, bytesRead, rr.RDLENGTH)
 	bytesRead += int(rr.RDLENGTH)
 	if err != nil {
@@ -134,7 +199,7 @@ func getResourceDataFieldForResourceType(rrType RecordType, data []byte, bytesRe
 		return NewRDataAAAA(data[bytesRead : uint16(bytesRead)+dataLen])
 
 	case RecordTypeTXT:
-		return NewRDataTXT(data[bytesRead+1 : uint16(bytesRead)+dataLen])
+		return NewRDataTXT(data[bytesRead : bytesRead+int(dataLen)])
 
 	case RecordTypeCNAME:
 		return NewRDataCNAME(data, bytesRead)
@@ -151,16 +216,53 @@ func getResourceDataFieldForResourceType(rrType RecordType, data []byte, bytesRe
 	case RecordTypePTR:
 		return NewRDataPTR(data, bytesRead)
 
-	default:
-		if IsRecordTypeObsolete(rrType) {
-			return NewRDataObsolete()
-		}
+	case RecordTypeSRV:
+		return NewRDataSRV(data, bytesRead)
 
-		if IsRecordTypeNotImplemented(rrType) {
-			return NewRDataNotImplemented()
-		}
+	case RecordTypeNAPTR:
+		return NewRDataNAPTR(data, bytesRead, dataLen)
+
+	case RecordTypeURI:
+		return NewRDataURI(data[bytesRead : bytesRead+int(dataLen)])
+
+	case RecordTypeCAA:
+		return NewRDataCAA(data[bytesRead : bytesRead+int(dataLen)])
+
+	case RecordTypeTLSA, RecordTypeSMIMEA:
+		return NewRDataTLSA(data[bytesRead : bytesRead+int(dataLen)])
+
+	case RecordTypeSSHFP:
+		return NewRDataSSHFP(data[bytesRead : bytesRead+int(dataLen)])
 
-		return NewRDataUnknown(rrType)
+	case RecordTypeOPENPGPKEY:
+		return NewRDataOPENPGPKEY(data[bytesRead : bytesRead+int(dataLen)])
+
+	case RecordTypeOPT:
+		return NewRDataOPT(data[bytesRead : bytesRead+int(dataLen)])
+
+	case RecordTypeTSIG:
+		return NewRDataTSIG(data, bytesRead, dataLen)
+
+	case RecordTypeDNSKEY, RecordTypeCDNSKEY:
+		return NewRDataDNSKEY(data[bytesRead : bytesRead+int(dataLen)])
+
+	case RecordTypeRRSIG:
+		return NewRDataRRSIG(data, bytesRead, dataLen)
+
+	case RecordTypeDS, RecordTypeCDS:
+		return NewRDataDS(data[bytesRead : bytesRead+int(dataLen)])
+
+	case RecordTypeNSEC:
+		return NewRDataNSEC(data, bytesRead, dataLen)
+
+	case RecordTypeNSEC3:
+		return NewRDataNSEC3(data[bytesRead : bytesRead+int(dataLen)])
+
+	case RecordTypeNSEC3PARAM:
+		return NewRDataNSEC3PARAM(data[bytesRead : bytesRead+int(dataLen)])
+
+	default:
+		return NewRDataUnknown(rrType, data[bytesRead:bytesRead+int(dataLen)])
 
 	}
 }
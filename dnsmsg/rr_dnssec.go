@@ -0,0 +1,749 @@
+package dnsmsg
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The RDATA of the records added by DNSSEC, see RFC 4034 and RFC 5155. CDS and
+// CDNSKEY records share the format of DS and DNSKEY records, see RFC 7344.
+
+// base32Hex encodes the hashed owner names of NSEC3 records
+var base32Hex = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// sigTimeFormat is the YYYYMMDDHHmmSS form RRSIG times are presented in
+const sigTimeFormat = "20060102150405"
+
+//-----------------------------------------------------------------------------
+// DNSKEY Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataDNSKEY represents a DNSKEY or CDNSKEY record holding a public key of
+// the zone:
+//
+//                          1 1 1 1 1 1 1 1 1 1 2 2 2 2 2 2 2 2 2 2 3 3
+//      0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//     |              Flags            |    Protocol   |   Algorithm   |
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//     /                                                               /
+//     /                            Public Key                         /
+//     /                                                               /
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type RDataDNSKEY struct {
+	flags     uint16
+	protocol  uint8
+	algorithm DNSSECAlgorithm
+	publicKey []byte
+}
+
+// NewRDataDNSKEY creates a new RDataDNSKEY instance
+func NewRDataDNSKEY(data []byte) (*RDataDNSKEY, error) {
+	if len(data) < 4 {
+		return nil, errors.New("Error unpacking DNSKEY: Overflow")
+	}
+
+	return &RDataDNSKEY{
+		flags:     binary.BigEndian.Uint16(data),
+		protocol:  data[2],
+		algorithm: DNSSECAlgorithm(data[3]),
+		publicKey: append([]byte{}, data[4:]...),
+	}, nil
+}
+
+// String makes this record printable. The key tag is added as a comment since
+// it is what RRSIG and DS records refer to the key by.
+func (r *RDataDNSKEY) String() string {
+	return fmt.Sprintf("%d %d %d %s ; key id = %d", r.flags, r.protocol, r.algorithm, base64.StdEncoding.EncodeToString(r.publicKey), r.KeyTag())
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataDNSKEY) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	binary.Write(&buf, binary.BigEndian, r.flags)
+	buf.WriteByte(r.protocol)
+	buf.WriteByte(uint8(r.algorithm))
+	buf.Write(r.publicKey)
+
+	return buf.Bytes(), nil
+}
+
+// Flags returns the flags of the key such as DNSKEYFlagZone and DNSKEYFlagSEP
+func (r *RDataDNSKEY) Flags() uint16 {
+	return r.flags
+}
+
+// Protocol returns the protocol of the key, which is always 3
+func (r *RDataDNSKEY) Protocol() uint8 {
+	return r.protocol
+}
+
+// Algorithm returns the algorithm the key is used with
+func (r *RDataDNSKEY) Algorithm() DNSSECAlgorithm {
+	return r.algorithm
+}
+
+// PublicKey returns the public key in the format of its algorithm
+func (r *RDataDNSKEY) PublicKey() []byte {
+	return r.publicKey
+}
+
+// KeyTag computes the tag RRSIG and DS records use to pick out this key from
+// the others of the zone, see RFC 4034 appendix B
+func (r *RDataDNSKEY) KeyTag() uint16 {
+	// RSA/MD5 keys use the most significant octets of the modulus instead
+	if r.algorithm == AlgorithmRSAMD5 {
+		if len(r.publicKey) < 3 {
+			return 0
+		}
+
+		return binary.BigEndian.Uint16(r.publicKey[len(r.publicKey)-3:])
+	}
+
+	rdata, _ := r.Encode()
+
+	var ac uint32
+
+	for i, b := range rdata {
+		if i&1 == 1 {
+			ac += uint32(b)
+		} else {
+			ac += uint32(b) << 8
+		}
+	}
+
+	ac += ac >> 16 & 0xFFFF
+
+	return uint16(ac)
+}
+
+//-----------------------------------------------------------------------------
+// RRSIG Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataRRSIG represents the signature over an RRset:
+//
+//                          1 1 1 1 1 1 1 1 1 1 2 2 2 2 2 2 2 2 2 2 3 3
+//      0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//     |        Type Covered           |  Algorithm    |     Labels    |
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//     |                         Original TTL                          |
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//     |                      Signature Expiration                     |
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//     |                      Signature Inception                      |
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//     |            Key Tag            |                               /
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+         Signer's Name         /
+//     /                                                               /
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//     /                                                               /
+//     /                            Signature                          /
+//     /                                                               /
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type RDataRRSIG struct {
+	typeCovered RecordType
+	algorithm   DNSSECAlgorithm
+	labels      uint8
+	originalTTL uint32
+	expiration  uint32
+	inception   uint32
+	keyTag      uint16
+	signerName  string
+	signature   []byte
+}
+
+// NewRDataRRSIG creates a new RDataRRSIG instance from the dataLen octets of
+// RDATA starting at offset
+func NewRDataRRSIG(data []byte, offset int, dataLen uint16) (*RDataRRSIG, error) {
+	end := offset + int(dataLen)
+
+	if offset+18 > end {
+		return nil, errors.New("Error unpacking RRSIG: Overflow")
+	}
+
+	r := &RDataRRSIG{
+		typeCovered: RecordType(binary.BigEndian.Uint16(data[offset:])),
+		algorithm:   DNSSECAlgorithm(data[offset+2]),
+		labels:      data[offset+3],
+		originalTTL: binary.BigEndian.Uint32(data[offset+4:]),
+		expiration:  binary.BigEndian.Uint32(data[offset+8:]),
+		inception:   binary.BigEndian.Uint32(data[offset+12:]),
+		keyTag:      binary.BigEndian.Uint16(data[offset+16:]),
+	}
+
+	signerName, offset, err := getPrintableDomainStr(data[:end], offset+18)
+	if err != nil {
+		return nil, err
+	}
+
+	r.signerName = signerName
+	r.signature = append([]byte{}, data[offset:end]...)
+
+	return r, nil
+}
+
+// String makes this record printable
+func (r *RDataRRSIG) String() string {
+	return fmt.Sprintf("%s %d %d %d %s %s %d %s %s",
+		RecordTypeString(r.typeCovered), r.algorithm, r.labels, r.originalTTL,
+		formatSigTime(r.expiration), formatSigTime(r.inception), r.keyTag, r.signerName,
+		base64.StdEncoding.EncodeToString(r.signature))
+}
+
+// Encode translates the record into its RDATA. The signer's name is never
+// compressed.
+func (r *RDataRRSIG) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := r.writeFields(&buf); err != nil {
+		return nil, err
+	}
+
+	buf.Write(r.signature)
+
+	return buf.Bytes(), nil
+}
+
+// writeFields writes every field but the signature, which is the part of the
+// RDATA covered by the signature itself
+func (r *RDataRRSIG) writeFields(buf *bytes.Buffer) error {
+	binary.Write(buf, binary.BigEndian, r.typeCovered)
+	buf.WriteByte(uint8(r.algorithm))
+	buf.WriteByte(r.labels)
+	binary.Write(buf, binary.BigEndian, r.originalTTL)
+	binary.Write(buf, binary.BigEndian, r.expiration)
+	binary.Write(buf, binary.BigEndian, r.inception)
+	binary.Write(buf, binary.BigEndian, r.keyTag)
+
+	return writeDomainName(buf, r.signerName, nil)
+}
+
+// TypeCovered returns the type of the RRset which was signed
+func (r *RDataRRSIG) TypeCovered() RecordType {
+	return r.typeCovered
+}
+
+// Algorithm returns the algorithm of the key the RRset was signed with
+func (r *RDataRRSIG) Algorithm() DNSSECAlgorithm {
+	return r.algorithm
+}
+
+// Labels returns the number of labels in the owner name which was signed,
+// which is fewer than the owner name has when it was expanded from a wildcard
+func (r *RDataRRSIG) Labels() uint8 {
+	return r.labels
+}
+
+// OriginalTTL returns the TTL of the RRset when it was signed
+func (r *RDataRRSIG) OriginalTTL() uint32 {
+	return r.originalTTL
+}
+
+// Expiration returns when the signature stops being valid in seconds since
+// the epoch, using serial number arithmetic
+func (r *RDataRRSIG) Expiration() uint32 {
+	return r.expiration
+}
+
+// Inception returns when the signature starts being valid in seconds since
+// the epoch, using serial number arithmetic
+func (r *RDataRRSIG) Inception() uint32 {
+	return r.inception
+}
+
+// KeyTag returns the key tag of the DNSKEY the RRset was signed with
+func (r *RDataRRSIG) KeyTag() uint16 {
+	return r.keyTag
+}
+
+// SignerName returns the name of the zone holding the DNSKEY the RRset was
+// signed with
+func (r *RDataRRSIG) SignerName() string {
+	return r.signerName
+}
+
+// Signature returns the signature in the format of its algorithm
+func (r *RDataRRSIG) Signature() []byte {
+	return r.signature
+}
+
+// formatSigTime presents an RRSIG time as YYYYMMDDHHmmSS in UTC
+func formatSigTime(t uint32) string {
+	return time.Unix(int64(t), 0).UTC().Format(sigTimeFormat)
+}
+
+//-----------------------------------------------------------------------------
+// DS Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataDS represents a DS or CDS record holding the digest of a DNSKEY of a
+// child zone:
+//
+//                          1 1 1 1 1 1 1 1 1 1 2 2 2 2 2 2 2 2 2 2 3 3
+//      0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//     |           Key Tag             |  Algorithm    |  Digest Type  |
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//     /                                                               /
+//     /                            Digest                             /
+//     /                                                               /
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type RDataDS struct {
+	keyTag     uint16
+	algorithm  DNSSECAlgorithm
+	digestType DigestType
+	digest     []byte
+}
+
+// NewRDataDS creates a new RDataDS instance
+func NewRDataDS(data []byte) (*RDataDS, error) {
+	if len(data) < 4 {
+		return nil, errors.New("Error unpacking DS: Overflow")
+	}
+
+	return &RDataDS{
+		keyTag:     binary.BigEndian.Uint16(data),
+		algorithm:  DNSSECAlgorithm(data[2]),
+		digestType: DigestType(data[3]),
+		digest:     append([]byte{}, data[4:]...),
+	}, nil
+}
+
+// String makes this record printable
+func (r *RDataDS) String() string {
+	return fmt.Sprintf("%d %d %d %s", r.keyTag, r.algorithm, r.digestType, strings.ToUpper(hex.EncodeToString(r.digest)))
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataDS) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	binary.Write(&buf, binary.BigEndian, r.keyTag)
+	buf.WriteByte(uint8(r.algorithm))
+	buf.WriteByte(uint8(r.digestType))
+	buf.Write(r.digest)
+
+	return buf.Bytes(), nil
+}
+
+// KeyTag returns the key tag of the DNSKEY the digest was made from
+func (r *RDataDS) KeyTag() uint16 {
+	return r.keyTag
+}
+
+// Algorithm returns the algorithm of the DNSKEY the digest was made from
+func (r *RDataDS) Algorithm() DNSSECAlgorithm {
+	return r.algorithm
+}
+
+// DigestType returns the hash the digest was made with
+func (r *RDataDS) DigestType() DigestType {
+	return r.digestType
+}
+
+// Digest returns the digest of the owner name and RDATA of the DNSKEY
+func (r *RDataDS) Digest() []byte {
+	return r.digest
+}
+
+//-----------------------------------------------------------------------------
+// NSEC Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataNSEC represents an NSEC record, which proves that no names exist
+// between its owner and the next name in the zone and lists the types held by
+// its owner
+type RDataNSEC struct {
+	nextDomain string
+	types      []RecordType
+}
+
+// NewRDataNSEC creates a new RDataNSEC instance from the dataLen octets of
+// RDATA starting at offset
+func NewRDataNSEC(data []byte, offset int, dataLen uint16) (*RDataNSEC, error) {
+	end := offset + int(dataLen)
+
+	nextDomain, offset, err := getPrintableDomainStr(data[:end], offset)
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := decodeTypeBitmap(data[offset:end])
+	if err != nil {
+		return nil, err
+	}
+
+	return &RDataNSEC{nextDomain: nextDomain, types: types}, nil
+}
+
+// String makes this record printable
+func (r *RDataNSEC) String() string {
+	return strings.TrimSpace(r.nextDomain + " " + typeBitmapString(r.types))
+}
+
+// Encode translates the record into its RDATA. The next domain name is never
+// compressed.
+func (r *RDataNSEC) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := writeDomainName(&buf, r.nextDomain, nil); err != nil {
+		return nil, err
+	}
+
+	buf.Write(encodeTypeBitmap(r.types))
+
+	return buf.Bytes(), nil
+}
+
+// NextDomain returns the next owner name in the canonical order of the zone
+func (r *RDataNSEC) NextDomain() string {
+	return r.nextDomain
+}
+
+// Types returns the record types held by the owner of the record
+func (r *RDataNSEC) Types() []RecordType {
+	return r.types
+}
+
+// HasType reports if the owner of the record holds records of type typ
+func (r *RDataNSEC) HasType(typ RecordType) bool {
+	return hasType(r.types, typ)
+}
+
+//-----------------------------------------------------------------------------
+// NSEC3 Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataNSEC3 represents an NSEC3 record, which works as NSEC does but over the
+// hashes of the owner names so the names of the zone cannot be listed:
+//
+//                          1 1 1 1 1 1 1 1 1 1 2 2 2 2 2 2 2 2 2 2 3 3
+//      0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//     |   Hash Alg.   |     Flags     |          Iterations           |
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//     |  Salt Length  |                     Salt                      /
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//     |  Hash Length  |             Next Hashed Owner Name            /
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//     /                         Type Bit Maps                         /
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type RDataNSEC3 struct {
+	hashAlgorithm   uint8
+	flags           uint8
+	iterations      uint16
+	salt            []byte
+	nextHashedOwner []byte
+	types           []RecordType
+}
+
+// NewRDataNSEC3 creates a new RDataNSEC3 instance
+func NewRDataNSEC3(data []byte) (*RDataNSEC3, error) {
+	r := new(RDataNSEC3)
+
+	offset, err := r.decodeParams(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset >= len(data) || offset+1+int(data[offset]) > len(data) {
+		return nil, errors.New("Error unpacking NSEC3: Overflow")
+	}
+
+	hashLen := int(data[offset])
+	r.nextHashedOwner = append([]byte{}, data[offset+1:offset+1+hashLen]...)
+
+	if r.types, err = decodeTypeBitmap(data[offset+1+hashLen:]); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// decodeParams reads the fields shared with NSEC3PARAM, returning the offset
+// just past them
+func (r *RDataNSEC3) decodeParams(data []byte) (int, error) {
+	if len(data) < 5 || 5+int(data[4]) > len(data) {
+		return 0, errors.New("Error unpacking NSEC3: Overflow")
+	}
+
+	r.hashAlgorithm = data[0]
+	r.flags = data[1]
+	r.iterations = binary.BigEndian.Uint16(data[2:])
+	r.salt = append([]byte{}, data[5:5+int(data[4])]...)
+
+	return 5 + int(data[4]), nil
+}
+
+// String makes this record printable
+func (r *RDataNSEC3) String() string {
+	s := fmt.Sprintf("%d %d %d %s %s", r.hashAlgorithm, r.flags, r.iterations, saltString(r.salt), base32Hex.EncodeToString(r.nextHashedOwner))
+
+	if len(r.types) > 0 {
+		s += " " + typeBitmapString(r.types)
+	}
+
+	return s
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataNSEC3) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := r.writeParams(&buf); err != nil {
+		return nil, err
+	}
+
+	if len(r.nextHashedOwner) > 255 {
+		return nil, errors.New("NSEC3 next hashed owner name exceeds 255 octets")
+	}
+
+	buf.WriteByte(uint8(len(r.nextHashedOwner)))
+	buf.Write(r.nextHashedOwner)
+	buf.Write(encodeTypeBitmap(r.types))
+
+	return buf.Bytes(), nil
+}
+
+// writeParams writes the fields shared with NSEC3PARAM
+func (r *RDataNSEC3) writeParams(buf *bytes.Buffer) error {
+	if len(r.salt) > 255 {
+		return errors.New("NSEC3 salt exceeds 255 octets")
+	}
+
+	buf.WriteByte(r.hashAlgorithm)
+	buf.WriteByte(r.flags)
+	binary.Write(buf, binary.BigEndian, r.iterations)
+	buf.WriteByte(uint8(len(r.salt)))
+	buf.Write(r.salt)
+
+	return nil
+}
+
+// HashAlgorithm returns the hash used for the owner names, which is always
+// NSEC3HashSHA1
+func (r *RDataNSEC3) HashAlgorithm() uint8 {
+	return r.hashAlgorithm
+}
+
+// Flags returns the flags of the record such as NSEC3FlagOptOut
+func (r *RDataNSEC3) Flags() uint8 {
+	return r.flags
+}
+
+// OptOut reports if the record may cover unsigned delegations
+func (r *RDataNSEC3) OptOut() bool {
+	return r.flags&NSEC3FlagOptOut != 0
+}
+
+// Iterations returns how many extra times the owner names were hashed
+func (r *RDataNSEC3) Iterations() uint16 {
+	return r.iterations
+}
+
+// Salt returns the salt added to the owner names before hashing
+func (r *RDataNSEC3) Salt() []byte {
+	return r.salt
+}
+
+// NextHashedOwner returns the next hashed owner name in the zone
+func (r *RDataNSEC3) NextHashedOwner() []byte {
+	return r.nextHashedOwner
+}
+
+// Types returns the record types held by the original owner name
+func (r *RDataNSEC3) Types() []RecordType {
+	return r.types
+}
+
+// HasType reports if the original owner name holds records of type typ
+func (r *RDataNSEC3) HasType(typ RecordType) bool {
+	return hasType(r.types, typ)
+}
+
+//-----------------------------------------------------------------------------
+// NSEC3PARAM Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataNSEC3PARAM represents an NSEC3PARAM record, which holds the parameters
+// an authoritative server uses to hash names when answering from its NSEC3
+// records. It shares the first fields of NSEC3.
+type RDataNSEC3PARAM struct {
+	hashAlgorithm uint8
+	flags         uint8
+	iterations    uint16
+	salt          []byte
+}
+
+// NewRDataNSEC3PARAM creates a new RDataNSEC3PARAM instance
+func NewRDataNSEC3PARAM(data []byte) (*RDataNSEC3PARAM, error) {
+	var params RDataNSEC3
+
+	offset, err := params.decodeParams(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset != len(data) {
+		return nil, errors.New("Error unpacking NSEC3PARAM: Overflow")
+	}
+
+	return &RDataNSEC3PARAM{
+		hashAlgorithm: params.hashAlgorithm,
+		flags:         params.flags,
+		iterations:    params.iterations,
+		salt:          params.salt,
+	}, nil
+}
+
+// String makes this record printable
+func (r *RDataNSEC3PARAM) String() string {
+	return fmt.Sprintf("%d %d %d %s", r.hashAlgorithm, r.flags, r.iterations, saltString(r.salt))
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataNSEC3PARAM) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	params := RDataNSEC3{hashAlgorithm: r.hashAlgorithm, flags: r.flags, iterations: r.iterations, salt: r.salt}
+	if err := params.writeParams(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// HashAlgorithm returns the hash used for the owner names
+func (r *RDataNSEC3PARAM) HashAlgorithm() uint8 {
+	return r.hashAlgorithm
+}
+
+// Flags returns the flags of the record, which are always 0 as published
+func (r *RDataNSEC3PARAM) Flags() uint8 {
+	return r.flags
+}
+
+// Iterations returns how many extra times the owner names are hashed
+func (r *RDataNSEC3PARAM) Iterations() uint16 {
+	return r.iterations
+}
+
+// Salt returns the salt added to the owner names before hashing
+func (r *RDataNSEC3PARAM) Salt() []byte {
+	return r.salt
+}
+
+// saltString presents an NSEC3 salt in hex, or as "-" when there is none
+func saltString(salt []byte) string {
+	if len(salt) == 0 {
+		return "-"
+	}
+
+	return strings.ToUpper(hex.EncodeToString(salt))
+}
+
+//-----------------------------------------------------------------------------
+// Type Bit Maps
+//-----------------------------------------------------------------------------
+
+// encodeTypeBitmap translates a list of record types into the windowed bitmap
+// used by NSEC and NSEC3 records. Types are split into windows of 256 by their
+// upper octet and each window present is written as:
+//
+//     +---------------+---------------+-------------------------------+
+//     | Window Number | Bitmap Length |   Bitmap (1 to 32 octets)     /
+//     +---------------+---------------+-------------------------------+
+//
+// where bit n of the bitmap is set when the type with lower octet n is held.
+// Trailing zero octets of a bitmap are left off.
+func encodeTypeBitmap(types []RecordType) []byte {
+	sorted := append([]RecordType{}, types...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var buf bytes.Buffer
+
+	for i := 0; i < len(sorted); {
+		window := uint8(sorted[i] >> 8)
+
+		var bitmap [32]byte
+		length := 0
+
+		for ; i < len(sorted) && uint8(sorted[i]>>8) == window; i++ {
+			low := uint8(sorted[i])
+			bitmap[low/8] |= 0x80 >> (low % 8)
+			length = int(low/8) + 1
+		}
+
+		buf.WriteByte(window)
+		buf.WriteByte(uint8(length))
+		buf.Write(bitmap[:length])
+	}
+
+	return buf.Bytes()
+}
+
+// decodeTypeBitmap reads the record types from the windowed bitmap of an NSEC
+// or NSEC3 record
+func decodeTypeBitmap(data []byte) ([]RecordType, error) {
+	var types []RecordType
+
+	lastWindow := -1
+
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errors.New("Error unpacking type bitmap: Overflow")
+		}
+
+		window, length := int(data[0]), int(data[1])
+
+		if window <= lastWindow || length == 0 || length > 32 || 2+length > len(data) {
+			return nil, errors.New("Error unpacking type bitmap: Invalid window")
+		}
+
+		for i, b := range data[2 : 2+length] {
+			for bit := 0; bit < 8; bit++ {
+				if b&(0x80>>uint(bit)) != 0 {
+					types = append(types, RecordType(window<<8|i*8+bit))
+				}
+			}
+		}
+
+		data = data[2+length:]
+		lastWindow = window
+	}
+
+	return types, nil
+}
+
+// typeBitmapString presents the types of a bitmap separated by spaces
+func typeBitmapString(types []RecordType) string {
+	names := make([]string, len(types))
+
+	for i, typ := range types {
+		names[i] = RecordTypeString(typ)
+	}
+
+	return strings.Join(names, " ")
+}
+
+// hasType reports if typ is one of types
+func hasType(types []RecordType, typ RecordType) bool {
+	for _, t := range types {
+		if t == typ {
+			return true
+		}
+	}
+
+	return false
+}
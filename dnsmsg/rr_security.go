@@ -0,0 +1,253 @@
+package dnsmsg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The RDATA of the records which publish the certificates and keys a domain
+// uses, or the certificate authorities allowed to issue for it. SMIMEA records
+// share the format of TLSA records, see RFC 8162.
+
+//-----------------------------------------------------------------------------
+// CAA Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataCAA represents a CAA record holding a property which restricts the
+// certificate authorities allowed to issue certificates for the domain, see
+// RFC 8659. The value fills the rest of the RDATA.
+type RDataCAA struct {
+	flags uint8
+	tag   string
+	value string
+}
+
+// NewRDataCAA creates a new RDataCAA instance
+func NewRDataCAA(data []byte) (*RDataCAA, error) {
+	if len(data) < 2 || len(data) < 2+int(data[1]) {
+		return nil, errors.New("Error unpacking CAA: Overflow")
+	}
+
+	end := 2 + int(data[1])
+
+	return &RDataCAA{
+		flags: data[0],
+		tag:   string(data[2:end]),
+		value: string(data[end:]),
+	}, nil
+}
+
+// String makes this record printable
+func (r *RDataCAA) String() string {
+	return fmt.Sprintf("%d %s %s", r.flags, r.tag, quoteText(r.value))
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataCAA) Encode() ([]byte, error) {
+	if err := checkCAATag(r.tag); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteByte(r.flags)
+	buf.WriteByte(uint8(len(r.tag)))
+	buf.WriteString(r.tag)
+	buf.WriteString(r.value)
+
+	return buf.Bytes(), nil
+}
+
+// Flags returns the flags of the property, see CAAFlagCritical
+func (r *RDataCAA) Flags() uint8 {
+	return r.flags
+}
+
+// IsCritical reports if a certificate authority which does not understand the
+// property must refuse to issue
+func (r *RDataCAA) IsCritical() bool {
+	return r.flags&CAAFlagCritical != 0
+}
+
+// Tag returns the name of the property such as "issue", "issuewild" or
+// "iodef"
+func (r *RDataCAA) Tag() string {
+	return r.tag
+}
+
+// Value returns the value of the property
+func (r *RDataCAA) Value() string {
+	return r.value
+}
+
+// checkCAATag makes sure a property tag is made of 1 to 15 ASCII letters and
+// digits
+func checkCAATag(tag string) error {
+	if len(tag) == 0 || len(tag) > 15 {
+		return fmt.Errorf("CAA tag '%s' must be 1 to 15 characters", tag)
+	}
+
+	for i := 0; i < len(tag); i++ {
+		c := tag[i]
+		if !isDigit(c) && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return fmt.Errorf("CAA tag '%s' may only hold letters and digits", tag)
+		}
+	}
+
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// TLSA Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataTLSA represents a TLSA or SMIMEA record associating a certificate or
+// public key with the service at its owner, see RFC 6698:
+//
+//                          1 1 1 1 1 1 1 1 1 1 2 2 2 2 2 2 2 2 2 2 3 3
+//      0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//     |  Cert. Usage  |   Selector    | Matching Type |               /
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+               /
+//     /                                                               /
+//     /                 Certificate Association Data                  /
+//     /                                                               /
+//     +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type RDataTLSA struct {
+	usage        uint8
+	selector     uint8
+	matchingType uint8
+	data         []byte
+}
+
+// NewRDataTLSA creates a new RDataTLSA instance
+func NewRDataTLSA(data []byte) (*RDataTLSA, error) {
+	if len(data) < 3 {
+		return nil, errors.New("Error unpacking TLSA: Overflow")
+	}
+
+	return &RDataTLSA{
+		usage:        data[0],
+		selector:     data[1],
+		matchingType: data[2],
+		data:         append([]byte{}, data[3:]...),
+	}, nil
+}
+
+// String makes this record printable
+func (r *RDataTLSA) String() string {
+	return fmt.Sprintf("%d %d %d %s", r.usage, r.selector, r.matchingType, strings.ToUpper(hex.EncodeToString(r.data)))
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataTLSA) Encode() ([]byte, error) {
+	return append([]byte{r.usage, r.selector, r.matchingType}, r.data...), nil
+}
+
+// Usage returns how the certificate is to be checked, such as
+// TLSAUsageDANEEE
+func (r *RDataTLSA) Usage() uint8 {
+	return r.usage
+}
+
+// Selector returns which part of the certificate is matched, either
+// TLSASelectorCert or TLSASelectorSPKI
+func (r *RDataTLSA) Selector() uint8 {
+	return r.selector
+}
+
+// MatchingType returns how the selected part is held, either in full or as a
+// SHA-256 or SHA-512 digest
+func (r *RDataTLSA) MatchingType() uint8 {
+	return r.matchingType
+}
+
+// Data returns the certificate association data
+func (r *RDataTLSA) Data() []byte {
+	return r.data
+}
+
+//-----------------------------------------------------------------------------
+// SSHFP Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataSSHFP represents an SSHFP record holding the fingerprint of an SSH
+// host key, see RFC 4255
+type RDataSSHFP struct {
+	algorithm   uint8
+	fpType      uint8
+	fingerprint []byte
+}
+
+// NewRDataSSHFP creates a new RDataSSHFP instance
+func NewRDataSSHFP(data []byte) (*RDataSSHFP, error) {
+	if len(data) < 2 {
+		return nil, errors.New("Error unpacking SSHFP: Overflow")
+	}
+
+	return &RDataSSHFP{
+		algorithm:   data[0],
+		fpType:      data[1],
+		fingerprint: append([]byte{}, data[2:]...),
+	}, nil
+}
+
+// String makes this record printable
+func (r *RDataSSHFP) String() string {
+	return fmt.Sprintf("%d %d %s", r.algorithm, r.fpType, strings.ToUpper(hex.EncodeToString(r.fingerprint)))
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataSSHFP) Encode() ([]byte, error) {
+	return append([]byte{r.algorithm, r.fpType}, r.fingerprint...), nil
+}
+
+// Algorithm returns the algorithm of the host key, such as
+// SSHFPAlgorithmEd25519
+func (r *RDataSSHFP) Algorithm() uint8 {
+	return r.algorithm
+}
+
+// FingerprintType returns the hash the fingerprint was made with
+func (r *RDataSSHFP) FingerprintType() uint8 {
+	return r.fpType
+}
+
+// Fingerprint returns the digest of the host key
+func (r *RDataSSHFP) Fingerprint() []byte {
+	return r.fingerprint
+}
+
+//-----------------------------------------------------------------------------
+// OPENPGPKEY Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataOPENPGPKEY represents an OPENPGPKEY record holding the OpenPGP public
+// key of the user whose hashed local part owns it, see RFC 7929
+type RDataOPENPGPKEY struct {
+	key []byte
+}
+
+// NewRDataOPENPGPKEY creates a new RDataOPENPGPKEY instance
+func NewRDataOPENPGPKEY(data []byte) (*RDataOPENPGPKEY, error) {
+	return &RDataOPENPGPKEY{key: append([]byte{}, data...)}, nil
+}
+
+// String makes this record printable
+func (r *RDataOPENPGPKEY) String() string {
+	return base64.StdEncoding.EncodeToString(r.key)
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataOPENPGPKEY) Encode() ([]byte, error) {
+	return r.key, nil
+}
+
+// Key returns the transferable public key packets
+func (r *RDataOPENPGPKEY) Key() []byte {
+	return r.key
+}
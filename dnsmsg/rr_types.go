@@ -0,0 +1,993 @@
+package dnsmsg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+)
+
+// ResourceDataField is an interface used to make RData easily readable in an
+// RR and to translate it back into the RDATA octets sent on the wire.
+type ResourceDataField interface {
+	String() string
+	Encode() ([]byte, error)
+}
+
+//-----------------------------------------------------------------------------
+// UNKNOWN Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataUnknown holds the RDATA of a record type which is not decoded, such as
+// an obsolete type or one without a mnemonic. It is shown and parsed in the
+// generic '\# <length> <hex>' form of RFC 3597 so nothing is lost.
+type RDataUnknown struct {
+	qType RecordType
+	data  []byte
+}
+
+// NewRDataUnknown creates a new RDataUnknown instance
+func NewRDataUnknown(typ RecordType, data []byte) (*RDataUnknown, error) {
+	return &RDataUnknown{
+		qType: typ,
+		data:  append([]byte(nil), data...),
+	}, nil
+}
+
+// String makes this record printable in the generic form
+func (r *RDataUnknown) String() string {
+	if len(r.data) == 0 {
+		return `\# 0`
+	}
+
+	return fmt.Sprintf(`\# %d %X`, len(r.data), r.data)
+}
+
+// Encode returns the RDATA octets as they were received
+func (r *RDataUnknown) Encode() ([]byte, error) {
+	return append([]byte(nil), r.data...), nil
+}
+
+// Type returns the RecordType which was not decoded
+func (r *RDataUnknown) Type() RecordType {
+	return r.qType
+}
+
+// Data returns the RDATA octets
+func (r *RDataUnknown) Data() []byte {
+	return r.data
+}
+
+//-----------------------------------------------------------------------------
+// Empty RDATA
+//-----------------------------------------------------------------------------
+
+// RDataEmpty represents a record without any RDATA. UPDATE messages use these
+// to refer to a whole RRset or every record owned by a name, see RFC 2136
+// section 2.4.
+type RDataEmpty struct{}
+
+// String makes this record printable in the generic form of RFC 3597 so it
+// can be read back
+func (r *RDataEmpty) String() string {
+	return `\# 0`
+}
+
+// Encode translates the record into its empty RDATA
+func (r *RDataEmpty) Encode() ([]byte, error) {
+	return nil, nil
+}
+
+//-----------------------------------------------------------------------------
+// A Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataA represents an A Record
+type RDataA struct {
+	ipAddr net.IP
+}
+
+// NewRDataA creates a new RDataA instance
+func NewRDataA(data []byte) (*RDataA, error) {
+	if len(data) != net.IPv4len {
+		return nil, errors.New("Error unpacking A: Invalid length")
+	}
+
+	return &RDataA{
+		ipAddr: net.IPv4(data[0], data[1], data[2], data[3]),
+	}, nil
+}
+
+// String makes this record printable
+func (r *RDataA) String() string {
+	return r.ipAddr.String()
+}
+
+// Encode translates the record into its 4 octet RDATA
+func (r *RDataA) Encode() ([]byte, error) {
+	ip := r.ipAddr.To4()
+
+	if ip == nil {
+		return nil, fmt.Errorf("Invalid IPv4 address for A record: %s", r.ipAddr)
+	}
+
+	return []byte(ip), nil
+}
+
+// IP returns the IPv4 address held by the record
+func (r *RDataA) IP() net.IP {
+	return r.ipAddr
+}
+
+//-----------------------------------------------------------------------------
+// AAAA Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataAAAA represents an A Record
+type RDataAAAA struct {
+	ipAddr net.IP
+}
+
+// NewRDataAAAA creates a new RDataAAAA instance
+func NewRDataAAAA(data []byte) (*RDataAAAA, error) {
+	if len(data) != net.IPv6len {
+		return nil, errors.New("Error unpacking AAAA: Invalid length")
+	}
+
+	return &RDataAAAA{
+		ipAddr: append(make(net.IP, 0, net.IPv6len), data...),
+	}, nil
+}
+
+// String makes this record printable
+func (r *RDataAAAA) String() string {
+	return r.ipAddr.String()
+}
+
+// Encode translates the record into its 16 octet RDATA
+func (r *RDataAAAA) Encode() ([]byte, error) {
+	ip := r.ipAddr.To16()
+
+	if ip == nil {
+		return nil, fmt.Errorf("Invalid IPv6 address for AAAA record: %s", r.ipAddr)
+	}
+
+	return []byte(ip), nil
+}
+
+// IP returns the IPv6 address held by the record
+func (r *RDataAAAA) IP() net.IP {
+	return r.ipAddr
+}
+
+//-----------------------------------------------------------------------------
+// CNAME Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataCNAME represents an A Record
+type RDataCNAME struct {
+	domain string
+}
+
+// NewRDataCNAME creates a new RDataCNAME instance
+func NewRDataCNAME(data []byte, offset int) (*RDataCNAME, error) {
+	domain, _, err := getPrintableDomainStr(data, offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &RDataCNAME{domain: domain}, nil
+}
+
+// String makes this record printable
+func (r *RDataCNAME) String() string {
+	return r.domain
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataCNAME) Encode() ([]byte, error) {
+	return encodeDomainName(r.domain)
+}
+
+func (r *RDataCNAME) encodeTo(buf *bytes.Buffer, compression compressionMap) error {
+	return writeDomainName(buf, r.domain, compression)
+}
+
+func (r *RDataCNAME) stringRelativeTo(origin string) string {
+	return relativeName(r.domain, origin)
+}
+
+// Domain returns the domain name the record points to
+func (r *RDataCNAME) Domain() string {
+	return r.domain
+}
+
+//-----------------------------------------------------------------------------
+// NS Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataNS represents an A Record
+type RDataNS struct {
+	domain string
+}
+
+// NewRDataNS creates a new RDataNS instance
+func NewRDataNS(data []byte, offset int) (*RDataNS, error) {
+	domain, _, err := getPrintableDomainStr(data, offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &RDataNS{domain: domain}, nil
+}
+
+// String makes this record printable
+func (r *RDataNS) String() string {
+	return r.domain
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataNS) Encode() ([]byte, error) {
+	return encodeDomainName(r.domain)
+}
+
+func (r *RDataNS) encodeTo(buf *bytes.Buffer, compression compressionMap) error {
+	return writeDomainName(buf, r.domain, compression)
+}
+
+func (r *RDataNS) stringRelativeTo(origin string) string {
+	return relativeName(r.domain, origin)
+}
+
+// Domain returns the domain name the record points to
+func (r *RDataNS) Domain() string {
+	return r.domain
+}
+
+//-----------------------------------------------------------------------------
+// TXT Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataTXT represents a TXT record holding one or more <character-string>
+// values
+type RDataTXT struct {
+	txt []string
+}
+
+// NewRDataTXT creates a new RDataTXT instance
+func NewRDataTXT(data []byte) (*RDataTXT, error) {
+	r := new(RDataTXT)
+
+	for offset := 0; offset < len(data); {
+		var txt string
+		var err error
+
+		if txt, offset, err = decodeCharacterString(data, offset); err != nil {
+			return nil, err
+		}
+
+		r.txt = append(r.txt, txt)
+	}
+
+	return r, nil
+}
+
+// String makes this record printable with each string quoted
+func (r *RDataTXT) String() string {
+	quoted := make([]string, len(r.txt))
+	for i, txt := range r.txt {
+		quoted[i] = quoteText(txt)
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataTXT) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, txt := range r.txt {
+		if err := encodeCharacterString(&buf, txt); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Strings returns each of the strings held by the record
+func (r *RDataTXT) Strings() []string {
+	return r.txt
+}
+
+// Text returns the strings held by the record joined together, which is how
+// SPF, DKIM and DMARC records split across several strings are read
+func (r *RDataTXT) Text() string {
+	return strings.Join(r.txt, "")
+}
+
+//-----------------------------------------------------------------------------
+// SOA Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataSOA represents an A Record
+type RDataSOA struct {
+	mname   string
+	rname   string
+	serial  uint32
+	refresh uint32
+	retry   uint32
+	expire  uint32
+	minimum uint32
+}
+
+// NewRDataSOA creates a new RDataSOA instance
+func NewRDataSOA(data []byte, offset int) (*RDataSOA, error) {
+	mname, offset, err := getPrintableDomainStr(data, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	rname, offset, err := getPrintableDomainStr(data, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, offset, err := decodeUint32(data, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, offset, err := decodeUint32(data, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	retry, offset, err := decodeUint32(data, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	expire, offset, err := decodeUint32(data, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	minimum, offset, err := decodeUint32(data, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RDataSOA{
+		mname:   mname,
+		rname:   rname,
+		serial:  serial,
+		refresh: refresh,
+		retry:   retry,
+		expire:  expire,
+		minimum: minimum,
+	}, nil
+}
+
+// String makes this record printable
+func (r *RDataSOA) String() string {
+	return fmt.Sprintf("%s %s %d %d %d %d %d", r.mname, r.rname, r.serial, r.refresh, r.retry, r.expire, r.minimum)
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataSOA) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	err := r.encodeTo(&buf, nil)
+
+	return buf.Bytes(), err
+}
+
+func (r *RDataSOA) encodeTo(buf *bytes.Buffer, compression compressionMap) error {
+	if err := writeDomainName(buf, r.mname, compression); err != nil {
+		return err
+	}
+
+	if err := writeDomainName(buf, r.rname, compression); err != nil {
+		return err
+	}
+
+	binary.Write(buf, binary.BigEndian, r.serial)
+	binary.Write(buf, binary.BigEndian, r.refresh)
+	binary.Write(buf, binary.BigEndian, r.retry)
+	binary.Write(buf, binary.BigEndian, r.expire)
+	binary.Write(buf, binary.BigEndian, r.minimum)
+
+	return nil
+}
+
+func (r *RDataSOA) stringRelativeTo(origin string) string {
+	mname := relativeName(r.mname, origin)
+	rname := relativeName(r.rname, origin)
+
+	return fmt.Sprintf("%s %s %d %d %d %d %d", mname, rname, r.serial, r.refresh, r.retry, r.expire, r.minimum)
+}
+
+// MName returns the domain name of the primary name server for the zone
+func (r *RDataSOA) MName() string {
+	return r.mname
+}
+
+// RName returns the mailbox of the person responsible for the zone
+func (r *RDataSOA) RName() string {
+	return r.rname
+}
+
+// Serial returns the version number of the original copy of the zone
+func (r *RDataSOA) Serial() uint32 {
+	return r.serial
+}
+
+// Refresh returns the interval before the zone should be refreshed
+func (r *RDataSOA) Refresh() uint32 {
+	return r.refresh
+}
+
+// Retry returns the interval before a failed refresh should be retried
+func (r *RDataSOA) Retry() uint32 {
+	return r.retry
+}
+
+// Expire returns the upper limit before the zone is no longer authoritative
+func (r *RDataSOA) Expire() uint32 {
+	return r.expire
+}
+
+// Minimum returns the minimum TTL to be exported with any RR from the zone
+func (r *RDataSOA) Minimum() uint32 {
+	return r.minimum
+}
+
+//-----------------------------------------------------------------------------
+// MX Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataMX represents an A Record
+type RDataMX struct {
+	preference uint16
+	exchange   string
+}
+
+// NewRDataMX creates a new RDataMX instance
+func NewRDataMX(data []byte, offset int) (*RDataMX, error) {
+	preference, offset, err := decodeUint16(data, offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	exchange, _, err := getPrintableDomainStr(data, offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &RDataMX{
+		preference: preference,
+		exchange:   exchange,
+	}, nil
+}
+
+// String makes this record printable
+func (r *RDataMX) String() string {
+	return fmt.Sprintf("%d %s", r.preference, r.exchange)
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataMX) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	err := r.encodeTo(&buf, nil)
+
+	return buf.Bytes(), err
+}
+
+func (r *RDataMX) encodeTo(buf *bytes.Buffer, compression compressionMap) error {
+	binary.Write(buf, binary.BigEndian, r.preference)
+
+	return writeDomainName(buf, r.exchange, compression)
+}
+
+func (r *RDataMX) stringRelativeTo(origin string) string {
+	return fmt.Sprintf("%d %s", r.preference, relativeName(r.exchange, origin))
+}
+
+// Preference returns the preference given to this RR among others at the same owner
+func (r *RDataMX) Preference() uint16 {
+	return r.preference
+}
+
+// Exchange returns the domain name of the host acting as a mail exchange
+func (r *RDataMX) Exchange() string {
+	return r.exchange
+}
+
+//-----------------------------------------------------------------------------
+// PTR Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataPTR represents an A Record
+type RDataPTR struct {
+	domain string
+}
+
+// NewRDataPTR creates a new RDataPTR instance
+func NewRDataPTR(data []byte, offset int) (*RDataPTR, error) {
+	domain, _, err := getPrintableDomainStr(data, offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &RDataPTR{domain: domain}, nil
+}
+
+// String makes this record printable
+func (r *RDataPTR) String() string {
+	return r.domain
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataPTR) Encode() ([]byte, error) {
+	return encodeDomainName(r.domain)
+}
+
+func (r *RDataPTR) encodeTo(buf *bytes.Buffer, compression compressionMap) error {
+	return writeDomainName(buf, r.domain, compression)
+}
+
+func (r *RDataPTR) stringRelativeTo(origin string) string {
+	return relativeName(r.domain, origin)
+}
+
+// Domain returns the domain name the record points to
+func (r *RDataPTR) Domain() string {
+	return r.domain
+}
+
+//-----------------------------------------------------------------------------
+// SRV Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataSRV represents an SRV record locating the servers for a service, see
+// RFC 2782. The target is never compressed.
+type RDataSRV struct {
+	priority uint16
+	weight   uint16
+	port     uint16
+	target   string
+}
+
+// NewRDataSRV creates a new RDataSRV instance
+func NewRDataSRV(data []byte, offset int) (*RDataSRV, error) {
+	var fields [3]uint16
+	var err error
+
+	for i := range fields {
+		if fields[i], offset, err = decodeUint16(data, offset); err != nil {
+			return nil, err
+		}
+	}
+
+	target, _, err := getPrintableDomainStr(data, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RDataSRV{
+		priority: fields[0],
+		weight:   fields[1],
+		port:     fields[2],
+		target:   target,
+	}, nil
+}
+
+// String makes this record printable
+func (r *RDataSRV) String() string {
+	return fmt.Sprintf("%d %d %d %s", r.priority, r.weight, r.port, r.target)
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataSRV) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	binary.Write(&buf, binary.BigEndian, r.priority)
+	binary.Write(&buf, binary.BigEndian, r.weight)
+	binary.Write(&buf, binary.BigEndian, r.port)
+
+	err := writeDomainName(&buf, r.target, nil)
+
+	return buf.Bytes(), err
+}
+
+func (r *RDataSRV) stringRelativeTo(origin string) string {
+	return fmt.Sprintf("%d %d %d %s", r.priority, r.weight, r.port, relativeName(r.target, origin))
+}
+
+// Priority returns the priority of the target, lower values being tried first
+func (r *RDataSRV) Priority() uint16 {
+	return r.priority
+}
+
+// Weight returns the relative weight for picking among targets of the same
+// priority
+func (r *RDataSRV) Weight() uint16 {
+	return r.weight
+}
+
+// Port returns the port the service listens on at the target
+func (r *RDataSRV) Port() uint16 {
+	return r.port
+}
+
+// Target returns the domain name of the host providing the service. A target
+// of "." means the service is not available at this domain.
+func (r *RDataSRV) Target() string {
+	return r.target
+}
+
+//-----------------------------------------------------------------------------
+// NAPTR Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataNAPTR represents a NAPTR record holding a rule of the Dynamic
+// Delegation Discovery System, see RFC 3403. The replacement is never
+// compressed.
+type RDataNAPTR struct {
+	order       uint16
+	preference  uint16
+	flags       string
+	service     string
+	regexp      string
+	replacement string
+}
+
+// NewRDataNAPTR creates a new RDataNAPTR instance
+func NewRDataNAPTR(data []byte, offset int, dataLen uint16) (*RDataNAPTR, error) {
+	end := offset + int(dataLen)
+	if end > len(data) {
+		return nil, errors.New("Error unpacking NAPTR: Overflow")
+	}
+
+	r := new(RDataNAPTR)
+	var err error
+
+	if r.order, offset, err = decodeUint16(data[:end], offset); err != nil {
+		return nil, err
+	}
+
+	if r.preference, offset, err = decodeUint16(data[:end], offset); err != nil {
+		return nil, err
+	}
+
+	for _, field := range []*string{&r.flags, &r.service, &r.regexp} {
+		if *field, offset, err = decodeCharacterString(data[:end], offset); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.replacement, _, err = getPrintableDomainStr(data[:end], offset); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// String makes this record printable
+func (r *RDataNAPTR) String() string {
+	return r.stringRelativeTo("")
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataNAPTR) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	binary.Write(&buf, binary.BigEndian, r.order)
+	binary.Write(&buf, binary.BigEndian, r.preference)
+
+	for _, field := range []string{r.flags, r.service, r.regexp} {
+		if err := encodeCharacterString(&buf, field); err != nil {
+			return nil, err
+		}
+	}
+
+	err := writeDomainName(&buf, r.replacement, nil)
+
+	return buf.Bytes(), err
+}
+
+func (r *RDataNAPTR) stringRelativeTo(origin string) string {
+	return fmt.Sprintf("%d %d %s %s %s %s", r.order, r.preference, quoteText(r.flags), quoteText(r.service),
+		quoteText(r.regexp), relativeName(r.replacement, origin))
+}
+
+// Order returns the order the rule is processed in, lower values first
+func (r *RDataNAPTR) Order() uint16 {
+	return r.order
+}
+
+// Preference returns the preference among rules of the same order, lower
+// values being preferred
+func (r *RDataNAPTR) Preference() uint16 {
+	return r.preference
+}
+
+// Flags returns the flags controlling the rewriting, such as "U" when the
+// result is a URI or "S" when it is a domain name to look up SRV records for
+func (r *RDataNAPTR) Flags() string {
+	return r.flags
+}
+
+// Service returns the service parameters available down this rewrite path
+func (r *RDataNAPTR) Service() string {
+	return r.service
+}
+
+// Regexp returns the substitution expression applied to the original string
+func (r *RDataNAPTR) Regexp() string {
+	return r.regexp
+}
+
+// Replacement returns the next domain name to query when the rule has no
+// substitution expression
+func (r *RDataNAPTR) Replacement() string {
+	return r.replacement
+}
+
+//-----------------------------------------------------------------------------
+// URI Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataURI represents a URI record mapping a service name to a URI, see RFC
+// 7553. The target fills the rest of the RDATA rather than being a
+// <character-string>.
+type RDataURI struct {
+	priority uint16
+	weight   uint16
+	target   string
+}
+
+// NewRDataURI creates a new RDataURI instance
+func NewRDataURI(data []byte) (*RDataURI, error) {
+	if len(data) < 4 {
+		return nil, errors.New("Error unpacking URI: Overflow")
+	}
+
+	return &RDataURI{
+		priority: binary.BigEndian.Uint16(data),
+		weight:   binary.BigEndian.Uint16(data[2:]),
+		target:   string(data[4:]),
+	}, nil
+}
+
+// String makes this record printable
+func (r *RDataURI) String() string {
+	return fmt.Sprintf("%d %d %s", r.priority, r.weight, quoteText(r.target))
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataURI) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	binary.Write(&buf, binary.BigEndian, r.priority)
+	binary.Write(&buf, binary.BigEndian, r.weight)
+	buf.WriteString(r.target)
+
+	return buf.Bytes(), nil
+}
+
+// Priority returns the priority of the target, lower values being tried first
+func (r *RDataURI) Priority() uint16 {
+	return r.priority
+}
+
+// Weight returns the relative weight for picking among targets of the same
+// priority
+func (r *RDataURI) Weight() uint16 {
+	return r.weight
+}
+
+// Target returns the URI of the service
+func (r *RDataURI) Target() string {
+	return r.target
+}
+
+//-----------------------------------------------------------------------------
+// OPT Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataOPT represents the options of an OPT pseudo-record. See EDNS for the
+// fields held outside of the RDATA.
+type RDataOPT struct {
+	options []EDNSOption
+}
+
+// NewRDataOPT creates a new RDataOPT instance
+func NewRDataOPT(data []byte) (*RDataOPT, error) {
+	options, err := decodeEDNSOptions(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &RDataOPT{options: options}, nil
+}
+
+// String makes this record printable
+func (r *RDataOPT) String() string {
+	options := make([]string, len(r.options))
+
+	for i, option := range r.options {
+		options[i] = option.String()
+	}
+
+	return strings.Join(options, "; ")
+}
+
+// Options returns the EDNS options held by the record
+func (r *RDataOPT) Options() []EDNSOption {
+	return r.options
+}
+
+// Encode translates the record into its RDATA
+func (r *RDataOPT) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, option := range r.options {
+		if len(option.Data) > math.MaxUint16 {
+			return nil, fmt.Errorf("EDNS option %d exceeds the maximum length", option.Code)
+		}
+
+		binary.Write(&buf, binary.BigEndian, option.Code)
+		binary.Write(&buf, binary.BigEndian, uint16(len(option.Data)))
+		buf.Write(option.Data)
+	}
+
+	return buf.Bytes(), nil
+}
+
+//-----------------------------------------------------------------------------
+// TSIG Record RDATA
+//-----------------------------------------------------------------------------
+
+// RDataTSIG represents the signature carried by a TSIG record at the end of a
+// message. See RFC 8945 section 4.2
+type RDataTSIG struct {
+	algorithm  string
+	timeSigned uint64
+	fudge      uint16
+	mac        []byte
+	originalID uint16
+	error      ResponseCode
+	otherData  []byte
+}
+
+// NewRDataTSIG creates a new RDataTSIG instance from the dataLen octets of
+// RDATA starting at offset
+func NewRDataTSIG(data []byte, offset int, dataLen uint16) (*RDataTSIG, error) {
+	end := offset + int(dataLen)
+
+	algorithm, offset, err := getPrintableDomainStr(data[:end], offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset+10 > end {
+		return nil, errors.New("Error unpacking TSIG: Overflow")
+	}
+
+	r := &RDataTSIG{algorithm: algorithm}
+
+	// The time signed is a 48 bit number of seconds since the epoch
+	r.timeSigned = uint64(binary.BigEndian.Uint16(data[offset:]))<<32 | uint64(binary.BigEndian.Uint32(data[offset+2:]))
+	r.fudge = binary.BigEndian.Uint16(data[offset+6:])
+	macSize := int(binary.BigEndian.Uint16(data[offset+8:]))
+	offset += 10
+
+	if offset+macSize+6 > end {
+		return nil, errors.New("Error unpacking TSIG: Overflow")
+	}
+
+	r.mac = append([]byte{}, data[offset:offset+macSize]...)
+	offset += macSize
+
+	r.originalID = binary.BigEndian.Uint16(data[offset:])
+	r.error = ResponseCode(binary.BigEndian.Uint16(data[offset+2:]))
+	otherLen := int(binary.BigEndian.Uint16(data[offset+4:]))
+	offset += 6
+
+	if offset+otherLen != end {
+		return nil, errors.New("Error unpacking TSIG: Overflow")
+	}
+
+	r.otherData = append([]byte{}, data[offset:end]...)
+
+	return r, nil
+}
+
+// String makes this record printable
+func (r *RDataTSIG) String() string {
+	s := fmt.Sprintf("%s %d %d %d %s %d %s %d",
+		r.algorithm, r.timeSigned, r.fudge, len(r.mac), base64.StdEncoding.EncodeToString(r.mac),
+		r.originalID, tsigErrorStr(r.error), len(r.otherData))
+
+	if len(r.otherData) > 0 {
+		s += " " + base64.StdEncoding.EncodeToString(r.otherData)
+	}
+
+	return s
+}
+
+// Encode translates the record into its RDATA. The algorithm name is never
+// compressed.
+func (r *RDataTSIG) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := writeDomainName(&buf, r.algorithm, nil); err != nil {
+		return nil, err
+	}
+
+	if len(r.mac) > math.MaxUint16 || len(r.otherData) > math.MaxUint16 {
+		return nil, errors.New("TSIG MAC or other data exceeds the maximum length")
+	}
+
+	binary.Write(&buf, binary.BigEndian, uint16(r.timeSigned>>32))
+	binary.Write(&buf, binary.BigEndian, uint32(r.timeSigned))
+	binary.Write(&buf, binary.BigEndian, r.fudge)
+	binary.Write(&buf, binary.BigEndian, uint16(len(r.mac)))
+	buf.Write(r.mac)
+	binary.Write(&buf, binary.BigEndian, r.originalID)
+	binary.Write(&buf, binary.BigEndian, r.error)
+	binary.Write(&buf, binary.BigEndian, uint16(len(r.otherData)))
+	buf.Write(r.otherData)
+
+	return buf.Bytes(), nil
+}
+
+// Algorithm returns the name of the algorithm the MAC was computed with
+func (r *RDataTSIG) Algorithm() string {
+	return r.algorithm
+}
+
+// TimeSigned returns when the message was signed in seconds since the epoch
+func (r *RDataTSIG) TimeSigned() uint64 {
+	return r.timeSigned
+}
+
+// Fudge returns how many seconds the time signed may differ from the clock of
+// the receiver
+func (r *RDataTSIG) Fudge() uint16 {
+	return r.fudge
+}
+
+// MAC returns the message authentication code
+func (r *RDataTSIG) MAC() []byte {
+	return r.mac
+}
+
+// OriginalID returns the ID of the message when it was signed
+func (r *RDataTSIG) OriginalID() uint16 {
+	return r.originalID
+}
+
+// Error returns the TSIG error reported by the server
+func (r *RDataTSIG) Error() ResponseCode {
+	return r.error
+}
+
+// OtherData returns the other data, which holds the time of the server when
+// the error is BADTIME
+func (r *RDataTSIG) OtherData() []byte {
+	return r.otherData
+}
@@ -0,0 +1,397 @@
+package dnsmsg
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Checks of certificates and SSH host keys against the TLSA and SSHFP records
+// published for them, and of the certificate authorities CAA records allow.
+
+//-----------------------------------------------------------------------------
+// TLSA Checks
+//-----------------------------------------------------------------------------
+
+// LoadCertificates reads the certificates in a PEM file, or a single DER
+// encoded certificate. A chain should start with the end entity certificate.
+func LoadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+
+	for rest := data; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid certificate in %s: %v", path, err)
+		}
+
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		if certs, err = x509.ParseCertificates(data); err != nil || len(certs) == 0 {
+			return nil, fmt.Errorf("No certificates found in %s", path)
+		}
+	}
+
+	return certs, nil
+}
+
+// TLSAAssociationData returns the data a TLSA record with the given selector
+// and matching type holds for cert
+func TLSAAssociationData(cert *x509.Certificate, selector, matchingType uint8) ([]byte, error) {
+	var selected []byte
+
+	switch selector {
+	case TLSASelectorCert:
+		selected = cert.Raw
+	case TLSASelectorSPKI:
+		selected = cert.RawSubjectPublicKeyInfo
+	default:
+		return nil, fmt.Errorf("Unknown TLSA selector %d", selector)
+	}
+
+	switch matchingType {
+	case TLSAMatchingFull:
+		return selected, nil
+	case TLSAMatchingSHA256:
+		sum := sha256.Sum256(selected)
+		return sum[:], nil
+	case TLSAMatchingSHA512:
+		sum := sha512.Sum512(selected)
+		return sum[:], nil
+	}
+
+	return nil, fmt.Errorf("Unknown TLSA matching type %d", matchingType)
+}
+
+// NewTLSA creates the TLSA record associating cert with a service
+func NewTLSA(cert *x509.Certificate, usage, selector, matchingType uint8) (*RDataTLSA, error) {
+	data, err := TLSAAssociationData(cert, selector, matchingType)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RDataTLSA{usage: usage, selector: selector, matchingType: matchingType, data: data}, nil
+}
+
+// Matches reports if the record holds the association data of cert
+func (r *RDataTLSA) Matches(cert *x509.Certificate) bool {
+	data, err := TLSAAssociationData(cert, r.selector, r.matchingType)
+
+	return err == nil && bytes.Equal(data, r.data)
+}
+
+// VerifyCertificate checks a certificate chain, starting with the end entity
+// certificate, against the record as described in RFC 6698 section 2.1.1. The
+// PKIX usages also need the chain to be valid up to one of roots, or the
+// system roots when roots is nil. Names in the certificate are not checked.
+func (r *RDataTLSA) VerifyCertificate(chain []*x509.Certificate, roots *x509.CertPool) error {
+	if len(chain) == 0 {
+		return errors.New("No certificates to verify")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	opts := x509.VerifyOptions{
+		Intermediates: intermediates,
+		Roots:         roots,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+
+	switch r.usage {
+	case TLSAUsageDANEEE:
+		if !r.Matches(chain[0]) {
+			return errors.New("The end entity certificate does not match")
+		}
+
+		return nil
+
+	case TLSAUsagePKIXEE:
+		if !r.Matches(chain[0]) {
+			return errors.New("The end entity certificate does not match")
+		}
+
+		if _, err := chain[0].Verify(opts); err != nil {
+			return fmt.Errorf("The certificate failed PKIX validation: %v", err)
+		}
+
+		return nil
+
+	case TLSAUsageDANETA:
+		// The trust anchor is one of the certificates given and stands in
+		// for the system roots
+		for _, cert := range chain[1:] {
+			if !r.Matches(cert) {
+				continue
+			}
+
+			opts.Roots = x509.NewCertPool()
+			opts.Roots.AddCert(cert)
+
+			if _, err := chain[0].Verify(opts); err != nil {
+				return fmt.Errorf("The certificate does not chain to the matching trust anchor: %v", err)
+			}
+
+			return nil
+		}
+
+		return errors.New("No certificate in the chain matches the trust anchor")
+
+	case TLSAUsagePKIXTA:
+		chains, err := chain[0].Verify(opts)
+		if err != nil {
+			return fmt.Errorf("The certificate failed PKIX validation: %v", err)
+		}
+
+		for _, verified := range chains {
+			for _, cert := range verified[1:] {
+				if r.Matches(cert) {
+					return nil
+				}
+			}
+		}
+
+		return errors.New("No certificate authority in the validated chain matches")
+	}
+
+	return fmt.Errorf("Unknown TLSA certificate usage %d", r.usage)
+}
+
+//-----------------------------------------------------------------------------
+// SSHFP Checks
+//-----------------------------------------------------------------------------
+
+// sshKeyAlgorithms maps the names SSH gives host key types to the algorithms
+// of SSHFP records
+var sshKeyAlgorithms = map[string]uint8{
+	"ssh-rsa":             SSHFPAlgorithmRSA,
+	"ssh-dss":             SSHFPAlgorithmDSA,
+	"ecdsa-sha2-nistp256": SSHFPAlgorithmECDSA,
+	"ecdsa-sha2-nistp384": SSHFPAlgorithmECDSA,
+	"ecdsa-sha2-nistp521": SSHFPAlgorithmECDSA,
+	"ssh-ed25519":         SSHFPAlgorithmEd25519,
+	"ssh-ed448":           SSHFPAlgorithmEd448,
+}
+
+// SSHHostKey is a public host key in the wire format SSH sends it in
+type SSHHostKey struct {
+	keyType string
+	blob    []byte
+}
+
+// ParseSSHHostKey reads a public key as written in a .pub file,
+// 'type base64 [comment]', or in a known_hosts line with the host names
+// first
+func ParseSSHHostKey(line string) (*SSHHostKey, error) {
+	fields := strings.Fields(line)
+
+	for i := 0; i+1 < len(fields); i++ {
+		if _, ok := sshKeyAlgorithms[fields[i]]; !ok {
+			continue
+		}
+
+		blob, err := base64.StdEncoding.DecodeString(fields[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid SSH public key: %v", err)
+		}
+
+		// The key starts with its type as a length prefixed string
+		if len(blob) < 4 || binary.BigEndian.Uint32(blob) > uint32(len(blob)-4) {
+			return nil, errors.New("Error unpacking SSH public key: Overflow")
+		}
+
+		if string(blob[4:4+binary.BigEndian.Uint32(blob)]) != fields[i] {
+			return nil, fmt.Errorf("SSH public key does not hold a %s key", fields[i])
+		}
+
+		return &SSHHostKey{keyType: fields[i], blob: blob}, nil
+	}
+
+	return nil, fmt.Errorf("No SSH public key found in '%s'", line)
+}
+
+// LoadSSHHostKeys reads the public keys in a .pub or known_hosts file,
+// skipping blank lines and comments
+func LoadSSHHostKeys(path string) ([]*SSHHostKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var keys []*SSHHostKey
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, err := ParseSSHHostKey(line)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("No SSH public keys found in %s", path)
+	}
+
+	return keys, nil
+}
+
+// Type returns the name SSH gives the type of key, such as "ssh-ed25519"
+func (k *SSHHostKey) Type() string {
+	return k.keyType
+}
+
+// Algorithm returns the SSHFP algorithm of the key
+func (k *SSHHostKey) Algorithm() uint8 {
+	return sshKeyAlgorithms[k.keyType]
+}
+
+// Fingerprint returns the digest of the key made with the hash of an SSHFP
+// fingerprint type
+func (k *SSHHostKey) Fingerprint(fpType uint8) ([]byte, error) {
+	switch fpType {
+	case SSHFPTypeSHA1:
+		sum := sha1.Sum(k.blob)
+		return sum[:], nil
+	case SSHFPTypeSHA256:
+		sum := sha256.Sum256(k.blob)
+		return sum[:], nil
+	}
+
+	return nil, fmt.Errorf("Unknown SSHFP fingerprint type %d", fpType)
+}
+
+// SSHFP creates the SSHFP record publishing the fingerprint of the key
+func (k *SSHHostKey) SSHFP(fpType uint8) (*RDataSSHFP, error) {
+	fingerprint, err := k.Fingerprint(fpType)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RDataSSHFP{algorithm: k.Algorithm(), fpType: fpType, fingerprint: fingerprint}, nil
+}
+
+// Matches reports if the record holds the fingerprint of key
+func (r *RDataSSHFP) Matches(key *SSHHostKey) bool {
+	if r.algorithm != key.Algorithm() {
+		return false
+	}
+
+	fingerprint, err := key.Fingerprint(r.fpType)
+
+	return err == nil && bytes.Equal(fingerprint, r.fingerprint)
+}
+
+//-----------------------------------------------------------------------------
+// CAA Checks
+//-----------------------------------------------------------------------------
+
+// knownCAATags are the properties a certificate authority is expected to
+// understand. An unknown property marked critical forbids issuance.
+var knownCAATags = map[string]bool{
+	"issue":        true,
+	"issuewild":    true,
+	"iodef":        true,
+	"issuemail":    true,
+	"contactemail": true,
+	"contactphone": true,
+}
+
+// CAAIssuer returns the domain of the certificate authority an issue or
+// issuewild property names, dropping any parameters after a semicolon. An
+// empty string means no certificate authority may issue.
+func (r *RDataCAA) CAAIssuer() string {
+	issuer := r.value
+	if i := strings.Index(issuer, ";"); i >= 0 {
+		issuer = issuer[:i]
+	}
+
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(issuer), "."))
+}
+
+// CAAPermits reports if the CAA records found for a domain allow the
+// certificate authority identified by issuer to issue a certificate for it,
+// along with the reason, see RFC 8659 section 4. Wildcard certificates are
+// governed by the issuewild properties when there are any.
+func CAAPermits(records []*RDataCAA, issuer string, wildcard bool) (bool, string) {
+	issuer = strings.ToLower(strings.TrimSuffix(issuer, "."))
+
+	if len(records) == 0 {
+		return true, "No CAA records restrict issuance"
+	}
+
+	var issue, issueWild []*RDataCAA
+
+	for _, r := range records {
+		tag := strings.ToLower(r.tag)
+
+		if r.IsCritical() && !knownCAATags[tag] {
+			return false, fmt.Sprintf("The critical property '%s' is not understood", r.tag)
+		}
+
+		switch tag {
+		case "issue":
+			issue = append(issue, r)
+		case "issuewild":
+			issueWild = append(issueWild, r)
+		}
+	}
+
+	relevant, kind := issue, "issue"
+	if wildcard && len(issueWild) > 0 {
+		relevant, kind = issueWild, "issuewild"
+	}
+
+	if len(relevant) == 0 {
+		return true, "No issue properties restrict issuance"
+	}
+
+	for _, r := range relevant {
+		if r.CAAIssuer() != "" && r.CAAIssuer() == issuer {
+			return true, fmt.Sprintf("%s is allowed by %s", issuer, r)
+		}
+	}
+
+	return false, fmt.Sprintf("%s is not named by any %s property", issuer, kind)
+}
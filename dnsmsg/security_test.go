@@ -0,0 +1,242 @@
+package dnsmsg
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCertificate creates a certificate for name signed by parent, or a self
+// signed certificate authority when parent is nil
+func testCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	} else {
+		template.DNSNames = []string{name}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+func TestTLSAVerifyCertificate(t *testing.T) {
+	ca, caKey := testCertificate(t, "Test CA", nil, nil)
+	leaf, _ := testCertificate(t, "www.example.com", ca, caKey)
+	other, _ := testCertificate(t, "Other CA", nil, nil)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	tlsa := func(usage, selector, matchingType uint8, cert *x509.Certificate) *RDataTLSA {
+		r, err := NewTLSA(cert, usage, selector, matchingType)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return r
+	}
+
+	tests := []struct {
+		name  string
+		tlsa  *RDataTLSA
+		chain []*x509.Certificate
+		ok    bool
+	}{
+		{"DANE-EE SPKI SHA-256", tlsa(TLSAUsageDANEEE, TLSASelectorSPKI, TLSAMatchingSHA256, leaf), []*x509.Certificate{leaf}, true},
+		{"DANE-EE full certificate", tlsa(TLSAUsageDANEEE, TLSASelectorCert, TLSAMatchingFull, leaf), []*x509.Certificate{leaf}, true},
+		{"DANE-EE SHA-512", tlsa(TLSAUsageDANEEE, TLSASelectorCert, TLSAMatchingSHA512, leaf), []*x509.Certificate{leaf}, true},
+		{"DANE-EE other certificate", tlsa(TLSAUsageDANEEE, TLSASelectorSPKI, TLSAMatchingSHA256, ca), []*x509.Certificate{leaf}, false},
+		{"DANE-TA in the chain", tlsa(TLSAUsageDANETA, TLSASelectorSPKI, TLSAMatchingSHA256, ca), []*x509.Certificate{leaf, ca}, true},
+		{"DANE-TA not in the chain", tlsa(TLSAUsageDANETA, TLSASelectorSPKI, TLSAMatchingSHA256, ca), []*x509.Certificate{leaf}, false},
+		{"DANE-TA not signing the certificate", tlsa(TLSAUsageDANETA, TLSASelectorSPKI, TLSAMatchingSHA256, other), []*x509.Certificate{leaf, other}, false},
+		{"PKIX-EE", tlsa(TLSAUsagePKIXEE, TLSASelectorSPKI, TLSAMatchingSHA256, leaf), []*x509.Certificate{leaf}, true},
+		{"PKIX-EE other certificate", tlsa(TLSAUsagePKIXEE, TLSASelectorSPKI, TLSAMatchingSHA256, ca), []*x509.Certificate{leaf}, false},
+		{"PKIX-TA", tlsa(TLSAUsagePKIXTA, TLSASelectorCert, TLSAMatchingSHA256, ca), []*x509.Certificate{leaf}, true},
+		{"PKIX-TA naming the end entity", tlsa(TLSAUsagePKIXTA, TLSASelectorCert, TLSAMatchingSHA256, leaf), []*x509.Certificate{leaf}, false},
+		{"unknown usage", &RDataTLSA{usage: 9, selector: TLSASelectorSPKI, matchingType: TLSAMatchingSHA256}, []*x509.Certificate{leaf}, false},
+		{"no certificates", tlsa(TLSAUsageDANEEE, TLSASelectorSPKI, TLSAMatchingSHA256, leaf), nil, false},
+	}
+
+	for _, tt := range tests {
+		err := tt.tlsa.VerifyCertificate(tt.chain, roots)
+
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: VerifyCertificate error = %v, want success %v", tt.name, err, tt.ok)
+		}
+	}
+
+	// PKIX usages fail against roots which do not include the authority
+	if err := tlsa(TLSAUsagePKIXEE, TLSASelectorSPKI, TLSAMatchingSHA256, leaf).VerifyCertificate([]*x509.Certificate{leaf}, x509.NewCertPool()); err == nil {
+		t.Error("PKIX-EE verified a certificate without a trusted root")
+	}
+
+	for _, params := range [][2]uint8{{2, TLSAMatchingSHA256}, {TLSASelectorSPKI, 3}} {
+		if _, err := NewTLSA(leaf, TLSAUsageDANEEE, params[0], params[1]); err == nil {
+			t.Errorf("NewTLSA with selector %d and matching type %d succeeded", params[0], params[1])
+		}
+	}
+}
+
+// sshKeyBlob builds the wire format of an SSH Ed25519 public key
+func sshKeyBlob(public ed25519.PublicKey) []byte {
+	var blob []byte
+
+	for _, field := range [][]byte{[]byte("ssh-ed25519"), public} {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+		blob = append(append(blob, size[:]...), field...)
+	}
+
+	return blob
+}
+
+func TestSSHFP(t *testing.T) {
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob := sshKeyBlob(public)
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	sum := sha256.Sum256(blob)
+
+	for _, line := range []string{
+		"ssh-ed25519 " + encoded + " root@host",
+		"host.example.com,192.0.2.1 ssh-ed25519 " + encoded,
+	} {
+		key, err := ParseSSHHostKey(line)
+		if err != nil {
+			t.Fatalf("ParseSSHHostKey(%q): %v", line, err)
+		}
+
+		if key.Type() != "ssh-ed25519" || key.Algorithm() != SSHFPAlgorithmEd25519 {
+			t.Errorf("key type %s with algorithm %d, want ssh-ed25519 and %d", key.Type(), key.Algorithm(), SSHFPAlgorithmEd25519)
+		}
+
+		sshfp, err := key.SSHFP(SSHFPTypeSHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := "4 2 " + strings.ToUpper(hex.EncodeToString(sum[:])); sshfp.String() != want {
+			t.Errorf("SSHFP = %s, want %s", sshfp, want)
+		}
+
+		tests := []struct {
+			rr   string
+			want bool
+		}{
+			{"host.example.com. 300 IN SSHFP 4 2 " + hex.EncodeToString(sum[:]), true},
+			{"host.example.com. 300 IN SSHFP 1 2 " + hex.EncodeToString(sum[:]), false},
+			{"host.example.com. 300 IN SSHFP 4 1 " + hex.EncodeToString(sum[:20]), false},
+			{"host.example.com. 300 IN SSHFP 4 2 " + hex.EncodeToString(make([]byte, 32)), false},
+		}
+
+		for _, tt := range tests {
+			rr, err := ParseRR(tt.rr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := rr.RDATA.(*RDataSSHFP).Matches(key); got != tt.want {
+				t.Errorf("%s matches = %v, want %v", rr.RDATA, got, tt.want)
+			}
+		}
+	}
+
+	if _, err := (&SSHHostKey{keyType: "ssh-ed25519", blob: blob}).Fingerprint(3); err == nil {
+		t.Error("Fingerprint with an unknown type succeeded")
+	}
+
+	malformed := []string{
+		"",
+		"ssh-ed25519",
+		"ssh-ed25519 not*base64",
+		"ssh-rsa " + encoded,
+		"ssh-ed25519 AAAA",
+		"ssh-unknown " + encoded,
+	}
+
+	for _, line := range malformed {
+		if _, err := ParseSSHHostKey(line); err == nil {
+			t.Errorf("ParseSSHHostKey(%q) succeeded", line)
+		}
+	}
+}
+
+func TestCAAPermits(t *testing.T) {
+	caa := func(flags uint8, tag, value string) *RDataCAA {
+		return &RDataCAA{flags: flags, tag: tag, value: value}
+	}
+
+	tests := []struct {
+		name     string
+		records  []*RDataCAA
+		issuer   string
+		wildcard bool
+		want     bool
+	}{
+		{"no records", nil, "ca.example.net", false, true},
+		{"named issuer", []*RDataCAA{caa(0, "issue", "ca.example.net")}, "ca.example.net", false, true},
+		{"issuer with parameters", []*RDataCAA{caa(0, "issue", "ca.example.net; account=230123")}, "ca.example.net", false, true},
+		{"case and trailing dot", []*RDataCAA{caa(0, "ISSUE", "CA.Example.NET.")}, "ca.example.net.", false, true},
+		{"another issuer", []*RDataCAA{caa(0, "issue", "other.example.org")}, "ca.example.net", false, false},
+		{"one of several issuers", []*RDataCAA{caa(0, "issue", "other.example.org"), caa(0, "issue", "ca.example.net")}, "ca.example.net", false, true},
+		{"no issuer allowed", []*RDataCAA{caa(0, "issue", ";")}, "ca.example.net", false, false},
+		{"only other properties", []*RDataCAA{caa(0, "iodef", "mailto:security@example.com")}, "ca.example.net", false, true},
+
+		// Wildcard certificates follow issuewild when there is any
+		{"issuewild for a wildcard", []*RDataCAA{caa(0, "issue", "other.example.org"), caa(0, "issuewild", "ca.example.net")}, "ca.example.net", true, true},
+		{"issuewild forbidding a wildcard", []*RDataCAA{caa(0, "issue", "ca.example.net"), caa(0, "issuewild", ";")}, "ca.example.net", true, false},
+		{"issuewild ignored without a wildcard", []*RDataCAA{caa(0, "issue", "ca.example.net"), caa(0, "issuewild", ";")}, "ca.example.net", false, true},
+		{"issue for a wildcard", []*RDataCAA{caa(0, "issue", "ca.example.net")}, "ca.example.net", true, true},
+
+		// An unknown property marked critical forbids issuance
+		{"unknown critical property", []*RDataCAA{caa(0, "issue", "ca.example.net"), caa(128, "future", "x")}, "ca.example.net", false, false},
+		{"unknown property", []*RDataCAA{caa(0, "issue", "ca.example.net"), caa(0, "future", "x")}, "ca.example.net", false, true},
+		{"known critical property", []*RDataCAA{caa(128, "issue", "ca.example.net")}, "ca.example.net", false, true},
+	}
+
+	for _, tt := range tests {
+		if got, reason := CAAPermits(tt.records, tt.issuer, tt.wildcard); got != tt.want {
+			t.Errorf("%s: CAAPermits = %v (%s), want %v", tt.name, got, reason, tt.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package dnsmsg
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SRV and URI records list the servers offering a service along with a
+// priority and a weight. Clients try the lowest priority first and share the
+// load between servers of the same priority in proportion to their weights,
+// see RFC 2782. NAPTR records are tried by order and then preference, see RFC
+// 3403 section 4.1.
+
+// ErrServiceUnavailable is returned by lookups when the only target given is
+// ".", meaning the service is decidedly not available at the domain
+var ErrServiceUnavailable = errors.New("Service is not available at this domain")
+
+// SortSRV orders records the way clients should try them: by priority, with
+// the records of each priority in a random order weighted by their weights
+func SortSRV(records []*RDataSRV) {
+	order := weightedOrder(len(records), func(i int) (uint16, uint16) {
+		return records[i].priority, records[i].weight
+	}, rand.Intn)
+
+	sorted := make([]*RDataSRV, len(records))
+	for i, j := range order {
+		sorted[i] = records[j]
+	}
+
+	copy(records, sorted)
+}
+
+// SortURI orders records by priority and weight like SortSRV, see RFC 7553
+// section 4.4
+func SortURI(records []*RDataURI) {
+	order := weightedOrder(len(records), func(i int) (uint16, uint16) {
+		return records[i].priority, records[i].weight
+	}, rand.Intn)
+
+	sorted := make([]*RDataURI, len(records))
+	for i, j := range order {
+		sorted[i] = records[j]
+	}
+
+	copy(records, sorted)
+}
+
+// weightedOrder returns the indexes of n records sorted by priority, picking
+// the records of each priority one at a time with a chance proportional to
+// their weight. Records with no weight are placed first so they are picked
+// only when the random number is zero, as RFC 2782 describes.
+func weightedOrder(n int, get func(int) (uint16, uint16), intn func(int) int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		pa, wa := get(order[a])
+		pb, wb := get(order[b])
+
+		if pa != pb {
+			return pa < pb
+		}
+
+		return wa == 0 && wb != 0
+	})
+
+	for start := 0; start < n; {
+		priority, _ := get(order[start])
+
+		end := start
+		for end < n {
+			if p, _ := get(order[end]); p != priority {
+				break
+			}
+
+			end++
+		}
+
+		for i := start; i < end; i++ {
+			sum := 0
+			for _, j := range order[i:end] {
+				_, w := get(j)
+				sum += int(w)
+			}
+
+			pick := intn(sum + 1)
+			running := 0
+
+			for k := i; k < end; k++ {
+				_, w := get(order[k])
+				running += int(w)
+
+				if running >= pick {
+					picked := order[k]
+					copy(order[i+1:k+1], order[i:k])
+					order[i] = picked
+					break
+				}
+			}
+		}
+
+		start = end
+	}
+
+	return order
+}
+
+// SortNAPTR orders records by order and then preference. Clients work down the
+// list, skipping records for services they do not support, and stop looking at
+// records of a higher order once one has been used.
+func SortNAPTR(records []*RDataNAPTR) {
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].order != records[j].order {
+			return records[i].order < records[j].order
+		}
+
+		return records[i].preference < records[j].preference
+	})
+}
+
+// IsTerminal reports if the flags of the record end the lookup, so that the
+// result is looked up as an address, SRV record or URI rather than as another
+// set of NAPTR records
+func (r *RDataNAPTR) IsTerminal() bool {
+	return strings.ContainsAny(strings.ToUpper(r.flags), "SAUP")
+}
+
+// Rewrite applies the substitution expression of the record to input, as in
+// RFC 3402 section 3.2. Records without an expression return their
+// replacement domain instead. An empty string is returned without an error
+// when the expression does not match.
+func (r *RDataNAPTR) Rewrite(input string) (string, error) {
+	if r.regexp == "" {
+		return r.replacement, nil
+	}
+
+	delim := r.regexp[:1]
+	if delim == "\\" || delim == "i" || (delim >= "1" && delim <= "9") {
+		return "", fmt.Errorf("Invalid NAPTR delimiter '%s'", delim)
+	}
+
+	parts := splitUnescaped(r.regexp[1:], delim[0])
+	if len(parts) != 3 || parts[0] == "" || (parts[2] != "" && parts[2] != "i") {
+		return "", fmt.Errorf("Invalid NAPTR substitution expression '%s'", r.regexp)
+	}
+
+	ere := parts[0]
+	if parts[2] == "i" {
+		ere = "(?i)" + ere
+	}
+
+	re, err := regexp.Compile(ere)
+	if err != nil {
+		return "", fmt.Errorf("Invalid NAPTR regular expression '%s': %v", parts[0], err)
+	}
+
+	match := re.FindStringSubmatchIndex(input)
+	if match == nil {
+		return "", nil
+	}
+
+	// Back references are written \1 to \9 and any other character may be
+	// escaped with a backslash
+	var template strings.Builder
+	repl := parts[1]
+
+	for i := 0; i < len(repl); i++ {
+		c := repl[i]
+
+		if c == '\\' && i+1 < len(repl) {
+			i++
+			c = repl[i]
+
+			if c >= '1' && c <= '9' {
+				fmt.Fprintf(&template, "${%c}", c)
+				continue
+			}
+		}
+
+		if c == '$' {
+			template.WriteString("$$")
+			continue
+		}
+
+		template.WriteByte(c)
+	}
+
+	return string(re.ExpandString(nil, template.String(), input, match)), nil
+}
+
+// splitUnescaped splits s at each occurrence of sep which is not escaped with
+// a backslash, keeping the escapes
+func splitUnescaped(s string, sep byte) []string {
+	var parts []string
+
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
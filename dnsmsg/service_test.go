@@ -0,0 +1,141 @@
+package dnsmsg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWeightedOrder(t *testing.T) {
+	type record struct{ priority, weight uint16 }
+
+	tests := []struct {
+		name    string
+		records []record
+		picks   []int
+		want    []int
+	}{
+		{"by priority", []record{{20, 0}, {10, 0}, {30, 5}}, []int{0, 0, 0}, []int{1, 0, 2}},
+
+		// Records without weight come first so only a pick of zero
+		// chooses them
+		{"zero weight picked by zero", []record{{10, 10}, {10, 20}, {10, 0}}, []int{0, 25, 0}, []int{2, 1, 0}},
+		{"zero weight passed over", []record{{10, 10}, {10, 20}, {10, 0}}, []int{5, 0, 0}, []int{0, 2, 1}},
+		{"heaviest picked", []record{{10, 10}, {10, 20}, {10, 0}}, []int{30, 10, 0}, []int{1, 0, 2}},
+
+		// The records of each priority are picked separately
+		{"within priorities", []record{{20, 1}, {10, 1}, {10, 1}}, []int{2, 1, 1}, []int{2, 1, 0}},
+		{"all weights zero", []record{{10, 0}, {10, 0}}, []int{0, 0}, []int{0, 1}},
+	}
+
+	for _, tt := range tests {
+		var calls int
+
+		get := func(i int) (uint16, uint16) {
+			return tt.records[i].priority, tt.records[i].weight
+		}
+
+		intn := func(n int) int {
+			pick := tt.picks[calls]
+			calls++
+
+			if pick >= n {
+				t.Fatalf("%s: pick %d of %d", tt.name, pick, n)
+			}
+
+			return pick
+		}
+
+		if got := weightedOrder(len(tt.records), get, intn); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: order = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSortSRV(t *testing.T) {
+	records := []*RDataSRV{
+		{priority: 20, weight: 5, target: "c.example.com."},
+		{priority: 10, weight: 0, target: "a.example.com."},
+		{priority: 30, weight: 0, target: "d.example.com."},
+		{priority: 10, weight: 50, target: "b.example.com."},
+	}
+
+	for i := 0; i < 20; i++ {
+		SortSRV(records)
+
+		if records[0].priority != 10 || records[1].priority != 10 || records[2].target != "c.example.com." || records[3].target != "d.example.com." {
+			t.Fatalf("sorted records %v are not in priority order", records)
+		}
+	}
+}
+
+func TestSortNAPTR(t *testing.T) {
+	records := []*RDataNAPTR{
+		{order: 100, preference: 20, service: "c"},
+		{order: 50, preference: 90, service: "a"},
+		{order: 100, preference: 10, service: "b"},
+	}
+
+	SortNAPTR(records)
+
+	if records[0].service != "a" || records[1].service != "b" || records[2].service != "c" {
+		t.Errorf("sorted records %v, want a, b, c", records)
+	}
+}
+
+func TestNAPTRRewrite(t *testing.T) {
+	tests := []struct {
+		regexp string
+		input  string
+		want   string
+	}{
+		{"!^.*$!sip:info@example.com!", "+15551234", "sip:info@example.com"},
+		{`!^\+1(.*)$!sip:\1@example.com!`, "+15551234", "sip:5551234@example.com"},
+		{`!^\+1(...)(.*)$!\2.\1.example.com!`, "+15551234", "1234.555.example.com"},
+		{"!^ABC$!matched!i", "abc", "matched"},
+		{"!^ABC$!matched!", "abc", ""},
+		{`/^a\/b$/escaped delimiter/`, "a/b", "escaped delimiter"},
+		{"!^(.*)$!$\\1!", "x", "$x"},
+		{"", "+15551234", "sip.example.com."},
+	}
+
+	for _, tt := range tests {
+		r := &RDataNAPTR{regexp: tt.regexp, replacement: "sip.example.com."}
+
+		got, err := r.Rewrite(tt.input)
+		if err != nil {
+			t.Errorf("Rewrite(%q) with %q: %v", tt.input, tt.regexp, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("Rewrite(%q) with %q = %q, want %q", tt.input, tt.regexp, got, tt.want)
+		}
+	}
+
+	malformed := []string{
+		`\a\b\`,
+		"iaibi",
+		"1a1b1",
+		"!a!b",
+		"!a!b!c!",
+		"!a!b!x",
+		"!!b!",
+		"!(!b!",
+	}
+
+	for _, expr := range malformed {
+		r := &RDataNAPTR{regexp: expr}
+
+		if got, err := r.Rewrite("a"); err == nil {
+			t.Errorf("Rewrite with %q = %q, want an error", expr, got)
+		}
+	}
+}
+
+func TestNAPTRIsTerminal(t *testing.T) {
+	for flags, want := range map[string]bool{"S": true, "a": true, "U": true, "p": true, "": false, "X": false} {
+		if got := (&RDataNAPTR{flags: flags}).IsTerminal(); got != want {
+			t.Errorf("IsTerminal with flags %q = %v, want %v", flags, got, want)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package dnsmsg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Signing a zone adds the DNSKEY records of its keys, an NSEC or NSEC3 chain
+// linking every name so that missing names and types can be proven, and an
+// RRSIG over each RRset the zone is authoritative for. The NS records at a
+// delegation and the glue below it belong to the child zone so they are left
+// unsigned, see RFC 4035 section 2.
+
+// SignOptions controls how a zone is signed
+type SignOptions struct {
+	// Inception and Expiration bound the validity period of the signatures
+	Inception  time.Time
+	Expiration time.Time
+
+	// NSEC3 selects a chain of NSEC3 records in place of NSEC records,
+	// hashed with the given number of extra iterations and salt
+	NSEC3      bool
+	Iterations uint16
+	Salt       []byte
+
+	// OptOut leaves delegations without DS records out of the NSEC3 chain,
+	// see RFC 5155 section 6
+	OptOut bool
+}
+
+// SignZone signs the records of the zone named origin with keys, replacing any
+// RRSIG, NSEC, NSEC3 and NSEC3PARAM records it already holds. When both key
+// signing keys, marked by DNSKEYFlagSEP, and zone signing keys are given the
+// key signing keys only sign the DNSKEY RRset. Otherwise every key signs every
+// RRset. The signed records are returned in canonical order.
+func SignZone(origin string, rrs []RR, keys []*SigningKey, opts SignOptions) ([]RR, error) {
+	origin = strings.ToLower(Fqdn(origin))
+
+	if len(keys) == 0 {
+		return nil, errors.New("At least one key is required to sign a zone")
+	}
+
+	for _, key := range keys {
+		if key.owner != origin {
+			return nil, fmt.Errorf("Key %d belongs to %s, not %s", key.KeyTag(), key.owner, origin)
+		}
+	}
+
+	var soa *RDataSOA
+	var soaTTL uint32
+	var records []RR
+
+	for _, rr := range rrs {
+		switch rr.TYPE {
+		case RecordTypeRRSIG, RecordTypeNSEC, RecordTypeNSEC3, RecordTypeNSEC3PARAM:
+			continue
+		case RecordTypeSOA:
+			if strings.EqualFold(Fqdn(rr.NAME), origin) {
+				soa, soaTTL = rr.RDATA.(*RDataSOA), rr.TTL
+			}
+		}
+
+		if !IsSubDomain(origin, rr.NAME) {
+			return nil, fmt.Errorf("%s is outside of the zone %s", rr.NAME, origin)
+		}
+
+		records = append(records, rr)
+	}
+
+	if soa == nil {
+		return nil, fmt.Errorf("No SOA record found for %s", origin)
+	}
+
+	records = addKeys(records, keys, soaTTL)
+
+	z := newSigningZone(origin, records)
+
+	// The records proving a name does not exist are cached for as long as a
+	// negative answer would be, see RFC 9077
+	ttl := soa.Minimum()
+	if soaTTL < ttl {
+		ttl = soaTTL
+	}
+
+	var chain []RR
+	var err error
+
+	if opts.NSEC3 {
+		chain, err = z.nsec3Chain(ttl, opts)
+	} else {
+		chain = z.nsecChain(ttl)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	z.add(chain)
+
+	var ksks, zsks []*SigningKey
+
+	for _, key := range keys {
+		if key.IsKSK() {
+			ksks = append(ksks, key)
+		} else {
+			zsks = append(zsks, key)
+		}
+	}
+
+	if len(ksks) == 0 || len(zsks) == 0 {
+		ksks = keys
+		zsks = keys
+	}
+
+	signed := append([]RR{}, z.records...)
+
+	for _, set := range z.rrsets() {
+		if !z.signs(set[0]) {
+			continue
+		}
+
+		signers := zsks
+		if set[0].TYPE == RecordTypeDNSKEY {
+			signers = ksks
+		}
+
+		for _, key := range signers {
+			sig, err := key.Sign(set, opts.Inception, opts.Expiration)
+			if err != nil {
+				return nil, err
+			}
+
+			signed = append(signed, sig)
+		}
+	}
+
+	SortCanonical(signed)
+
+	return signed, nil
+}
+
+// addKeys adds the DNSKEY records of keys which the zone does not already
+// publish
+func addKeys(records []RR, keys []*SigningKey, ttl uint32) []RR {
+	for _, key := range keys {
+		public, _ := key.dnskey.Encode()
+		published := false
+
+		for _, rr := range records {
+			if rr.TYPE != RecordTypeDNSKEY || !strings.EqualFold(Fqdn(rr.NAME), key.owner) {
+				continue
+			}
+
+			if existing, _ := rr.RDATA.Encode(); bytes.Equal(existing, public) {
+				published = true
+			}
+		}
+
+		if !published {
+			records = append(records, key.DNSKEY(ttl))
+		}
+	}
+
+	return records
+}
+
+//-----------------------------------------------------------------------------
+// Zone Contents
+//-----------------------------------------------------------------------------
+
+// signingZone sorts the records of a zone being signed by owner and notes
+// where it is delegated
+type signingZone struct {
+	origin  string
+	records []RR
+	names   []string
+	types   map[string][]RecordType
+	cuts    map[string]bool
+}
+
+func newSigningZone(origin string, records []RR) *signingZone {
+	z := &signingZone{
+		origin: origin,
+		types:  make(map[string][]RecordType),
+		cuts:   make(map[string]bool),
+	}
+
+	for _, rr := range records {
+		if rr.TYPE == RecordTypeNS && !strings.EqualFold(Fqdn(rr.NAME), origin) {
+			z.cuts[strings.ToLower(Fqdn(rr.NAME))] = true
+		}
+	}
+
+	z.add(records)
+
+	return z
+}
+
+// add adds records to the zone, noting the types held by each name which is
+// not glue below a delegation
+func (z *signingZone) add(records []RR) {
+	for _, rr := range records {
+		z.records = append(z.records, rr)
+
+		name := strings.ToLower(Fqdn(rr.NAME))
+		if z.isGlue(name) {
+			continue
+		}
+
+		if _, ok := z.types[name]; !ok {
+			z.names = append(z.names, name)
+		}
+
+		if !hasType(z.types[name], rr.TYPE) {
+			z.types[name] = append(z.types[name], rr.TYPE)
+		}
+	}
+
+	sort.Slice(z.names, func(i, j int) bool {
+		return CompareNames(z.names[i], z.names[j]) < 0
+	})
+}
+
+// isGlue reports if name falls below a delegation of the zone
+func (z *signingZone) isGlue(name string) bool {
+	for parent := name; parent != z.origin && parent != "."; {
+		parent = ParentName(parent)
+
+		if z.cuts[parent] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSecureCut reports if name is a delegation to a signed zone, which has DS
+// records
+func (z *signingZone) isSecureCut(name string) bool {
+	return z.cuts[name] && hasType(z.types[name], RecordTypeDS)
+}
+
+// signs reports if the zone signs the RRset rr belongs to. Only the DS and
+// NSEC records at a delegation are the zone's own.
+func (z *signingZone) signs(rr RR) bool {
+	name := strings.ToLower(Fqdn(rr.NAME))
+
+	if z.isGlue(name) {
+		return false
+	}
+
+	if z.cuts[name] {
+		return rr.TYPE == RecordTypeDS || rr.TYPE == RecordTypeNSEC
+	}
+
+	return true
+}
+
+// rrsets groups the records of the zone by owner and type
+func (z *signingZone) rrsets() [][]RR {
+	index := make(map[string]int)
+	var sets [][]RR
+
+	for _, rr := range z.records {
+		key := fmt.Sprintf("%s/%d/%d", strings.ToLower(Fqdn(rr.NAME)), rr.CLASS, rr.TYPE)
+
+		i, ok := index[key]
+		if !ok {
+			i = len(sets)
+			index[key] = i
+			sets = append(sets, nil)
+		}
+
+		sets[i] = append(sets[i], rr)
+	}
+
+	return sets
+}
+
+// bitmapTypes returns the types an NSEC or NSEC3 record owned by name lists:
+// those held by the name along with extra, plus RRSIG when any of them will be
+// signed
+func (z *signingZone) bitmapTypes(name string, extra ...RecordType) []RecordType {
+	types := append(append([]RecordType{}, z.types[name]...), extra...)
+
+	signed := len(z.types[name]) > 0 && (!z.cuts[name] || z.isSecureCut(name))
+	if signed || hasType(extra, RecordTypeNSEC) {
+		types = append(types, RecordTypeRRSIG)
+	}
+
+	sort.Slice(types, func(i, j int) bool {
+		return types[i] < types[j]
+	})
+
+	return types
+}
+
+//-----------------------------------------------------------------------------
+// NSEC and NSEC3 Chains
+//-----------------------------------------------------------------------------
+
+// nsecChain links every name of the zone in canonical order with NSEC
+// records, the last one pointing back to the origin
+func (z *signingZone) nsecChain(ttl uint32) []RR {
+	var chain []RR
+
+	for i, name := range z.names {
+		chain = append(chain, RR{
+			NAME:  name,
+			TYPE:  RecordTypeNSEC,
+			CLASS: RecordClassIN,
+			TTL:   ttl,
+			RDATA: &RDataNSEC{
+				nextDomain: z.names[(i+1)%len(z.names)],
+				types:      z.bitmapTypes(name, RecordTypeNSEC),
+			},
+		})
+	}
+
+	return chain
+}
+
+// nsec3Chain links the hashes of every name of the zone, including the empty
+// non-terminals between them, with NSEC3 records in hash order. With opt-out
+// the delegations without DS records are left out.
+func (z *signingZone) nsec3Chain(ttl uint32, opts SignOptions) ([]RR, error) {
+	var flags uint8
+	if opts.OptOut {
+		flags = NSEC3FlagOptOut
+	}
+
+	owners := make(map[string]bool)
+
+	for _, name := range z.names {
+		if opts.OptOut && z.cuts[name] && !z.isSecureCut(name) {
+			continue
+		}
+
+		for owner := name; !owners[owner]; owner = ParentName(owner) {
+			owners[owner] = true
+
+			if owner == z.origin {
+				break
+			}
+		}
+	}
+
+	type hashedName struct {
+		hash []byte
+		name string
+	}
+
+	var hashed []hashedName
+
+	for name := range owners {
+		hash, err := HashName(name, opts.Iterations, opts.Salt)
+		if err != nil {
+			return nil, err
+		}
+
+		hashed = append(hashed, hashedName{hash: hash, name: name})
+	}
+
+	sort.Slice(hashed, func(i, j int) bool {
+		return bytes.Compare(hashed[i].hash, hashed[j].hash) < 0
+	})
+
+	var chain []RR
+
+	for i, h := range hashed {
+		next := hashed[(i+1)%len(hashed)]
+
+		if i > 0 && bytes.Equal(hashed[i-1].hash, h.hash) {
+			return nil, fmt.Errorf("%s and %s hash to the same NSEC3 owner, try another salt", hashed[i-1].name, h.name)
+		}
+
+		var extra []RecordType
+		if h.name == z.origin {
+			extra = append(extra, RecordTypeNSEC3PARAM)
+		}
+
+		chain = append(chain, RR{
+			NAME:  strings.ToLower(base32Hex.EncodeToString(h.hash)) + "." + z.origin,
+			TYPE:  RecordTypeNSEC3,
+			CLASS: RecordClassIN,
+			TTL:   ttl,
+			RDATA: &RDataNSEC3{
+				hashAlgorithm:   NSEC3HashSHA1,
+				flags:           flags,
+				iterations:      opts.Iterations,
+				salt:            opts.Salt,
+				nextHashedOwner: next.hash,
+				types:           z.bitmapTypes(h.name, extra...),
+			},
+		})
+	}
+
+	// The parameters tell authoritative servers how to hash the names they
+	// are asked for, see RFC 5155 section 4
+	chain = append(chain, RR{
+		NAME:  z.origin,
+		TYPE:  RecordTypeNSEC3PARAM,
+		CLASS: RecordClassIN,
+		TTL:   0,
+		RDATA: &RDataNSEC3PARAM{
+			hashAlgorithm: NSEC3HashSHA1,
+			iterations:    opts.Iterations,
+			salt:          opts.Salt,
+		},
+	})
+
+	return chain, nil
+}
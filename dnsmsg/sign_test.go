@@ -0,0 +1,423 @@
+package dnsmsg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signTestZone holds a wildcard, an empty non-terminal below host.empty, a
+// signed delegation with DS records and an unsigned one with glue
+const signTestZone = `
+$TTL 300
+@		SOA	ns hostmaster 1 3600 600 86400 60
+@		NS	ns
+ns		A	192.0.2.53
+www		A	192.0.2.1
+*.wild		TXT	"from the wildcard"
+host.empty	A	192.0.2.2
+secure		NS	ns.secure
+secure		DS	12345 15 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D
+ns.secure	A	192.0.2.54
+unsigned	NS	ns.unsigned
+ns.unsigned	A	192.0.2.55
+`
+
+// The validity period of the test signatures
+var (
+	testInception  = time.Date(2024, time.June, 1, 11, 0, 0, 0, time.UTC)
+	testExpiration = time.Date(2024, time.June, 1, 13, 0, 0, 0, time.UTC)
+)
+
+func TestSigningKey(t *testing.T) {
+	rrset := mustParseRRs(t,
+		"www.example.com. 300 IN A 192.0.2.1",
+		"www.example.com. 300 IN A 192.0.2.2",
+	)
+
+	// Signatures are made over the canonical form, so the case of the names
+	// and the order of the records do not matter
+	reordered := mustParseRRs(t,
+		"WWW.Example.COM. 300 IN A 192.0.2.2",
+		"www.example.com. 300 IN A 192.0.2.1",
+	)
+
+	changed := mustParseRRs(t,
+		"www.example.com. 300 IN A 192.0.2.1",
+		"www.example.com. 300 IN A 192.0.2.3",
+	)
+
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	algorithms := []DNSSECAlgorithm{AlgorithmRSASHA256, AlgorithmECDSAP256SHA256, AlgorithmECDSAP384SHA384, AlgorithmED25519}
+
+	for _, algorithm := range algorithms {
+		name := DNSSECAlgorithmToStrMap[algorithm]
+
+		key, err := GenerateSigningKey("example.com.", algorithm, DNSKEYFlagZone)
+		if err != nil {
+			t.Fatalf("%s: GenerateSigningKey: %v", name, err)
+		}
+
+		dnskey := key.DNSKEY(300).RDATA.(*RDataDNSKEY)
+
+		sig, err := key.Sign(rrset, testInception, testExpiration)
+		if err != nil {
+			t.Fatalf("%s: Sign: %v", name, err)
+		}
+
+		rrsig := sig.RDATA.(*RDataRRSIG)
+
+		if err := rrsig.Verify(dnskey, rrset); err != nil {
+			t.Errorf("%s: Verify: %v", name, err)
+		}
+
+		if err := rrsig.Verify(dnskey, reordered); err != nil {
+			t.Errorf("%s: Verify of the reordered RRset: %v", name, err)
+		}
+
+		if err := rrsig.Verify(dnskey, changed); err == nil {
+			t.Errorf("%s: Verify accepted a changed RRset", name)
+		}
+
+		if rrsig.KeyTag() != key.KeyTag() || rrsig.SignerName() != "example.com." || rrsig.Labels() != 3 {
+			t.Errorf("%s: RRSIG %s, want key %d of example.com. over 3 labels", name, rrsig, key.KeyTag())
+		}
+
+		ds, err := key.DS(DigestTypeSHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !ds.RDATA.(*RDataDS).Matches("example.com.", dnskey) {
+			t.Errorf("%s: DS %s does not match the key", name, ds.RDATA)
+		}
+
+		// The key files written can be loaded back to sign with
+		base, err := key.WriteFiles(dir)
+		if err != nil {
+			t.Fatalf("%s: WriteFiles: %v", name, err)
+		}
+
+		loaded, err := LoadSigningKey(base + ".private")
+		if err != nil {
+			t.Fatalf("%s: LoadSigningKey: %v", name, err)
+		}
+
+		if loaded.KeyTag() != key.KeyTag() || loaded.Owner() != "example.com." || loaded.IsKSK() {
+			t.Errorf("%s: loaded key %d of %s, want zone signing key %d of example.com.", name, loaded.KeyTag(), loaded.Owner(), key.KeyTag())
+		}
+
+		if sig, err = loaded.Sign(rrset, testInception, testExpiration); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := sig.RDATA.(*RDataRRSIG).Verify(dnskey, rrset); err != nil {
+			t.Errorf("%s: Verify of the loaded key's signature: %v", name, err)
+		}
+	}
+}
+
+// The labels of a wildcard's signature leave out the asterisk
+func TestSignWildcard(t *testing.T) {
+	key, err := GenerateSigningKey("example.com.", AlgorithmED25519, DNSKEYFlagZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := key.Sign(mustParseRRs(t, "*.example.com. 300 IN A 192.0.2.1"), testInception, testExpiration)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if labels := sig.RDATA.(*RDataRRSIG).Labels(); labels != 2 {
+		t.Errorf("labels = %d, want 2", labels)
+	}
+
+	if _, err := key.Sign(mustParseRRs(t, "www.example.org. 300 IN A 192.0.2.1"), testInception, testExpiration); err == nil {
+		t.Error("Sign accepted a record outside the zone of the key")
+	}
+}
+
+// signedRRsets groups the records of a signed zone by owner and type, keeping
+// the RRSIG records apart with the type they cover
+type signedRRsets struct {
+	sets map[string][]RR
+	sigs map[string][]*RDataRRSIG
+}
+
+func groupSigned(rrs []RR) signedRRsets {
+	s := signedRRsets{sets: make(map[string][]RR), sigs: make(map[string][]*RDataRRSIG)}
+
+	for _, rr := range rrs {
+		if sig, ok := rr.RDATA.(*RDataRRSIG); ok {
+			key := rr.NAME + " " + RecordTypeToStrMap[sig.TypeCovered()]
+			s.sigs[key] = append(s.sigs[key], sig)
+			continue
+		}
+
+		key := rr.NAME + " " + RecordTypeToStrMap[rr.TYPE]
+		s.sets[key] = append(s.sets[key], rr)
+	}
+
+	return s
+}
+
+func TestSignZone(t *testing.T) {
+	zone, err := ParseZone(strings.NewReader(signTestZone), "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ksk, err := GenerateSigningKey("example.com.", AlgorithmECDSAP256SHA256, DNSKEYFlagZone|DNSKEYFlagSEP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zsk, err := GenerateSigningKey("example.com.", AlgorithmED25519, DNSKEYFlagZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := SignZone("example.com.", zone, []*SigningKey{ksk, zsk}, SignOptions{Inception: testInception, Expiration: testExpiration})
+	if err != nil {
+		t.Fatalf("SignZone: %v", err)
+	}
+
+	s := groupSigned(signed)
+
+	// The key signing key only signs the DNSKEY RRset and the records the
+	// child zone owns are left unsigned
+	unsigned := map[string]bool{
+		"secure.example.com. NS":     true,
+		"ns.secure.example.com. A":   true,
+		"unsigned.example.com. NS":   true,
+		"ns.unsigned.example.com. A": true,
+	}
+
+	for key, set := range s.sets {
+		sigs := s.sigs[key]
+
+		if unsigned[key] {
+			if len(sigs) > 0 {
+				t.Errorf("%s is signed", key)
+			}
+
+			continue
+		}
+
+		signer := zsk
+		if set[0].TYPE == RecordTypeDNSKEY {
+			signer = ksk
+		}
+
+		if len(sigs) != 1 || sigs[0].KeyTag() != signer.KeyTag() {
+			t.Errorf("%s has %d signatures, want one by key %d", key, len(sigs), signer.KeyTag())
+			continue
+		}
+
+		if err := sigs[0].Verify(signer.DNSKEY(300).RDATA.(*RDataDNSKEY), set); err != nil {
+			t.Errorf("%s: Verify: %v", key, err)
+		}
+	}
+
+	if n := len(s.sets["example.com. DNSKEY"]); n != 2 {
+		t.Errorf("zone publishes %d DNSKEY records, want 2", n)
+	}
+
+	// The NSEC records link the names in canonical order, leaving out glue
+	// and the empty non-terminal
+	names := []string{
+		"example.com.", "host.empty.example.com.", "ns.example.com.", "secure.example.com.",
+		"unsigned.example.com.", "*.wild.example.com.", "www.example.com.",
+	}
+
+	types := map[string]string{
+		"example.com.":            "NS SOA RRSIG NSEC DNSKEY",
+		"secure.example.com.":     "NS DS RRSIG NSEC",
+		"unsigned.example.com.":   "NS RRSIG NSEC",
+		"*.wild.example.com.":     "TXT RRSIG NSEC",
+		"host.empty.example.com.": "A RRSIG NSEC",
+	}
+
+	for i, name := range names {
+		set := s.sets[name+" NSEC"]
+		if len(set) != 1 {
+			t.Errorf("%s has %d NSEC records, want 1", name, len(set))
+			continue
+		}
+
+		nsec := set[0].RDATA.(*RDataNSEC)
+
+		if next := names[(i+1)%len(names)]; nsec.NextDomain() != next {
+			t.Errorf("NSEC %s -> %s, want %s", name, nsec.NextDomain(), next)
+		}
+
+		if want, ok := types[name]; ok && typesString(nsec.Types()) != want {
+			t.Errorf("NSEC %s lists %s, want %s", name, typesString(nsec.Types()), want)
+		}
+
+		if set[0].TTL != 60 {
+			t.Errorf("NSEC %s has TTL %d, want the SOA minimum", name, set[0].TTL)
+		}
+	}
+}
+
+// typesString lists types by their mnemonics
+func typesString(types []RecordType) string {
+	var names []string
+	for _, typ := range types {
+		names = append(names, RecordTypeToStrMap[typ])
+	}
+
+	return strings.Join(names, " ")
+}
+
+func TestSignZoneNSEC3(t *testing.T) {
+	zone, err := ParseZone(strings.NewReader(signTestZone), "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := GenerateSigningKey("example.com.", AlgorithmED25519, DNSKEYFlagZone|DNSKEYFlagSEP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	salt := []byte{0xaa, 0xbb}
+
+	// Every name is hashed including the empty non-terminal, while opt-out
+	// leaves out the unsigned delegation
+	names := []string{
+		"example.com.", "empty.example.com.", "host.empty.example.com.", "ns.example.com.",
+		"secure.example.com.", "wild.example.com.", "*.wild.example.com.", "www.example.com.",
+	}
+
+	for _, optOut := range []bool{false, true} {
+		opts := SignOptions{
+			Inception:  testInception,
+			Expiration: testExpiration,
+			NSEC3:      true,
+			Iterations: 5,
+			Salt:       salt,
+			OptOut:     optOut,
+		}
+
+		signed, err := SignZone("example.com.", zone, []*SigningKey{key}, opts)
+		if err != nil {
+			t.Fatalf("SignZone: %v", err)
+		}
+
+		want := append([]string{}, names...)
+		if !optOut {
+			want = append(want, "unsigned.example.com.")
+		}
+
+		wantHashes := make(map[string]string)
+		for _, name := range want {
+			hash, err := HashName(name, 5, salt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantHashes[string(hash)] = name
+		}
+
+		var hashes [][]byte
+		var param *RDataNSEC3PARAM
+
+		for _, rr := range signed {
+			switch rdata := rr.RDATA.(type) {
+			case *RDataNSEC3PARAM:
+				param = rdata
+			case *RDataNSEC:
+				t.Errorf("opt-out %v: NSEC record %s in an NSEC3 zone", optOut, rr.NAME)
+			case *RDataNSEC3:
+				hash, err := HashedOwner(rr.NAME)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if _, ok := wantHashes[string(hash)]; !ok {
+					t.Errorf("opt-out %v: NSEC3 %s is not the hash of a name in the zone", optOut, rr.NAME)
+				}
+
+				if rdata.OptOut() != optOut || rdata.Iterations() != 5 || !bytes.Equal(rdata.Salt(), salt) {
+					t.Errorf("opt-out %v: NSEC3 %s has parameters %s", optOut, rr.NAME, rdata)
+				}
+
+				hashes = append(hashes, hash, rdata.NextHashedOwner())
+			}
+		}
+
+		if param == nil || param.Iterations() != 5 || !bytes.Equal(param.Salt(), salt) {
+			t.Errorf("opt-out %v: NSEC3PARAM %v, want 5 iterations with salt aabb", optOut, param)
+		}
+
+		if len(hashes)/2 != len(want) {
+			t.Errorf("opt-out %v: %d NSEC3 records, want %d", optOut, len(hashes)/2, len(want))
+			continue
+		}
+
+		// Each record points to the next hash in order, the last to the
+		// first
+		sorted := make([][]byte, 0, len(want))
+		for i := 0; i < len(hashes); i += 2 {
+			sorted = append(sorted, hashes[i])
+		}
+
+		sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+
+		for i := 0; i < len(hashes); i += 2 {
+			at := sort.Search(len(sorted), func(j int) bool { return bytes.Compare(sorted[j], hashes[i]) >= 0 })
+
+			if next := sorted[(at+1)%len(sorted)]; !bytes.Equal(hashes[i+1], next) {
+				t.Errorf("opt-out %v: NSEC3 of %s does not point to the next hash", optOut, wantHashes[string(hashes[i])])
+			}
+		}
+	}
+}
+
+func TestSignZoneErrors(t *testing.T) {
+	zone, err := ParseZone(strings.NewReader(signTestZone), "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := GenerateSigningKey("example.com.", AlgorithmED25519, DNSKEYFlagZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := GenerateSigningKey("example.org.", AlgorithmED25519, DNSKEYFlagZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := SignOptions{Inception: testInception, Expiration: testExpiration}
+
+	tests := []struct {
+		name string
+		rrs  []RR
+		keys []*SigningKey
+	}{
+		{"no keys", zone, nil},
+		{"key of another zone", zone, []*SigningKey{other}},
+		{"no SOA", zone[1:], []*SigningKey{key}},
+		{"record outside the zone", append(mustParseRRs(t, "www.example.org. 300 IN A 192.0.2.1"), zone...), []*SigningKey{key}},
+	}
+
+	for _, tt := range tests {
+		if _, err := SignZone("example.com.", tt.rrs, tt.keys, opts); err == nil {
+			t.Errorf("%s: SignZone succeeded", tt.name)
+		}
+	}
+}
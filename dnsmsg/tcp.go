@@ -0,0 +1,50 @@
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxTCPMsgSize is the largest message which can be sent over TCP since
+// messages are prefixed with a two byte length field
+const MaxTCPMsgSize = 65535
+
+// WriteTCPMessage writes an encoded message prefixed with its two byte length
+// as required for messages sent over TCP. See RFC 1035 section 4.2.2
+func WriteTCPMessage(w io.Writer, msgBytes []byte) error {
+	if len(msgBytes) > MaxTCPMsgSize {
+		return fmt.Errorf("Message size %d exceeds the maximum of %d for TCP", len(msgBytes), MaxTCPMsgSize)
+	}
+
+	buf := make([]byte, 2+len(msgBytes))
+	binary.BigEndian.PutUint16(buf, uint16(len(msgBytes)))
+	copy(buf[2:], msgBytes)
+
+	_, err := w.Write(buf)
+
+	return err
+}
+
+// ReadTCPMessage reads a single length prefixed message sent over TCP
+func ReadTCPMessage(r io.Reader) ([]byte, error) {
+	var lenBuf [2]byte
+
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+
+	msgLen := binary.BigEndian.Uint16(lenBuf[:])
+	if msgLen == 0 {
+		return nil, errors.New("Received a zero length TCP message")
+	}
+
+	msgBytes := make([]byte, msgLen)
+
+	if _, err := io.ReadFull(r, msgBytes); err != nil {
+		return nil, err
+	}
+
+	return msgBytes, nil
+}
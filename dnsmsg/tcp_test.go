@@ -0,0 +1,38 @@
+package dnsmsg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTCPMessage(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := WriteTCPMessage(&buf, []byte("message")); err != nil {
+		t.Fatalf("WriteTCPMessage: %v", err)
+	}
+
+	if !bytes.Equal(buf.Bytes()[:2], []byte{0, 7}) {
+		t.Errorf("length prefix = %x, want 0007", buf.Bytes()[:2])
+	}
+
+	if msg, err := ReadTCPMessage(&buf); err != nil || string(msg) != "message" {
+		t.Errorf("ReadTCPMessage = %q, %v, want \"message\"", msg, err)
+	}
+
+	if err := WriteTCPMessage(&buf, make([]byte, MaxTCPMsgSize+1)); err == nil {
+		t.Error("WriteTCPMessage accepted a message too long for its length prefix")
+	}
+
+	tests := map[string][]byte{
+		"zero length":   {0, 0},
+		"short prefix":  {0},
+		"short message": {0, 4, 'a', 'b'},
+	}
+
+	for name, data := range tests {
+		if _, err := ReadTCPMessage(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: ReadTCPMessage succeeded", name)
+		}
+	}
+}
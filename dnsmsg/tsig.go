@@ -0,0 +1,488 @@
+package dnsmsg
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TSIG signs a message with a secret shared between client and server as
+// described in RFC 8945. The signature is carried in a TSIG record added to
+// the end of the additional section once the rest of the message has been
+// encoded. The MAC covers the message as it was before the TSIG record was
+// added along with these TSIG variables:
+//
+//     +---------------------+
+//     |       Key Name      | canonical form, uncompressed
+//     +---------------------+
+//     |   Class and TTL     | always ANY and 0
+//     +---------------------+
+//     |    Algorithm Name   | canonical form, uncompressed
+//     +---------------------+
+//     | Time Signed, Fudge  | the timers
+//     +---------------------+
+//     |  Error, Other Data  |
+//     +---------------------+
+//
+// A response is signed over the MAC of the request as well, and each message
+// after the first of a response spanning several, such as a zone transfer, is
+// signed over the MAC of the message before it and the timers only.
+
+// These are the TSIG algorithms supported
+const (
+	HmacSHA256 = "hmac-sha256."
+	HmacSHA512 = "hmac-sha512."
+)
+
+const (
+	// DefaultTSIGFudge is how many seconds the clocks of the signer and the
+	// receiver may differ by
+	DefaultTSIGFudge = 300
+
+	// The number of messages in a row a multi-message response may leave
+	// unsigned. See RFC 8945 section 5.3.1
+	maxUnsignedTSIGMessages = 99
+)
+
+var tsigAlgorithms = map[string]func() hash.Hash{
+	HmacSHA256: sha256.New,
+	HmacSHA512: sha512.New,
+}
+
+// These are the errors returned when a TSIG signature cannot be verified
+var (
+	ErrTSIGMissing     = errors.New("Message is not signed with TSIG")
+	ErrTSIGBadKey      = errors.New("TSIG key or algorithm is not the one expected")
+	ErrTSIGBadSig      = errors.New("TSIG signature does not match the message")
+	ErrTSIGBadTime     = errors.New("TSIG time signed is outside the fudge allowed")
+	ErrTSIGUnsignedEnd = errors.New("Multi-message response did not end with a signed message")
+)
+
+// TSIGError is returned when the other side reports that it could not verify
+// the signature of a message sent to it
+type TSIGError struct {
+	Code ResponseCode
+}
+
+func (e *TSIGError) Error() string {
+	return fmt.Sprintf("Server rejected the TSIG signature with %s", tsigErrorStr(e.Code))
+}
+
+// tsigErrorStr names the error field of a TSIG record, which shares its
+// values with the response codes apart from BADSIG
+func tsigErrorStr(code ResponseCode) string {
+	switch code {
+	case ResponseCodeNoError:
+		return "NOERROR"
+	case ResponseCodeBadSig:
+		return "BADSIG"
+	case ResponseCodeBadKey:
+		return "BADKEY"
+	case ResponseCodeBadTime:
+		return "BADTIME"
+	case ResponseCodeBadTrunc:
+		return "BADTRUNC"
+	}
+
+	if s, ok := ResponseCodeToStrMap[code]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("RCODE%d", code)
+}
+
+// TSIGKey is a secret shared with a server and the name both sides know it by
+type TSIGKey struct {
+	Name      string
+	Algorithm string
+	Secret    []byte
+}
+
+// NewTSIGKey creates a TSIGKey, checking the algorithm is supported. The
+// algorithm may be given with or without the trailing period.
+func NewTSIGKey(name, algorithm string, secret []byte) (*TSIGKey, error) {
+	algorithm = strings.ToLower(Fqdn(algorithm))
+
+	if _, ok := tsigAlgorithms[algorithm]; !ok {
+		return nil, fmt.Errorf("Unsupported TSIG algorithm '%s'", strings.TrimSuffix(algorithm, "."))
+	}
+
+	if _, err := encodeDomainName(name); err != nil || name == "" {
+		return nil, fmt.Errorf("Invalid TSIG key name '%s'", name)
+	}
+
+	if len(secret) == 0 {
+		return nil, errors.New("TSIG secret is empty")
+	}
+
+	return &TSIGKey{Name: strings.ToLower(Fqdn(name)), Algorithm: algorithm, Secret: secret}, nil
+}
+
+// ParseTSIGKey reads a key given as "name:algorithm:secret" with the secret
+// encoded in base64, such as "transfer-key:hmac-sha256:c2VjcmV0"
+func ParseTSIGKey(s string) (*TSIGKey, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("Invalid TSIG key '%s', expected name:algorithm:secret", s)
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid TSIG secret: %v", err)
+	}
+
+	return NewTSIGKey(parts[0], parts[1], secret)
+}
+
+var (
+	keyFileNameRe      = regexp.MustCompile(`key\s+"?([^"\s{]+)"?\s*{`)
+	keyFileAlgorithmRe = regexp.MustCompile(`algorithm\s+"?([\w.-]+)"?\s*;`)
+	keyFileSecretRe    = regexp.MustCompile(`secret\s+"([^"]+)"\s*;`)
+)
+
+// LoadTSIGKeyFile reads a key from a file holding either a single
+// "name:algorithm:secret" line or a key statement as written by tsig-keygen:
+//
+//     key "transfer-key" {
+//         algorithm hmac-sha256;
+//         secret "c2VjcmV0";
+//     };
+func LoadTSIGKeyFile(path string) (*TSIGKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	content := string(data)
+
+	if !strings.Contains(content, "{") {
+		return ParseTSIGKey(strings.TrimSpace(content))
+	}
+
+	name := keyFileNameRe.FindStringSubmatch(content)
+	algorithm := keyFileAlgorithmRe.FindStringSubmatch(content)
+	secret := keyFileSecretRe.FindStringSubmatch(content)
+
+	if name == nil || algorithm == nil || secret == nil {
+		return nil, fmt.Errorf("%s: Expected a key statement with an algorithm and secret", path)
+	}
+
+	secretBytes, err := base64.StdEncoding.DecodeString(secret[1])
+	if err != nil {
+		return nil, fmt.Errorf("%s: Invalid TSIG secret: %v", path, err)
+	}
+
+	return NewTSIGKey(name[1], algorithm[1], secretBytes)
+}
+
+// Sign adds a TSIG record to an encoded message, returning the signed message
+// and its MAC. Requests are signed with a nil requestMAC while responses are
+// signed with the MAC of the request they answer.
+func (k *TSIGKey) Sign(msg, requestMAC []byte) ([]byte, []byte, error) {
+	return k.sign(msg, requestMAC, false, ResponseCodeNoError, nil)
+}
+
+// SignError adds a TSIG record reporting that a request could not be
+// verified to an encoded response. A BADTIME response is signed and carries
+// the current time so the client can see how far its clock is out. The other
+// errors leave the MAC empty since the request cannot be trusted.
+func (k *TSIGKey) SignError(msg, requestMAC []byte, code ResponseCode) ([]byte, error) {
+	if code == ResponseCodeBadTime {
+		var now bytes.Buffer
+		writeTimeSigned(&now, uint64(time.Now().Unix()))
+
+		signed, _, err := k.sign(msg, requestMAC, false, code, now.Bytes())
+
+		return signed, err
+	}
+
+	if len(msg) < maxHeaderSize {
+		return nil, errors.New("Message is too short to sign")
+	}
+
+	rdata := &RDataTSIG{
+		algorithm:  k.Algorithm,
+		timeSigned: uint64(time.Now().Unix()),
+		fudge:      DefaultTSIGFudge,
+		originalID: binary.BigEndian.Uint16(msg),
+		error:      code,
+	}
+
+	return appendTSIG(msg, k.Name, rdata)
+}
+
+// sign computes the MAC of msg and adds the TSIG record holding it
+func (k *TSIGKey) sign(msg, prevMAC []byte, timersOnly bool, code ResponseCode, otherData []byte) ([]byte, []byte, error) {
+	newHash, ok := tsigAlgorithms[k.Algorithm]
+	if !ok {
+		return nil, nil, fmt.Errorf("Unsupported TSIG algorithm '%s'", k.Algorithm)
+	}
+
+	if len(msg) < maxHeaderSize {
+		return nil, nil, errors.New("Message is too short to sign")
+	}
+
+	rdata := &RDataTSIG{
+		algorithm:  k.Algorithm,
+		timeSigned: uint64(time.Now().Unix()),
+		fudge:      DefaultTSIGFudge,
+		originalID: binary.BigEndian.Uint16(msg),
+		error:      code,
+		otherData:  otherData,
+	}
+
+	mac := hmac.New(newHash, k.Secret)
+	k.writeDigest(mac, prevMAC, msg, rdata, timersOnly)
+	rdata.mac = mac.Sum(nil)
+
+	signed, err := appendTSIG(msg, k.Name, rdata)
+
+	return signed, rdata.mac, err
+}
+
+// Verify checks the TSIG record at the end of an encoded message was signed
+// with this key, returning its MAC. Responses are verified with the MAC of
+// the request they answer.
+func (k *TSIGKey) Verify(msg, requestMAC []byte) ([]byte, error) {
+	return k.verify(msg, requestMAC, nil, false)
+}
+
+// verify checks the signature of msg which covers prevMAC, any unsigned
+// messages before it and msg itself
+func (k *TSIGKey) verify(msg, prevMAC, unsigned []byte, timersOnly bool) ([]byte, error) {
+	stripped, rr, err := splitTSIG(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if rr == nil {
+		return nil, ErrTSIGMissing
+	}
+
+	rdata, ok := rr.RDATA.(*RDataTSIG)
+	if !ok {
+		return nil, errors.New("Error unpacking TSIG: Missing RDATA")
+	}
+
+	if !strings.EqualFold(Fqdn(rr.NAME), k.Name) || !strings.EqualFold(rdata.algorithm, k.Algorithm) {
+		return nil, ErrTSIGBadKey
+	}
+
+	// An error reported by the other side means the MAC may be empty
+	if rdata.error != ResponseCodeNoError {
+		return nil, &TSIGError{Code: rdata.error}
+	}
+
+	newHash, ok := tsigAlgorithms[k.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported TSIG algorithm '%s'", k.Algorithm)
+	}
+
+	mac := hmac.New(newHash, k.Secret)
+	k.writeDigest(mac, prevMAC, append(append([]byte{}, unsigned...), stripped...), rdata, timersOnly)
+
+	if !hmac.Equal(mac.Sum(nil), rdata.mac) {
+		return nil, ErrTSIGBadSig
+	}
+
+	now := time.Now().Unix()
+	signed := int64(rdata.timeSigned)
+
+	if now-signed > int64(rdata.fudge) || signed-now > int64(rdata.fudge) {
+		return nil, ErrTSIGBadTime
+	}
+
+	return rdata.mac, nil
+}
+
+// writeDigest writes everything covered by the MAC to h. The full TSIG
+// variables are used unless timersOnly is set, as it is for the messages
+// after the first of a multi-message response.
+func (k *TSIGKey) writeDigest(h hash.Hash, prevMAC, msgs []byte, rdata *RDataTSIG, timersOnly bool) {
+	var buf bytes.Buffer
+
+	if prevMAC != nil {
+		binary.Write(&buf, binary.BigEndian, uint16(len(prevMAC)))
+		buf.Write(prevMAC)
+	}
+
+	buf.Write(msgs)
+
+	if !timersOnly {
+		name, _ := encodeDomainName(strings.ToLower(k.Name))
+		buf.Write(name)
+		binary.Write(&buf, binary.BigEndian, RecordClassWildcard)
+		binary.Write(&buf, binary.BigEndian, uint32(0))
+
+		algorithm, _ := encodeDomainName(strings.ToLower(k.Algorithm))
+		buf.Write(algorithm)
+	}
+
+	writeTimeSigned(&buf, rdata.timeSigned)
+	binary.Write(&buf, binary.BigEndian, rdata.fudge)
+
+	if !timersOnly {
+		binary.Write(&buf, binary.BigEndian, rdata.error)
+		binary.Write(&buf, binary.BigEndian, uint16(len(rdata.otherData)))
+		buf.Write(rdata.otherData)
+	}
+
+	h.Write(buf.Bytes())
+}
+
+// writeTimeSigned writes a time as the 48 bit number of seconds used by TSIG
+func writeTimeSigned(buf *bytes.Buffer, t uint64) {
+	binary.Write(buf, binary.BigEndian, uint16(t>>32))
+	binary.Write(buf, binary.BigEndian, uint32(t))
+}
+
+// appendTSIG adds a TSIG record to the end of an encoded message and counts it
+// in the header
+func appendTSIG(msg []byte, name string, rdata *RDataTSIG) ([]byte, error) {
+	rr := RR{NAME: name, TYPE: RecordTypeTSIG, CLASS: RecordClassWildcard, RDATA: rdata}
+
+	rrBytes, err := rr.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	signed := append(append([]byte{}, msg...), rrBytes...)
+	binary.BigEndian.PutUint16(signed[10:], binary.BigEndian.Uint16(signed[10:])+1)
+
+	return signed, nil
+}
+
+// splitTSIG finds the TSIG record which must be the last record of an encoded
+// message. The message is returned as it was before the record was added,
+// with the original ID and without the record counted in the header. A nil
+// record is returned when the message is not signed.
+func splitTSIG(msg []byte) ([]byte, *RR, error) {
+	h := new(Header)
+
+	offset, err := DecodeHeader(msg, 0, h)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := uint16(0); i < h.QDCOUNT; i++ {
+		if offset, err = DecodeQuestion(msg, offset, new(Question)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	count := int(h.ANCOUNT) + int(h.NSCOUNT) + int(h.ARCOUNT)
+	start := offset
+	rr := new(RR)
+
+	for i := 0; i < count; i++ {
+		start = offset
+
+		if offset, err = DecodeRR(msg, offset, rr); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if h.ARCOUNT == 0 || rr.TYPE != RecordTypeTSIG {
+		return msg, nil, nil
+	}
+
+	rdata, ok := rr.RDATA.(*RDataTSIG)
+	if !ok {
+		return nil, nil, errors.New("Error unpacking TSIG: Missing RDATA")
+	}
+
+	stripped := append([]byte{}, msg[:start]...)
+	binary.BigEndian.PutUint16(stripped, rdata.originalID)
+	binary.BigEndian.PutUint16(stripped[10:], h.ARCOUNT-1)
+
+	return stripped, rr, nil
+}
+
+// TSIGStream signs or verifies the messages of a response spanning several
+// messages, such as a zone transfer, where each signature carries on from the
+// one before it. See RFC 8945 section 5.3.1
+type TSIGStream struct {
+	key *TSIGKey
+
+	// the MAC of the request and then of the last message signed
+	mac []byte
+
+	// set once the first message has been signed or verified
+	started bool
+
+	// the messages received since the last signed one
+	unsigned      bytes.Buffer
+	unsignedCount int
+}
+
+// NewTSIGStream creates a TSIGStream for the response to the request with the
+// given MAC
+func NewTSIGStream(key *TSIGKey, requestMAC []byte) *TSIGStream {
+	return &TSIGStream{key: key, mac: requestMAC}
+}
+
+// Sign adds a TSIG record to the next encoded message of the response. Every
+// message is signed.
+func (s *TSIGStream) Sign(msg []byte) ([]byte, error) {
+	signed, mac, err := s.key.sign(msg, s.mac, s.started, ResponseCodeNoError, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mac = mac
+	s.started = true
+
+	return signed, nil
+}
+
+// Verify checks the signature of the next encoded message of the response.
+// The first message must be signed but a signer may leave up to 99 messages
+// in a row after it unsigned, which are then covered by the next signature.
+func (s *TSIGStream) Verify(msg []byte) error {
+	if s.started {
+		_, rr, err := splitTSIG(msg)
+		if err != nil {
+			return err
+		}
+
+		if rr == nil {
+			if s.unsignedCount++; s.unsignedCount > maxUnsignedTSIGMessages {
+				return fmt.Errorf("More than %d messages in a row were not signed with TSIG", maxUnsignedTSIGMessages)
+			}
+
+			s.unsigned.Write(msg)
+			return nil
+		}
+	}
+
+	mac, err := s.key.verify(msg, s.mac, s.unsigned.Bytes(), s.started)
+	if err != nil {
+		return err
+	}
+
+	s.mac = mac
+	s.started = true
+	s.unsigned.Reset()
+	s.unsignedCount = 0
+
+	return nil
+}
+
+// Done checks that the last message verified was signed
+func (s *TSIGStream) Done() error {
+	if s.unsignedCount > 0 {
+		return ErrTSIGUnsignedEnd
+	}
+
+	return nil
+}
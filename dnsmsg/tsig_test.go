@@ -0,0 +1,347 @@
+package dnsmsg
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testTSIGKey returns a key for signing test messages
+func testTSIGKey(t *testing.T, secret string) *TSIGKey {
+	t.Helper()
+
+	key, err := NewTSIGKey("transfer-key", "hmac-sha256", []byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// testMessage encodes a message with the ID and question given
+func testMessage(t *testing.T, id uint16, name string) []byte {
+	t.Helper()
+
+	m := NewQuery(name, RecordTypeA)
+	m.Header.ID = id
+
+	data, err := m.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+// signAt signs msg as sign does but with the time signed given. The MAC
+// covers prevMAC and any unsigned messages which came before msg.
+func signAt(t *testing.T, k *TSIGKey, msg, prevMAC, unsigned []byte, timersOnly bool, timeSigned uint64) ([]byte, []byte) {
+	t.Helper()
+
+	rdata := &RDataTSIG{
+		algorithm:  k.Algorithm,
+		timeSigned: timeSigned,
+		fudge:      DefaultTSIGFudge,
+		originalID: binary.BigEndian.Uint16(msg),
+	}
+
+	mac := hmac.New(tsigAlgorithms[k.Algorithm], k.Secret)
+	k.writeDigest(mac, prevMAC, append(append([]byte{}, unsigned...), msg...), rdata, timersOnly)
+	rdata.mac = mac.Sum(nil)
+
+	signed, err := appendTSIG(msg, k.Name, rdata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed, rdata.mac
+}
+
+func TestTSIGRoundTrip(t *testing.T) {
+	key := testTSIGKey(t, "secret")
+
+	query := testMessage(t, 1, "www.example.com.")
+
+	signed, requestMAC, err := key.Sign(query, nil)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	m := Message{}
+	if _, err := DecodeMessage(signed, &m); err != nil {
+		t.Fatalf("DecodeMessage: %v", err)
+	}
+
+	if n := len(m.Additional); n != 1 || m.Additional[0].TYPE != RecordTypeTSIG || m.Additional[0].NAME != "transfer-key." {
+		t.Fatalf("additional section = %v, want the TSIG record", m.Additional)
+	}
+
+	mac, err := key.Verify(signed, nil)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	if !hmac.Equal(mac, requestMAC) {
+		t.Errorf("Verify returned MAC %x, want %x", mac, requestMAC)
+	}
+
+	// The response is signed over the MAC of the request
+	resp := testMessage(t, 1, "www.example.com.")
+
+	signedResp, _, err := key.Sign(resp, requestMAC)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	if _, err := key.Verify(signedResp, requestMAC); err != nil {
+		t.Errorf("Verify of the response: %v", err)
+	}
+
+	if _, err := key.Verify(signedResp, nil); err != ErrTSIGBadSig {
+		t.Errorf("Verify of the response without the request MAC = %v, want %v", err, ErrTSIGBadSig)
+	}
+
+	// Signing keeps the original ID so a forwarder may change it
+	binary.BigEndian.PutUint16(signed, 99)
+
+	if _, err := key.Verify(signed, nil); err != nil {
+		t.Errorf("Verify after the ID changed: %v", err)
+	}
+}
+
+func TestTSIGVerifyErrors(t *testing.T) {
+	key := testTSIGKey(t, "secret")
+	query := testMessage(t, 1, "www.example.com.")
+
+	signed, _, err := key.Sign(query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherName, err := NewTSIGKey("other-key", HmacSHA256, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherAlgorithm, err := NewTSIGKey("transfer-key", HmacSHA512, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := uint64(time.Now().Unix())
+	late, _ := signAt(t, key, query, nil, nil, false, now-DefaultTSIGFudge-10)
+	early, _ := signAt(t, key, query, nil, nil, false, now+DefaultTSIGFudge+10)
+	inFudge, _ := signAt(t, key, query, nil, nil, false, now-DefaultTSIGFudge+10)
+
+	// Changing the question leaves the signature over the old one
+	tampered := append([]byte{}, signed...)
+	tampered[len(query)-6] = 'X'
+
+	tests := []struct {
+		name string
+		key  *TSIGKey
+		msg  []byte
+		want error
+	}{
+		{"unsigned", key, query, ErrTSIGMissing},
+		{"other secret", testTSIGKey(t, "guess"), signed, ErrTSIGBadSig},
+		{"tampered", key, tampered, ErrTSIGBadSig},
+		{"other key name", otherName, signed, ErrTSIGBadKey},
+		{"other algorithm", otherAlgorithm, signed, ErrTSIGBadKey},
+		{"signed too long ago", key, late, ErrTSIGBadTime},
+		{"signed in the future", key, early, ErrTSIGBadTime},
+		{"within the fudge", key, inFudge, nil},
+	}
+
+	for _, tt := range tests {
+		if _, err := tt.key.Verify(tt.msg, nil); err != tt.want {
+			t.Errorf("%s: Verify error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestTSIGSignError(t *testing.T) {
+	key := testTSIGKey(t, "secret")
+
+	_, requestMAC, err := key.Sign(testMessage(t, 1, "www.example.com."), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, code := range []ResponseCode{ResponseCodeBadSig, ResponseCodeBadKey, ResponseCodeBadTime} {
+		signed, err := key.SignError(testMessage(t, 1, "www.example.com."), requestMAC, code)
+		if err != nil {
+			t.Fatalf("SignError: %v", err)
+		}
+
+		_, err = key.Verify(signed, requestMAC)
+
+		if tsigErr, ok := err.(*TSIGError); !ok || tsigErr.Code != code {
+			t.Errorf("Verify of a %s response = %v, want the error reported", tsigErrorStr(code), err)
+		}
+
+		_, rr, err := splitTSIG(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rdata := rr.RDATA.(*RDataTSIG)
+
+		// Only BADTIME is signed, carrying the time of the server
+		if signedMAC := len(rdata.MAC()) > 0; signedMAC != (code == ResponseCodeBadTime) {
+			t.Errorf("%s response has a MAC of %d octets", tsigErrorStr(code), len(rdata.MAC()))
+		}
+
+		if code == ResponseCodeBadTime && len(rdata.OtherData()) != 6 {
+			t.Errorf("BADTIME other data = %x, want the 48 bit time", rdata.OtherData())
+		}
+	}
+}
+
+func TestTSIGStream(t *testing.T) {
+	key := testTSIGKey(t, "secret")
+
+	_, requestMAC, err := key.Sign(testMessage(t, 7, "example.com."), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := make([][]byte, 5)
+	for i := range msgs {
+		msgs[i] = testMessage(t, 7, fmt.Sprintf("m%d.example.com.", i))
+	}
+
+	now := uint64(time.Now().Unix())
+
+	// Every message signed by TSIGStream
+	allSigned := make([][]byte, len(msgs))
+	signer := NewTSIGStream(key, requestMAC)
+
+	for i, msg := range msgs {
+		if allSigned[i], err = signer.Sign(msg); err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+	}
+
+	// The first and last messages signed with the two between them left
+	// unsigned and covered by the last signature
+	first, mac := signAt(t, key, msgs[0], requestMAC, nil, false, now)
+	last, _ := signAt(t, key, msgs[3], mac, append(append([]byte{}, msgs[1]...), msgs[2]...), true, now)
+	withUnsigned := [][]byte{first, msgs[1], msgs[2], last}
+
+	tamperedUnsigned := append([]byte{}, msgs[1]...)
+	tamperedUnsigned[len(tamperedUnsigned)-6] = 'X'
+
+	tests := []struct {
+		name       string
+		requestMAC []byte
+		msgs       [][]byte
+		verify     error
+		done       error
+	}{
+		{"every message signed", requestMAC, allSigned, nil, nil},
+		{"unsigned intermediates", requestMAC, withUnsigned, nil, nil},
+		{"tampered intermediate", requestMAC, [][]byte{first, tamperedUnsigned, msgs[2], last}, ErrTSIGBadSig, nil},
+		{"unsigned first message", requestMAC, [][]byte{msgs[0], allSigned[1]}, ErrTSIGMissing, nil},
+		{"unsigned last message", requestMAC, [][]byte{first, msgs[1]}, nil, ErrTSIGUnsignedEnd},
+		{"out of order", requestMAC, [][]byte{allSigned[0], allSigned[2]}, ErrTSIGBadSig, nil},
+		{"signed over another request", []byte("other"), allSigned[:1], ErrTSIGBadSig, nil},
+	}
+
+	for _, tt := range tests {
+		stream := NewTSIGStream(key, tt.requestMAC)
+
+		var err error
+		for _, msg := range tt.msgs {
+			if err = stream.Verify(msg); err != nil {
+				break
+			}
+		}
+
+		if err != tt.verify {
+			t.Errorf("%s: Verify error = %v, want %v", tt.name, err, tt.verify)
+			continue
+		}
+
+		if err == nil {
+			if err := stream.Done(); err != tt.done {
+				t.Errorf("%s: Done = %v, want %v", tt.name, err, tt.done)
+			}
+		}
+	}
+
+	// A signer may only leave 99 messages in a row unsigned
+	stream := NewTSIGStream(key, requestMAC)
+	if err := stream.Verify(first); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		err = stream.Verify(msgs[1])
+	}
+
+	if err == nil {
+		t.Error("Verify accepted 100 unsigned messages in a row")
+	}
+}
+
+func TestParseTSIGKey(t *testing.T) {
+	key, err := ParseTSIGKey("Transfer-Key:HMAC-SHA256:c2VjcmV0")
+	if err != nil {
+		t.Fatalf("ParseTSIGKey: %v", err)
+	}
+
+	if key.Name != "transfer-key." || key.Algorithm != HmacSHA256 || string(key.Secret) != "secret" {
+		t.Errorf("key = %+v, want transfer-key. with hmac-sha256.", key)
+	}
+
+	for _, s := range []string{
+		"transfer-key:hmac-sha256",
+		"transfer-key:hmac-md5:c2VjcmV0",
+		"transfer-key:hmac-sha256:not base64",
+		"transfer-key:hmac-sha256:",
+	} {
+		if _, err := ParseTSIGKey(s); err == nil {
+			t.Errorf("ParseTSIGKey(%q) succeeded", s)
+		}
+	}
+}
+
+func TestLoadTSIGKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"line.key": "transfer-key:hmac-sha512:c2VjcmV0\n",
+		"bind.key": `key "transfer-key" {
+	algorithm hmac-sha512;
+	secret "c2VjcmV0";
+};
+`,
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		key, err := LoadTSIGKeyFile(path)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		if key.Name != "transfer-key." || key.Algorithm != HmacSHA512 || string(key.Secret) != "secret" {
+			t.Errorf("%s: key = %+v, want transfer-key. with hmac-sha512.", name, key)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package dnsmsg
+
+// UPDATE messages reuse the four sections of a query with a different
+// meaning, see RFC 2136 section 2:
+//
+//     +---------------------+
+//     |        Header       |
+//     +---------------------+
+//     |         Zone        | specifies the zone to be updated
+//     +---------------------+
+//     |     Prerequisite    | RRs or RRsets which must (not) preexist
+//     +---------------------+
+//     |        Update       | RRs or RRsets to be added or deleted
+//     +---------------------+
+//     |   Additional Data   | additional data
+//     +---------------------+
+//
+// The zone is held in Questions, the prerequisites in Answers and the updates
+// in Authority. The CLASS and TTL of each record tell the server what to do
+// with it.
+
+// NewUpdate creates an UPDATE message with a random ID for the zone in the IN
+// class. Prerequisites and updates are added with the methods below.
+func NewUpdate(zone string) *Message {
+	m := NewQuery(Fqdn(zone), RecordTypeSOA)
+	m.Header.OPCODE = OpcodeUpdate
+	m.Header.RD = 0
+
+	return m
+}
+
+// emptyRR builds a record without RDATA which refers to every record of typ
+// owned by name
+func emptyRR(name string, typ RecordType, class RecordClass) RR {
+	return RR{NAME: Fqdn(name), TYPE: typ, CLASS: class, RDATA: &RDataEmpty{}}
+}
+
+// NameInUse adds a prerequisite that name owns at least one record
+func (m *Message) NameInUse(name string) {
+	m.Answers = append(m.Answers, emptyRR(name, RecordTypeWildcard, RecordClassWildcard))
+}
+
+// NameNotInUse adds a prerequisite that name does not own any records
+func (m *Message) NameNotInUse(name string) {
+	m.Answers = append(m.Answers, emptyRR(name, RecordTypeWildcard, RecordClassNone))
+}
+
+// RRsetExists adds a prerequisite that name owns records of type typ whatever
+// they hold
+func (m *Message) RRsetExists(name string, typ RecordType) {
+	m.Answers = append(m.Answers, emptyRR(name, typ, RecordClassWildcard))
+}
+
+// RRsetNotExists adds a prerequisite that name does not own records of type
+// typ
+func (m *Message) RRsetNotExists(name string, typ RecordType) {
+	m.Answers = append(m.Answers, emptyRR(name, typ, RecordClassNone))
+}
+
+// RRsetExistsWithData adds a prerequisite that the RRset of each record given
+// exists and holds exactly the records given for it. The TTL of the records
+// is not compared.
+func (m *Message) RRsetExistsWithData(rrs ...RR) {
+	for _, rr := range rrs {
+		rr.TTL = 0
+		m.Answers = append(m.Answers, rr)
+	}
+}
+
+// Insert adds updates which add each record to the zone
+func (m *Message) Insert(rrs ...RR) {
+	m.Authority = append(m.Authority, rrs...)
+}
+
+// Remove adds updates which delete each record from the zone
+func (m *Message) Remove(rrs ...RR) {
+	for _, rr := range rrs {
+		rr.CLASS = RecordClassNone
+		rr.TTL = 0
+		m.Authority = append(m.Authority, rr)
+	}
+}
+
+// RemoveRRset adds an update which deletes every record of type typ owned by
+// name
+func (m *Message) RemoveRRset(name string, typ RecordType) {
+	m.Authority = append(m.Authority, emptyRR(name, typ, RecordClassWildcard))
+}
+
+// RemoveName adds an update which deletes every record owned by name
+func (m *Message) RemoveName(name string) {
+	m.Authority = append(m.Authority, emptyRR(name, RecordTypeWildcard, RecordClassWildcard))
+}
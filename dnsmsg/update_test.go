@@ -0,0 +1,85 @@
+package dnsmsg
+
+import (
+	"testing"
+)
+
+func TestUpdateRoundTrip(t *testing.T) {
+	a, err := ParseRR("www.example.com. 300 IN A 192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewUpdate("example.com")
+	m.NameInUse("www.example.com.")
+	m.NameNotInUse("new.example.com.")
+	m.RRsetExists("www.example.com.", RecordTypeA)
+	m.RRsetNotExists("www.example.com.", RecordTypeAAAA)
+	m.RRsetExistsWithData(a)
+	m.Insert(a)
+	m.Remove(a)
+	m.RemoveRRset("old.example.com.", RecordTypeMX)
+	m.RemoveName("gone.example.com.")
+
+	got := Message{}
+	if _, err := DecodeMessage(roundTrip(t, *m), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Header.OPCODE != OpcodeUpdate || got.Questions[0].QTYPE != RecordTypeSOA {
+		t.Errorf("header %+v with zone %v, want an UPDATE", got.Header, got.Questions)
+	}
+
+	// Records of class ANY or NONE without RDATA refer to a whole RRset or
+	// name
+	tests := []struct {
+		rr    RR
+		class RecordClass
+		empty bool
+	}{
+		{got.Answers[0], RecordClassWildcard, true},
+		{got.Answers[1], RecordClassNone, true},
+		{got.Answers[2], RecordClassWildcard, true},
+		{got.Answers[3], RecordClassNone, true},
+		{got.Answers[4], RecordClassIN, false},
+		{got.Authority[0], RecordClassIN, false},
+		{got.Authority[1], RecordClassNone, false},
+		{got.Authority[2], RecordClassWildcard, true},
+		{got.Authority[3], RecordClassWildcard, true},
+	}
+
+	for _, tt := range tests {
+		_, empty := tt.rr.RDATA.(*RDataEmpty)
+
+		if tt.rr.CLASS != tt.class || empty != tt.empty {
+			t.Errorf("%s: class %d with empty RDATA %v, want class %d and %v", &tt.rr, tt.rr.CLASS, empty, tt.class, tt.empty)
+		}
+	}
+
+	if got.Answers[4].TTL != 0 || got.Authority[1].TTL != 0 {
+		t.Errorf("prerequisite and deletion TTLs = %d and %d, want 0", got.Answers[4].TTL, got.Authority[1].TTL)
+	}
+}
+
+// Only UPDATE records of class ANY or NONE may leave out RDATA their type
+// needs
+func TestDecodeEmptyRData(t *testing.T) {
+	for _, class := range []RecordClass{RecordClassIN, RecordClassWildcard, RecordClassNone} {
+		m := Message{
+			Header:    Header{ID: 1, OPCODE: OpcodeUpdate},
+			Questions: []Question{{QNAME: "example.com.", QTYPE: RecordTypeSOA, QCLASS: RecordClassIN}},
+			Authority: []RR{{NAME: "www.example.com.", TYPE: RecordTypeCNAME, CLASS: class, RDATA: &RDataEmpty{}}},
+		}
+
+		data, err := m.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = DecodeMessage(data, &Message{})
+
+		if want := class != RecordClassIN; (err == nil) != want {
+			t.Errorf("class %d: DecodeMessage error = %v, want success %v", class, err, want)
+		}
+	}
+}
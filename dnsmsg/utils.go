@@ -0,0 +1,458 @@
+package dnsmsg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// mostly so algorithms can make sense when read
+	octetMaxIdx = 7
+
+	// See RFC 1035 section 2.3.4
+	maxLabelOctets = 63
+
+	// See RFC 1035 section 3.3
+	maxCharacterStringOctets = 255
+
+	// See RFC 1035 section 2.3.4
+	maxDomainNameWireOctets = 255
+
+	// This is the maximum number of compression pointers that should occur in a
+	// semantically valid message. Each label in a domain name must be at least one
+	// octet and is separated by a period. The root label won't be represented by a
+	// compression pointer to a compression pointer, hence the -2 to exclude the
+	// smallest valid root label.
+	//
+	// It is possible to construct a valid message that has more compression pointers
+	// than this, and still doesn't loop, by pointing to a previous pointer. This is
+	// not something a well written implementation should ever do, so we leave them
+	// to trip the maximum compression pointer check.
+	// borrowed from: https://github.com/miekg/dns/blob/master/msg.go
+	maxCompressionPointers = (maxDomainNameWireOctets+1)/2 - 2
+)
+
+// makeOctetMask creates a bitmask. This bitmask can be used to extract a value
+// from an octet by ANDing the bytes. For example, say we wanted to read just
+// the first 4 bits of the octet. We would want to unset the other bits so only
+// those 4 are set. We create a mask to do that.
+//
+// mask = (1 << 4) - 1 = 00001111
+// val = 10011101
+// val & mask = 00001101
+func makeOctetMask(size uint) byte {
+	return (1 << size) - 1
+}
+
+// In order to set the correct fields for the header, we want to use bit
+// shifting in the octet. For example:
+//
+// Setting AA in the 3rd octet in the header:
+// AA = 00000001 (is authoritative)
+// octetMaxIdx = 7
+// bitIdx = 5
+// size = 1
+// 00000001 << 7 - (5 + (1 - 1)) === 00000001 << 2 === 00000100
+//
+// This would set the AA field based on the RFC since the octet scheme is:
+///
+//     +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//     |QR|   Opcode  |AA|TC|RD|RA|   Z    |   RCODE   |
+//     +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+func setBitsAtIdx(b byte, bitIdx, size uint) byte {
+	return b << (octetMaxIdx - (bitIdx + (size - 1)))
+}
+
+// getBitAtIdx is similiar to setting bits except we want to shift them to the
+// right and then use a bit mask to unset all of the additional values to the
+// left of our bits. For example, let's get the 3 bit sequence starting at the
+// fourth bit in the octet.
+//
+// b = 10010010
+// b = 100 | 100 | 10
+// bitIdx = 3
+// size = 3
+// b >> (7 - (3 + (3 - 1))) === b >> (7 - 5) === 00100100
+// 00100100 & 00000111 === 00000100
+func getBitsAtIdx(b byte, bitIdx, size uint) byte {
+	return (b >> (octetMaxIdx - (bitIdx + (size - 1)))) & makeOctetMask(size)
+}
+
+// decodeUint16 helps in unpacking a BigEndian Uint16 value based on the
+// current offset of bytes read.
+func decodeUint16(data []byte, offset int) (uint16, int, error) {
+	if offset+2 > len(data) {
+		return 0, len(data), errors.New("Error unpacking Uint16: Overflow")
+	}
+	return binary.BigEndian.Uint16(data[offset:]), offset + 2, nil
+}
+
+// decodeUint32 helps in unpacking a BigEndian Uint32 value based on the
+// current offset of bytes read.
+func decodeUint32(data []byte, offset int) (uint32, int, error) {
+	if offset+4 > len(data) {
+		return 0, len(data), errors.New("Error unpacking Uint32: Overflow")
+	}
+	return binary.BigEndian.Uint32(data[offset:]), offset + 4, nil
+}
+
+// extractDomainNameLabels parses data based on how domains names are stored in
+// DNS messages. It takes into account name compression by following pointers
+// and returns a slice of labels for the domain name along with the offset
+// directly after the name where it was first encountered. The labels are in
+// presentation format with special and non-printable octets escaped.
+func extractDomainNameLabels(data []byte, bytesRead int) ([]string, int, error) {
+	var labels []string
+
+	ptrsFollowed := 0
+	domainSpaceLeft := maxDomainNameWireOctets
+
+	// Once a pointer is followed the name continues elsewhere in the message
+	// so we remember where the name ended at its original position.
+	offset := bytesRead
+	endOffset := -1
+
+	for {
+		if offset >= len(data) {
+			return labels, bytesRead, errors.New("Error unpacking domain name: Overflow")
+		}
+
+		currentByte := data[offset]
+
+		switch currentByte & 0xC0 {
+
+		// we have a pointer
+		case 0xC0:
+			if ptrsFollowed >= maxCompressionPointers {
+				return labels, bytesRead, errors.New("Too many compression pointers in domain name")
+			}
+
+			if offset+1 >= len(data) {
+				return labels, bytesRead, errors.New("Error unpacking compression pointer: Overflow")
+			}
+
+			if endOffset < 0 {
+				endOffset = offset + 2
+			}
+
+			offset = int(currentByte&makeOctetMask(6))<<8 | int(data[offset+1])
+			ptrsFollowed++
+
+		// we have a label
+		case 0x00:
+			labelLen := int(currentByte)
+
+			// the null label of the root terminates the name
+			if labelLen == 0 {
+				offset++
+
+				if endOffset < 0 {
+					endOffset = offset
+				}
+
+				return labels, endOffset, nil
+			}
+
+			if offset+labelLen+1 > len(data) {
+				return labels, bytesRead, errors.New("Error unpacking label: Overflow")
+			}
+
+			label := escapeLabel(data[offset+1 : offset+labelLen+1])
+			labels = append(labels, label)
+			offset += labelLen + 1
+
+			// +1 for the label separator
+			domainSpaceLeft -= labelLen + 1
+			if domainSpaceLeft <= 0 {
+				return labels, bytesRead, errors.New("Domains exceed max size for field")
+			}
+
+		default:
+			return labels, bytesRead, errors.New("Invalid RData found: could not parse labels for domain")
+		}
+	}
+}
+
+// Get the printable string for a domain record
+func getPrintableDomainStr(data []byte, offset int) (string, int, error) {
+	var err error
+
+	labels, bytesRead, err := extractDomainNameLabels(data, offset)
+
+	if err != nil {
+		return "", bytesRead, err
+	}
+
+	return fmt.Sprintf("%s.", strings.Join(labels, ".")), bytesRead, err
+}
+
+// encodeDomainName translates a domain name into the sequence of length
+// prefixed labels used on the wire. A trailing period is optional and the root
+// domain may be given as either an empty string or a single period.
+func encodeDomainName(name string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	err := writeDomainName(&buf, name, nil)
+
+	return buf.Bytes(), err
+}
+
+// decodeCharacterString reads the length prefixed <character-string> at
+// offset, returning it along with the offset after it
+func decodeCharacterString(data []byte, offset int) (string, int, error) {
+	if offset >= len(data) || offset+1+int(data[offset]) > len(data) {
+		return "", len(data), errors.New("Error unpacking character-string: Overflow")
+	}
+
+	end := offset + 1 + int(data[offset])
+
+	return string(data[offset+1 : end]), end, nil
+}
+
+// encodeCharacterString translates text of at most 255 octets into a single
+// <character-string>
+func encodeCharacterString(buf *bytes.Buffer, txt string) error {
+	if len(txt) > maxCharacterStringOctets {
+		return fmt.Errorf("Character-string '%s' exceeds %d octets", txt, maxCharacterStringOctets)
+	}
+
+	buf.WriteByte(uint8(len(txt)))
+	buf.WriteString(txt)
+
+	return nil
+}
+
+// Fqdn returns name with a trailing period so it is fully qualified
+func Fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+
+	return name + "."
+}
+
+// IsSubDomain reports if child is equal to or falls under parent in the domain
+// name tree. Names are compared case insensitively.
+func IsSubDomain(parent, child string) bool {
+	parent = strings.ToLower(Fqdn(parent))
+	child = strings.ToLower(Fqdn(child))
+
+	for {
+		if child == parent {
+			return true
+		}
+
+		if child == "." {
+			return false
+		}
+
+		child = ParentName(child)
+	}
+}
+
+// ParentName removes the first label of a domain name. A period escaped with
+// a backslash is part of a label rather than the end of one. The parent of a
+// name with a single label is the root.
+func ParentName(name string) string {
+	for i := 0; i < len(name); i++ {
+		switch name[i] {
+		case '\\':
+			i++
+		case '.':
+			if i+1 < len(name) {
+				return name[i+1:]
+			}
+
+			return "."
+		}
+	}
+
+	return "."
+}
+
+// CountLabels returns the number of labels in a domain name not counting the
+// null label of the root
+func CountLabels(name string) int {
+	labels, err := splitLabels(name)
+	if err != nil {
+		return strings.Count(strings.Trim(name, "."), ".") + 1
+	}
+
+	return len(labels)
+}
+
+// CompareSerials compares two SOA serial numbers using the serial number
+// arithmetic of RFC 1982, which lets serials wrap around. The result is -1 if
+// a is older than b, 1 if it is newer and 0 if they are equal.
+func CompareSerials(a, b uint32) int {
+	switch diff := int32(a - b); {
+	case diff < 0:
+		return -1
+	case diff > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// escapeLabel translates the octets of a label into presentation format. The
+// octets with a special meaning in master files are escaped with a backslash
+// and those which are not printable are written as \DDD, see RFC 1035
+// section 5.1.
+func escapeLabel(label []byte) string {
+	var sb strings.Builder
+
+	for _, b := range label {
+		switch {
+		case b == '.' || b == '\\' || b == '"' || b == '(' || b == ')' || b == ';' || b == '@' || b == '$':
+			sb.WriteByte('\\')
+			sb.WriteByte(b)
+		case b < '!' || b > '~':
+			sb.WriteString(fmt.Sprintf("\\%03d", b))
+		default:
+			sb.WriteByte(b)
+		}
+	}
+
+	return sb.String()
+}
+
+// splitLabels breaks a domain name in presentation format into the octets of
+// each of its labels. Periods escaped with a backslash are kept within a
+// label and escape sequences are interpreted.
+func splitLabels(name string) ([]string, error) {
+	var labels []string
+	var label []byte
+
+	if name == "." || name == "" {
+		return nil, nil
+	}
+
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; {
+		case c == '.':
+			if len(label) == 0 {
+				return nil, errors.New("Malformed label found, must not be 0 length")
+			}
+
+			labels = append(labels, string(label))
+			label = nil
+
+		case c == '\\':
+			b, next, err := readEscape(name, i)
+			if err != nil {
+				return nil, err
+			}
+
+			label = append(label, b)
+			i = next - 1
+
+		default:
+			label = append(label, c)
+		}
+	}
+
+	// The trailing period of a fully qualified name is optional
+	if len(label) > 0 {
+		labels = append(labels, string(label))
+	}
+
+	return labels, nil
+}
+
+// readEscape interprets the escape sequence starting with the backslash at
+// s[i]. A backslash followed by three decimal digits is the octet with that
+// value and a backslash followed by any other character is that character. The
+// octet is returned along with the index after the sequence.
+func readEscape(s string, i int) (byte, int, error) {
+	if i+1 >= len(s) {
+		return 0, i, fmt.Errorf("Dangling escape at the end of '%s'", s)
+	}
+
+	if !isDigit(s[i+1]) {
+		return s[i+1], i + 2, nil
+	}
+
+	if i+3 >= len(s) || !isDigit(s[i+2]) || !isDigit(s[i+3]) {
+		return 0, i, fmt.Errorf("Invalid escape sequence in '%s'", s)
+	}
+
+	value := int(s[i+1]-'0')*100 + int(s[i+2]-'0')*10 + int(s[i+3]-'0')
+	if value > 255 {
+		return 0, i, fmt.Errorf("Invalid escape sequence in '%s'", s)
+	}
+
+	return byte(value), i + 4, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// quoteText writes text as a quoted <character-string>. Quotes and
+// backslashes are escaped along with any octets which are not printable.
+func quoteText(txt string) string {
+	var sb strings.Builder
+
+	sb.WriteByte('"')
+
+	for i := 0; i < len(txt); i++ {
+		switch b := txt[i]; {
+		case b == '"' || b == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(b)
+		case b < ' ' || b > '~':
+			sb.WriteString(fmt.Sprintf("\\%03d", b))
+		default:
+			sb.WriteByte(b)
+		}
+	}
+
+	sb.WriteByte('"')
+
+	return sb.String()
+}
+
+// toLowerASCII lowercases the ASCII letters in s leaving every other octet
+// alone, which is how domain names are compared
+func toLowerASCII(s string) string {
+	b := []byte(s)
+
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + ('a' - 'A')
+		}
+	}
+
+	return string(b)
+}
+
+// CompareNames orders domain names in the canonical order described in RFC
+// 4034 section 6.1. Names are compared label by label starting from the root
+// with each label compared as lowercased octets, so a name sorts ahead of the
+// names below it. The result is -1, 0 or 1 like strings.Compare.
+func CompareNames(a, b string) int {
+	aLabels, _ := splitLabels(a)
+	bLabels, _ := splitLabels(b)
+
+	for i := 1; i <= len(aLabels) && i <= len(bLabels); i++ {
+		aLabel := toLowerASCII(aLabels[len(aLabels)-i])
+		bLabel := toLowerASCII(bLabels[len(bLabels)-i])
+
+		if c := strings.Compare(aLabel, bLabel); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(aLabels) < len(bLabels):
+		return -1
+	case len(aLabels) > len(bLabels):
+		return 1
+	default:
+		return 0
+	}
+}
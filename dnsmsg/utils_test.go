@@ -0,0 +1,66 @@
+package dnsmsg
+
+import "testing"
+
+func TestParentName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"www.example.com.", "example.com."},
+		{"example.com", "com"},
+		{"com.", "."},
+		{"com", "."},
+		{".", "."},
+		{"", "."},
+		{`a\.b.example.com.`, "example.com."},
+		{`a\\.example.com.`, "example.com."},
+		{`a\046b.example.com.`, "example.com."},
+	}
+
+	for _, tt := range tests {
+		if got := ParentName(tt.name); got != tt.want {
+			t.Errorf("ParentName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsSubDomain(t *testing.T) {
+	tests := []struct {
+		parent, child string
+		want          bool
+	}{
+		{"example.com.", "www.example.com.", true},
+		{"example.com", "WWW.Example.COM", true},
+		{"example.com.", "example.com.", true},
+		{".", "example.com.", true},
+		{".", ".", true},
+		{"example.com.", "com.", false},
+		{"example.com.", "wwwexample.com.", false},
+		{"example.com.", `www\.example.com.`, false},
+		{`b\.example.com.`, `a.b\.example.com.`, true},
+	}
+
+	for _, tt := range tests {
+		if got := IsSubDomain(tt.parent, tt.child); got != tt.want {
+			t.Errorf("IsSubDomain(%q, %q) = %v, want %v", tt.parent, tt.child, got, tt.want)
+		}
+	}
+}
+
+func TestCountLabels(t *testing.T) {
+	tests := map[string]int{
+		".":                  0,
+		"":                   0,
+		"com":                1,
+		"www.example.com.":   3,
+		`a\.b.example.com.`:  3,
+		`a\\.b.example.com.`: 4,
+	}
+
+	for name, want := range tests {
+		if got := CountLabels(name); got != want {
+			t.Errorf("CountLabels(%q) = %d, want %d", name, got, want)
+		}
+	}
+}
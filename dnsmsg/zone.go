@@ -0,0 +1,1285 @@
+package dnsmsg
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTTL is given to records parsed with ParseRR which do not set one
+	DefaultTTL = 3600
+
+	// The number of nested $INCLUDE directives followed before giving up
+	maxIncludeDepth = 8
+)
+
+// ZoneParseError reports where in a zone file a problem was found
+type ZoneParseError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *ZoneParseError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// ParseZoneFile reads the records held in the master file at path. Relative
+// domain names are completed with origin until a $ORIGIN directive changes it
+// and $INCLUDE paths are relative to the directory of the file.
+func ParseZoneFile(path, origin string) ([]RR, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	p := &zoneParser{origin: Fqdn(origin)}
+
+	return p.parse(f, path)
+}
+
+// ParseZone reads the records held in a master file as described in RFC 1035
+// section 5. Each entry holds a single record:
+//
+//     <owner> [<ttl>] [<class>] <type> <rdata>
+//
+// The owner may be left blank by starting the line with whitespace to reuse
+// the previous owner, or given as @ for the origin. Names which are not fully
+// qualified are relative to the origin. The TTL defaults to the value set by
+// $TTL or the previous record, and the class defaults to the previous record.
+//
+// Parentheses allow an entry to span lines, quotes allow text to hold
+// whitespace and anything after a semicolon is a comment. The $ORIGIN, $TTL
+// and $INCLUDE directives are supported.
+func ParseZone(r io.Reader, origin string) ([]RR, error) {
+	p := &zoneParser{origin: Fqdn(origin)}
+
+	return p.parse(r, "")
+}
+
+// ParseRR parses a single resource record in the presentation format used by
+// master files. Names must be fully qualified and the TTL defaults to
+// DefaultTTL when it is left out.
+func ParseRR(s string) (RR, error) {
+	return ParseRRWithOrigin(s, ".")
+}
+
+// ParseRRWithOrigin is like ParseRR but names which are not fully qualified
+// are relative to origin
+func ParseRRWithOrigin(s, origin string) (RR, error) {
+	p := &zoneParser{
+		origin:        Fqdn(origin),
+		defaultTTL:    DefaultTTL,
+		hasDefaultTTL: true,
+	}
+
+	l := newZoneLexer(strings.NewReader(strings.TrimLeft(s, " \t")))
+
+	tokens, err := l.nextEntry()
+	if err != nil {
+		return RR{}, err
+	}
+
+	if len(tokens) == 0 {
+		return RR{}, errors.New("No record found")
+	}
+
+	if more, err := l.nextEntry(); err != nil || len(more) > 0 {
+		return RR{}, errors.New("Expected a single record")
+	}
+
+	rr, ok, err := p.parseEntry(tokens)
+	if err == nil && !ok {
+		err = errors.New("Expected a record but found a directive")
+	}
+
+	return rr, err
+}
+
+// SplitZoneFields splits a line into fields the way ParseZone does, dropping
+// any comment. Quoted fields are returned without their quotes and escape
+// sequences are kept as written.
+func SplitZoneFields(s string) ([]string, error) {
+	tokens, err := newZoneLexer(strings.NewReader(s)).nextEntry()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, len(tokens))
+	for i, token := range tokens {
+		fields[i] = token.value
+	}
+
+	return fields, nil
+}
+
+//-----------------------------------------------------------------------------
+// Lexer
+//-----------------------------------------------------------------------------
+
+// zoneToken is a single field of an entry in a master file
+type zoneToken struct {
+	value string
+
+	// the value was given between double quotes
+	quoted bool
+
+	// the line the token was found on
+	line int
+
+	// the token started at the very beginning of a line
+	lineStart bool
+}
+
+// zoneLexer splits a master file into entries made up of tokens. Escape
+// sequences are kept in the token values so names and text can interpret them.
+type zoneLexer struct {
+	r          *bufio.Reader
+	line       int
+	parenDepth int
+}
+
+func newZoneLexer(r io.Reader) *zoneLexer {
+	return &zoneLexer{r: bufio.NewReader(r), line: 1}
+}
+
+// nextEntry returns the tokens making up the next entry, which ends at a
+// newline outside of parentheses. An empty slice is returned at the end of
+// the input.
+func (l *zoneLexer) nextEntry() ([]zoneToken, error) {
+	var tokens []zoneToken
+	var sb strings.Builder
+	var token zoneToken
+
+	inToken := false
+	inQuotes := false
+	escaped := false
+	atLineStart := true
+
+	flush := func() {
+		if inToken {
+			token.value = sb.String()
+			tokens = append(tokens, token)
+			sb.Reset()
+			inToken = false
+		}
+	}
+
+	start := func(quoted bool) {
+		token = zoneToken{quoted: quoted, line: l.line, lineStart: atLineStart}
+		inToken = true
+	}
+
+	for {
+		c, _, err := l.r.ReadRune()
+
+		if err == io.EOF {
+			if inQuotes {
+				return tokens, fmt.Errorf("Unterminated quoted string starting on line %d", token.line)
+			}
+
+			if l.parenDepth > 0 {
+				return tokens, errors.New("Unbalanced parentheses at end of file")
+			}
+
+			flush()
+			return tokens, nil
+		}
+
+		if err != nil {
+			return tokens, err
+		}
+
+		switch {
+		case escaped:
+			sb.WriteRune(c)
+			escaped = false
+
+		case c == '\\':
+			if !inToken {
+				start(false)
+			}
+
+			sb.WriteRune(c)
+			escaped = true
+
+		case inQuotes && c == '"':
+			inQuotes = false
+			flush()
+
+		case inQuotes && c == '\n':
+			return tokens, fmt.Errorf("Unterminated quoted string starting on line %d", token.line)
+
+		case inQuotes:
+			sb.WriteRune(c)
+
+		case c == '"':
+			flush()
+			start(true)
+			inQuotes = true
+
+		case c == ';':
+			flush()
+
+			// The comment runs to the end of the line which is handled below
+			if _, err := l.r.ReadString('\n'); err != nil {
+				continue
+			}
+
+			l.r.UnreadByte()
+
+		case c == '(':
+			flush()
+			l.parenDepth++
+
+		case c == ')':
+			flush()
+			l.parenDepth--
+
+			if l.parenDepth < 0 {
+				return tokens, errors.New("Closing parenthesis without an opening one")
+			}
+
+		case c == '\n':
+			flush()
+			l.line++
+			atLineStart = true
+
+			if l.parenDepth == 0 && len(tokens) > 0 {
+				return tokens, nil
+			}
+
+			continue
+
+		case c == ' ' || c == '\t' || c == '\r':
+			flush()
+
+		default:
+			if !inToken {
+				start(false)
+			}
+
+			sb.WriteRune(c)
+		}
+
+		atLineStart = false
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Parser
+//-----------------------------------------------------------------------------
+
+// zoneParser holds the state carried between the entries of a master file
+type zoneParser struct {
+	origin string
+
+	// the TTL set by $TTL
+	defaultTTL    uint32
+	hasDefaultTTL bool
+
+	// the TTL, owner and class of the previous record
+	lastTTL    uint32
+	hasLastTTL bool
+	lastOwner  string
+	lastClass  RecordClass
+
+	includeDepth int
+}
+
+// parse reads every entry from r. The file name is used for errors and to
+// find the files given to $INCLUDE.
+func (p *zoneParser) parse(r io.Reader, file string) ([]RR, error) {
+	var rrs []RR
+
+	l := newZoneLexer(r)
+
+	for {
+		tokens, err := l.nextEntry()
+		if err != nil {
+			return rrs, &ZoneParseError{File: file, Line: l.line, Err: err}
+		}
+
+		if len(tokens) == 0 {
+			return rrs, nil
+		}
+
+		if directive := strings.ToUpper(tokens[0].value); tokens[0].lineStart && directive == "$INCLUDE" {
+			included, err := p.include(tokens, file)
+			if err != nil {
+				if _, ok := err.(*ZoneParseError); !ok {
+					err = &ZoneParseError{File: file, Line: tokens[0].line, Err: err}
+				}
+
+				return rrs, err
+			}
+
+			rrs = append(rrs, included...)
+			continue
+		}
+
+		rr, ok, err := p.parseEntry(tokens)
+		if err != nil {
+			return rrs, &ZoneParseError{File: file, Line: tokens[0].line, Err: err}
+		}
+
+		if ok {
+			rrs = append(rrs, rr)
+		}
+	}
+}
+
+// include reads the records of the file named by a $INCLUDE directive. The
+// origin given to the directive only applies within the included file.
+func (p *zoneParser) include(tokens []zoneToken, file string) ([]RR, error) {
+	if len(tokens) < 2 || len(tokens) > 3 {
+		return nil, errors.New("$INCLUDE expects a file name and optional origin")
+	}
+
+	if p.includeDepth >= maxIncludeDepth {
+		return nil, errors.New("Too many nested $INCLUDE directives")
+	}
+
+	path := tokens[1].value
+	if !filepath.IsAbs(path) && file != "" {
+		path = filepath.Join(filepath.Dir(file), path)
+	}
+
+	child := *p
+	child.includeDepth++
+
+	if len(tokens) == 3 {
+		origin, err := p.absName(tokens[2].value)
+		if err != nil {
+			return nil, err
+		}
+
+		child.origin = origin
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	rrs, err := child.parse(f, path)
+
+	// The owner, TTL and class carry on from the included file
+	p.lastOwner, p.lastTTL, p.hasLastTTL, p.lastClass = child.lastOwner, child.lastTTL, child.hasLastTTL, child.lastClass
+
+	return rrs, err
+}
+
+// parseEntry handles a single entry, returning false for a directive which
+// does not produce a record
+func (p *zoneParser) parseEntry(tokens []zoneToken) (RR, bool, error) {
+	var rr RR
+	var err error
+
+	first := tokens[0]
+
+	if first.lineStart && !first.quoted && strings.HasPrefix(first.value, "$") {
+		return rr, false, p.parseDirective(tokens)
+	}
+
+	i := 0
+
+	if first.lineStart {
+		if rr.NAME, err = p.absName(first.value); err != nil {
+			return rr, false, err
+		}
+
+		p.lastOwner = rr.NAME
+		i++
+	} else {
+		if p.lastOwner == "" {
+			return rr, false, errors.New("No owner name given and there is no previous owner to use")
+		}
+
+		rr.NAME = p.lastOwner
+	}
+
+	// The TTL and class are both optional and may come in either order
+	hasTTL, hasClass := false, false
+
+	for ; i < len(tokens); i++ {
+		if !hasTTL {
+			if ttl, err := parseTTL(tokens[i].value); err == nil {
+				rr.TTL, hasTTL = ttl, true
+				continue
+			}
+		}
+
+		if !hasClass {
+			if class, ok := recordClassFromStr(tokens[i].value); ok {
+				rr.CLASS, hasClass = class, true
+				continue
+			}
+		}
+
+		break
+	}
+
+	if i >= len(tokens) {
+		return rr, false, errors.New("Missing record type")
+	}
+
+	typ, err := ParseRecordType(tokens[i].value)
+	if err != nil {
+		return rr, false, err
+	}
+
+	rr.TYPE = typ
+
+	switch {
+	case hasTTL:
+		p.lastTTL, p.hasLastTTL = rr.TTL, true
+	case p.hasDefaultTTL:
+		rr.TTL = p.defaultTTL
+	case p.hasLastTTL:
+		rr.TTL = p.lastTTL
+	default:
+		return rr, false, errors.New("No TTL given and no $TTL set")
+	}
+
+	if !hasClass {
+		rr.CLASS = p.lastClass
+		if rr.CLASS == RecordClassUnknown {
+			rr.CLASS = RecordClassIN
+		}
+	}
+
+	p.lastClass = rr.CLASS
+
+	rr.RDATA, err = parseRData(typ, tokens[i+1:], p.origin)
+	if err != nil {
+		return rr, false, err
+	}
+
+	return rr, true, nil
+}
+
+// parseDirective handles $ORIGIN and $TTL. $INCLUDE is handled by the caller
+// since it needs to read another file.
+func (p *zoneParser) parseDirective(tokens []zoneToken) error {
+	directive := strings.ToUpper(tokens[0].value)
+
+	switch directive {
+
+	case "$ORIGIN":
+		if len(tokens) != 2 {
+			return errors.New("$ORIGIN expects a single domain name")
+		}
+
+		origin, err := p.absName(tokens[1].value)
+		if err != nil {
+			return err
+		}
+
+		p.origin = origin
+
+	case "$TTL":
+		if len(tokens) != 2 {
+			return errors.New("$TTL expects a single TTL")
+		}
+
+		ttl, err := parseTTL(tokens[1].value)
+		if err != nil {
+			return err
+		}
+
+		p.defaultTTL, p.hasDefaultTTL = ttl, true
+
+	case "$INCLUDE":
+		return errors.New("$INCLUDE is not allowed here")
+
+	default:
+		return fmt.Errorf("Unknown directive '%s'", tokens[0].value)
+	}
+
+	return nil
+}
+
+// absName makes a domain name fully qualified by completing relative names
+// with the current origin
+func (p *zoneParser) absName(name string) (string, error) {
+	return absDomainName(name, p.origin)
+}
+
+// absDomainName completes a relative domain name with origin. The name @
+// stands for the origin itself.
+func absDomainName(name, origin string) (string, error) {
+	switch {
+	case name == "@":
+		name = origin
+	case strings.HasSuffix(name, ".") && !strings.HasSuffix(name, "\\."):
+		// already fully qualified
+	case origin == "." || origin == "":
+		name += "."
+	default:
+		name += "." + origin
+	}
+
+	if _, err := encodeDomainName(name); err != nil {
+		return "", fmt.Errorf("Invalid domain name '%s': %v", name, err)
+	}
+
+	return name, nil
+}
+
+// parseTTL reads a TTL given in seconds or using the units w, d, h, m and s
+// such as 1h30m
+func parseTTL(s string) (uint32, error) {
+	if value, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(value), nil
+	}
+
+	var total, value uint64
+
+	digits := false
+
+	for _, c := range strings.ToLower(s) {
+		if c >= '0' && c <= '9' {
+			value = value*10 + uint64(c-'0')
+			digits = true
+
+			if value > math.MaxUint32 {
+				return 0, fmt.Errorf("TTL '%s' is too large", s)
+			}
+
+			continue
+		}
+
+		var unit uint64
+
+		switch c {
+		case 'w':
+			unit = 7 * 24 * 60 * 60
+		case 'd':
+			unit = 24 * 60 * 60
+		case 'h':
+			unit = 60 * 60
+		case 'm':
+			unit = 60
+		case 's':
+			unit = 1
+		}
+
+		if unit == 0 || !digits {
+			return 0, fmt.Errorf("Invalid TTL '%s'", s)
+		}
+
+		total += value * unit
+		value, digits = 0, false
+	}
+
+	if digits || total > math.MaxUint32 {
+		return 0, fmt.Errorf("Invalid TTL '%s'", s)
+	}
+
+	return uint32(total), nil
+}
+
+// recordClassFromStr looks up a RecordClass by its presentation format
+func recordClassFromStr(s string) (RecordClass, bool) {
+	for class, str := range RecordClassToStrMap {
+		if class != RecordClassWildcard && class != RecordClassNone && strings.EqualFold(s, str) {
+			return class, true
+		}
+	}
+
+	return RecordClassUnknown, false
+}
+
+//-----------------------------------------------------------------------------
+// RDATA presentation format
+//-----------------------------------------------------------------------------
+
+// parseRData translates the presentation format of RDATA into the
+// ResourceDataField for typ. Relative domain names are completed with origin.
+func parseRData(typ RecordType, tokens []zoneToken, origin string) (ResourceDataField, error) {
+	typStr := RecordTypeString(typ)
+
+	fields := make([]string, len(tokens))
+	for i, token := range tokens {
+		fields[i] = token.value
+	}
+
+	// Any type may give its RDATA in the generic form of RFC 3597
+	if len(tokens) > 0 && tokens[0].value == `\#` && !tokens[0].quoted {
+		return parseGenericRData(typ, fields[1:])
+	}
+
+	switch typ {
+
+	case RecordTypeA:
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("%s record expects an address", typStr)
+		}
+
+		ip := net.ParseIP(fields[0]).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("Invalid IPv4 address '%s'", fields[0])
+		}
+
+		return &RDataA{ipAddr: ip}, nil
+
+	case RecordTypeAAAA:
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("%s record expects an address", typStr)
+		}
+
+		ip := net.ParseIP(fields[0])
+		if ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf("Invalid IPv6 address '%s'", fields[0])
+		}
+
+		return &RDataAAAA{ipAddr: ip}, nil
+
+	case RecordTypeCNAME, RecordTypeNS, RecordTypePTR:
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("%s record expects a domain name", typStr)
+		}
+
+		domain, err := absDomainName(fields[0], origin)
+		if err != nil {
+			return nil, err
+		}
+
+		switch typ {
+		case RecordTypeCNAME:
+			return &RDataCNAME{domain: domain}, nil
+		case RecordTypeNS:
+			return &RDataNS{domain: domain}, nil
+		default:
+			return &RDataPTR{domain: domain}, nil
+		}
+
+	case RecordTypeMX:
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s record expects a preference and exchange", typStr)
+		}
+
+		preference, err := parseUint16(fields[0])
+		if err != nil {
+			return nil, err
+		}
+
+		exchange, err := absDomainName(fields[1], origin)
+		if err != nil {
+			return nil, err
+		}
+
+		return &RDataMX{preference: preference, exchange: exchange}, nil
+
+	case RecordTypeSRV:
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("%s record expects '<priority> <weight> <port> <target>'", typStr)
+		}
+
+		var values [3]uint16
+
+		for i, field := range fields[:3] {
+			value, err := parseUint16(field)
+			if err != nil {
+				return nil, err
+			}
+
+			values[i] = value
+		}
+
+		target, err := absDomainName(fields[3], origin)
+		if err != nil {
+			return nil, err
+		}
+
+		return &RDataSRV{priority: values[0], weight: values[1], port: values[2], target: target}, nil
+
+	case RecordTypeNAPTR:
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("%s record expects '<order> <preference> <flags> <service> <regexp> <replacement>'", typStr)
+		}
+
+		return parseNAPTR(fields, origin)
+
+	case RecordTypeURI:
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s record expects '<priority> <weight> <target>'", typStr)
+		}
+
+		priority, err := parseUint16(fields[0])
+		if err != nil {
+			return nil, err
+		}
+
+		weight, err := parseUint16(fields[1])
+		if err != nil {
+			return nil, err
+		}
+
+		target, err := unescapeText(fields[2])
+		if err != nil {
+			return nil, err
+		}
+
+		return &RDataURI{priority: priority, weight: weight, target: target}, nil
+
+	case RecordTypeTXT:
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("%s record expects at least one string", typStr)
+		}
+
+		r := new(RDataTXT)
+
+		for _, field := range fields {
+			txt, err := unescapeText(field)
+			if err != nil {
+				return nil, err
+			}
+
+			// Strings too long for a single <character-string> are split
+			// across several
+			for len(txt) > maxCharacterStringOctets {
+				r.txt = append(r.txt, txt[:maxCharacterStringOctets])
+				txt = txt[maxCharacterStringOctets:]
+			}
+
+			r.txt = append(r.txt, txt)
+		}
+
+		return r, nil
+
+	case RecordTypeSOA:
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("%s record expects '<mname> <rname> <serial> <refresh> <retry> <expire> <minimum>'", typStr)
+		}
+
+		mname, err := absDomainName(fields[0], origin)
+		if err != nil {
+			return nil, err
+		}
+
+		rname, err := absDomainName(fields[1], origin)
+		if err != nil {
+			return nil, err
+		}
+
+		serial, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid SOA serial '%s'", fields[2])
+		}
+
+		// The timers may use the same units as a TTL
+		var timers [4]uint32
+
+		for i, field := range fields[3:] {
+			if timers[i], err = parseTTL(field); err != nil {
+				return nil, fmt.Errorf("Invalid SOA value '%s'", field)
+			}
+		}
+
+		return &RDataSOA{
+			mname:   mname,
+			rname:   rname,
+			serial:  uint32(serial),
+			refresh: timers[0],
+			retry:   timers[1],
+			expire:  timers[2],
+			minimum: timers[3],
+		}, nil
+
+	case RecordTypeDNSKEY, RecordTypeCDNSKEY:
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("%s record expects '<flags> <protocol> <algorithm> <public key>'", typStr)
+		}
+
+		return parseDNSKEY(fields)
+
+	case RecordTypeRRSIG:
+		if len(fields) < 9 {
+			return nil, fmt.Errorf("%s record expects '<type covered> <algorithm> <labels> <original ttl> <expiration> <inception> <key tag> <signer> <signature>'", typStr)
+		}
+
+		return parseRRSIG(fields, origin)
+
+	case RecordTypeDS, RecordTypeCDS:
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("%s record expects '<key tag> <algorithm> <digest type> <digest>'", typStr)
+		}
+
+		return parseDS(fields)
+
+	case RecordTypeNSEC:
+		if len(fields) < 1 {
+			return nil, fmt.Errorf("%s record expects '<next domain> <types>'", typStr)
+		}
+
+		nextDomain, err := absDomainName(fields[0], origin)
+		if err != nil {
+			return nil, err
+		}
+
+		types, err := parseTypes(fields[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		return &RDataNSEC{nextDomain: nextDomain, types: types}, nil
+
+	case RecordTypeNSEC3:
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("%s record expects '<hash algorithm> <flags> <iterations> <salt> <next hashed owner> <types>'", typStr)
+		}
+
+		return parseNSEC3(fields)
+
+	case RecordTypeNSEC3PARAM:
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("%s record expects '<hash algorithm> <flags> <iterations> <salt>'", typStr)
+		}
+
+		params, err := parseNSEC3Params(fields)
+		if err != nil {
+			return nil, err
+		}
+
+		return &RDataNSEC3PARAM{
+			hashAlgorithm: params.hashAlgorithm,
+			flags:         params.flags,
+			iterations:    params.iterations,
+			salt:          params.salt,
+		}, nil
+
+	case RecordTypeCAA:
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s record expects '<flags> <tag> <value>'", typStr)
+		}
+
+		flags, err := parseUint8(fields[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkCAATag(fields[1]); err != nil {
+			return nil, err
+		}
+
+		value, err := unescapeText(fields[2])
+		if err != nil {
+			return nil, err
+		}
+
+		return &RDataCAA{flags: flags, tag: fields[1], value: value}, nil
+
+	case RecordTypeTLSA, RecordTypeSMIMEA:
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("%s record expects '<usage> <selector> <matching type> <data>'", typStr)
+		}
+
+		params, data, err := parseHexRData(fields, 3)
+		if err != nil {
+			return nil, err
+		}
+
+		return &RDataTLSA{usage: params[0], selector: params[1], matchingType: params[2], data: data}, nil
+
+	case RecordTypeSSHFP:
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%s record expects '<algorithm> <type> <fingerprint>'", typStr)
+		}
+
+		params, fingerprint, err := parseHexRData(fields, 2)
+		if err != nil {
+			return nil, err
+		}
+
+		return &RDataSSHFP{algorithm: params[0], fpType: params[1], fingerprint: fingerprint}, nil
+
+	case RecordTypeOPENPGPKEY:
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("%s record expects '<key>'", typStr)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.Join(fields, ""))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid OpenPGP key: %v", err)
+		}
+
+		return &RDataOPENPGPKEY{key: key}, nil
+
+	default:
+		return nil, fmt.Errorf("Cannot parse RDATA for %s records", typStr)
+	}
+}
+
+// parseNAPTR reads '<order> <preference> <flags> <service> <regexp>
+// <replacement>' where the middle three are character-strings
+func parseNAPTR(fields []string, origin string) (*RDataNAPTR, error) {
+	order, err := parseUint16(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	preference, err := parseUint16(fields[1])
+	if err != nil {
+		return nil, err
+	}
+
+	var texts [3]string
+
+	for i, field := range fields[2:5] {
+		if texts[i], err = unescapeText(field); err != nil {
+			return nil, err
+		}
+
+		if len(texts[i]) > maxCharacterStringOctets {
+			return nil, fmt.Errorf("NAPTR field '%s' exceeds %d octets", field, maxCharacterStringOctets)
+		}
+	}
+
+	replacement, err := absDomainName(fields[5], origin)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RDataNAPTR{
+		order:       order,
+		preference:  preference,
+		flags:       texts[0],
+		service:     texts[1],
+		regexp:      texts[2],
+		replacement: replacement,
+	}, nil
+}
+
+// parseDNSKEY reads '<flags> <protocol> <algorithm> <public key>' where the
+// key is in base64 and may be split across several fields
+func parseDNSKEY(fields []string) (*RDataDNSKEY, error) {
+	flags, err := parseUint16(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	protocol, err := parseUint8(fields[1])
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm, err := ParseDNSSECAlgorithm(fields[2])
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(strings.Join(fields[3:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid public key: %v", err)
+	}
+
+	return &RDataDNSKEY{flags: flags, protocol: protocol, algorithm: algorithm, publicKey: publicKey}, nil
+}
+
+// parseRRSIG reads '<type covered> <algorithm> <labels> <original ttl>
+// <expiration> <inception> <key tag> <signer> <signature>' where the
+// signature is in base64 and may be split across several fields
+func parseRRSIG(fields []string, origin string) (*RDataRRSIG, error) {
+	typeCovered, err := ParseRecordType(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm, err := ParseDNSSECAlgorithm(fields[1])
+	if err != nil {
+		return nil, err
+	}
+
+	labels, err := parseUint8(fields[2])
+	if err != nil {
+		return nil, err
+	}
+
+	originalTTL, err := parseTTL(fields[3])
+	if err != nil {
+		return nil, err
+	}
+
+	expiration, err := parseSigTime(fields[4])
+	if err != nil {
+		return nil, err
+	}
+
+	inception, err := parseSigTime(fields[5])
+	if err != nil {
+		return nil, err
+	}
+
+	keyTag, err := parseUint16(fields[6])
+	if err != nil {
+		return nil, err
+	}
+
+	signerName, err := absDomainName(fields[7], origin)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.Join(fields[8:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid signature: %v", err)
+	}
+
+	return &RDataRRSIG{
+		typeCovered: typeCovered,
+		algorithm:   algorithm,
+		labels:      labels,
+		originalTTL: originalTTL,
+		expiration:  expiration,
+		inception:   inception,
+		keyTag:      keyTag,
+		signerName:  signerName,
+		signature:   signature,
+	}, nil
+}
+
+// parseDS reads '<key tag> <algorithm> <digest type> <digest>' where the
+// digest is in hex and may be split across several fields
+func parseDS(fields []string) (*RDataDS, error) {
+	keyTag, err := parseUint16(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm, err := ParseDNSSECAlgorithm(fields[1])
+	if err != nil {
+		return nil, err
+	}
+
+	digestType, err := parseUint8(fields[2])
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := hex.DecodeString(strings.Join(fields[3:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid digest: %v", err)
+	}
+
+	return &RDataDS{keyTag: keyTag, algorithm: algorithm, digestType: DigestType(digestType), digest: digest}, nil
+}
+
+// parseHexRData reads count 8 bit values followed by data in hex which may be
+// split across several fields, as TLSA and SSHFP records are written
+func parseHexRData(fields []string, count int) ([]uint8, []byte, error) {
+	params := make([]uint8, count)
+
+	for i, field := range fields[:count] {
+		value, err := parseUint8(field)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		params[i] = value
+	}
+
+	data, err := hex.DecodeString(strings.Join(fields[count:], ""))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid hex data: %v", err)
+	}
+
+	return params, data, nil
+}
+
+// parseGenericRData reads '<length> <hex>' following \# as described in RFC
+// 3597 section 5. The octets are decoded as typ when it is known so the
+// record is the same as one given in its usual form.
+func parseGenericRData(typ RecordType, fields []string) (ResourceDataField, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("Generic RDATA expects '\\# <length> <hex>'")
+	}
+
+	length, err := parseUint16(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := hex.DecodeString(strings.Join(fields[1:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid hex data: %v", err)
+	}
+
+	if len(data) != int(length) {
+		return nil, fmt.Errorf("Generic RDATA holds %d octets instead of %d", len(data), length)
+	}
+
+	return getResourceDataFieldForResourceType(typ, data, 0, length)
+}
+
+// parseNSEC3 reads '<hash algorithm> <flags> <iterations> <salt> <next hashed
+// owner> <types>' where the next hashed owner is in base32hex
+func parseNSEC3(fields []string) (*RDataNSEC3, error) {
+	r, err := parseNSEC3Params(fields[:4])
+	if err != nil {
+		return nil, err
+	}
+
+	if r.nextHashedOwner, err = base32Hex.DecodeString(strings.ToUpper(fields[4])); err != nil {
+		return nil, fmt.Errorf("Invalid next hashed owner name '%s'", fields[4])
+	}
+
+	if r.types, err = parseTypes(fields[5:]); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// parseNSEC3Params reads '<hash algorithm> <flags> <iterations> <salt>' where
+// the salt is in hex or "-" when there is none
+func parseNSEC3Params(fields []string) (*RDataNSEC3, error) {
+	hashAlgorithm, err := parseUint8(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	flags, err := parseUint8(fields[1])
+	if err != nil {
+		return nil, err
+	}
+
+	iterations, err := parseUint16(fields[2])
+	if err != nil {
+		return nil, err
+	}
+
+	var salt []byte
+
+	if fields[3] != "-" {
+		if salt, err = hex.DecodeString(fields[3]); err != nil || len(salt) > 255 {
+			return nil, fmt.Errorf("Invalid salt '%s'", fields[3])
+		}
+	}
+
+	return &RDataNSEC3{hashAlgorithm: hashAlgorithm, flags: flags, iterations: iterations, salt: salt}, nil
+}
+
+// parseTypes reads the list of types held by the owner of an NSEC or NSEC3
+// record
+func parseTypes(fields []string) ([]RecordType, error) {
+	types := make([]RecordType, 0, len(fields))
+
+	for _, field := range fields {
+		typ, err := ParseRecordType(field)
+		if err != nil {
+			return nil, err
+		}
+
+		types = append(types, typ)
+	}
+
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	return types, nil
+}
+
+// ParseDNSSECAlgorithm reads a DNSSEC algorithm given by number or mnemonic
+func ParseDNSSECAlgorithm(s string) (DNSSECAlgorithm, error) {
+	for algorithm, name := range DNSSECAlgorithmToStrMap {
+		if strings.EqualFold(s, name) {
+			return algorithm, nil
+		}
+	}
+
+	value, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("Unknown DNSSEC algorithm '%s'", s)
+	}
+
+	return DNSSECAlgorithm(value), nil
+}
+
+// parseSigTime reads an RRSIG time given either as YYYYMMDDHHmmSS in UTC or
+// as seconds since the epoch
+func parseSigTime(s string) (uint32, error) {
+	if len(s) == len(sigTimeFormat) {
+		t, err := time.Parse(sigTimeFormat, s)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid signature time '%s'", s)
+		}
+
+		// Times past 2106 wrap around as serial numbers do
+		return uint32(t.Unix()), nil
+	}
+
+	value, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid signature time '%s'", s)
+	}
+
+	return uint32(value), nil
+}
+
+// parseUint8 parses a decimal 8 bit value
+func parseUint8(s string) (uint8, error) {
+	value, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid 8 bit value '%s'", s)
+	}
+
+	return uint8(value), nil
+}
+
+// parseUint16 parses a decimal 16 bit value
+func parseUint16(s string) (uint16, error) {
+	value, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid 16 bit value '%s'", s)
+	}
+
+	return uint16(value), nil
+}
+
+// unescapeText interprets the escape sequences allowed in a <character-string>
+func unescapeText(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+
+	var sb strings.Builder
+
+	for i := 0; i < len(s); {
+		if s[i] != '\\' {
+			sb.WriteByte(s[i])
+			i++
+			continue
+		}
+
+		b, next, err := readEscape(s, i)
+		if err != nil {
+			return "", err
+		}
+
+		sb.WriteByte(b)
+		i = next
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,381 @@
+package dnsmsg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// zoneRecords presents each record on a line of its own
+func zoneRecords(rrs []RR) string {
+	var lines []string
+
+	for _, rr := range rrs {
+		lines = append(lines, fmt.Sprintf("%s\t%d\t%s\t%s\t%s", rr.NAME, rr.TTL,
+			RecordClassToStrMap[rr.CLASS], RecordTypeString(rr.TYPE), rr.RDATA))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func TestParseRR(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"www.example.com. 300 IN A 192.0.2.1", "192.0.2.1"},
+		{"www.example.com. 300 in aaaa 2001:db8::1", "2001:db8::1"},
+		{"example.com. 3600 IN NS ns1.example.com.", "ns1.example.com."},
+		{"example.com. 300 IN MX 10 mail.example.com.", "10 mail.example.com."},
+		{`example.com. 300 IN TXT "v=spf1 -all"`, `"v=spf1 -all"`},
+		{`example.com. 300 IN TXT "v=DKIM1; " "p=AQID"`, `"v=DKIM1; " "p=AQID"`},
+		{`example.com. 300 IN TXT "` + strings.Repeat("a", 300) + `"`, `"` + strings.Repeat("a", 255) + `" "` + strings.Repeat("a", 45) + `"`},
+		{"example.com. 3600 IN SOA ns1.example.com. host.example.com. 1 7200 3600 1209600 300",
+			"ns1.example.com. host.example.com. 1 7200 3600 1209600 300"},
+		{"example.com. 3600 IN DNSKEY 257 3 15 ( AQID BAUGBwg= )", "257 3 15 AQIDBAUGBwg= ; key id = 5156"},
+		{"example.com. 3600 IN DS 12345 15 2 ABABABABABABABABABABABABABABABAB abababababababababababababababab",
+			"12345 15 2 ABABABABABABABABABABABABABABABABABABABABABABABABABABABABABABABAB"},
+		{"www.example.com. 300 IN RRSIG A 15 3 300 20250101000000 20240101000000 12345 example.com. CQgHBg==",
+			"A 15 3 300 20250101000000 20240101000000 12345 example.com. CQgHBg=="},
+		{"www.example.com. 300 IN NSEC zzz.example.com. A AAAA RRSIG NSEC CAA", "zzz.example.com. A AAAA RRSIG NSEC CAA"},
+		{"www.example.com. 300 IN NSEC3 1 1 0 AABB 89144GI289144GI289144GI289144GI2 A RRSIG",
+			"1 1 0 AABB 89144GI289144GI289144GI289144GI2 A RRSIG"},
+		{"example.com. 0 IN NSEC3PARAM 1 0 0 -", "1 0 0 -"},
+		{"_sip._tcp.example.com. 300 IN SRV 10 60 5060 sip.example.com.", "10 60 5060 sip.example.com."},
+		{`example.com. 300 IN NAPTR 100 10 "u" "E2U+sip" "!^.*$!sip:info@example.com!" .`,
+			`100 10 "u" "E2U+sip" "!^.*$!sip:info@example.com!" .`},
+		{`_http._tcp.example.com. 300 IN URI 10 1 "https://www.example.com/"`, `10 1 "https://www.example.com/"`},
+		{`example.com. 300 IN CAA 0 issue "ca.example.net; account=230123"`, `0 issue "ca.example.net; account=230123"`},
+		{"_443._tcp.www.example.com. 300 IN TLSA 3 1 1 ( 0d6fce3320dc91e0 df4ea7a63cb0a0cd )", "3 1 1 0D6FCE3320DC91E0DF4EA7A63CB0A0CD"},
+		{"host.example.com. 300 IN SSHFP 4 2 ABCDEF0123", "4 2 ABCDEF0123"},
+		{"key._openpgpkey.example.com. 300 IN OPENPGPKEY mQENBF ZZ", "mQENBFZZ"},
+
+		// Any type may be given in the generic form, which is how types
+		// without a decoder are shown
+		{`www.example.com. 300 IN TYPE65 \# 7 ( 0001 0000030000 )`, `\# 7 00010000030000`},
+		{`old.example.com. 300 IN HINFO \# 8 03414d44034c4e58`, `\# 8 03414D44034C4E58`},
+		{`empty.example.com. 300 IN TYPE1234 \# 0`, `\# 0`},
+		{`www.example.com. 300 IN TYPE1 \# 4 c0000201`, "192.0.2.1"},
+		{`www.example.com. 300 IN MX \# 8 000a046d61696c00`, "10 mail."},
+	}
+
+	for _, tt := range tests {
+		rr, err := ParseRR(tt.s)
+		if err != nil {
+			t.Errorf("ParseRR(%q): %v", tt.s, err)
+			continue
+		}
+
+		if got := rr.RDATA.String(); got != tt.want {
+			t.Errorf("ParseRR(%q) RDATA = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+
+	// The TTL and class are optional and names are relative to the root
+	rr, err := ParseRR("www.example.com IN A 192.0.2.1")
+	if err != nil || rr.NAME != "www.example.com." || rr.TTL != DefaultTTL || rr.CLASS != RecordClassIN {
+		t.Errorf("ParseRR without a TTL = %s, %v, want www.example.com. with TTL %d", &rr, err, DefaultTTL)
+	}
+
+	malformed := []string{
+		"",
+		"www.example.com. 300 IN A",
+		"www.example.com. ttl IN A 192.0.2.1",
+		"www.example.com. 300 IN BOGUS 192.0.2.1",
+		"www.example.com. 300 IN A 2001:db8::1",
+		"www.example.com. 300 IN AAAA 192.0.2.1",
+		"example.com. 300 IN MX mail.example.com.",
+		"example.com. 300 IN SOA ns1.example.com. host.example.com. 1 7200 3600",
+		"www.example.com. 300 IN A 192.0.2.1\nwww.example.com. 300 IN A 192.0.2.2",
+		"$TTL 300",
+		"example.com. 3600 IN DNSKEY 257 3 15 not-base64",
+		"example.com. 3600 IN DS 12345 15 2 XYZ",
+		"www.example.com. 300 IN RRSIG A 15 3 300 2025-01-01 20240101000000 12345 example.com. CQgHBg==",
+		"www.example.com. 300 IN NSEC zzz.example.com. BOGUS",
+		"www.example.com. 300 IN NSEC3 1 1 0 AABB not-base32hex A",
+		"_sip._tcp.example.com. 300 IN SRV 10 60 sip.example.com.",
+		"_sip._tcp.example.com. 300 IN SRV 10 60 70000 sip.example.com.",
+		`example.com. 300 IN NAPTR 100 10 "u" "E2U+sip" "!^.*$!sip:info@example.com!"`,
+		`_http._tcp.example.com. 300 IN URI 10 "https://www.example.com/"`,
+		`example.com. 300 IN CAA 0 is-sue "ca.example.net"`,
+		"_443._tcp.www.example.com. 300 IN TLSA 3 1 1 XYZ",
+		"_443._tcp.www.example.com. 300 IN TLSA 3 1 0d6fce",
+		"host.example.com. 300 IN SSHFP 4 2",
+		"key._openpgpkey.example.com. 300 IN OPENPGPKEY not*base64",
+		`www.example.com. 300 IN TYPE65 \#`,
+		`www.example.com. 300 IN TYPE65 \# 2 00`,
+		`www.example.com. 300 IN TYPE65 \# 1 zz`,
+		`www.example.com. 300 IN TYPE65 \# -1`,
+		`www.example.com. 300 IN A \# 3 c00002`,
+		`www.example.com. 300 IN TYPE70000 \# 0`,
+		`www.example.com. 300 IN TYPE \# 0`,
+	}
+
+	for _, s := range malformed {
+		if rr, err := ParseRR(s); err == nil {
+			t.Errorf("ParseRR(%q) = %s, want an error", s, &rr)
+		}
+	}
+}
+
+func TestParseZone(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "comments and blank lines",
+			text: `; a comment
+www.example.com. 300 IN A 192.0.2.1 ; trailing comment
+
+mail.example.com. 300 IN A 192.0.2.2
+`,
+			want: []string{
+				"www.example.com.	300	IN	A	192.0.2.1",
+				"mail.example.com.	300	IN	A	192.0.2.2",
+			},
+		},
+		{
+			name: "relative names and the origin",
+			text: `@	300	IN	NS	ns1
+ns1	300	IN	A	192.0.2.53
+www.sub	300	IN	CNAME	@
+mail	300	IN	MX	10 mail.example.net.
+`,
+			want: []string{
+				"example.com.	300	IN	NS	ns1.example.com.",
+				"ns1.example.com.	300	IN	A	192.0.2.53",
+				"www.sub.example.com.	300	IN	CNAME	example.com.",
+				"mail.example.com.	300	IN	MX	10 mail.example.net.",
+			},
+		},
+		{
+			name: "$ORIGIN changes the origin for later names",
+			text: `www	300	IN	A	192.0.2.1
+$ORIGIN sub
+www	300	IN	A	192.0.2.2
+$ORIGIN example.net.
+www	300	IN	CNAME	www.sub.example.com.
+`,
+			want: []string{
+				"www.example.com.	300	IN	A	192.0.2.1",
+				"www.sub.example.com.	300	IN	A	192.0.2.2",
+				"www.example.net.	300	IN	CNAME	www.sub.example.com.",
+			},
+		},
+		{
+			name: "$TTL and the previous TTL",
+			text: `$TTL 1h
+a	IN	A	192.0.2.1
+b	60	IN	A	192.0.2.2
+c	IN	A	192.0.2.3
+$TTL 1d2h3m4s
+d	A	192.0.2.4
+e	1w	A	192.0.2.5
+`,
+			want: []string{
+				"a.example.com.	3600	IN	A	192.0.2.1",
+				"b.example.com.	60	IN	A	192.0.2.2",
+				"c.example.com.	3600	IN	A	192.0.2.3",
+				"d.example.com.	93784	IN	A	192.0.2.4",
+				"e.example.com.	604800	IN	A	192.0.2.5",
+			},
+		},
+		{
+			name: "previous TTL without $TTL",
+			text: `a	120	IN	A	192.0.2.1
+b	IN	A	192.0.2.2
+`,
+			want: []string{
+				"a.example.com.	120	IN	A	192.0.2.1",
+				"b.example.com.	120	IN	A	192.0.2.2",
+			},
+		},
+		{
+			name: "blank owner and class before TTL",
+			text: `www	IN	300	A	192.0.2.1
+	A	192.0.2.2
+	IN	AAAA	2001:db8::1
+`,
+			want: []string{
+				"www.example.com.	300	IN	A	192.0.2.1",
+				"www.example.com.	300	IN	A	192.0.2.2",
+				"www.example.com.	300	IN	AAAA	2001:db8::1",
+			},
+		},
+		{
+			name: "parentheses span lines",
+			text: `@	300	IN	SOA	ns1 hostmaster (
+		2024010101	; serial
+		2h		; refresh
+		1h		; retry
+		2w		; expire
+		300 )		; minimum
+www	300	IN	A	(
+	192.0.2.1 )
+`,
+			want: []string{
+				"example.com.	300	IN	SOA	ns1.example.com. hostmaster.example.com. 2024010101 7200 3600 1209600 300",
+				"www.example.com.	300	IN	A	192.0.2.1",
+			},
+		},
+		{
+			name: "quoted text and escapes",
+			text: `a	300	IN	TXT	"two  spaces; and a semicolon"
+b	300	IN	TXT	"split " "strings"
+c	300	IN	TXT	"a \"quote\" and \\ backslash"
+d	300	IN	TXT	semi\059colon \065BC
+e	300	IN	TXT	"(not a paren)"
+`,
+			want: []string{
+				`a.example.com.	300	IN	TXT	"two  spaces; and a semicolon"`,
+				`b.example.com.	300	IN	TXT	"split " "strings"`,
+				`c.example.com.	300	IN	TXT	"a \"quote\" and \\ backslash"`,
+				`d.example.com.	300	IN	TXT	"semi;colon" "ABC"`,
+				`e.example.com.	300	IN	TXT	"(not a paren)"`,
+			},
+		},
+		{
+			name: "escaped period in a name",
+			text: `a\.b	300	IN	A	192.0.2.1
+`,
+			want: []string{
+				`a\.b.example.com.	300	IN	A	192.0.2.1`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rrs, err := ParseZone(strings.NewReader(tt.text), "example.com")
+			if err != nil {
+				t.Fatalf("ParseZone: %v", err)
+			}
+
+			if got, want := zoneRecords(rrs), strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("records =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestParseZoneErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		line int
+	}{
+		{"no TTL", "www IN A 192.0.2.1\n", 1},
+		{"no previous owner", "  300 IN A 192.0.2.1\n", 1},
+		{"missing type", "www 300 IN\n", 1},
+		{"unknown type", "www 300 IN BOGUS 1\n", 1},
+		{"bad RDATA on a later line", "$TTL 300\nwww A 192.0.2.1\n\nwww A 192.0.2\n", 4},
+		{"unknown directive", "$TTL 300\n$GENERATE 1-2 a$ A 192.0.2.$\n", 2},
+		{"$TTL without a value", "$TTL\n", 1},
+		{"$ORIGIN with two names", "$ORIGIN a. b.\n", 1},
+		{"unbalanced parentheses", "$TTL 300\nwww A ( 192.0.2.1\n", 3},
+		{"closing parenthesis", "www 300 A 192.0.2.1 )\n", 1},
+		{"unterminated quotes", "www 300 TXT \"open\nnext 300 A 192.0.2.1\n", 1},
+		{"dangling escape", "www 300 TXT abc\\", 1},
+		{"label too long", strings.Repeat("a", 64) + " 300 A 192.0.2.1\n", 1},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseZone(strings.NewReader(tt.text), "example.com.")
+
+		perr, ok := err.(*ZoneParseError)
+		if !ok {
+			t.Errorf("%s: error = %v, want a ZoneParseError", tt.name, err)
+			continue
+		}
+
+		if perr.Line != tt.line {
+			t.Errorf("%s: error on line %d, want %d: %v", tt.name, perr.Line, tt.line, err)
+		}
+	}
+}
+
+func TestParseZoneFileInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zone")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"example.com.zone": `$TTL 300
+@	IN	SOA	ns1 hostmaster 1 2h 1h 2w 300
+$INCLUDE hosts/www.zone
+$INCLUDE hosts/www.zone sub
+after	IN	A	192.0.2.9
+`,
+		"hosts/www.zone": `www	A	192.0.2.1
+$INCLUDE mail.zone
+`,
+		"hosts/mail.zone": `mail	60	A	192.0.2.2
+`,
+		"loop.zone": `$INCLUDE loop.zone
+`,
+		"missing.zone": `$TTL 300
+@	IN	A	192.0.2.1
+$INCLUDE nothing.zone
+`,
+		"broken.zone": `$TTL 300
+$INCLUDE hosts/broken.zone
+`,
+		"hosts/broken.zone": `www	A	192.0.2.1
+www	A	not-an-address
+`,
+	}
+
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rrs, err := ParseZoneFile(filepath.Join(dir, "example.com.zone"), "example.com")
+	if err != nil {
+		t.Fatalf("ParseZoneFile: %v", err)
+	}
+
+	// The origin given to $INCLUDE only applies within the included file but
+	// the TTL carries on from it
+	want := strings.Join([]string{
+		"example.com.	300	IN	SOA	ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300",
+		"www.example.com.	300	IN	A	192.0.2.1",
+		"mail.example.com.	60	IN	A	192.0.2.2",
+		"www.sub.example.com.	300	IN	A	192.0.2.1",
+		"mail.sub.example.com.	60	IN	A	192.0.2.2",
+		"after.example.com.	300	IN	A	192.0.2.9",
+	}, "\n")
+
+	if got := zoneRecords(rrs); got != want {
+		t.Errorf("records =\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := ParseZoneFile(filepath.Join(dir, "loop.zone"), "example.com"); err == nil {
+		t.Error("ParseZoneFile followed $INCLUDE directives forever")
+	}
+
+	if _, err := ParseZoneFile(filepath.Join(dir, "missing.zone"), "example.com"); err == nil {
+		t.Error("ParseZoneFile succeeded with a missing $INCLUDE file")
+	}
+
+	// Errors in an included file name that file and its line
+	_, err = ParseZoneFile(filepath.Join(dir, "broken.zone"), "example.com")
+	if perr, ok := err.(*ZoneParseError); !ok || perr.File != filepath.Join(dir, "hosts/broken.zone") || perr.Line != 2 {
+		t.Errorf("error = %v, want one for line 2 of hosts/broken.zone", err)
+	}
+}
@@ -0,0 +1,137 @@
+package dnsmsg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// relativeRData is implemented by RDATA holding domain names which can be
+// written relative to the origin of a master file
+type relativeRData interface {
+	stringRelativeTo(origin string) string
+}
+
+// WriteZone writes records to w in the master file format read by ParseZone.
+// The records are written in canonical order with any SOA record at the
+// origin first. When origin is given, a $ORIGIN directive is written and the
+// names at or below it are written relative to it. Records sharing an owner
+// with the record before them leave the owner blank.
+func WriteZone(w io.Writer, origin string, rrs []RR) error {
+	bw := bufio.NewWriter(w)
+
+	if origin != "" {
+		origin = Fqdn(origin)
+		fmt.Fprintf(bw, "$ORIGIN %s\n", origin)
+	}
+
+	sorted := make([]RR, 0, len(rrs))
+	for _, rr := range rrs {
+		// The OPT and TSIG pseudo-records only have meaning within a single
+		// message
+		if rr.TYPE != RecordTypeOPT && rr.TYPE != RecordTypeTSIG {
+			sorted = append(sorted, rr)
+		}
+	}
+
+	SortCanonical(sorted)
+
+	// The SOA record marks the start of a zone so it always comes first
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return isOriginSOA(sorted[i], origin) && !isOriginSOA(sorted[j], origin)
+	})
+
+	lastOwner := ""
+
+	for _, rr := range sorted {
+		owner := relativeName(rr.NAME, origin)
+		if strings.EqualFold(owner, lastOwner) {
+			owner = ""
+		} else {
+			lastOwner = owner
+		}
+
+		rData := rr.RDATA.String()
+		if relative, ok := rr.RDATA.(relativeRData); ok {
+			rData = relative.stringRelativeTo(origin)
+		}
+
+		class := RecordClassToStrMap[rr.CLASS]
+		typ := RecordTypeString(rr.TYPE)
+
+		fmt.Fprintf(bw, "%s\t%d\t%s\t%s\t%s\n", owner, rr.TTL, class, typ, rData)
+	}
+
+	return bw.Flush()
+}
+
+// SortCanonical sorts records by owner name in canonical order, then by type
+// and finally by their RDATA octets, as described in RFC 4034 section 6
+func SortCanonical(rrs []RR) {
+	rData := make([][]byte, len(rrs))
+
+	for i, rr := range rrs {
+		// RDATA which cannot be encoded is left empty so it sorts first
+		rData[i], _ = rr.RDATA.Encode()
+	}
+
+	sort.Sort(canonicalRRs{rrs: rrs, rData: rData})
+}
+
+// canonicalRRs sorts records together with their encoded RDATA
+type canonicalRRs struct {
+	rrs   []RR
+	rData [][]byte
+}
+
+func (c canonicalRRs) Len() int {
+	return len(c.rrs)
+}
+
+func (c canonicalRRs) Swap(i, j int) {
+	c.rrs[i], c.rrs[j] = c.rrs[j], c.rrs[i]
+	c.rData[i], c.rData[j] = c.rData[j], c.rData[i]
+}
+
+func (c canonicalRRs) Less(i, j int) bool {
+	if cmp := CompareNames(c.rrs[i].NAME, c.rrs[j].NAME); cmp != 0 {
+		return cmp < 0
+	}
+
+	if c.rrs[i].TYPE != c.rrs[j].TYPE {
+		return c.rrs[i].TYPE < c.rrs[j].TYPE
+	}
+
+	return bytes.Compare(c.rData[i], c.rData[j]) < 0
+}
+
+// isOriginSOA checks if rr is the SOA record at the top of the zone
+func isOriginSOA(rr RR, origin string) bool {
+	if rr.TYPE != RecordTypeSOA {
+		return false
+	}
+
+	return origin == "" || CompareNames(rr.NAME, origin) == 0
+}
+
+// relativeName writes name relative to origin if it falls below it. The origin
+// itself is written as @.
+func relativeName(name, origin string) string {
+	if origin == "" || origin == "." {
+		return name
+	}
+
+	if CompareNames(name, origin) == 0 {
+		return "@"
+	}
+
+	if IsSubDomain(origin, name) {
+		name = Fqdn(name)
+		return name[:len(name)-len(origin)-1]
+	}
+
+	return name
+}
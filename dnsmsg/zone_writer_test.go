@@ -0,0 +1,177 @@
+package dnsmsg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// mustParseRRs parses one record per line
+func mustParseRRs(t *testing.T, lines ...string) []RR {
+	t.Helper()
+
+	var rrs []RR
+
+	for _, line := range lines {
+		rr, err := ParseRR(line)
+		if err != nil {
+			t.Fatalf("ParseRR(%q): %v", line, err)
+		}
+
+		rrs = append(rrs, rr)
+	}
+
+	return rrs
+}
+
+func TestWriteZone(t *testing.T) {
+	rrs := mustParseRRs(t,
+		"www.example.com. 300 IN A 192.0.2.1",
+		"example.com. 3600 IN NS ns1.example.com.",
+		"www.example.com. 300 IN AAAA 2001:db8::1",
+		"example.com. 300 IN MX 10 mail.example.net.",
+		"alias.example.com. 300 IN CNAME www.example.com.",
+		"example.com. 3600 IN SOA ns1.example.com. host.example.com. 1 7200 3600 1209600 300",
+		"example.com. 300 IN TXT \"v=spf1 -all\"",
+	)
+
+	opt, err := NewRDataOPT(nil)
+	if err != nil {
+		t.Fatalf("NewRDataOPT: %v", err)
+	}
+
+	rrs = append(rrs, RR{NAME: ".", TYPE: RecordTypeOPT, CLASS: 4096, RDATA: opt})
+
+	want := strings.Join([]string{
+		"$ORIGIN example.com.",
+		"@\t3600\tIN\tSOA\tns1 host 1 7200 3600 1209600 300",
+		"\t3600\tIN\tNS\tns1",
+		"\t300\tIN\tMX\t10 mail.example.net.",
+		"\t300\tIN\tTXT\t\"v=spf1 -all\"",
+		"alias\t300\tIN\tCNAME\twww",
+		"www\t300\tIN\tA\t192.0.2.1",
+		"\t300\tIN\tAAAA\t2001:db8::1",
+		"",
+	}, "\n")
+
+	var buf bytes.Buffer
+	if err := WriteZone(&buf, "example.com", rrs); err != nil {
+		t.Fatalf("WriteZone: %v", err)
+	}
+
+	if got := buf.String(); got != want {
+		t.Errorf("WriteZone wrote\n%s\nwant\n%s", got, want)
+	}
+
+	// Without an origin every name is written in full
+	buf.Reset()
+	if err := WriteZone(&buf, "", rrs[:1]); err != nil {
+		t.Fatalf("WriteZone: %v", err)
+	}
+
+	if got, want := buf.String(), "www.example.com.\t300\tIN\tA\t192.0.2.1\n"; got != want {
+		t.Errorf("WriteZone without an origin wrote %q, want %q", got, want)
+	}
+}
+
+func TestWriteZoneRoundTrip(t *testing.T) {
+	text := `$ORIGIN example.com.
+$TTL 300
+@	IN	SOA	ns1 host ( 2024010101 3600 600
+		86400 60 )
+	IN	NS	ns1
+	IN	MX	10 mail
+	IN	TXT	"quoted \"text\"" "back\\slash" "\007bell; not a comment"
+ns1	IN	A	192.0.2.1
+mail	IN	AAAA	2001:db8::25
+dot\.ted	IN	A	192.0.2.2
+sp\032ace	IN	CNAME	www.example.net.
+outside.example.net.	IN	PTR	mail
+`
+
+	rrs, err := ParseZone(strings.NewReader(text), "example.com.")
+	if err != nil {
+		t.Fatalf("ParseZone: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteZone(&buf, "example.com.", rrs); err != nil {
+		t.Fatalf("WriteZone: %v", err)
+	}
+
+	again, err := ParseZone(bytes.NewReader(buf.Bytes()), "")
+	if err != nil {
+		t.Fatalf("ParseZone of the written zone: %v\n%s", err, buf.String())
+	}
+
+	SortCanonical(rrs)
+	SortCanonical(again)
+
+	if got, want := zoneRecords(again), zoneRecords(rrs); got != want {
+		t.Errorf("records after write and parse\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCompareNames(t *testing.T) {
+	// The ordering given in RFC 4034 section 6.1
+	ordered := []string{
+		"example.",
+		"a.example.",
+		"yljkjljk.a.example.",
+		"Z.a.example.",
+		"zABC.a.EXAMPLE.",
+		"z.example.",
+		`\001.z.example.`,
+		"*.z.example.",
+		`\200.z.example.`,
+	}
+
+	for i := range ordered {
+		for j := range ordered {
+			want := 0
+			switch {
+			case i < j:
+				want = -1
+			case i > j:
+				want = 1
+			}
+
+			if got := CompareNames(ordered[i], ordered[j]); got != want {
+				t.Errorf("CompareNames(%q, %q) = %d, want %d", ordered[i], ordered[j], got, want)
+			}
+		}
+	}
+
+	if got := CompareNames("Example.COM", "example.com."); got != 0 {
+		t.Errorf("CompareNames ignoring case and the trailing period = %d, want 0", got)
+	}
+}
+
+func TestSortCanonical(t *testing.T) {
+	rrs := mustParseRRs(t,
+		"b.example. 300 IN A 192.0.2.2",
+		"a.example. 300 IN MX 20 mx.example.",
+		"b.example. 300 IN A 192.0.2.1",
+		"a.example. 300 IN A 192.0.2.9",
+		"a.example. 300 IN MX 10 mx.example.",
+		"example. 300 IN NS ns.example.",
+	)
+
+	SortCanonical(rrs)
+
+	want := []string{
+		"example. NS ns.example.",
+		"a.example. A 192.0.2.9",
+		"a.example. MX 10 mx.example.",
+		"a.example. MX 20 mx.example.",
+		"b.example. A 192.0.2.1",
+		"b.example. A 192.0.2.2",
+	}
+
+	for i, rr := range rrs {
+		got := rr.NAME + " " + RecordTypeToStrMap[rr.TYPE] + " " + rr.RDATA.String()
+		if got != want[i] {
+			t.Errorf("record %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
@@ -1,5 +1,5 @@
 module github.com/dansackett/dns-client
 
-go 1.12
+go 1.13
 
 require github.com/pkg/errors v0.8.1
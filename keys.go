@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// loadTSIGKey reads the TSIG key given either on the command line as
+// name:algorithm:secret or in a key file. A nil key is returned when neither
+// is given.
+func loadTSIGKey(key, keyFile string) (*dnsmsg.TSIGKey, error) {
+	switch {
+	case key != "" && keyFile != "":
+		return nil, errors.New("'key' and 'key-file' cannot both be given")
+	case key != "":
+		return dnsmsg.ParseTSIGKey(key)
+	case keyFile != "":
+		return dnsmsg.LoadTSIGKeyFile(keyFile)
+	}
+
+	return nil, nil
+}
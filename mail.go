@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+
+	"github.com/dansackett/dns-client/dnsclient"
+	"github.com/dansackett/dns-client/dnsmsg"
+	"github.com/dansackett/dns-client/mailauth"
+)
+
+// printMailAuth presents the SPF, DKIM and DMARC records among the TXT
+// records of an answer tag by tag, or says why they could not be read
+func printMailAuth(msg *dnsmsg.Message) {
+	for _, rr := range msg.Answers {
+		txt, ok := rr.RDATA.(*dnsmsg.RDataTXT)
+		if !ok {
+			continue
+		}
+
+		record, err := mailauth.Recognize(rr.NAME, txt.Text())
+
+		switch {
+		case err != nil:
+			fmt.Printf("> %v\n", err)
+		case record != nil:
+			fmt.Println(mailauth.Describe(rr.NAME, record))
+		}
+	}
+}
+
+// runSPFCheck evaluates the SPF policy of a sender's domain for the host
+// sending the mail, printing each step taken and exiting with a non-zero
+// status unless the host passes:
+//
+//     spf-check -ip 192.0.2.10 -sender alice@example.com
+//     spf-check -ip 2001:db8::25 -helo mail.example.com
+func runSPFCheck(args []string) {
+	fs := flag.NewFlagSet("spf-check", flag.ExitOnError)
+	ipStr := fs.String("ip", "", "IP of the host sending the mail. This is required.")
+	sender := fs.String("sender", "", "MAIL FROM address or domain of the mail. The HELO name is checked when empty.")
+	helo := fs.String("helo", "", "Name the host greeted with, used by the %{h} macro.")
+	receiver := fs.String("receiver", "", "Domain of the host receiving the mail, used by the %{r} macro in explanations.")
+	serverAddr := fs.String("server-addr", "8.8.8.8:53", "IP and Port for the DNS server to query.")
+	timeout := fs.Duration("timeout", dnsclient.DefaultTimeout, "How long to wait for a response before retrying.")
+	useTCP := fs.Bool("tcp", false, "Send the queries over TCP instead of UDP.")
+	fs.Parse(args)
+
+	ip := net.ParseIP(*ipStr)
+	if ip == nil {
+		log.Fatalf("error: %v", "'ip' must be an IPv4 or IPv6 address")
+	}
+
+	if *sender == "" && *helo == "" {
+		log.Fatalf("error: %v", "'sender' or 'helo' is required")
+	}
+
+	client := dnsclient.New(*serverAddr)
+	client.Timeout = *timeout
+	client.ForceTCP = *useTCP
+
+	checker := mailauth.NewSPFChecker(client)
+	checker.HELO = *helo
+	checker.Receiver = *receiver
+
+	check := checker.Check(context.Background(), ip, *sender)
+	fmt.Println(check)
+
+	if check.Result != mailauth.SPFPass {
+		os.Exit(1)
+	}
+}
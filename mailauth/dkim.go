@@ -0,0 +1,203 @@
+package mailauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DKIM signers publish their public keys at <selector>._domainkey.<domain>,
+// see RFC 6376 section 3.6.1.
+
+// dkimFlagNames describes the flags of the t= tag
+var dkimFlagNames = map[string]string{
+	"y": "testing, signatures are not to be relied on",
+	"s": "the domain of signatures must match exactly, not subdomains",
+}
+
+// DKIMKey is a DKIM public key record
+type DKIMKey struct {
+	// Version is "DKIM1" or empty when the record does not say
+	Version string
+
+	// KeyType is the kind of key, "rsa" unless the record gives another
+	KeyType string
+
+	// HashAlgorithms lists the hashes signatures may use, with any allowed
+	// when empty
+	HashAlgorithms []string
+
+	// Notes is text meant for people reading the record
+	Notes string
+
+	// PublicKey is the decoded key. An empty key has been revoked.
+	PublicKey []byte
+
+	// ServiceTypes lists the services the key applies to, "*" for all
+	ServiceTypes []string
+
+	// Flags holds the flags of the t= tag, such as "y" for testing
+	Flags []string
+
+	// Tags holds every tag of the record as written
+	Tags []Tag
+}
+
+// isDKIMOwner reports if owner is below a _domainkey label with a selector in
+// front of it
+func isDKIMOwner(owner string) bool {
+	labels := strings.Split(strings.ToLower(owner), ".")
+
+	for i, label := range labels {
+		if label == "_domainkey" && i > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isDKIM reports if txt announces itself as a DKIM key
+func isDKIM(txt string) bool {
+	return firstTagIs(txt, "v", "DKIM1")
+}
+
+// ParseDKIMKey reads a DKIM key record
+func ParseDKIMKey(txt string) (*DKIMKey, error) {
+	tags, err := ParseTagList(txt)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid DKIM record: %v", err)
+	}
+
+	k := &DKIMKey{KeyType: "rsa", ServiceTypes: []string{"*"}, Tags: tags}
+
+	for i, tag := range tags {
+		switch tag.Name {
+		case "v":
+			if i != 0 || tag.Value != "DKIM1" {
+				return nil, errors.New("Invalid DKIM record: v=DKIM1 must be the first tag")
+			}
+
+			k.Version = tag.Value
+		case "k":
+			k.KeyType = strings.ToLower(tag.Value)
+		case "h":
+			k.HashAlgorithms = splitList(tag.Value, ":")
+		case "n":
+			k.Notes = tag.Value
+		case "s":
+			k.ServiceTypes = splitList(tag.Value, ":")
+		case "t":
+			k.Flags = splitList(tag.Value, ":")
+		}
+	}
+
+	p, ok := tagValue(tags, "p")
+	if !ok {
+		return nil, errors.New("Invalid DKIM record: the p= tag is required")
+	}
+
+	// The key may be folded with whitespace
+	p = strings.Join(strings.Fields(p), "")
+
+	if k.PublicKey, err = base64.StdEncoding.DecodeString(p); err != nil {
+		return nil, fmt.Errorf("Invalid DKIM record: invalid public key: %v", err)
+	}
+
+	return k, nil
+}
+
+// Kind names the sort of record
+func (k *DKIMKey) Kind() string {
+	return "DKIM"
+}
+
+// Revoked reports if the key has been withdrawn by publishing it empty
+func (k *DKIMKey) Revoked() bool {
+	return len(k.PublicKey) == 0
+}
+
+// Testing reports if the domain is testing DKIM, so failing signatures are not
+// to be treated differently from unsigned mail
+func (k *DKIMKey) Testing() bool {
+	for _, flag := range k.Flags {
+		if flag == "y" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Summary describes each part of the record
+func (k *DKIMKey) Summary() []string {
+	var lines []string
+
+	if k.Version != "" {
+		lines = append(lines, "Version: "+k.Version)
+	}
+
+	lines = append(lines, "Key: "+k.describeKey())
+
+	if len(k.HashAlgorithms) > 0 {
+		lines = append(lines, "Hash algorithms: "+strings.Join(k.HashAlgorithms, ", "))
+	}
+
+	lines = append(lines, "Services: "+strings.Join(k.ServiceTypes, ", "))
+
+	for _, flag := range k.Flags {
+		description, ok := dkimFlagNames[flag]
+		if !ok {
+			description = "unknown"
+		}
+
+		lines = append(lines, fmt.Sprintf("Flag: %s (%s)", flag, description))
+	}
+
+	if k.Notes != "" {
+		lines = append(lines, "Notes: "+k.Notes)
+	}
+
+	return lines
+}
+
+// describeKey names the type and size of the public key
+func (k *DKIMKey) describeKey() string {
+	if k.Revoked() {
+		return "revoked"
+	}
+
+	switch k.KeyType {
+	case "rsa":
+		// Keys are meant to be a SubjectPublicKeyInfo but some signers
+		// publish a bare RSAPublicKey
+		if key, err := x509.ParsePKIXPublicKey(k.PublicKey); err == nil {
+			switch key := key.(type) {
+			case *rsa.PublicKey:
+				return fmt.Sprintf("rsa, %d bits", key.N.BitLen())
+			case *ecdsa.PublicKey:
+				return fmt.Sprintf("ecdsa, %d bits, which DKIM does not support", key.Params().BitSize)
+			}
+		}
+
+		if key, err := x509.ParsePKCS1PublicKey(k.PublicKey); err == nil {
+			return fmt.Sprintf("rsa, %d bits", key.N.BitLen())
+		}
+
+		return "rsa, which cannot be parsed"
+
+	case "ed25519":
+		if len(k.PublicKey) != ed25519.PublicKeySize {
+			return fmt.Sprintf("ed25519, with %d octets instead of %d", len(k.PublicKey), ed25519.PublicKeySize)
+		}
+
+		return "ed25519"
+	}
+
+	return fmt.Sprintf("%s, %d octets", k.KeyType, len(k.PublicKey))
+}
@@ -0,0 +1,119 @@
+package mailauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDKIMKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spki, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecSPKI, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaP := base64.StdEncoding.EncodeToString(spki)
+	pkcs1P := base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey))
+	ecP := base64.StdEncoding.EncodeToString(ecSPKI)
+	edP := strings.Repeat("A", 43) + "="
+
+	tests := []struct {
+		name    string
+		txt     string
+		summary []string
+	}{
+		{"rsa", "v=DKIM1; k=rsa; p=" + rsaP,
+			[]string{"Version: DKIM1", "Key: rsa, 1024 bits", "Services: *"}},
+		{"rsa by default", "p=" + rsaP,
+			[]string{"Key: rsa, 1024 bits", "Services: *"}},
+		{"bare RSAPublicKey", "p=" + pkcs1P,
+			[]string{"Key: rsa, 1024 bits", "Services: *"}},
+		{"ecdsa", "p=" + ecP,
+			[]string{"Key: ecdsa, 256 bits, which DKIM does not support", "Services: *"}},
+		{"unreadable rsa", "p=AQID",
+			[]string{"Key: rsa, which cannot be parsed", "Services: *"}},
+		{"ed25519", "v=DKIM1; k=ED25519; p=" + edP,
+			[]string{"Version: DKIM1", "Key: ed25519", "Services: *"}},
+		{"short ed25519", "k=ed25519; p=AQID",
+			[]string{"Key: ed25519, with 3 octets instead of 32", "Services: *"}},
+		{"unknown key type", "k=future; p=AQID",
+			[]string{"Key: future, 3 octets", "Services: *"}},
+		{"revoked", "v=DKIM1; p=",
+			[]string{"Version: DKIM1", "Key: revoked", "Services: *"}},
+		{"key folded with whitespace", "k=ed25519; p=" + edP[:10] + " \t " + edP[10:],
+			[]string{"Key: ed25519", "Services: *"}},
+		{"every tag", "v=DKIM1; h=sha1 : sha256; k=ed25519; n=rotated yearly; p=" + edP + "; s=email; t=y:s:x",
+			[]string{"Version: DKIM1", "Key: ed25519", "Hash algorithms: sha1, sha256", "Services: email",
+				"Flag: y (testing, signatures are not to be relied on)",
+				"Flag: s (the domain of signatures must match exactly, not subdomains)",
+				"Flag: x (unknown)", "Notes: rotated yearly"}},
+
+		// Tags the key does not know are kept but otherwise ignored
+		{"unknown tags", "k=ed25519; future=1; p=" + edP + "; z=",
+			[]string{"Key: ed25519", "Services: *"}},
+	}
+
+	for _, tt := range tests {
+		k, err := ParseDKIMKey(tt.txt)
+		if err != nil {
+			t.Errorf("%s: ParseDKIMKey: %v", tt.name, err)
+			continue
+		}
+
+		if got := k.Summary(); !reflect.DeepEqual(got, tt.summary) {
+			t.Errorf("%s: Summary = %q, want %q", tt.name, got, tt.summary)
+		}
+	}
+
+	k, err := ParseDKIMKey("v=DKIM1; t=y; future=1; p=")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !k.Testing() || !k.Revoked() || len(k.Tags) != 4 || k.Tags[2] != (Tag{"future", "1"}) {
+		t.Errorf("key %+v is not a revoked testing key with all its tags", k)
+	}
+
+	malformed := []struct {
+		name string
+		txt  string
+	}{
+		{"empty", ""},
+		{"no key", "v=DKIM1; k=rsa"},
+		{"version not first", "k=rsa; v=DKIM1; p=AQID"},
+		{"unknown version", "v=DKIM2; p=AQID"},
+		{"duplicate tag", "v=DKIM1; p=AQID; p=AQID"},
+		{"duplicate unknown tag", "x=1; p=AQID; x=2"},
+		{"invalid base64", "p=not*base64"},
+		{"tag without a value", "v=DKIM1; p"},
+		{"invalid tag name", "v=DKIM1; 9=x; p=AQID"},
+		{"empty tag", "v=DKIM1;; p=AQID"},
+	}
+
+	for _, tt := range malformed {
+		if k, err := ParseDKIMKey(tt.txt); err == nil {
+			t.Errorf("%s: ParseDKIMKey(%q) = %+v, want an error", tt.name, tt.txt, k)
+		}
+	}
+}
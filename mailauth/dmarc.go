@@ -0,0 +1,204 @@
+package mailauth
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Domains publish their DMARC policy at _dmarc.<domain>, see RFC 7489 section
+// 6.1.
+
+// dmarcPolicies are the values the p= and sp= tags may take
+var dmarcPolicies = map[string]bool{
+	"none":       true,
+	"quarantine": true,
+	"reject":     true,
+}
+
+// dmarcFailureOptions describes the options of the fo= tag
+var dmarcFailureOptions = map[string]string{
+	"0": "report when all checks fail",
+	"1": "report when any check fails",
+	"d": "report when DKIM fails",
+	"s": "report when SPF fails",
+}
+
+// DMARC is a DMARC policy record
+type DMARC struct {
+	// Policy is what receivers should do with mail failing the checks:
+	// "none", "quarantine" or "reject"
+	Policy string
+
+	// SubdomainPolicy applies to the subdomains of the domain in place of
+	// Policy
+	SubdomainPolicy string
+
+	// DKIMAlignment and SPFAlignment are "r" when the authenticated domain
+	// need only share the organizational domain, or "s" when it must match
+	DKIMAlignment string
+	SPFAlignment  string
+
+	// Percent is the share of failing mail the policy applies to
+	Percent int
+
+	// AggregateReports and FailureReports are the URIs reports are sent to
+	AggregateReports []string
+	FailureReports   []string
+
+	// FailureOptions say when failure reports are made
+	FailureOptions []string
+
+	// ReportFormat is the format of failure reports
+	ReportFormat string
+
+	// ReportInterval is how often aggregate reports are asked for, in
+	// seconds
+	ReportInterval uint32
+
+	// Tags holds every tag of the record as written
+	Tags []Tag
+}
+
+// isDMARC reports if txt announces itself as a DMARC policy
+func isDMARC(txt string) bool {
+	return firstTagIs(txt, "v", "DMARC1")
+}
+
+// ParseDMARC reads a DMARC policy record, filling in the defaults of the tags
+// it leaves out
+func ParseDMARC(txt string) (*DMARC, error) {
+	tags, err := ParseTagList(txt)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid DMARC record: %v", err)
+	}
+
+	if tags[0].Name != "v" || tags[0].Value != "DMARC1" {
+		return nil, errors.New("Invalid DMARC record: v=DMARC1 must be the first tag")
+	}
+
+	d := &DMARC{
+		DKIMAlignment:  "r",
+		SPFAlignment:   "r",
+		Percent:        100,
+		FailureOptions: []string{"0"},
+		ReportFormat:   "afrf",
+		ReportInterval: 86400,
+		Tags:           tags,
+	}
+
+	for _, tag := range tags[1:] {
+		value := strings.ToLower(tag.Value)
+
+		switch tag.Name {
+		case "p", "sp":
+			if !dmarcPolicies[value] {
+				return nil, fmt.Errorf("Invalid DMARC record: unknown policy '%s'", tag.Value)
+			}
+
+			if tag.Name == "p" {
+				d.Policy = value
+			} else {
+				d.SubdomainPolicy = value
+			}
+
+		case "adkim", "aspf":
+			if value != "r" && value != "s" {
+				return nil, fmt.Errorf("Invalid DMARC record: %s must be 'r' or 's'", tag.Name)
+			}
+
+			if tag.Name == "adkim" {
+				d.DKIMAlignment = value
+			} else {
+				d.SPFAlignment = value
+			}
+
+		case "pct":
+			pct, err := strconv.Atoi(tag.Value)
+			if err != nil || pct < 0 || pct > 100 {
+				return nil, fmt.Errorf("Invalid DMARC record: pct must be from 0 to 100, not '%s'", tag.Value)
+			}
+
+			d.Percent = pct
+
+		case "rua":
+			d.AggregateReports = splitList(tag.Value, ",")
+		case "ruf":
+			d.FailureReports = splitList(tag.Value, ",")
+		case "fo":
+			d.FailureOptions = splitList(value, ":")
+		case "rf":
+			d.ReportFormat = value
+
+		case "ri":
+			ri, err := strconv.ParseUint(tag.Value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid DMARC record: invalid report interval '%s'", tag.Value)
+			}
+
+			d.ReportInterval = uint32(ri)
+		}
+	}
+
+	// A record without a policy but asking for reports is treated as
+	// monitoring only, see RFC 7489 section 6.6.3
+	if d.Policy == "" {
+		if len(d.AggregateReports) == 0 {
+			return nil, errors.New("Invalid DMARC record: the p= tag is required")
+		}
+
+		d.Policy = "none"
+	}
+
+	if d.SubdomainPolicy == "" {
+		d.SubdomainPolicy = d.Policy
+	}
+
+	return d, nil
+}
+
+// Kind names the sort of record
+func (d *DMARC) Kind() string {
+	return "DMARC"
+}
+
+// Summary describes each part of the record
+func (d *DMARC) Summary() []string {
+	lines := []string{
+		"Policy: " + d.Policy,
+		"Subdomain policy: " + d.SubdomainPolicy,
+		"DKIM alignment: " + describeAlignment(d.DKIMAlignment),
+		"SPF alignment: " + describeAlignment(d.SPFAlignment),
+		fmt.Sprintf("Applies to: %d%% of failing mail", d.Percent),
+	}
+
+	if len(d.AggregateReports) > 0 {
+		lines = append(lines, "Aggregate reports: "+strings.Join(d.AggregateReports, ", "))
+		lines = append(lines, fmt.Sprintf("Report interval: %ds", d.ReportInterval))
+	}
+
+	if len(d.FailureReports) > 0 {
+		lines = append(lines, "Failure reports: "+strings.Join(d.FailureReports, ", "))
+
+		for _, option := range d.FailureOptions {
+			description, ok := dmarcFailureOptions[option]
+			if !ok {
+				description = "unknown"
+			}
+
+			lines = append(lines, fmt.Sprintf("Failure option: %s (%s)", option, description))
+		}
+	}
+
+	return lines
+}
+
+// describeAlignment names an alignment mode
+func describeAlignment(mode string) string {
+	if mode == "s" {
+		return "strict"
+	}
+
+	return "relaxed"
+}
@@ -0,0 +1,110 @@
+package mailauth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDMARC(t *testing.T) {
+	defaults := func(policy string) DMARC {
+		return DMARC{
+			Policy:          policy,
+			SubdomainPolicy: policy,
+			DKIMAlignment:   "r",
+			SPFAlignment:    "r",
+			Percent:         100,
+			FailureOptions:  []string{"0"},
+			ReportFormat:    "afrf",
+			ReportInterval:  86400,
+		}
+	}
+
+	tests := []struct {
+		name string
+		txt  string
+		want func(d *DMARC)
+	}{
+		{"policy only", "v=DMARC1; p=reject", func(d *DMARC) {
+			*d = defaults("reject")
+		}},
+		{"every tag", "v=DMARC1; p=Quarantine; sp=none; adkim=s; aspf=S; pct=25; " +
+			"rua=mailto:a@example.com, mailto:b@example.net; ruf=mailto:f@example.com; fo=1:D; rf=AFRF; ri=3600", func(d *DMARC) {
+			*d = defaults("quarantine")
+			d.SubdomainPolicy = "none"
+			d.DKIMAlignment = "s"
+			d.SPFAlignment = "s"
+			d.Percent = 25
+			d.AggregateReports = []string{"mailto:a@example.com", "mailto:b@example.net"}
+			d.FailureReports = []string{"mailto:f@example.com"}
+			d.FailureOptions = []string{"1", "d"}
+			d.ReportFormat = "afrf"
+			d.ReportInterval = 3600
+		}},
+
+		// Reports without a policy only monitor the mail
+		{"reports without a policy", "v=DMARC1; rua=mailto:a@example.com", func(d *DMARC) {
+			*d = defaults("none")
+			d.AggregateReports = []string{"mailto:a@example.com"}
+		}},
+
+		// Tags the policy does not know are kept but otherwise ignored
+		{"unknown tags", "v=DMARC1; p=none; future=1; np=reject", func(d *DMARC) {
+			*d = defaults("none")
+		}},
+		{"trailing semicolon", "v=DMARC1; p=none;", func(d *DMARC) {
+			*d = defaults("none")
+		}},
+	}
+
+	for _, tt := range tests {
+		d, err := ParseDMARC(tt.txt)
+		if err != nil {
+			t.Errorf("%s: ParseDMARC: %v", tt.name, err)
+			continue
+		}
+
+		var want DMARC
+		tt.want(&want)
+		want.Tags = d.Tags
+
+		if !reflect.DeepEqual(*d, want) {
+			t.Errorf("%s: ParseDMARC = %+v, want %+v", tt.name, *d, want)
+		}
+	}
+
+	d, err := ParseDMARC("v=DMARC1; p=none; future=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []Tag{{"v", "DMARC1"}, {"p", "none"}, {"future", "1"}}; !reflect.DeepEqual(d.Tags, want) {
+		t.Errorf("Tags = %v, want %v", d.Tags, want)
+	}
+
+	malformed := []struct {
+		name string
+		txt  string
+	}{
+		{"empty", ""},
+		{"no version", "p=reject"},
+		{"version not first", "p=reject; v=DMARC1"},
+		{"unknown version", "v=DMARC2; p=reject"},
+		{"no policy or reports", "v=DMARC1; pct=50"},
+		{"unknown policy", "v=DMARC1; p=discard"},
+		{"unknown subdomain policy", "v=DMARC1; p=none; sp=drop"},
+		{"unknown alignment", "v=DMARC1; p=none; adkim=x"},
+		{"percent too large", "v=DMARC1; p=none; pct=101"},
+		{"percent not a number", "v=DMARC1; p=none; pct=half"},
+		{"negative interval", "v=DMARC1; p=none; ri=-1"},
+		{"duplicate tag", "v=DMARC1; p=none; p=reject"},
+		{"duplicate unknown tag", "v=DMARC1; p=none; x=1; x=1"},
+		{"tag without a value", "v=DMARC1; p"},
+		{"empty tag", "v=DMARC1;; p=none"},
+	}
+
+	for _, tt := range malformed {
+		if d, err := ParseDMARC(tt.txt); err == nil {
+			t.Errorf("%s: ParseDMARC(%q) = %+v, want an error", tt.name, tt.txt, d)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Package mailauth parses the SPF, DKIM and DMARC policies domains publish in
+// TXT records to authenticate the mail sent in their name.
+package mailauth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Record is an SPF policy, DKIM key or DMARC policy read from a TXT record
+type Record interface {
+	// Kind names the sort of record: "SPF", "DKIM" or "DMARC"
+	Kind() string
+
+	// Summary describes each part of the record, one per line
+	Summary() []string
+}
+
+// Recognize parses the text of a TXT record owned by owner if it is an SPF,
+// DKIM or DMARC record. DKIM keys are recognized by an owner below a
+// _domainkey label and DMARC policies by starting with v=DMARC1. A nil Record
+// and error are returned for any other text.
+func Recognize(owner, txt string) (Record, error) {
+	var r Record
+	var err error
+
+	switch {
+	case IsSPF(txt):
+		r, err = ParseSPF(txt)
+	case isDMARC(txt):
+		r, err = ParseDMARC(txt)
+	case isDKIMOwner(owner) || isDKIM(txt):
+		r, err = ParseDKIMKey(txt)
+	default:
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Describe presents a record found at owner in the style of the sections of
+// a response
+func Describe(owner string, r Record) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("> %s: %s\n", r.Kind(), owner))
+
+	for _, line := range r.Summary() {
+		sb.WriteString(fmt.Sprintf(">   %s\n", line))
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+//-----------------------------------------------------------------------------
+// Tag Lists
+//-----------------------------------------------------------------------------
+
+// Tag is one name=value pair of the tag lists DKIM and DMARC records are made
+// of
+type Tag struct {
+	Name  string
+	Value string
+}
+
+// ParseTagList reads a list of tags separated by semicolons as described in
+// RFC 6376 section 3.2. Whitespace around names and values is dropped and a
+// name may only appear once.
+func ParseTagList(s string) ([]Tag, error) {
+	var tags []Tag
+
+	seen := make(map[string]bool)
+	specs := strings.Split(s, ";")
+
+	for i, spec := range specs {
+		spec = strings.TrimSpace(spec)
+
+		// The list may end with a semicolon
+		if spec == "" && i == len(specs)-1 {
+			break
+		}
+
+		if spec == "" {
+			return nil, errors.New("Tag list holds an empty tag")
+		}
+
+		eq := strings.Index(spec, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("Tag '%s' has no value", spec)
+		}
+
+		name := strings.TrimSpace(spec[:eq])
+		if !isTagName(name) {
+			return nil, fmt.Errorf("Invalid tag name '%s'", name)
+		}
+
+		if seen[name] {
+			return nil, fmt.Errorf("Tag '%s' appears more than once", name)
+		}
+
+		seen[name] = true
+		tags = append(tags, Tag{Name: name, Value: strings.TrimSpace(spec[eq+1:])})
+	}
+
+	if len(tags) == 0 {
+		return nil, errors.New("Tag list is empty")
+	}
+
+	return tags, nil
+}
+
+// isTagName reports if name is a letter followed by letters, digits and
+// underscores
+func isTagName(name string) bool {
+	if name == "" || !isAlpha(name[0]) {
+		return false
+	}
+
+	for i := 1; i < len(name); i++ {
+		if c := name[i]; !isAlpha(c) && !isDigit(c) && c != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// tagValue returns the value of the tag called name, and whether it was
+// given
+func tagValue(tags []Tag, name string) (string, bool) {
+	for _, tag := range tags {
+		if tag.Name == name {
+			return tag.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// splitList splits a value holding a list such as "sha1:sha256", dropping the
+// whitespace around each item
+func splitList(value, sep string) []string {
+	var items []string
+
+	for _, item := range strings.Split(value, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// firstTagIs reports if txt is a tag list starting with name=value, which is
+// how DKIM and DMARC records announce their version
+func firstTagIs(txt, name, value string) bool {
+	first := strings.SplitN(txt, ";", 2)[0]
+
+	eq := strings.Index(first, "=")
+	if eq < 0 {
+		return false
+	}
+
+	return strings.TrimSpace(first[:eq]) == name && strings.TrimSpace(first[eq+1:]) == value
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,117 @@
+package mailauth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+func TestParseTagList(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []Tag
+	}{
+		{"v=DKIM1; p=AQID", []Tag{{"v", "DKIM1"}, {"p", "AQID"}}},
+		{"  v = DMARC1 ;p=none;", []Tag{{"v", "DMARC1"}, {"p", "none"}}},
+		{"a=; b_2=x=y", []Tag{{"a", ""}, {"b_2", "x=y"}}},
+		{"n=two  spaces inside", []Tag{{"n", "two  spaces inside"}}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTagList(tt.s)
+		if err != nil {
+			t.Errorf("ParseTagList(%q): %v", tt.s, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseTagList(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+
+	malformed := []string{
+		"",
+		";",
+		"v=DKIM1;; p=AQID",
+		"v=DKIM1; p",
+		"=AQID",
+		"1p=AQID",
+		"p-q=AQID",
+		"p=AQID; p=BAUG",
+	}
+
+	for _, s := range malformed {
+		if tags, err := ParseTagList(s); err == nil {
+			t.Errorf("ParseTagList(%q) = %v, want an error", s, tags)
+		}
+	}
+}
+
+func TestRecognize(t *testing.T) {
+	key := strings.Repeat("A", 43) + "="
+
+	tests := []struct {
+		rr   string
+		kind string
+	}{
+		{`example.com. 300 IN TXT "v=spf1 -all"`, "SPF"},
+		{`example.com. 300 IN TXT "v=spf1 include:_spf.example.net " "-all"`, "SPF"},
+		{`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=reject"`, "DMARC"},
+		{`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=rej" "ect; rua=mailto:d@example.com"`, "DMARC"},
+		{`sel._domainkey.example.com. 300 IN TXT "k=ed25519; p=` + key + `"`, "DKIM"},
+		{`sel._domainkey.example.com. 300 IN TXT "v=DKIM1; k=ed25519; p=` + key[:20] + `" "` + key[20:] + `"`, "DKIM"},
+		{`other.example.com. 300 IN TXT "v=DKIM1; k=ed25519; p=` + key + `"`, "DKIM"},
+		{`example.com. 300 IN TXT "google-site-verification=abc"`, ""},
+		{`_domainkey.example.com. 300 IN TXT "o=~"`, ""},
+	}
+
+	for _, tt := range tests {
+		rr, err := dnsmsg.ParseRR(tt.rr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Records split across several strings are read joined together
+		r, err := Recognize(rr.NAME, rr.RDATA.(*dnsmsg.RDataTXT).Text())
+		if err != nil {
+			t.Errorf("Recognize(%s): %v", tt.rr, err)
+			continue
+		}
+
+		var kind string
+		if r != nil {
+			kind = r.Kind()
+		}
+
+		if kind != tt.kind {
+			t.Errorf("Recognize(%s) kind = %q, want %q", tt.rr, kind, tt.kind)
+		}
+	}
+
+	// Recognized records which cannot be read are errors
+	for _, txt := range []string{"v=DMARC1; p=never", "v=DKIM1; k=rsa", "v=spf1 bogus"} {
+		if r, err := Recognize("example.com.", txt); err == nil {
+			t.Errorf("Recognize(%q) = %v, want an error", txt, r)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	d, err := ParseDMARC("v=DMARC1; p=quarantine; adkim=s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `> DMARC: _dmarc.example.com.
+>   Policy: quarantine
+>   Subdomain policy: quarantine
+>   DKIM alignment: strict
+>   SPF alignment: relaxed
+>   Applies to: 100% of failing mail`
+
+	if got := Describe("_dmarc.example.com.", d); got != want {
+		t.Errorf("Describe =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,458 @@
+package mailauth
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Domains list the hosts allowed to send their mail in an SPF record starting
+// with v=spf1, see RFC 7208 section 4.5.
+
+// Qualifier is the result an SPF mechanism gives when it matches
+type Qualifier byte
+
+// These are the qualifiers which may come before a mechanism. A mechanism
+// without one passes.
+const (
+	QualifierPass     Qualifier = '+'
+	QualifierFail     Qualifier = '-'
+	QualifierSoftFail Qualifier = '~'
+	QualifierNeutral  Qualifier = '?'
+)
+
+// String names the result of the qualifier
+func (q Qualifier) String() string {
+	switch q {
+	case QualifierFail:
+		return "fail"
+	case QualifierSoftFail:
+		return "softfail"
+	case QualifierNeutral:
+		return "neutral"
+	}
+
+	return "pass"
+}
+
+// MaxSPFLookups is the number of terms causing DNS lookups an SPF check may
+// evaluate, including those of included records, see RFC 7208 section 4.6.4
+const MaxSPFLookups = 10
+
+// SPFMechanism is one directive of an SPF record, which matches the hosts
+// given by its name and arguments
+type SPFMechanism struct {
+	Qualifier Qualifier
+
+	// Name is the mechanism: "all", "include", "a", "mx", "ptr", "ip4",
+	// "ip6" or "exists"
+	Name string
+
+	// Domain is the domain-spec given, which may hold macros. It is empty
+	// when the mechanism has none.
+	Domain string
+
+	// Network is the network of an ip4 or ip6 mechanism
+	Network *net.IPNet
+
+	// Prefix4 and Prefix6 are the prefix lengths the addresses found by an a
+	// or mx mechanism are compared with, 32 and 128 unless given
+	Prefix4 int
+	Prefix6 int
+}
+
+// String writes the mechanism as it appears in a record
+func (m SPFMechanism) String() string {
+	var sb strings.Builder
+
+	if m.Qualifier != QualifierPass {
+		sb.WriteByte(byte(m.Qualifier))
+	}
+
+	sb.WriteString(m.Name)
+
+	switch {
+	case m.Network != nil:
+		ones, _ := m.Network.Mask.Size()
+		sb.WriteString(fmt.Sprintf(":%s/%d", m.Network.IP, ones))
+
+	case m.Domain != "":
+		sb.WriteString(":" + m.Domain)
+	}
+
+	if m.Name == "a" || m.Name == "mx" {
+		if m.Prefix4 != 32 {
+			sb.WriteString(fmt.Sprintf("/%d", m.Prefix4))
+		}
+
+		if m.Prefix6 != 128 {
+			sb.WriteString(fmt.Sprintf("//%d", m.Prefix6))
+		}
+	}
+
+	return sb.String()
+}
+
+// causesLookup reports if evaluating the mechanism asks the DNS
+func (m SPFMechanism) causesLookup() bool {
+	switch m.Name {
+	case "include", "a", "mx", "ptr", "exists":
+		return true
+	}
+
+	return false
+}
+
+// SPF is an SPF record
+type SPF struct {
+	// Mechanisms are checked in order until one matches
+	Mechanisms []SPFMechanism
+
+	// Redirect is the domain whose record is used when no mechanism matches
+	Redirect string
+
+	// Explanation is the domain of a TXT record explaining a fail result
+	Explanation string
+
+	// Modifiers holds the modifiers which are not understood, which are
+	// ignored when checking
+	Modifiers []Tag
+}
+
+var (
+	// spfModifierRE matches the name and equals sign a modifier starts with
+	spfModifierRE = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9._-]*=`)
+
+	// spfCIDRRE splits the dual-cidr-length off the end of an a or mx
+	// mechanism's arguments
+	spfCIDRRE = regexp.MustCompile(`^(.*?)(?:/([0-9]+))?(?://([0-9]+))?$`)
+)
+
+// IsSPF reports if txt is an SPF record, which starts with the version
+// v=spf1 followed by a space or nothing
+func IsSPF(txt string) bool {
+	return len(txt) >= 6 && strings.EqualFold(txt[:6], "v=spf1") && (len(txt) == 6 || txt[6] == ' ')
+}
+
+// ParseSPF reads an SPF record
+func ParseSPF(txt string) (*SPF, error) {
+	if !IsSPF(txt) {
+		return nil, errors.New("Invalid SPF record: it must start with v=spf1")
+	}
+
+	s := new(SPF)
+
+	for _, term := range strings.Fields(txt[6:]) {
+		if spfModifierRE.MatchString(term) {
+			if err := s.addModifier(term); err != nil {
+				return nil, fmt.Errorf("Invalid SPF record: %v", err)
+			}
+
+			continue
+		}
+
+		m, err := parseSPFMechanism(term)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid SPF record: %v", err)
+		}
+
+		s.Mechanisms = append(s.Mechanisms, m)
+	}
+
+	return s, nil
+}
+
+// addModifier reads a name=value modifier. The redirect and exp modifiers may
+// only be given once.
+func (s *SPF) addModifier(term string) error {
+	eq := strings.Index(term, "=")
+	name, value := strings.ToLower(term[:eq]), term[eq+1:]
+
+	switch name {
+	case "redirect", "exp":
+		if err := checkMacroString(value); err != nil || value == "" {
+			return fmt.Errorf("Invalid domain in '%s'", term)
+		}
+
+		target := &s.Redirect
+		if name == "exp" {
+			target = &s.Explanation
+		}
+
+		if *target != "" {
+			return fmt.Errorf("The %s modifier appears more than once", name)
+		}
+
+		*target = value
+
+	default:
+		if err := checkMacroString(value); err != nil {
+			return fmt.Errorf("Invalid modifier '%s': %v", term, err)
+		}
+
+		s.Modifiers = append(s.Modifiers, Tag{Name: name, Value: value})
+	}
+
+	return nil
+}
+
+// parseSPFMechanism reads one directive, a qualifier followed by a mechanism
+// and its arguments
+func parseSPFMechanism(term string) (SPFMechanism, error) {
+	m := SPFMechanism{Qualifier: QualifierPass, Prefix4: 32, Prefix6: 128}
+
+	switch Qualifier(term[0]) {
+	case QualifierPass, QualifierFail, QualifierSoftFail, QualifierNeutral:
+		m.Qualifier = Qualifier(term[0])
+		term = term[1:]
+	}
+
+	name := term
+	args := ""
+
+	if i := strings.IndexAny(term, ":/"); i >= 0 {
+		name, args = term[:i], term[i:]
+	}
+
+	m.Name = strings.ToLower(name)
+
+	switch m.Name {
+	case "all":
+		if args != "" {
+			return m, fmt.Errorf("The all mechanism takes no arguments in '%s'", term)
+		}
+
+	case "include", "exists", "ptr":
+		if args == "" && m.Name != "ptr" {
+			return m, fmt.Errorf("The %s mechanism needs a domain in '%s'", m.Name, term)
+		}
+
+		if args != "" {
+			if !strings.HasPrefix(args, ":") || len(args) == 1 {
+				return m, fmt.Errorf("Invalid domain in '%s'", term)
+			}
+
+			m.Domain = args[1:]
+		}
+
+	case "a", "mx":
+		parts := spfCIDRRE.FindStringSubmatch(args)
+
+		if domain := parts[1]; domain != "" {
+			if !strings.HasPrefix(domain, ":") || len(domain) == 1 {
+				return m, fmt.Errorf("Invalid domain in '%s'", term)
+			}
+
+			m.Domain = domain[1:]
+		}
+
+		var err error
+
+		if parts[2] != "" {
+			if m.Prefix4, err = parsePrefix(parts[2], 32); err != nil {
+				return m, fmt.Errorf("%v in '%s'", err, term)
+			}
+		}
+
+		if parts[3] != "" {
+			if m.Prefix6, err = parsePrefix(parts[3], 128); err != nil {
+				return m, fmt.Errorf("%v in '%s'", err, term)
+			}
+		}
+
+	case "ip4", "ip6":
+		network, err := parseSPFNetwork(m.Name, args)
+		if err != nil {
+			return m, fmt.Errorf("%v in '%s'", err, term)
+		}
+
+		m.Network = network
+
+	default:
+		return m, fmt.Errorf("Unknown mechanism '%s'", term)
+	}
+
+	if err := checkMacroString(m.Domain); err != nil {
+		return m, fmt.Errorf("%v in '%s'", err, term)
+	}
+
+	return m, nil
+}
+
+// parseSPFNetwork reads the ':address[/prefix]' arguments of an ip4 or ip6
+// mechanism
+func parseSPFNetwork(name, args string) (*net.IPNet, error) {
+	if !strings.HasPrefix(args, ":") {
+		return nil, fmt.Errorf("The %s mechanism needs an address", name)
+	}
+
+	addr, prefix := args[1:], ""
+	if i := strings.Index(addr, "/"); i >= 0 {
+		addr, prefix = addr[:i], addr[i+1:]
+	}
+
+	bits := 32
+	ip := net.ParseIP(addr)
+
+	if name == "ip6" {
+		bits = 128
+	} else if ip != nil {
+		ip = ip.To4()
+	}
+
+	if ip == nil || (name == "ip6") != (strings.Contains(addr, ":")) {
+		return nil, fmt.Errorf("Invalid address '%s'", addr)
+	}
+
+	ones := bits
+
+	if prefix != "" {
+		var err error
+		if ones, err = parsePrefix(prefix, bits); err != nil {
+			return nil, err
+		}
+	}
+
+	mask := net.CIDRMask(ones, bits)
+
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}, nil
+}
+
+// parsePrefix reads a prefix length of at most max bits. Leading zeros are
+// not allowed.
+func parsePrefix(s string, max int) (int, error) {
+	prefix, err := strconv.Atoi(s)
+	if err != nil || prefix > max || (len(s) > 1 && s[0] == '0') {
+		return 0, fmt.Errorf("Invalid prefix length '%s'", s)
+	}
+
+	return prefix, nil
+}
+
+// checkMacroString makes sure each % in s starts a valid macro, see RFC 7208
+// section 7.1
+func checkMacroString(s string) error {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			continue
+		}
+
+		if i+1 == len(s) {
+			return errors.New("Macro is not finished")
+		}
+
+		switch s[i+1] {
+		case '%', '_', '-':
+			i++
+			continue
+		case '{':
+		default:
+			return fmt.Errorf("Invalid macro '%%%c'", s[i+1])
+		}
+
+		end := strings.Index(s[i:], "}")
+		if end < 0 {
+			return errors.New("Macro is not closed")
+		}
+
+		if _, err := parseMacro(s[i+2 : i+end]); err != nil {
+			return err
+		}
+
+		i += end
+	}
+
+	return nil
+}
+
+// spfMacro is the letter, digit count, reversal and delimiters of a macro
+// such as %{ir.}
+type spfMacro struct {
+	letter     byte
+	digits     int
+	reverse    bool
+	delimiters string
+}
+
+// parseMacro reads the inside of the braces of a macro
+func parseMacro(s string) (spfMacro, error) {
+	var macro spfMacro
+
+	if s == "" || !strings.ContainsRune("slodiphcrtvSLODIPHCRTV", rune(s[0])) {
+		return macro, fmt.Errorf("Invalid macro '%%{%s}'", s)
+	}
+
+	macro.letter = s[0]
+	i := 1
+
+	for i < len(s) && isDigit(s[i]) {
+		macro.digits = macro.digits*10 + int(s[i]-'0')
+		i++
+	}
+
+	if i < len(s) && (s[i] == 'r' || s[i] == 'R') {
+		macro.reverse = true
+		i++
+	}
+
+	macro.delimiters = s[i:]
+
+	for j := 0; j < len(macro.delimiters); j++ {
+		if !strings.ContainsRune(".-+,/_=", rune(macro.delimiters[j])) {
+			return macro, fmt.Errorf("Invalid macro '%%{%s}'", s)
+		}
+	}
+
+	return macro, nil
+}
+
+// Kind names the sort of record
+func (s *SPF) Kind() string {
+	return "SPF"
+}
+
+// Lookups returns the number of terms of the record which ask the DNS, not
+// counting those of included records
+func (s *SPF) Lookups() int {
+	count := 0
+
+	for _, m := range s.Mechanisms {
+		if m.causesLookup() {
+			count++
+		}
+	}
+
+	if s.Redirect != "" {
+		count++
+	}
+
+	return count
+}
+
+// Summary describes each part of the record
+func (s *SPF) Summary() []string {
+	var lines []string
+
+	for _, m := range s.Mechanisms {
+		lines = append(lines, fmt.Sprintf("%-8s %s", m.Qualifier, m))
+	}
+
+	if s.Redirect != "" {
+		lines = append(lines, "Redirect: "+s.Redirect)
+	}
+
+	if s.Explanation != "" {
+		lines = append(lines, "Explanation: "+s.Explanation)
+	}
+
+	for _, modifier := range s.Modifiers {
+		lines = append(lines, fmt.Sprintf("Modifier: %s=%s", modifier.Name, modifier.Value))
+	}
+
+	lines = append(lines, fmt.Sprintf("DNS lookups: %d of %d", s.Lookups(), MaxSPFLookups))
+
+	return lines
+}
@@ -0,0 +1,867 @@
+package mailauth
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dansackett/dns-client/dnsclient"
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// Checking a host against the SPF policy of a domain follows the check_host()
+// function of RFC 7208 section 4. Every step taken is noted in a trail so the
+// result can be explained.
+
+// SPFResult is the outcome of an SPF check, see RFC 7208 section 2.6
+type SPFResult string
+
+// These are the results an SPF check can give
+const (
+	SPFNone      SPFResult = "none"
+	SPFNeutral   SPFResult = "neutral"
+	SPFPass      SPFResult = "pass"
+	SPFFail      SPFResult = "fail"
+	SPFSoftFail  SPFResult = "softfail"
+	SPFTempError SPFResult = "temperror"
+	SPFPermError SPFResult = "permerror"
+)
+
+// MaxSPFVoidLookups is the number of lookups made by mechanisms which may
+// find no records before the check fails, see RFC 7208 section 4.6.4
+const MaxSPFVoidLookups = 2
+
+// maxSPFNames is the number of MX or PTR names a single mechanism looks at
+const maxSPFNames = 10
+
+// qualifierResults maps the qualifier of a matching mechanism to the result
+var qualifierResults = map[Qualifier]SPFResult{
+	QualifierPass:     SPFPass,
+	QualifierFail:     SPFFail,
+	QualifierSoftFail: SPFSoftFail,
+	QualifierNeutral:  SPFNeutral,
+}
+
+// SPFCheck is the outcome of checking a host against an SPF policy
+type SPFCheck struct {
+	Result SPFResult
+
+	// Explanation is the text the domain gives for a fail result, if any
+	Explanation string
+
+	// Lookups and VoidLookups count the DNS lookups made against the limits
+	// of MaxSPFLookups and MaxSPFVoidLookups
+	Lookups     int
+	VoidLookups int
+
+	// Trail notes each record fetched and mechanism tried, indented by how
+	// deeply it was included
+	Trail []string
+}
+
+// String presents the outcome in the style of the sections of a response
+func (c *SPFCheck) String() string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("> SPF: %s\n", c.Result))
+
+	if c.Explanation != "" {
+		sb.WriteString(fmt.Sprintf("> Explanation: %s\n", c.Explanation))
+	}
+
+	sb.WriteString(fmt.Sprintf("> DNS lookups: %d of %d, void lookups: %d of %d\n", c.Lookups, MaxSPFLookups, c.VoidLookups, MaxSPFVoidLookups))
+	sb.WriteString("> Decision trail:\n")
+
+	for _, step := range c.Trail {
+		sb.WriteString(fmt.Sprintf(">   %s\n", step))
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// SPFChecker checks hosts against the SPF policies of the domains they send
+// mail for
+type SPFChecker struct {
+	// Asks for the records of a type at a name. The response code tells a
+	// missing name apart from a failed lookup.
+	Query func(ctx context.Context, name string, typ dnsmsg.RecordType) (*dnsmsg.Message, error)
+
+	// HELO is the name the host gave in its SMTP greeting. It is checked in
+	// place of an empty sender and fills in the %{h} macro.
+	HELO string
+
+	// Receiver is the domain of the host checking, used by the %{r} macro in
+	// explanations. "unknown" is used when empty.
+	Receiver string
+
+	// The time used by the %{t} macro in explanations. The current time is
+	// used when zero.
+	Now time.Time
+}
+
+// NewSPFChecker creates an SPFChecker asking client for the records it needs
+func NewSPFChecker(client *dnsclient.Client) *SPFChecker {
+	return &SPFChecker{
+		Query: func(ctx context.Context, name string, typ dnsmsg.RecordType) (*dnsmsg.Message, error) {
+			resp, _, err := client.Exchange(ctx, dnsmsg.NewQuery(name, typ))
+
+			return resp, err
+		},
+	}
+}
+
+// Check decides if the host at ip may send mail from sender, an address or a
+// bare domain. An empty sender checks the HELO name with a local part of
+// postmaster, see RFC 7208 section 2.4.
+func (c *SPFChecker) Check(ctx context.Context, ip net.IP, sender string) *SPFCheck {
+	if sender == "" {
+		sender = c.HELO
+	}
+
+	local, domain := "postmaster", sender
+	if at := strings.LastIndex(sender, "@"); at >= 0 {
+		local, domain = sender[:at], sender[at+1:]
+	}
+
+	if local == "" {
+		local = "postmaster"
+	}
+
+	s := &spfSession{
+		c:      c,
+		ctx:    ctx,
+		ip:     ip,
+		local:  local,
+		domain: strings.TrimSuffix(domain, "."),
+		check:  new(SPFCheck),
+	}
+
+	s.check.Result, s.check.Explanation = s.checkHost(s.domain, 0)
+
+	return s.check
+}
+
+//-----------------------------------------------------------------------------
+// Evaluation
+//-----------------------------------------------------------------------------
+
+// spfSession holds the state of one check, which is shared by the records it
+// includes so the lookup limits cover all of them
+type spfSession struct {
+	c      *SPFChecker
+	ctx    context.Context
+	ip     net.IP
+	local  string
+	domain string
+	check  *SPFCheck
+}
+
+// spfError ends a check with a temperror or permerror result
+type spfError struct {
+	result SPFResult
+	reason string
+}
+
+func (e *spfError) Error() string {
+	return e.reason
+}
+
+func permError(format string, args ...interface{}) error {
+	return &spfError{result: SPFPermError, reason: fmt.Sprintf(format, args...)}
+}
+
+func tempError(format string, args ...interface{}) error {
+	return &spfError{result: SPFTempError, reason: fmt.Sprintf(format, args...)}
+}
+
+// note adds a step to the trail indented for the depth of inclusion
+func (s *spfSession) note(depth int, format string, args ...interface{}) {
+	s.check.Trail = append(s.check.Trail, strings.Repeat("  ", depth)+fmt.Sprintf(format, args...))
+}
+
+// checkHost evaluates the policy of domain for the host, returning the result
+// along with the explanation of a fail result
+func (s *spfSession) checkHost(domain string, depth int) (SPFResult, string) {
+	if !isValidSPFDomain(domain) {
+		s.note(depth, "%s: not a valid domain", domain)
+		return SPFNone, ""
+	}
+
+	record, err := s.fetchRecord(domain)
+	if err != nil {
+		s.note(depth, "%s: %v", domain, err)
+		return err.(*spfError).result, ""
+	}
+
+	if record == nil {
+		s.note(depth, "%s: no SPF record", domain)
+		return SPFNone, ""
+	}
+
+	s.note(depth, "%s: %s", domain, record)
+
+	spf, err := ParseSPF(record.Text())
+	if err != nil {
+		s.note(depth+1, "%v", err)
+		return SPFPermError, ""
+	}
+
+	for _, m := range spf.Mechanisms {
+		matched, err := s.matches(m, domain, depth+1)
+		if err != nil {
+			s.note(depth+1, "%s: %v", m, err)
+			return err.(*spfError).result, ""
+		}
+
+		if !matched {
+			continue
+		}
+
+		result := qualifierResults[m.Qualifier]
+		s.note(depth+1, "%s: match, %s", m, result)
+
+		if result == SPFFail && spf.Explanation != "" {
+			return result, s.explain(spf.Explanation, domain, depth+1)
+		}
+
+		return result, ""
+	}
+
+	if spf.Redirect == "" {
+		s.note(depth+1, "no mechanism matched, neutral")
+		return SPFNeutral, ""
+	}
+
+	if err := s.countLookup(); err != nil {
+		s.note(depth+1, "redirect=%s: %v", spf.Redirect, err)
+		return SPFPermError, ""
+	}
+
+	target, err := s.expandDomain(spf.Redirect, domain)
+	if err != nil {
+		s.note(depth+1, "redirect=%s: %v", spf.Redirect, err)
+		return SPFPermError, ""
+	}
+
+	s.note(depth+1, "no mechanism matched, redirect to %s", target)
+
+	result, explanation := s.checkHost(target, depth+1)
+
+	// A redirect to a domain without a policy is an error in the record
+	// doing the redirecting
+	if result == SPFNone {
+		s.note(depth+1, "redirect=%s: the target has no SPF record, permerror", target)
+		return SPFPermError, ""
+	}
+
+	return result, explanation
+}
+
+// fetchRecord returns the single SPF record of domain, or nil when it has
+// none
+func (s *spfSession) fetchRecord(domain string) (*dnsmsg.RDataTXT, error) {
+	rrs, err := s.lookup(domain, dnsmsg.RecordTypeTXT)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *dnsmsg.RDataTXT
+
+	for _, rr := range rrs {
+		txt, ok := rr.RDATA.(*dnsmsg.RDataTXT)
+		if !ok || !IsSPF(txt.Text()) {
+			continue
+		}
+
+		if found != nil {
+			return nil, permError("more than one SPF record")
+		}
+
+		found = txt
+	}
+
+	return found, nil
+}
+
+// matches reports if mechanism m of the policy of domain matches the host
+func (s *spfSession) matches(m SPFMechanism, domain string, depth int) (bool, error) {
+	if m.causesLookup() {
+		if err := s.countLookup(); err != nil {
+			return false, err
+		}
+	}
+
+	target := domain
+
+	if m.Domain != "" {
+		var err error
+		if target, err = s.expandDomain(m.Domain, domain); err != nil {
+			return false, err
+		}
+	}
+
+	switch m.Name {
+	case "all":
+		return true, nil
+
+	case "ip4", "ip6":
+		matched := m.Network.Contains(s.ip)
+		if !matched {
+			s.note(depth, "%s: no match", m)
+		}
+
+		return matched, nil
+
+	case "include":
+		s.note(depth, "%s: checking %s", m, target)
+
+		result, _ := s.checkHost(target, depth+1)
+
+		switch result {
+		case SPFPass:
+			return true, nil
+		case SPFTempError:
+			return false, tempError("the included policy gave temperror")
+		case SPFPermError, SPFNone:
+			return false, permError("the included policy gave %s", result)
+		}
+
+		s.note(depth, "%s: no match, the included policy gave %s", m, result)
+		return false, nil
+
+	case "a":
+		addrs, err := s.addresses(target, true)
+		if err != nil {
+			return false, err
+		}
+
+		return s.matchAddresses(m, target, addrs, depth), nil
+
+	case "mx":
+		return s.matchMX(m, target, depth)
+
+	case "ptr":
+		for _, name := range s.validatedNames(true, depth) {
+			if strings.EqualFold(name, target) || hasSuffixFold(name, "."+target) {
+				return true, nil
+			}
+		}
+
+		s.note(depth, "%s: no match", m)
+		return false, nil
+
+	case "exists":
+		rrs, err := s.voidableLookup(target, dnsmsg.RecordTypeA)
+		if err != nil {
+			return false, err
+		}
+
+		if len(rrs) == 0 {
+			s.note(depth, "%s: no match, %s has no A records", m, target)
+		}
+
+		return len(rrs) > 0, nil
+	}
+
+	return false, permError("unknown mechanism")
+}
+
+// matchMX looks up the exchanges of target and reports if the host is one of
+// them
+func (s *spfSession) matchMX(m SPFMechanism, target string, depth int) (bool, error) {
+	rrs, err := s.voidableLookup(target, dnsmsg.RecordTypeMX)
+	if err != nil {
+		return false, err
+	}
+
+	if len(rrs) > maxSPFNames {
+		return false, permError("%s has more than %d MX records", target, maxSPFNames)
+	}
+
+	var addrs []net.IP
+
+	for _, rr := range rrs {
+		mx, ok := rr.RDATA.(*dnsmsg.RDataMX)
+		if !ok {
+			continue
+		}
+
+		exchangeAddrs, err := s.addresses(strings.TrimSuffix(mx.Exchange(), "."), false)
+		if err != nil {
+			return false, err
+		}
+
+		addrs = append(addrs, exchangeAddrs...)
+	}
+
+	return s.matchAddresses(m, target, addrs, depth), nil
+}
+
+// matchAddresses reports if the host falls within the prefix of the a or mx
+// mechanism m around any of addrs, noting the addresses when it does not
+func (s *spfSession) matchAddresses(m SPFMechanism, target string, addrs []net.IP, depth int) bool {
+	prefix, bits := m.Prefix4, 32
+	if s.ip.To4() == nil {
+		prefix, bits = m.Prefix6, 128
+	}
+
+	mask := net.CIDRMask(prefix, bits)
+
+	var found []string
+
+	for _, addr := range addrs {
+		network := net.IPNet{IP: addr.Mask(mask), Mask: mask}
+		if network.Contains(s.ip) {
+			return true
+		}
+
+		found = append(found, addr.String())
+	}
+
+	if len(found) == 0 {
+		s.note(depth, "%s: no match, %s has no addresses", m, target)
+	} else {
+		s.note(depth, "%s: no match, %s has %s", m, target, strings.Join(found, ", "))
+	}
+
+	return false
+}
+
+// addresses looks up the A or AAAA records of name, whichever match the
+// family of the host. Void lookups are counted when voidable is set.
+func (s *spfSession) addresses(name string, voidable bool) ([]net.IP, error) {
+	typ := dnsmsg.RecordTypeA
+	if s.ip.To4() == nil {
+		typ = dnsmsg.RecordTypeAAAA
+	}
+
+	lookup := s.lookup
+	if voidable {
+		lookup = s.voidableLookup
+	}
+
+	rrs, err := lookup(name, typ)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []net.IP
+
+	for _, rr := range rrs {
+		switch rData := rr.RDATA.(type) {
+		case *dnsmsg.RDataA:
+			addrs = append(addrs, rData.IP())
+		case *dnsmsg.RDataAAAA:
+			addrs = append(addrs, rData.IP())
+		}
+	}
+
+	return addrs, nil
+}
+
+// validatedNames returns the names the PTR records of the host point to
+// which have an address record leading back to it, see RFC 7208 section 5.5.
+// Lookup failures leave names out rather than failing the check. A PTR lookup
+// finding nothing is counted as void when voidable is set.
+func (s *spfSession) validatedNames(voidable bool, depth int) []string {
+	lookup := s.lookup
+	if voidable {
+		lookup = s.voidableLookup
+	}
+
+	rrs, err := lookup(reverseName(s.ip), dnsmsg.RecordTypePTR)
+	if err != nil {
+		if spfErr := err.(*spfError); spfErr.result == SPFPermError {
+			s.note(depth, "%v", err)
+		}
+
+		return nil
+	}
+
+	var names []string
+
+	for i, rr := range rrs {
+		ptr, ok := rr.RDATA.(*dnsmsg.RDataPTR)
+		if !ok || i >= maxSPFNames {
+			continue
+		}
+
+		name := strings.TrimSuffix(ptr.Domain(), ".")
+
+		addrs, err := s.addresses(name, false)
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			if addr.Equal(s.ip) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+
+	return names
+}
+
+// explain looks up the explanation of a fail result, giving up quietly when
+// it cannot be found, see RFC 7208 section 6.2
+func (s *spfSession) explain(exp, domain string, depth int) string {
+	target, err := s.expandDomain(exp, domain)
+	if err != nil {
+		return ""
+	}
+
+	rrs, err := s.lookup(target, dnsmsg.RecordTypeTXT)
+	if err != nil || len(rrs) != 1 {
+		s.note(depth, "exp=%s: no single explanation found at %s", exp, target)
+		return ""
+	}
+
+	txt, ok := rrs[0].RDATA.(*dnsmsg.RDataTXT)
+	if !ok {
+		return ""
+	}
+
+	explanation, err := s.expand(txt.Text(), domain, true)
+	if err != nil {
+		s.note(depth, "exp=%s: %v", exp, err)
+		return ""
+	}
+
+	return explanation
+}
+
+//-----------------------------------------------------------------------------
+// DNS Lookups
+//-----------------------------------------------------------------------------
+
+// countLookup counts a term which asks the DNS against the limit
+func (s *spfSession) countLookup() error {
+	s.check.Lookups++
+
+	if s.check.Lookups > MaxSPFLookups {
+		return permError("more than %d DNS lookups", MaxSPFLookups)
+	}
+
+	return nil
+}
+
+// lookup asks for the records of type typ at name. A missing name gives no
+// records while any other failure is a temperror.
+func (s *spfSession) lookup(name string, typ dnsmsg.RecordType) ([]dnsmsg.RR, error) {
+	name = dnsmsg.Fqdn(name)
+	typStr := dnsmsg.RecordTypeString(typ)
+
+	resp, err := s.c.Query(s.ctx, name, typ)
+	if err != nil {
+		return nil, tempError("%s lookup for %s failed: %v", typStr, name, err)
+	}
+
+	switch rcode := resp.ResponseCode(); rcode {
+	case dnsmsg.ResponseCodeNoError:
+	case dnsmsg.ResponseCodeNameError:
+		return nil, nil
+	default:
+		return nil, tempError("%s lookup for %s was answered with %s", typStr, name, dnsmsg.ResponseCodeToStrMap[rcode])
+	}
+
+	return answersFor(resp.Answers, name, typ), nil
+}
+
+// voidableLookup is like lookup but counts lookups finding no records against
+// the void lookup limit
+func (s *spfSession) voidableLookup(name string, typ dnsmsg.RecordType) ([]dnsmsg.RR, error) {
+	rrs, err := s.lookup(name, typ)
+	if err != nil || len(rrs) > 0 {
+		return rrs, err
+	}
+
+	s.check.VoidLookups++
+
+	if s.check.VoidLookups > MaxSPFVoidLookups {
+		return nil, permError("more than %d lookups found no records", MaxSPFVoidLookups)
+	}
+
+	return nil, nil
+}
+
+// answersFor returns the records of type typ owned by name in answers,
+// following any CNAME records which lead away from it
+func answersFor(answers []dnsmsg.RR, name string, typ dnsmsg.RecordType) []dnsmsg.RR {
+	var records []dnsmsg.RR
+
+	for range answers {
+		next := ""
+
+		for _, rr := range answers {
+			if !strings.EqualFold(dnsmsg.Fqdn(rr.NAME), name) {
+				continue
+			}
+
+			if rr.TYPE == typ {
+				records = append(records, rr)
+			} else if cname, ok := rr.RDATA.(*dnsmsg.RDataCNAME); ok {
+				next = dnsmsg.Fqdn(cname.Domain())
+			}
+		}
+
+		if len(records) > 0 || next == "" {
+			break
+		}
+
+		name = next
+	}
+
+	return records
+}
+
+//-----------------------------------------------------------------------------
+// Macros
+//-----------------------------------------------------------------------------
+
+// expandDomain expands the macros of a domain-spec, dropping labels from the
+// left of the result until it fits in a domain name, see RFC 7208 section 7.3
+func (s *spfSession) expandDomain(spec, domain string) (string, error) {
+	expanded, err := s.expand(spec, domain, false)
+	if err != nil {
+		return "", err
+	}
+
+	expanded = strings.TrimSuffix(expanded, ".")
+
+	for len(expanded) > 253 {
+		i := strings.Index(expanded, ".")
+		if i < 0 {
+			return "", permError("'%s' expands to a name which is too long", spec)
+		}
+
+		expanded = expanded[i+1:]
+	}
+
+	return expanded, nil
+}
+
+// expand replaces the macros of s with their values for the current check.
+// The c, r and t macros are only allowed in explanations.
+func (s *spfSession) expand(spec, domain string, explanation bool) (string, error) {
+	var sb strings.Builder
+
+	for i := 0; i < len(spec); i++ {
+		if spec[i] != '%' || i+1 == len(spec) {
+			sb.WriteByte(spec[i])
+			continue
+		}
+
+		i++
+
+		switch spec[i] {
+		case '%':
+			sb.WriteByte('%')
+			continue
+		case '_':
+			sb.WriteByte(' ')
+			continue
+		case '-':
+			sb.WriteString("%20")
+			continue
+		case '{':
+		default:
+			return "", permError("invalid macro '%%%c'", spec[i])
+		}
+
+		end := strings.Index(spec[i:], "}")
+		if end < 0 {
+			return "", permError("macro is not closed in '%s'", spec)
+		}
+
+		macro, err := parseMacro(spec[i+1 : i+end])
+		if err != nil {
+			return "", permError("%v", err)
+		}
+
+		i += end
+
+		value, err := s.macroValue(macro.letter, domain, explanation)
+		if err != nil {
+			return "", err
+		}
+
+		sb.WriteString(transformMacro(value, macro))
+	}
+
+	return sb.String(), nil
+}
+
+// macroValue returns the value a macro letter stands for. Upper case letters
+// give their value URL escaped.
+func (s *spfSession) macroValue(letter byte, domain string, explanation bool) (string, error) {
+	var value string
+
+	switch lower := letter | 0x20; lower {
+	case 's':
+		value = s.local + "@" + s.domain
+	case 'l':
+		value = s.local
+	case 'o':
+		value = s.domain
+	case 'd':
+		value = domain
+	case 'i':
+		value = dottedIP(s.ip)
+	case 'v':
+		value = "in-addr"
+		if s.ip.To4() == nil {
+			value = "ip6"
+		}
+	case 'h':
+		value = s.c.HELO
+		if value == "" {
+			value = "unknown"
+		}
+	case 'p':
+		value = s.ptrName(domain)
+	case 'c', 'r', 't':
+		if !explanation {
+			return "", permError("the %%{%c} macro is only allowed in explanations", letter)
+		}
+
+		switch lower {
+		case 'c':
+			value = s.ip.String()
+		case 'r':
+			value = s.c.Receiver
+			if value == "" {
+				value = "unknown"
+			}
+		case 't':
+			now := s.c.Now
+			if now.IsZero() {
+				now = time.Now()
+			}
+
+			value = strconv.FormatInt(now.Unix(), 10)
+		}
+	}
+
+	if letter >= 'A' && letter <= 'Z' {
+		value = strings.Replace(url.QueryEscape(value), "+", "%20", -1)
+	}
+
+	return value, nil
+}
+
+// ptrName picks the validated name of the host for the %{p} macro, preferring
+// domain itself and then its subdomains
+func (s *spfSession) ptrName(domain string) string {
+	names := s.validatedNames(false, 0)
+
+	for _, name := range names {
+		if strings.EqualFold(name, domain) {
+			return name
+		}
+	}
+
+	for _, name := range names {
+		if hasSuffixFold(name, "."+domain) {
+			return name
+		}
+	}
+
+	if len(names) > 0 {
+		return names[0]
+	}
+
+	return "unknown"
+}
+
+// transformMacro splits a value at the delimiters of the macro, reversing the
+// parts and keeping only the rightmost when asked, and joins them with
+// periods
+func transformMacro(value string, macro spfMacro) string {
+	delimiters := macro.delimiters
+	if delimiters == "" {
+		delimiters = "."
+	}
+
+	parts := strings.FieldsFunc(value, func(r rune) bool {
+		return strings.ContainsRune(delimiters, r)
+	})
+
+	if macro.reverse {
+		for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+			parts[i], parts[j] = parts[j], parts[i]
+		}
+	}
+
+	if macro.digits > 0 && macro.digits < len(parts) {
+		parts = parts[len(parts)-macro.digits:]
+	}
+
+	return strings.Join(parts, ".")
+}
+
+//-----------------------------------------------------------------------------
+// Names and Addresses
+//-----------------------------------------------------------------------------
+
+// isValidSPFDomain reports if domain is a name with at least two labels, none
+// of them empty or longer than 63 octets, see RFC 7208 section 4.3
+func isValidSPFDomain(domain string) bool {
+	if len(domain) == 0 || len(domain) > 253 {
+		return false
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// dottedIP writes an IPv4 address as usual and an IPv6 address as its 32
+// nibbles separated by periods, as the %{i} macro gives them
+func dottedIP(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String()
+	}
+
+	var nibbles []string
+
+	for _, b := range ip.To16() {
+		nibbles = append(nibbles, strconv.FormatUint(uint64(b>>4), 16), strconv.FormatUint(uint64(b&0x0f), 16))
+	}
+
+	return strings.Join(nibbles, ".")
+}
+
+// reverseName returns the name the PTR records of ip are found at
+func reverseName(ip net.IP) string {
+	parts := strings.Split(dottedIP(ip), ".")
+
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+
+	if ip.To4() != nil {
+		return strings.Join(parts, ".") + ".in-addr.arpa."
+	}
+
+	return strings.Join(parts, ".") + ".ip6.arpa."
+}
+
+// hasSuffixFold is strings.HasSuffix ignoring case
+func hasSuffixFold(s, suffix string) bool {
+	return len(s) >= len(suffix) && strings.EqualFold(s[len(s)-len(suffix):], suffix)
+}
@@ -0,0 +1,239 @@
+package mailauth
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+	"github.com/dansackett/dns-client/server"
+)
+
+// The zones the SPF checks are run against. Each name under example.com.
+// holds a policy exercising one part of the evaluation.
+var spfTestZones = map[string]string{
+	"example.com.": `
+@		SOA	ns hostmaster 1 3600 600 86400 300
+@		NS	ns
+ns		A	192.0.2.53
+@		MX	10 mail
+mail		A	192.0.2.25
+mail		AAAA	2001:db8::25
+www		A	192.0.2.80
+helo		A	192.0.2.25
+@		TXT	"v=spf1 mx -all"
+ip		TXT	"v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/32 -all"
+split		TXT	"v=spf1 ip4:192.0.2.0/24" " -all"
+a		TXT	"v=spf1 a:www.example.com/24 -all"
+helo		TXT	"v=spf1 a -all"
+inc		TXT	"v=spf1 include:example.net ~all"
+inc-none	TXT	"v=spf1 include:nothing.example.com -all"
+redir		TXT	"v=spf1 ip4:192.0.2.1 redirect=example.net"
+redir-none	TXT	"v=spf1 redirect=nothing.example.com"
+ptr		TXT	"v=spf1 ptr:example.com -all"
+exists		TXT	"v=spf1 exists:%{ir}.%{l}._spf.%{d} -all"
+1.2.0.192.user._spf.exists	A	127.0.0.2
+exp		TXT	"v=spf1 -all exp=explain.%{d}"
+explain.exp	TXT	"%{i} is not one of %{d}'s designated mail servers"
+two		TXT	"v=spf1 -all"
+two		TXT	"v=spf1 +all"
+limit		TXT	"v=spf1 a:www.example.com a:www.example.com a:www.example.com a:www.example.com a:www.example.com a:www.example.com a:www.example.com a:www.example.com a:www.example.com a:www.example.com a:www.example.com -all"
+void		TXT	"v=spf1 a:n1.example.com a:n2.example.com a:n3.example.com +all"
+syntax		TXT	"v=spf1 bogus:example.com -all"
+neutral		TXT	"v=spf1 ip4:203.0.113.1"
+`,
+	"example.net.": `
+@	SOA	ns.example.com. hostmaster 1 3600 600 86400 300
+@	NS	ns.example.com.
+@	TXT	"v=spf1 ip4:198.51.100.0/24 -all"
+`,
+	"2.0.192.in-addr.arpa.": `
+@	SOA	ns.example.com. hostmaster 1 3600 600 86400 300
+@	NS	ns.example.com.
+80	PTR	www.example.com.
+81	PTR	www.example.com.
+`,
+}
+
+// newSPFTestChecker returns an SPFChecker answering from spfTestZones. Lookups
+// of names under down.example.com. fail as if the server could not be reached.
+func newSPFTestChecker(t *testing.T) *SPFChecker {
+	t.Helper()
+
+	s := server.New("")
+
+	for origin, text := range spfTestZones {
+		rrs, err := dnsmsg.ParseZone(strings.NewReader("$TTL 300\n"+text), origin)
+		if err != nil {
+			t.Fatalf("zone %s: %v", origin, err)
+		}
+
+		z, err := server.NewZone(origin, rrs)
+		if err != nil {
+			t.Fatalf("zone %s: %v", origin, err)
+		}
+
+		s.AddZone(z)
+	}
+
+	return &SPFChecker{
+		Query: func(ctx context.Context, name string, typ dnsmsg.RecordType) (*dnsmsg.Message, error) {
+			if dnsmsg.IsSubDomain("down.example.com.", name) {
+				return nil, errors.New("timed out")
+			}
+
+			return s.Handle(dnsmsg.NewQuery(name, typ)), nil
+		},
+	}
+}
+
+func TestSPFCheck(t *testing.T) {
+	c := newSPFTestChecker(t)
+
+	tests := []struct {
+		ip     string
+		sender string
+		want   SPFResult
+	}{
+		{"192.0.2.25", "user@example.com", SPFPass},
+		{"2001:db8::25", "user@example.com", SPFPass},
+		{"192.0.2.26", "user@example.com", SPFFail},
+		{"192.0.2.26", "example.com", SPFFail},
+
+		{"192.0.2.200", "user@ip.example.com", SPFPass},
+		{"2001:db8:1::1", "user@ip.example.com", SPFPass},
+		{"198.51.100.1", "user@ip.example.com", SPFFail},
+		{"192.0.2.200", "user@split.example.com", SPFPass},
+		{"198.51.100.1", "user@split.example.com", SPFFail},
+
+		{"192.0.2.99", "user@a.example.com", SPFPass},
+		{"192.0.3.80", "user@a.example.com", SPFFail},
+
+		{"198.51.100.7", "user@inc.example.com", SPFPass},
+		{"203.0.113.1", "user@inc.example.com", SPFSoftFail},
+		{"203.0.113.1", "user@inc-none.example.com", SPFPermError},
+
+		{"192.0.2.1", "user@redir.example.com", SPFPass},
+		{"198.51.100.7", "user@redir.example.com", SPFPass},
+		{"203.0.113.1", "user@redir.example.com", SPFFail},
+		{"203.0.113.1", "user@redir-none.example.com", SPFPermError},
+
+		{"192.0.2.80", "user@ptr.example.com", SPFPass},
+		{"192.0.2.81", "user@ptr.example.com", SPFFail},
+		{"192.0.2.82", "user@ptr.example.com", SPFFail},
+
+		{"192.0.2.1", "user@exists.example.com", SPFPass},
+		{"192.0.2.1", "other@exists.example.com", SPFFail},
+
+		{"192.0.2.1", "user@neutral.example.com", SPFNeutral},
+		{"192.0.2.1", "user@www.example.com", SPFNone},
+		{"192.0.2.1", "user@nothing.example.com", SPFNone},
+		{"192.0.2.1", "user@two.example.com", SPFPermError},
+		{"192.0.2.1", "user@syntax.example.com", SPFPermError},
+		{"192.0.2.1", "user@down.example.com", SPFTempError},
+	}
+
+	for _, tt := range tests {
+		check := c.Check(context.Background(), net.ParseIP(tt.ip), tt.sender)
+
+		if check.Result != tt.want {
+			t.Errorf("%s from %s: result = %s, want %s\n%s", tt.sender, tt.ip, check.Result, tt.want, check)
+		}
+	}
+}
+
+func TestSPFCheckHELO(t *testing.T) {
+	c := newSPFTestChecker(t)
+	c.HELO = "helo.example.com"
+
+	if check := c.Check(context.Background(), net.ParseIP("192.0.2.25"), ""); check.Result != SPFPass {
+		t.Errorf("result = %s, want pass\n%s", check.Result, check)
+	}
+
+	if check := c.Check(context.Background(), net.ParseIP("192.0.2.26"), ""); check.Result != SPFFail {
+		t.Errorf("result = %s, want fail\n%s", check.Result, check)
+	}
+}
+
+func TestSPFCheckExplanation(t *testing.T) {
+	c := newSPFTestChecker(t)
+
+	check := c.Check(context.Background(), net.ParseIP("203.0.113.1"), "user@exp.example.com")
+
+	want := "203.0.113.1 is not one of exp.example.com's designated mail servers"
+	if check.Result != SPFFail || check.Explanation != want {
+		t.Errorf("result = %s with explanation %q, want fail with %q", check.Result, check.Explanation, want)
+	}
+}
+
+func TestSPFCheckLimits(t *testing.T) {
+	c := newSPFTestChecker(t)
+
+	check := c.Check(context.Background(), net.ParseIP("203.0.113.1"), "user@limit.example.com")
+	if check.Result != SPFPermError || check.Lookups != MaxSPFLookups+1 {
+		t.Errorf("result = %s after %d lookups, want permerror after %d\n%s", check.Result, check.Lookups, MaxSPFLookups+1, check)
+	}
+
+	check = c.Check(context.Background(), net.ParseIP("203.0.113.1"), "user@void.example.com")
+	if check.Result != SPFPermError || check.VoidLookups != MaxSPFVoidLookups+1 {
+		t.Errorf("result = %s after %d void lookups, want permerror after %d\n%s", check.Result, check.VoidLookups, MaxSPFVoidLookups+1, check)
+	}
+}
+
+func TestSPFMacroExpansion(t *testing.T) {
+	s := &spfSession{
+		c:      &SPFChecker{},
+		ip:     net.ParseIP("192.0.2.3"),
+		local:  "strong-bad",
+		domain: "email.example.com",
+		check:  new(SPFCheck),
+	}
+
+	// The examples of RFC 7208 section 7.4
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"%{s}", "strong-bad@email.example.com"},
+		{"%{o}", "email.example.com"},
+		{"%{d}", "email.example.com"},
+		{"%{d4}", "email.example.com"},
+		{"%{d3}", "email.example.com"},
+		{"%{d2}", "example.com"},
+		{"%{d1}", "com"},
+		{"%{dr}", "com.example.email"},
+		{"%{d2r}", "example.email"},
+		{"%{l}", "strong-bad"},
+		{"%{l-}", "strong.bad"},
+		{"%{lr}", "strong-bad"},
+		{"%{lr-}", "bad.strong"},
+		{"%{l1r-}", "strong"},
+		{"%{ir}.%{v}._spf.%{d2}", "3.2.0.192.in-addr._spf.example.com"},
+		{"%{lr-}.lp._spf.%{d2}", "bad.strong.lp._spf.example.com"},
+		{"%{lr-}.lp.%{ir}.%{v}._spf.%{d2}", "bad.strong.lp.3.2.0.192.in-addr._spf.example.com"},
+		{"%{ir}.%{v}.%{l1r-}.lp._spf.%{d2}", "3.2.0.192.in-addr.strong.lp._spf.example.com"},
+		{"%{d2}.trusted-domains.example.net", "example.com.trusted-domains.example.net"},
+		{"%{S}", "strong-bad%40email.example.com"},
+		{"a%%b%_c%-d", "a%b c%20d"},
+	}
+
+	for _, tt := range tests {
+		if got, err := s.expand(tt.spec, s.domain, false); err != nil || got != tt.want {
+			t.Errorf("expand(%q) = %q, %v, want %q", tt.spec, got, err, tt.want)
+		}
+	}
+
+	s.ip = net.ParseIP("2001:db8::cb01")
+
+	want := "1.0.b.c.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6._spf.example.com"
+	if got, err := s.expand("%{ir}.%{v}._spf.%{d2}", s.domain, false); err != nil || got != want {
+		t.Errorf("expand for IPv6 = %q, %v, want %q", got, err, want)
+	}
+
+	// The c, r and t macros are only allowed in explanations
+	if _, err := s.expand("%{c}", s.domain, false); err == nil {
+		t.Error("expand allowed %{c} outside an explanation")
+	}
+}
@@ -1,101 +1,171 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
-	"time"
+	"math"
+	"os"
+
+	"github.com/dansackett/dns-client/dnsclient"
+	"github.com/dansackett/dns-client/dnsmsg"
+	"github.com/dansackett/dns-client/resolver"
 )
 
 var domainFlagVal = flag.String("domain", "", "The domain to run DNS queries on. This is required.")
-var recordTypeFlagVal = flag.String("type", "A", "Record type to lookup. Defaults to \"A\"")
+var recordTypeFlagVal = flag.String("type", "A", "Record type to lookup, by name or as TYPE<n> for any numeric type. Defaults to \"A\"")
 var dnsServerAddrFlagVal = flag.String("server-addr", "8.8.8.8:53", "IP and Port for the DNS server to query. Defaults to \"8.8.8.8:53\".")
+var timeoutFlagVal = flag.Duration("timeout", dnsclient.DefaultTimeout, "How long to wait for a response before retrying.")
+var retriesFlagVal = flag.Int("retries", dnsclient.DefaultRetries, "Number of times to resend a UDP query which timed out.")
+var useTCPFlagVal = flag.Bool("tcp", false, "Send the query over TCP instead of UDP. Truncated UDP responses are always retried over TCP.")
+var ednsFlagVal = flag.Bool("edns", false, "Add an EDNS(0) OPT record to the query.")
+var bufSizeFlagVal = flag.Uint("bufsize", dnsmsg.DefaultEDNSUDPSize, "UDP payload size to advertise with EDNS. Implies -edns when set.")
+var dnssecFlagVal = flag.Bool("dnssec", false, "Set the DNSSEC OK bit to request DNSSEC records. Implies -edns.")
+var traceFlagVal = flag.Bool("trace", false, "Resolve the domain iteratively from the root servers, printing each delegation followed.")
+var rootServersFlagVal = flag.String("root-servers", "", "Comma separated IPs to start -trace from instead of the built-in root hints.")
+var tracePortFlagVal = flag.String("trace-port", resolver.DefaultPort, "Port every name server is queried on with -trace.")
+var serialFlagVal = flag.Uint("serial", 0, "Serial of the version of the zone already held, sent with -type IXFR.")
+var formatFlagVal = flag.String("format", "text", "Output format: \"text\" for a dig-esque summary or \"zone\" for the records in zone file format.")
+var keyFlagVal = flag.String("key", "", "TSIG key to sign the query with as name:algorithm:secret, with the secret in base64.")
+var keyFileFlagVal = flag.String("key-file", "", "File holding the TSIG key to sign the query with, either as name:algorithm:secret or a key statement.")
+var validateFlagVal = flag.Bool("validate", false, "Validate the DNSSEC signatures of the response by building the chain of trust from the trust anchor. Implies -dnssec.")
+var trustAnchorFlagVal = flag.String("trust-anchor", "", "Zone file of DS or DNSKEY records to trust with -validate instead of the root zone's keys.")
 
 func main() {
+	// Subcommands take their own flags so they are handled before parsing
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "update":
+			runUpdate(os.Args[2:])
+			return
+		case "sign":
+			runSign(os.Args[2:])
+			return
+		case "check":
+			runCheck(os.Args[2:])
+			return
+		case "spf-check":
+			runSPFCheck(os.Args[2:])
+			return
+		}
+	}
+
 	//-------------------------------------------------------------------------
 	// 1. Initialize client and parse flags
 	//-------------------------------------------------------------------------
-	client, err := InitClient()
+	flag.Parse()
+
+	client := dnsclient.New(*dnsServerAddrFlagVal)
+	client.Timeout = *timeoutFlagVal
+	client.Retries = *retriesFlagVal
+	client.ForceTCP = *useTCPFlagVal
+
+	key, err := loadTSIGKey(*keyFlagVal, *keyFileFlagVal)
 	if err != nil {
 		log.Fatalf("error: %v", err)
 	}
 
-	flag.Parse()
+	client.TSIG = key
 
 	// Validate flags
 	if *domainFlagVal == "" {
 		log.Fatalf("error: %v", "'domain' is required")
 	}
 
-	if _, ok := RecordTypeStrToRecordTypeMap[*recordTypeFlagVal]; !ok {
-		log.Fatalf("error: Type '%s' not implemented\n", *recordTypeFlagVal)
+	recordType, err := dnsmsg.ParseRecordType(*recordTypeFlagVal)
+	if err != nil {
+		log.Fatalf("error: %v", err)
 	}
 
-	//-------------------------------------------------------------------------
-	// 2. Create message for the DNS server
-	//-------------------------------------------------------------------------
-	var recursionDesired byte = 1
-
-	questions := []Question{
-		Question{
-			QNAME:  *domainFlagVal,
-			QTYPE:  RecordTypeStrToRecordTypeMap[*recordTypeFlagVal],
-			QCLASS: RecordClassIN,
-		},
+	if *formatFlagVal != "text" && *formatFlagVal != "zone" {
+		log.Fatalf("error: Unknown format '%s'", *formatFlagVal)
+	}
+
+	if *serialFlagVal > math.MaxUint32 {
+		log.Fatalf("error: 'serial' must be at most %d", uint32(math.MaxUint32))
+	}
+
+	if *bufSizeFlagVal > math.MaxUint16 {
+		log.Fatalf("error: 'bufsize' must be at most %d", math.MaxUint16)
+	}
+
+	// Signatures are needed to validate the response
+	if *validateFlagVal {
+		*dnssecFlagVal = true
+		*ednsFlagVal = true
 	}
 
-	header := Header{
-		ID:      GenerateRandID(),
-		QR:      QRTypeQuery,
-		OPCODE:  OpcodeQuery,
-		QDCOUNT: uint16(len(questions)),
-		RD:      recursionDesired,
+	// Setting either of these only makes sense with EDNS so we turn it on
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "bufsize" || f.Name == "dnssec" {
+			*ednsFlagVal = true
+		}
+	})
+
+	if *traceFlagVal {
+		runTrace(*domainFlagVal, recordType)
+		return
 	}
 
-	m := &Message{
-		Header:    header,
-		Questions: questions,
+	// Zone transfers stream many messages over TCP rather than a single
+	// response so they are handled on their own
+	switch recordType {
+	case dnsmsg.RecordTypeAXFR:
+		runTransfer(client, *domainFlagVal)
+		return
+	case dnsmsg.RecordTypeIXFR:
+		runIncrementalTransfer(client, *domainFlagVal, uint32(*serialFlagVal))
+		return
 	}
 
 	//-------------------------------------------------------------------------
-	// 3. Encode the message bytes and write them to the server
+	// 2. Create message for the DNS server
 	//-------------------------------------------------------------------------
-	msgBytes, err := m.Encode()
+	m := dnsmsg.NewQuery(*domainFlagVal, recordType)
 
-	if err != nil {
-		log.Fatalf("error: %v", err)
-	}
+	if *ednsFlagVal {
+		edns := dnsmsg.EDNS{UDPSize: uint16(*bufSizeFlagVal)}
 
-	startQueryTime := time.Now()
-	_, err = client.conn.Write(msgBytes)
+		if *dnssecFlagVal {
+			edns.Flags |= dnsmsg.EDNSFlagDO
+		}
 
-	if err != nil {
-		log.Fatalf("error: %v", err)
+		m.SetEDNS(edns)
 	}
 
 	//-------------------------------------------------------------------------
-	// 4. Listen for a response from the server and write it to a buffer
+	// 3. Send the message to the server and wait for a response to it.
+	//    Truncated UDP responses are retried over TCP.
 	//-------------------------------------------------------------------------
-	_, err = client.conn.Read(client.respBuf)
+	msg, info, err := client.ExchangeWithInfo(context.Background(), m)
 
 	if err != nil {
 		log.Fatalf("error: %v", err)
 	}
 
-	elapsedQueryTime := time.Since(startQueryTime)
-
 	//-------------------------------------------------------------------------
-	// 5. Decode the response into a Message object for parsing
+	// 4. Print the parsed response Message object into a dig-esque output or
+	//    as a zone file which can be loaded again
 	//-------------------------------------------------------------------------
-	msg := new(Message)
-	_, err = DecodeMessage(client.respBuf, msg, elapsedQueryTime)
-
-	if err != nil {
-		log.Fatalf("error: %v", err)
+	if *formatFlagVal == "zone" {
+		rrs := append(append(append([]dnsmsg.RR{}, msg.Answers...), msg.Authority...), msg.Additional...)
+
+		if err := dnsmsg.WriteZone(os.Stdout, "", rrs); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+	} else {
+		fmt.Println(dnsmsg.Format(msg, info))
+		printMailAuth(msg)
 	}
 
 	//-------------------------------------------------------------------------
-	// 6. Print the parsed response Message object into a dig-esque output
+	// 5. Validate the signatures of the response when asked to
 	//-------------------------------------------------------------------------
-	fmt.Println(msg)
+	if *validateFlagVal {
+		runValidate(client, msg)
+	}
 }
@@ -0,0 +1,401 @@
+// Package resolver resolves domain names iteratively, starting from the root
+// name servers and following referrals down to the authoritative servers for
+// the name in the same way a recursive resolver does.
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/dansackett/dns-client/dnsclient"
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+const (
+	// DefaultPort is the port name servers are queried on
+	DefaultPort = "53"
+
+	// The number of referrals followed for a single name before giving up
+	maxReferrals = 32
+
+	// The number of nested lookups, for CNAME targets and the addresses of
+	// name servers without glue, before giving up
+	maxDepth = 8
+)
+
+// These are the errors returned when resolution cannot make progress
+var (
+	ErrMaxReferrals = errors.New("Too many referrals followed while resolving")
+	ErrMaxDepth     = errors.New("Too many nested lookups while resolving")
+	ErrNoServers    = errors.New("No name servers could be reached")
+	ErrCNAMELoop    = errors.New("CNAME chain loops back on itself")
+)
+
+// Step is a single query made to a name server while resolving a name
+type Step struct {
+	// How many lookups deep this query is. Queries for the name being resolved
+	// are at 0 while those for CNAME targets or name server addresses are
+	// deeper.
+	Depth int
+
+	// The zone the server is expected to be authoritative for
+	Zone string
+
+	// The server which was queried
+	Server NameServer
+
+	// The question which was asked
+	Question dnsmsg.Question
+
+	// The response from the server. This is nil if Err is set.
+	Response *dnsmsg.Message
+
+	// The time taken for the server to respond
+	RTT time.Duration
+
+	// The error encountered while querying the server
+	Err error
+}
+
+func (s Step) String() string {
+	indent := strings.Repeat("  ", s.Depth)
+	typ := dnsmsg.RecordTypeString(s.Question.QTYPE)
+
+	step := fmt.Sprintf("%s> [ %s ] %s %s @ %s (%s)", indent, s.Zone, s.Question.QNAME, typ, s.Server.Name, s.Server.Addr)
+
+	if s.Err != nil {
+		return fmt.Sprintf("%s: error: %v", step, s.Err)
+	}
+
+	var outcome string
+
+	if s.Response.Header.RCODE != dnsmsg.ResponseCodeNoError {
+		outcome = fmt.Sprintf("status: %s", dnsmsg.ResponseCodeToStrMap[s.Response.Header.RCODE])
+	} else if len(s.Response.Answers) > 0 {
+		outcome = fmt.Sprintf("answered with %d records", len(s.Response.Answers))
+	} else if childZone, nsNames := FindReferral(s.Response, s.Zone, s.Question.QNAME); childZone != "" {
+		outcome = fmt.Sprintf("referred to %s via %s", childZone, strings.Join(nsNames, ", "))
+	} else {
+		outcome = "no records found"
+	}
+
+	return fmt.Sprintf("%s in %s: %s", step, s.RTT, outcome)
+}
+
+// Resolver resolves names by querying authoritative servers directly
+type Resolver struct {
+	// The servers resolution starts from. RootHints are used when empty.
+	Roots []NameServer
+
+	// The port each server is queried on. DefaultPort is used when empty.
+	Port string
+
+	// How long to wait for each server to respond
+	Timeout time.Duration
+
+	// The number of times a query is resent to a server which did not respond
+	Retries int
+
+	// Called for every query made while resolving when set
+	Trace func(Step)
+}
+
+// New creates a Resolver starting from the root hints
+func New() *Resolver {
+	return &Resolver{
+		Roots:   RootHints,
+		Port:    DefaultPort,
+		Timeout: dnsclient.DefaultTimeout,
+		Retries: dnsclient.DefaultRetries,
+	}
+}
+
+// Resolve finds the records of type typ held by name. The final response from
+// the authoritative server is returned, including a NAME ERROR or an empty
+// answer. When the name is an alias, the CNAME records leading to the answer
+// are placed ahead of it in the answer section.
+func (r *Resolver) Resolve(ctx context.Context, name string, typ dnsmsg.RecordType) (*dnsmsg.Message, error) {
+	return r.resolve(ctx, dnsmsg.Fqdn(name), typ, 0)
+}
+
+func (r *Resolver) resolve(ctx context.Context, name string, typ dnsmsg.RecordType, depth int) (*dnsmsg.Message, error) {
+	if depth > maxDepth {
+		return nil, ErrMaxDepth
+	}
+
+	zone := "."
+	servers := r.Roots
+	if len(servers) == 0 {
+		servers = RootHints
+	}
+
+	for i := 0; i < maxReferrals; i++ {
+		resp, err := r.queryServers(ctx, zone, servers, name, typ, depth)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Header.RCODE != dnsmsg.ResponseCodeNoError {
+			return resp, nil
+		}
+
+		if len(resp.Answers) > 0 {
+			return r.followCNAMEs(ctx, resp, name, typ, depth)
+		}
+
+		childZone, nsNames := FindReferral(resp, zone, name)
+
+		// Without an answer or a referral the name exists but has no records
+		// of the type asked for
+		if childZone == "" {
+			return resp, nil
+		}
+
+		zone = childZone
+		servers = serversForReferral(resp, nsNames)
+	}
+
+	return nil, ErrMaxReferrals
+}
+
+// queryServers asks each server in turn until one of them gives a usable
+// response. Servers without a known address are looked up first.
+func (r *Resolver) queryServers(ctx context.Context, zone string, servers []NameServer, name string, typ dnsmsg.RecordType, depth int) (*dnsmsg.Message, error) {
+	lastErr := ErrNoServers
+
+	for _, server := range servers {
+		addrs := []string{server.Addr}
+
+		if server.Addr == "" {
+			var err error
+
+			addrs, err = r.lookupAddrs(ctx, server.Name, depth+1)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+		}
+
+		for _, addr := range addrs {
+			resp, err := r.query(ctx, zone, NameServer{Name: server.Name, Addr: addr}, name, typ, depth)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+
+				lastErr = err
+				continue
+			}
+
+			switch resp.Header.RCODE {
+			case dnsmsg.ResponseCodeServerFailure, dnsmsg.ResponseCodeRefused, dnsmsg.ResponseCodeNotImplemented:
+				lastErr = fmt.Errorf("%s responded with %s", server.Name, dnsmsg.ResponseCodeToStrMap[resp.Header.RCODE])
+				continue
+			}
+
+			return resp, nil
+		}
+	}
+
+	return nil, lastErr
+}
+
+// query sends a single non-recursive query to a server
+func (r *Resolver) query(ctx context.Context, zone string, server NameServer, name string, typ dnsmsg.RecordType, depth int) (*dnsmsg.Message, error) {
+	port := r.Port
+	if port == "" {
+		port = DefaultPort
+	}
+
+	client := &dnsclient.Client{
+		Server:  net.JoinHostPort(server.Addr, port),
+		Timeout: r.Timeout,
+		Retries: r.Retries,
+	}
+
+	m := dnsmsg.NewQuery(name, typ)
+	m.Header.RD = 0
+
+	resp, rtt, err := client.Exchange(ctx, m)
+
+	if r.Trace != nil {
+		step := Step{
+			Depth:    depth,
+			Zone:     zone,
+			Server:   server,
+			Question: m.Questions[0],
+			RTT:      rtt,
+			Err:      err,
+		}
+
+		if err == nil {
+			step.Response = resp
+		}
+
+		r.Trace(step)
+	}
+
+	return resp, err
+}
+
+// lookupAddrs resolves the IPv4 addresses of a name server which was given in
+// a referral without glue
+func (r *Resolver) lookupAddrs(ctx context.Context, host string, depth int) ([]string, error) {
+	resp, err := r.resolve(ctx, host, dnsmsg.RecordTypeA, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+
+	for _, rr := range resp.Answers {
+		if a, ok := rr.RDATA.(*dnsmsg.RDataA); ok {
+			addrs = append(addrs, a.IP().String())
+		}
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("No addresses found for name server %s", host)
+	}
+
+	return addrs, nil
+}
+
+// followCNAMEs walks the CNAME records in an answer starting at name. When the
+// chain ends at a target the server did not answer for, the target is
+// resolved from the root and its answer is added after the chain.
+func (r *Resolver) followCNAMEs(ctx context.Context, resp *dnsmsg.Message, name string, typ dnsmsg.RecordType, depth int) (*dnsmsg.Message, error) {
+	if typ == dnsmsg.RecordTypeCNAME || typ == dnsmsg.RecordTypeWildcard {
+		return resp, nil
+	}
+
+	target := name
+	seen := map[string]bool{strings.ToLower(target): true}
+
+	for !hasRecords(resp.Answers, target, typ) {
+		cname := findCNAME(resp.Answers, target)
+		if cname == "" {
+			break
+		}
+
+		if seen[strings.ToLower(cname)] {
+			return nil, ErrCNAMELoop
+		}
+
+		seen[strings.ToLower(cname)] = true
+		target = cname
+	}
+
+	if target == name || hasRecords(resp.Answers, target, typ) {
+		return resp, nil
+	}
+
+	next, err := r.resolve(ctx, target, typ, depth+1)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := *next
+	merged.Questions = resp.Questions
+	merged.Answers = append(append([]dnsmsg.RR{}, resp.Answers...), next.Answers...)
+
+	return &merged, nil
+}
+
+// FindReferral looks for NS records in the authority section of a response
+// delegating a zone below the one queried which holds name. The delegated zone
+// and the names of its servers are returned, or an empty zone if the response
+// is not a referral.
+func FindReferral(resp *dnsmsg.Message, zone, name string) (string, []string) {
+	var childZone string
+	var nsNames []string
+
+	for _, rr := range resp.Authority {
+		ns, ok := rr.RDATA.(*dnsmsg.RDataNS)
+		if !ok {
+			continue
+		}
+
+		owner := strings.ToLower(dnsmsg.Fqdn(rr.NAME))
+
+		// A referral must bring us closer to the name or we would loop
+		if !dnsmsg.IsSubDomain(owner, name) || !dnsmsg.IsSubDomain(zone, owner) {
+			continue
+		}
+
+		if dnsmsg.CountLabels(owner) <= dnsmsg.CountLabels(zone) {
+			continue
+		}
+
+		if childZone == "" {
+			childZone = owner
+		}
+
+		if owner == childZone {
+			nsNames = append(nsNames, ns.Domain())
+		}
+	}
+
+	return childZone, nsNames
+}
+
+// serversForReferral pairs each name server with the glue addresses given in
+// the additional section. Servers without glue are listed last without an
+// address so they are only looked up when needed.
+func serversForReferral(resp *dnsmsg.Message, nsNames []string) []NameServer {
+	var glued, glueless []NameServer
+
+	for _, nsName := range nsNames {
+		found := false
+
+		for _, rr := range resp.Additional {
+			if !strings.EqualFold(dnsmsg.Fqdn(rr.NAME), dnsmsg.Fqdn(nsName)) {
+				continue
+			}
+
+			switch rData := rr.RDATA.(type) {
+			case *dnsmsg.RDataA:
+				glued = append(glued, NameServer{Name: nsName, Addr: rData.IP().String()})
+				found = true
+			case *dnsmsg.RDataAAAA:
+				glued = append(glued, NameServer{Name: nsName, Addr: rData.IP().String()})
+				found = true
+			}
+		}
+
+		if !found {
+			glueless = append(glueless, NameServer{Name: nsName})
+		}
+	}
+
+	return append(glued, glueless...)
+}
+
+// hasRecords checks if there are records of type typ owned by name
+func hasRecords(rrs []dnsmsg.RR, name string, typ dnsmsg.RecordType) bool {
+	for _, rr := range rrs {
+		if rr.TYPE == typ && strings.EqualFold(dnsmsg.Fqdn(rr.NAME), dnsmsg.Fqdn(name)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findCNAME returns the target of the CNAME record owned by name if there is
+// one
+func findCNAME(rrs []dnsmsg.RR, name string) string {
+	for _, rr := range rrs {
+		cname, ok := rr.RDATA.(*dnsmsg.RDataCNAME)
+
+		if ok && strings.EqualFold(dnsmsg.Fqdn(rr.NAME), dnsmsg.Fqdn(name)) {
+			return cname.Domain()
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,368 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// testRecord is a record served by a stand-in. The data is an IPv4 address
+// for A records and a domain name for the others.
+type testRecord struct {
+	name string
+	typ  dnsmsg.RecordType
+	data string
+}
+
+// The stand-in servers for a small tree of zones. The root delegates test. and
+// example. to the second server, which delegates hosting.example. with glue
+// and zone.test. to a name server in hosting.example. without glue. The third
+// server is authoritative for both of those.
+var testZones = []struct {
+	host  string
+	zones map[string][]testRecord
+}{
+	{"127.0.0.1", map[string][]testRecord{
+		".": {
+			{".", dnsmsg.RecordTypeSOA, "a.root."},
+			{".", dnsmsg.RecordTypeNS, "a.root."},
+			{"a.root.", dnsmsg.RecordTypeA, "127.0.0.1"},
+			{"test.", dnsmsg.RecordTypeNS, "ns.nic.test."},
+			{"ns.nic.test.", dnsmsg.RecordTypeA, "127.0.0.2"},
+			{"example.", dnsmsg.RecordTypeNS, "ns.nic.test."},
+		},
+	}},
+	{"127.0.0.2", map[string][]testRecord{
+		"test.": {
+			{"test.", dnsmsg.RecordTypeSOA, "ns.nic.test."},
+			{"test.", dnsmsg.RecordTypeNS, "ns.nic.test."},
+			{"ns.nic.test.", dnsmsg.RecordTypeA, "127.0.0.2"},
+			{"zone.test.", dnsmsg.RecordTypeNS, "ns1.hosting.example."},
+		},
+		"example.": {
+			{"example.", dnsmsg.RecordTypeSOA, "ns.nic.test."},
+			{"example.", dnsmsg.RecordTypeNS, "ns.nic.test."},
+			{"hosting.example.", dnsmsg.RecordTypeNS, "ns.hosting.example."},
+			{"ns.hosting.example.", dnsmsg.RecordTypeA, "127.0.0.3"},
+		},
+	}},
+	{"127.0.0.3", map[string][]testRecord{
+		"hosting.example.": {
+			{"hosting.example.", dnsmsg.RecordTypeSOA, "ns.hosting.example."},
+			{"hosting.example.", dnsmsg.RecordTypeNS, "ns.hosting.example."},
+			{"ns.hosting.example.", dnsmsg.RecordTypeA, "127.0.0.3"},
+			{"ns1.hosting.example.", dnsmsg.RecordTypeA, "127.0.0.3"},
+			{"web.hosting.example.", dnsmsg.RecordTypeA, "192.0.2.80"},
+		},
+		"zone.test.": {
+			{"zone.test.", dnsmsg.RecordTypeSOA, "ns1.hosting.example."},
+			{"zone.test.", dnsmsg.RecordTypeNS, "ns1.hosting.example."},
+			{"www.zone.test.", dnsmsg.RecordTypeCNAME, "web.hosting.example."},
+			{"loop1.zone.test.", dnsmsg.RecordTypeCNAME, "loop2.zone.test."},
+			{"loop2.zone.test.", dnsmsg.RecordTypeCNAME, "loop1.zone.test."},
+		},
+	}},
+}
+
+// wireName encodes a domain name as the length prefixed labels used on the
+// wire
+func wireName(name string) []byte {
+	var data []byte
+
+	for _, label := range strings.Split(strings.Trim(name, "."), ".") {
+		if label != "" {
+			data = append(append(data, byte(len(label))), label...)
+		}
+	}
+
+	return append(data, 0)
+}
+
+// rr builds the record served for r
+func (r testRecord) rr(t *testing.T) dnsmsg.RR {
+	t.Helper()
+
+	var rdata dnsmsg.ResourceDataField
+	var err error
+
+	switch r.typ {
+	case dnsmsg.RecordTypeA:
+		rdata, err = dnsmsg.NewRDataA(net.ParseIP(r.data).To4())
+	case dnsmsg.RecordTypeNS:
+		rdata, err = dnsmsg.NewRDataNS(wireName(r.data), 0)
+	case dnsmsg.RecordTypeCNAME:
+		rdata, err = dnsmsg.NewRDataCNAME(wireName(r.data), 0)
+	case dnsmsg.RecordTypeSOA:
+		data := append(wireName(r.data), wireName("hostmaster."+r.name)...)
+		rdata, err = dnsmsg.NewRDataSOA(append(data, make([]byte, 20)...), 0)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dnsmsg.RR{NAME: r.name, TYPE: r.typ, CLASS: dnsmsg.RecordClassIN, TTL: 300, RDATA: rdata}
+}
+
+// standIn answers queries for its zones the way an authoritative server does,
+// with referrals at zone cuts
+type standIn struct {
+	conn  net.PacketConn
+	zones map[string][]dnsmsg.RR
+}
+
+func (s *standIn) serve() {
+	buf := make([]byte, 512)
+
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		query := new(dnsmsg.Message)
+		if _, err := dnsmsg.DecodeMessage(buf[:n], query); err != nil || len(query.Questions) != 1 {
+			continue
+		}
+
+		if data, err := s.answer(query).Encode(); err == nil {
+			s.conn.WriteTo(data, addr)
+		}
+	}
+}
+
+func (s *standIn) answer(query *dnsmsg.Message) *dnsmsg.Message {
+	q := query.Questions[0]
+
+	resp := &dnsmsg.Message{Header: query.Header, Questions: query.Questions}
+	resp.Header.QR = dnsmsg.QRTypeResponse
+
+	origin := ""
+	for o := range s.zones {
+		if dnsmsg.IsSubDomain(o, q.QNAME) && dnsmsg.CountLabels(o) >= dnsmsg.CountLabels(origin) {
+			origin = o
+		}
+	}
+
+	if origin == "" {
+		resp.Header.RCODE = dnsmsg.ResponseCodeRefused
+		return resp
+	}
+
+	zone := s.zones[origin]
+
+	var owned []dnsmsg.RR
+
+	for _, rr := range zone {
+		// NS records below the origin are a zone cut
+		if rr.TYPE == dnsmsg.RecordTypeNS && rr.NAME != origin && dnsmsg.IsSubDomain(rr.NAME, q.QNAME) {
+			resp.Authority = append(resp.Authority, rr)
+
+			for _, glue := range zone {
+				if glue.TYPE == dnsmsg.RecordTypeA && strings.EqualFold(glue.NAME, rr.RDATA.(*dnsmsg.RDataNS).Domain()) {
+					resp.Additional = append(resp.Additional, glue)
+				}
+			}
+		}
+
+		if strings.EqualFold(rr.NAME, q.QNAME) {
+			owned = append(owned, rr)
+		}
+	}
+
+	if len(resp.Authority) > 0 {
+		return resp
+	}
+
+	resp.Header.AA = 1
+
+	// CNAME chains are followed as far as they stay in the zone
+	for i := 0; i < len(zone); i++ {
+		target := ""
+
+		for _, rr := range owned {
+			if rr.TYPE == q.QTYPE || rr.TYPE == dnsmsg.RecordTypeCNAME {
+				resp.Answers = append(resp.Answers, rr)
+			}
+
+			if cname, ok := rr.RDATA.(*dnsmsg.RDataCNAME); ok {
+				target = cname.Domain()
+			}
+		}
+
+		if target == "" || !dnsmsg.IsSubDomain(origin, target) {
+			break
+		}
+
+		owned = nil
+
+		for _, rr := range zone {
+			if strings.EqualFold(rr.NAME, target) {
+				owned = append(owned, rr)
+			}
+		}
+	}
+
+	if len(resp.Answers) == 0 {
+		if len(owned) == 0 {
+			resp.Header.RCODE = dnsmsg.ResponseCodeNameError
+		}
+
+		resp.Authority = append(resp.Authority, zone[0])
+	}
+
+	return resp
+}
+
+// serveTestZones starts the stand-in servers on a shared port and returns a
+// Resolver starting from the first of them
+func serveTestZones(t *testing.T) (*Resolver, func()) {
+	t.Helper()
+
+	var conns []net.PacketConn
+
+	closeAll := func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+
+	port := "0"
+
+	for _, zones := range testZones {
+		conn, err := net.ListenPacket("udp", net.JoinHostPort(zones.host, port))
+		if err != nil {
+			closeAll()
+			t.Skipf("cannot listen on %s: %v", zones.host, err)
+		}
+
+		_, port, _ = net.SplitHostPort(conn.LocalAddr().String())
+		conns = append(conns, conn)
+
+		s := &standIn{conn: conn, zones: make(map[string][]dnsmsg.RR)}
+
+		for origin, records := range zones.zones {
+			for _, r := range records {
+				s.zones[origin] = append(s.zones[origin], r.rr(t))
+			}
+		}
+
+		go s.serve()
+	}
+
+	r := New()
+	r.Roots = []NameServer{{Name: "a.root.", Addr: testZones[0].host}}
+	r.Port = port
+	r.Timeout = time.Second
+	r.Retries = 0
+
+	return r, closeAll
+}
+
+func TestResolve(t *testing.T) {
+	r, closeAll := serveTestZones(t)
+	defer closeAll()
+
+	var steps []Step
+	r.Trace = func(s Step) { steps = append(steps, s) }
+
+	resp, err := r.Resolve(context.Background(), "www.zone.test", dnsmsg.RecordTypeA)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	var answers []string
+	for _, rr := range resp.Answers {
+		answers = append(answers, rr.NAME+" "+dnsmsg.RecordTypeToStrMap[rr.TYPE]+" "+rr.RDATA.String())
+	}
+
+	want := []string{
+		"www.zone.test. CNAME web.hosting.example.",
+		"web.hosting.example. A 192.0.2.80",
+	}
+
+	if strings.Join(answers, "\n") != strings.Join(want, "\n") {
+		t.Errorf("answers =\n%s\nwant\n%s", strings.Join(answers, "\n"), strings.Join(want, "\n"))
+	}
+
+	// The name server for zone.test. has no glue so its address is looked up
+	// one level deeper before zone.test. is asked
+	var trail []string
+	for _, s := range steps {
+		if s.Err != nil {
+			t.Errorf("step %s failed", s)
+		}
+
+		trail = append(trail, strings.Repeat(" ", s.Depth)+s.Zone+" "+s.Question.QNAME)
+	}
+
+	wantTrail := []string{
+		". www.zone.test.",
+		"test. www.zone.test.",
+		" . ns1.hosting.example.",
+		" example. ns1.hosting.example.",
+		" hosting.example. ns1.hosting.example.",
+		"zone.test. www.zone.test.",
+		" . web.hosting.example.",
+		" example. web.hosting.example.",
+		" hosting.example. web.hosting.example.",
+	}
+
+	if got := strings.Join(trail, "\n"); got != strings.Join(wantTrail, "\n") {
+		t.Errorf("trail =\n%s\nwant\n%s", got, strings.Join(wantTrail, "\n"))
+	}
+}
+
+func TestResolveNegative(t *testing.T) {
+	r, closeAll := serveTestZones(t)
+	defer closeAll()
+
+	tests := []struct {
+		name  string
+		typ   dnsmsg.RecordType
+		rcode dnsmsg.ResponseCode
+	}{
+		{"nothing.zone.test.", dnsmsg.RecordTypeA, dnsmsg.ResponseCodeNameError},
+		{"nothing.example.", dnsmsg.RecordTypeA, dnsmsg.ResponseCodeNameError},
+		{"web.hosting.example.", dnsmsg.RecordTypeMX, dnsmsg.ResponseCodeNoError},
+	}
+
+	for _, tt := range tests {
+		resp, err := r.Resolve(context.Background(), tt.name, tt.typ)
+		if err != nil {
+			t.Errorf("%s: Resolve: %v", tt.name, err)
+			continue
+		}
+
+		if resp.Header.RCODE != tt.rcode || len(resp.Answers) != 0 {
+			t.Errorf("%s: got %s with %d answers, want %s with none", tt.name,
+				dnsmsg.ResponseCodeToStrMap[resp.Header.RCODE], len(resp.Answers), dnsmsg.ResponseCodeToStrMap[tt.rcode])
+		}
+	}
+}
+
+func TestResolveCNAMELoop(t *testing.T) {
+	r, closeAll := serveTestZones(t)
+	defer closeAll()
+
+	if _, err := r.Resolve(context.Background(), "loop1.zone.test.", dnsmsg.RecordTypeA); err != ErrCNAMELoop {
+		t.Errorf("error = %v, want %v", err, ErrCNAMELoop)
+	}
+}
+
+func TestResolveUnreachable(t *testing.T) {
+	r, closeAll := serveTestZones(t)
+	defer closeAll()
+
+	// Nothing listens on the port at this address
+	r.Roots = []NameServer{{Name: "a.root.", Addr: "127.0.0.4"}}
+	r.Timeout = 100 * time.Millisecond
+
+	if _, err := r.Resolve(context.Background(), "www.zone.test.", dnsmsg.RecordTypeA); err == nil {
+		t.Error("Resolve succeeded without a reachable root")
+	}
+}
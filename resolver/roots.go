@@ -0,0 +1,29 @@
+package resolver
+
+// NameServer is a name server which can be queried along with the address it
+// can be reached at
+type NameServer struct {
+	// The domain name of the server such as "a.root-servers.net."
+	Name string
+
+	// The IP address of the server without a port
+	Addr string
+}
+
+// RootHints are the root name servers resolution starts from. See
+// https://www.iana.org/domains/root/servers
+var RootHints = []NameServer{
+	{Name: "a.root-servers.net.", Addr: "198.41.0.4"},
+	{Name: "b.root-servers.net.", Addr: "170.247.170.2"},
+	{Name: "c.root-servers.net.", Addr: "192.33.4.12"},
+	{Name: "d.root-servers.net.", Addr: "199.7.91.13"},
+	{Name: "e.root-servers.net.", Addr: "192.203.230.10"},
+	{Name: "f.root-servers.net.", Addr: "192.5.5.241"},
+	{Name: "g.root-servers.net.", Addr: "192.112.36.4"},
+	{Name: "h.root-servers.net.", Addr: "198.97.190.53"},
+	{Name: "i.root-servers.net.", Addr: "192.36.148.17"},
+	{Name: "j.root-servers.net.", Addr: "192.58.128.30"},
+	{Name: "k.root-servers.net.", Addr: "193.0.14.129"},
+	{Name: "l.root-servers.net.", Addr: "199.7.83.42"},
+	{Name: "m.root-servers.net.", Addr: "202.12.27.33"},
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+	"github.com/dansackett/dns-client/server"
+)
+
+// repeatedFlag collects every value given to a flag which can be repeated
+type repeatedFlag []string
+
+func (r *repeatedFlag) String() string {
+	return strings.Join(*r, ",")
+}
+
+func (r *repeatedFlag) Set(value string) error {
+	*r = append(*r, value)
+	return nil
+}
+
+// runServe answers queries authoritatively for the zones given on the command
+// line until the process is stopped. The zone files are loaded again when the
+// process receives SIGHUP and the secondaries are notified of any zone with a
+// new serial.
+func runServe(args []string) {
+	var zones, secondaries, keys, keyFiles repeatedFlag
+
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listenAddr := fs.String("listen", ":53", "IP and Port to listen on for both UDP and TCP.")
+	fs.Var(&zones, "zone", "Zone file to serve, optionally prefixed by its origin as 'origin=path'. Can be repeated.")
+	fs.Var(&secondaries, "notify", "IP and Port of a secondary to send a NOTIFY when a zone is reloaded with a new serial. Can be repeated.")
+	fs.Var(&keys, "key", "TSIG key signed queries may use as name:algorithm:secret. Zone transfers must be signed once a key is given. Can be repeated.")
+	fs.Var(&keyFiles, "key-file", "File holding a TSIG key signed queries may use. Can be repeated.")
+	fs.Parse(args)
+
+	if len(zones) == 0 {
+		log.Fatalf("error: %v", "at least one 'zone' is required")
+	}
+
+	srv := server.New(*listenAddr)
+
+	for _, k := range keys {
+		key, err := dnsmsg.ParseTSIGKey(k)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+
+		srv.Keys = append(srv.Keys, key)
+	}
+
+	for _, path := range keyFiles {
+		key, err := dnsmsg.LoadTSIGKeyFile(path)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+
+		srv.Keys = append(srv.Keys, key)
+	}
+	srv.Secondaries = secondaries
+	srv.ErrorLog = log.New(os.Stderr, "", log.LstdFlags)
+
+	if err := loadZones(srv, zones); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			if err := loadZones(srv, zones); err != nil {
+				log.Printf("error: Failed to reload zones: %v", err)
+			}
+		}
+	}()
+
+	log.Printf("Listening on %s (udp, tcp)", *listenAddr)
+
+	if err := srv.ListenAndServe(); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+}
+
+// loadZones reads each zone file given with -zone and starts serving it in
+// place of any earlier version
+func loadZones(srv *server.Server, zones []string) error {
+	for _, zoneFlag := range zones {
+		origin, path := "", zoneFlag
+
+		if idx := strings.Index(zoneFlag, "="); idx >= 0 {
+			origin, path = zoneFlag[:idx], zoneFlag[idx+1:]
+		}
+
+		zone, err := server.LoadZoneFile(path, origin)
+		if err != nil {
+			return err
+		}
+
+		srv.AddZone(zone)
+		log.Printf("Loaded zone %s with %d records at serial %d from %s", zone.Origin, len(zone.Records()), zone.Serial(), path)
+	}
+
+	return nil
+}
@@ -0,0 +1,322 @@
+package server
+
+import "github.com/dansackett/dns-client/dnsmsg"
+
+// The number of CNAME records followed within a zone when building an answer
+const maxCNAMEChain = 8
+
+// Handle builds the response to a query from the zones held by the server. A
+// nil response is returned for messages which should not be answered at all.
+//
+// Zone transfers need more than one message so they are answered by Transfer
+// over TCP. Over UDP, AXFR is not implemented while IXFR is answered with the
+// SOA record of the zone so the client retries over TCP, see RFC 1995 section
+// 2.
+func (s *Server) Handle(query *dnsmsg.Message) *dnsmsg.Message {
+	resp, zone := s.prepare(query)
+	if zone == nil {
+		return resp
+	}
+
+	q := query.Questions[0]
+
+	switch q.QTYPE {
+	case dnsmsg.RecordTypeAXFR:
+		setResponseCode(resp, dnsmsg.ResponseCodeNotImplemented)
+	case dnsmsg.RecordTypeIXFR:
+		if !zone.isOrigin(q.QNAME) {
+			setResponseCode(resp, dnsmsg.ResponseCodeRefused)
+			break
+		}
+
+		resp.Header.AA = 1
+		resp.Answers = []dnsmsg.RR{zone.SOA()}
+	default:
+		zone.answer(resp, q)
+	}
+
+	return resp
+}
+
+// prepare checks a query can be answered and builds the start of the response
+// to it. The zone holding the question is returned along with the response
+// when the server is able to answer it, otherwise the response holds the
+// error to return. A nil response is returned for messages which should not
+// be answered at all.
+func (s *Server) prepare(query *dnsmsg.Message) (*dnsmsg.Message, *Zone) {
+	// Responding to a response could start a loop between two servers
+	if query.Header.QR != dnsmsg.QRTypeQuery {
+		return nil, nil
+	}
+
+	resp := &dnsmsg.Message{
+		Header: dnsmsg.Header{
+			ID:     query.Header.ID,
+			QR:     dnsmsg.QRTypeResponse,
+			OPCODE: query.Header.OPCODE,
+			RD:     query.Header.RD,
+		},
+		Questions: query.Questions,
+	}
+
+	if e := query.EDNS(); e != nil {
+		if e.Version != 0 {
+			setResponseCode(resp, dnsmsg.ResponseCodeBadVersion)
+			return resp, nil
+		}
+
+		resp.SetEDNS(dnsmsg.EDNS{UDPSize: dnsmsg.DefaultEDNSUDPSize, Flags: e.Flags & dnsmsg.EDNSFlagDO})
+	}
+
+	if query.Header.OPCODE != dnsmsg.OpcodeQuery {
+		setResponseCode(resp, dnsmsg.ResponseCodeNotImplemented)
+		return resp, nil
+	}
+
+	if len(query.Questions) != 1 {
+		setResponseCode(resp, dnsmsg.ResponseCodeFormatError)
+		return resp, nil
+	}
+
+	q := query.Questions[0]
+
+	zone := s.findZone(q.QNAME)
+
+	// DS records are held on the parent side of a zone cut so the parent
+	// zone answers for them when the server holds both, see RFC 4035 section
+	// 3.1.4.1
+	if q.QTYPE == dnsmsg.RecordTypeDS && zone != nil && zone.isOrigin(q.QNAME) && zone.Origin != "." {
+		if parent := s.findZone(dnsmsg.ParentName(zone.Origin)); parent != nil {
+			zone = parent
+		}
+	}
+
+	if zone == nil || (q.QCLASS != dnsmsg.RecordClassIN && q.QCLASS != dnsmsg.RecordClassWildcard) {
+		setResponseCode(resp, dnsmsg.ResponseCodeRefused)
+		return resp, nil
+	}
+
+	return resp, zone
+}
+
+// setResponseCode sets the response code on a message, placing the upper bits
+// in the OPT record when one is needed
+func setResponseCode(m *dnsmsg.Message, rcode dnsmsg.ResponseCode) {
+	m.Header.RCODE = rcode & 0x0F
+
+	if rcode > 0x0F {
+		e := m.EDNS()
+		if e == nil {
+			e = &dnsmsg.EDNS{UDPSize: dnsmsg.DefaultEDNSUDPSize}
+		}
+
+		e.ExtendedRCODE = uint8(rcode >> 4)
+		m.SetEDNS(*e)
+	}
+}
+
+// answer fills in the response to a question for a name within the zone
+// following the algorithm in RFC 1034 section 4.3.2. When the query set the
+// DO bit the RRSIG records covering each RRset are included, see RFC 4035
+// section 3.1.
+func (z *Zone) answer(resp *dnsmsg.Message, q dnsmsg.Question) {
+	name := canonicalName(q.QNAME)
+	dnssec := resp.EDNS() != nil && resp.EDNS().DO()
+
+	// When part of the name has been delegated another server holds the
+	// answer so we refer the client to it. The DS records at the cut belong
+	// to this zone though.
+	if cut := z.findDelegation(name); cut != "" && (cut != name || q.QTYPE != dnsmsg.RecordTypeDS) {
+		ns := filterType(z.records[cut], dnsmsg.RecordTypeNS)
+
+		resp.Authority = append(resp.Authority, ns...)
+
+		if ds := filterType(z.records[cut], dnsmsg.RecordTypeDS); dnssec && len(ds) > 0 {
+			resp.Authority = append(resp.Authority, ds...)
+			resp.Authority = append(resp.Authority, signaturesFor(z.records[cut], dnsmsg.RecordTypeDS)...)
+		} else if dnssec {
+			// An unsigned delegation has to be proven to have no DS records
+			resp.Authority = append(resp.Authority, z.denyType(cut)...)
+		}
+
+		resp.Additional = append(resp.Additional, z.additionalFor(ns)...)
+		return
+	}
+
+	resp.Header.AA = 1
+
+	for i := 0; i < maxCNAMEChain; i++ {
+		rrs, exists := z.lookupWithWildcard(name)
+
+		if !exists {
+			setResponseCode(resp, dnsmsg.ResponseCodeNameError)
+			z.addNegativeSOA(resp, dnssec)
+
+			if dnssec {
+				resp.Authority = append(resp.Authority, z.denyName(name)...)
+			}
+
+			return
+		}
+
+		// An answer expanded from a wildcard is only valid when the name
+		// does not exist on its own
+		expanded := dnssec && !z.names[name]
+
+		matching := rrs
+		if q.QTYPE != dnsmsg.RecordTypeWildcard {
+			matching = filterType(rrs, q.QTYPE)
+		}
+
+		if len(matching) > 0 {
+			resp.Answers = append(resp.Answers, matching...)
+
+			if dnssec && q.QTYPE != dnsmsg.RecordTypeWildcard && q.QTYPE != dnsmsg.RecordTypeRRSIG {
+				resp.Answers = append(resp.Answers, signaturesFor(rrs, q.QTYPE)...)
+			}
+
+			if expanded {
+				resp.Authority = append(resp.Authority, z.denyExpanded(name)...)
+			}
+
+			resp.Additional = append(resp.Additional, z.additionalFor(matching)...)
+			return
+		}
+
+		cnames := filterType(rrs, dnsmsg.RecordTypeCNAME)
+
+		// The name exists but has no records of the type asked for
+		if len(cnames) == 0 {
+			z.addNegativeSOA(resp, dnssec)
+
+			if dnssec {
+				resp.Authority = append(resp.Authority, z.denyType(name)...)
+			}
+
+			return
+		}
+
+		resp.Answers = append(resp.Answers, cnames[0])
+
+		if dnssec {
+			resp.Answers = append(resp.Answers, signaturesFor(rrs, dnsmsg.RecordTypeCNAME)...)
+		}
+
+		if expanded {
+			resp.Authority = append(resp.Authority, z.denyExpanded(name)...)
+		}
+
+		// The client has to chase targets outside of the zone on its own
+		name = canonicalName(cnames[0].RDATA.(*dnsmsg.RDataCNAME).Domain())
+		if !dnsmsg.IsSubDomain(z.Origin, name) || z.findDelegation(name) != "" {
+			return
+		}
+	}
+}
+
+// findDelegation returns the name of the closest zone cut between the origin
+// and name, or an empty string if the zone is authoritative for name
+func (z *Zone) findDelegation(name string) string {
+	for _, ancestor := range ancestors(z.Origin, name)[1:] {
+		if len(filterType(z.records[ancestor], dnsmsg.RecordTypeNS)) > 0 {
+			return ancestor
+		}
+	}
+
+	return ""
+}
+
+// lookupWithWildcard returns the records owned by name and whether the name
+// exists. A name which does not exist may be covered by a wildcard at its
+// closest encloser, in which case records are synthesized from it. See
+// RFC 4592
+func (z *Zone) lookupWithWildcard(name string) ([]dnsmsg.RR, bool) {
+	if z.names[name] {
+		return z.records[name], true
+	}
+
+	names := ancestors(z.Origin, name)
+
+	for i := len(names) - 1; i >= 0; i-- {
+		if !z.names[names[i]] {
+			continue
+		}
+
+		wildcard, ok := z.records[wildcardOf(names[i])]
+		if !ok {
+			return nil, false
+		}
+
+		synthesized := make([]dnsmsg.RR, len(wildcard))
+		for j, rr := range wildcard {
+			synthesized[j] = rr
+			synthesized[j].NAME = name
+		}
+
+		return synthesized, true
+	}
+
+	return nil, false
+}
+
+// negativeSOA returns the SOA record placed in the authority section of
+// negative answers. Its TTL is capped by the minimum field so resolvers cache
+// the negative answer for the right amount of time. See RFC 2308 section 3
+func (z *Zone) negativeSOA() dnsmsg.RR {
+	soa := z.SOA()
+
+	if minimum := soa.RDATA.(*dnsmsg.RDataSOA).Minimum(); minimum < soa.TTL {
+		soa.TTL = minimum
+	}
+
+	return soa
+}
+
+// addNegativeSOA adds the SOA record of a negative answer to the authority
+// section along with its signatures when they are wanted
+func (z *Zone) addNegativeSOA(resp *dnsmsg.Message, dnssec bool) {
+	resp.Authority = append(resp.Authority, z.negativeSOA())
+
+	if dnssec {
+		resp.Authority = append(resp.Authority, signaturesFor(z.records[z.Origin], dnsmsg.RecordTypeSOA)...)
+	}
+}
+
+// additionalFor returns the addresses held in the zone for the name servers,
+// mail exchanges and service targets referenced by rrs so clients do not need
+// to look them up
+func (z *Zone) additionalFor(rrs []dnsmsg.RR) []dnsmsg.RR {
+	var additional []dnsmsg.RR
+
+	seen := make(map[string]bool)
+
+	for _, rr := range rrs {
+		var target string
+
+		switch rData := rr.RDATA.(type) {
+		case *dnsmsg.RDataNS:
+			target = rData.Domain()
+		case *dnsmsg.RDataMX:
+			target = rData.Exchange()
+		case *dnsmsg.RDataSRV:
+			target = rData.Target()
+		default:
+			continue
+		}
+
+		target = canonicalName(target)
+		if seen[target] || !dnsmsg.IsSubDomain(z.Origin, target) {
+			continue
+		}
+
+		seen[target] = true
+
+		for _, addr := range z.records[target] {
+			if addr.TYPE == dnsmsg.RecordTypeA || addr.TYPE == dnsmsg.RecordTypeAAAA {
+				additional = append(additional, addr)
+			}
+		}
+	}
+
+	return additional
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// The NSEC or NSEC3 records of a signed zone prove that names and types do
+// not exist. Responses to queries with the DO bit set carry the records
+// needed for each kind of answer, see RFC 4035 section 3.1.3 and RFC 5155
+// section 7.2.
+
+// nsec3Entry is the hash held in the owner name of an NSEC3 record
+type nsec3Entry struct {
+	hash  []byte
+	owner string
+}
+
+// indexDenial sorts the owners of the NSEC records into canonical order and
+// the NSEC3 records by hash so the records proving a name does not exist can
+// be found
+func (z *Zone) indexDenial() {
+	z.nsecOwners = nil
+	z.nsec3 = nil
+
+	for owner, rrs := range z.records {
+		for _, rr := range rrs {
+			switch rData := rr.RDATA.(type) {
+			case *dnsmsg.RDataNSEC:
+				z.nsecOwners = append(z.nsecOwners, owner)
+			case *dnsmsg.RDataNSEC3:
+				hash, err := dnsmsg.HashedOwner(owner)
+				if err != nil {
+					continue
+				}
+
+				z.nsec3 = append(z.nsec3, nsec3Entry{hash: hash, owner: owner})
+				z.nsec3Params = rData
+			}
+		}
+	}
+
+	sort.Slice(z.nsecOwners, func(i, j int) bool {
+		return dnsmsg.CompareNames(z.nsecOwners[i], z.nsecOwners[j]) < 0
+	})
+
+	sort.Slice(z.nsec3, func(i, j int) bool {
+		return bytes.Compare(z.nsec3[i].hash, z.nsec3[j].hash) < 0
+	})
+}
+
+// denyName returns the records proving name does not exist and that no
+// wildcard could answer for it
+func (z *Zone) denyName(name string) []dnsmsg.RR {
+	switch {
+	case len(z.nsec3) > 0:
+		encloser, owners := z.nsec3EncloserProof(name)
+		return z.denialRecords(append(owners, z.nsec3Covering(wildcardOf(encloser))), dnsmsg.RecordTypeNSEC3)
+
+	case len(z.nsecOwners) > 0:
+		encloser := z.closestEncloser(name)
+		return z.denialRecords([]string{z.nsecCovering(name), z.nsecCovering(wildcardOf(encloser))}, dnsmsg.RecordTypeNSEC)
+	}
+
+	return nil
+}
+
+// denyType returns the records proving name holds no records of the type
+// asked for. When the name was answered from a wildcard the wildcard is shown
+// to lack the type along with the name not existing on its own.
+func (z *Zone) denyType(name string) []dnsmsg.RR {
+	synthesized := !z.names[name]
+
+	switch {
+	case len(z.nsec3) > 0:
+		if !synthesized && z.nsec3Matching(name) != "" {
+			return z.denialRecords([]string{z.nsec3Matching(name)}, dnsmsg.RecordTypeNSEC3)
+		}
+
+		// Names without an NSEC3 record of their own, such as unsigned
+		// delegations in an opt-out zone, are covered below their closest
+		// encloser
+		encloser, owners := z.nsec3EncloserProof(name)
+		if synthesized {
+			owners = append(owners, z.nsec3Matching(wildcardOf(encloser)))
+		}
+
+		return z.denialRecords(owners, dnsmsg.RecordTypeNSEC3)
+
+	case len(z.nsecOwners) > 0:
+		if synthesized {
+			encloser := z.closestEncloser(name)
+			return z.denialRecords([]string{z.nsecCovering(name), wildcardOf(encloser)}, dnsmsg.RecordTypeNSEC)
+		}
+
+		// An empty non-terminal has no NSEC record but falls within the
+		// record of the name before it
+		return z.denialRecords([]string{z.nsecCovering(name)}, dnsmsg.RecordTypeNSEC)
+	}
+
+	return nil
+}
+
+// denyExpanded returns the records proving a name answered from a wildcard
+// does not exist itself
+func (z *Zone) denyExpanded(name string) []dnsmsg.RR {
+	encloser := z.closestEncloser(name)
+
+	switch {
+	case len(z.nsec3) > 0:
+		return z.denialRecords([]string{z.nsec3Covering(nextCloser(encloser, name))}, dnsmsg.RecordTypeNSEC3)
+	case len(z.nsecOwners) > 0:
+		return z.denialRecords([]string{z.nsecCovering(name)}, dnsmsg.RecordTypeNSEC)
+	}
+
+	return nil
+}
+
+// denialRecords returns the records of type typ owned by each name along with
+// their signatures, leaving out names which were already given
+func (z *Zone) denialRecords(owners []string, typ dnsmsg.RecordType) []dnsmsg.RR {
+	var rrs []dnsmsg.RR
+
+	seen := make(map[string]bool)
+
+	for _, owner := range owners {
+		if owner == "" || seen[owner] {
+			continue
+		}
+
+		seen[owner] = true
+
+		rrs = append(rrs, filterType(z.records[owner], typ)...)
+		rrs = append(rrs, signaturesFor(z.records[owner], typ)...)
+	}
+
+	return rrs
+}
+
+// closestEncloser returns the longest name above name, or name itself, which
+// exists in the zone
+func (z *Zone) closestEncloser(name string) string {
+	names := ancestors(z.Origin, name)
+
+	for i := len(names) - 1; i > 0; i-- {
+		if z.names[names[i]] {
+			return names[i]
+		}
+	}
+
+	return z.Origin
+}
+
+// nsecCovering returns the owner of the NSEC record which matches name or is
+// the last one sorting before it. The chain wraps around so a name after the
+// last owner falls within the last record.
+func (z *Zone) nsecCovering(name string) string {
+	i := sort.Search(len(z.nsecOwners), func(i int) bool {
+		return dnsmsg.CompareNames(z.nsecOwners[i], name) > 0
+	})
+
+	if i == 0 {
+		return z.nsecOwners[len(z.nsecOwners)-1]
+	}
+
+	return z.nsecOwners[i-1]
+}
+
+// nsec3EncloserProof finds the closest encloser of name which has an NSEC3
+// record and returns it along with the owners of the records matching it and
+// covering the next closer name, see RFC 5155 section 7.2.1
+func (z *Zone) nsec3EncloserProof(name string) (string, []string) {
+	names := ancestors(z.Origin, name)
+
+	for i := len(names) - 1; i >= 0; i-- {
+		match := z.nsec3Matching(names[i])
+		if match == "" {
+			continue
+		}
+
+		owners := []string{match}
+		if i < len(names)-1 {
+			owners = append(owners, z.nsec3Covering(names[i+1]))
+		}
+
+		return names[i], owners
+	}
+
+	return z.Origin, nil
+}
+
+// nsec3Matching returns the owner of the NSEC3 record holding the hash of name
+// or an empty string if there is none
+func (z *Zone) nsec3Matching(name string) string {
+	hash := z.nsec3Hash(name)
+
+	i := sort.Search(len(z.nsec3), func(i int) bool {
+		return bytes.Compare(z.nsec3[i].hash, hash) >= 0
+	})
+
+	if hash == nil || i == len(z.nsec3) || !bytes.Equal(z.nsec3[i].hash, hash) {
+		return ""
+	}
+
+	return z.nsec3[i].owner
+}
+
+// nsec3Covering returns the owner of the NSEC3 record whose hash is the last
+// one sorting before the hash of name, wrapping around to the last record
+func (z *Zone) nsec3Covering(name string) string {
+	hash := z.nsec3Hash(name)
+	if hash == nil {
+		return ""
+	}
+
+	i := sort.Search(len(z.nsec3), func(i int) bool {
+		return bytes.Compare(z.nsec3[i].hash, hash) >= 0
+	})
+
+	if i == 0 {
+		return z.nsec3[len(z.nsec3)-1].owner
+	}
+
+	return z.nsec3[i-1].owner
+}
+
+// nsec3Hash hashes name with the parameters of the zone's NSEC3 records
+func (z *Zone) nsec3Hash(name string) []byte {
+	hash, err := dnsmsg.HashName(name, z.nsec3Params.Iterations(), z.nsec3Params.Salt())
+	if err != nil {
+		return nil
+	}
+
+	return hash
+}
+
+// nextCloser returns the name one label longer than encloser on the way down
+// to name
+func nextCloser(encloser, name string) string {
+	names := ancestors(encloser, name)
+	if len(names) < 2 {
+		return name
+	}
+
+	return names[1]
+}
@@ -0,0 +1,349 @@
+// Package server answers DNS queries authoritatively from zones held in
+// memory, listening on both UDP and TCP.
+package server
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dansackett/dns-client/dnsclient"
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+const (
+	maxUDPMsgSize = 512
+
+	// How long a TCP connection may sit idle between queries
+	tcpIdleTimeout = 10 * time.Second
+)
+
+// Server holds the zones it is authoritative for and the connections it
+// listens on
+type Server struct {
+	// IP and Port to listen on for both UDP and TCP such as ":53"
+	Addr string
+
+	// IP and Port of the secondary servers sent a NOTIFY when a zone is
+	// replaced by a newer version
+	Secondaries []string
+
+	// The TSIG keys queries may be signed with. Responses to signed queries
+	// are signed with the same key. When any keys are given, zone transfers
+	// are refused unless they are signed.
+	Keys []*dnsmsg.TSIGKey
+
+	// Where problems which cannot be returned to a caller, such as a secondary
+	// not acknowledging a NOTIFY, are reported. Nothing is logged when nil.
+	ErrorLog *log.Logger
+
+	mu    sync.RWMutex
+	zones map[string]*Zone
+
+	// the changes made to each zone, oldest first, for answering IXFR
+	journals map[string][]change
+
+	pc net.PacketConn
+	ln net.Listener
+}
+
+// New creates a new Server which listens on addr once started
+func New(addr string) *Server {
+	return &Server{
+		Addr:     addr,
+		zones:    make(map[string]*Zone),
+		journals: make(map[string][]change),
+	}
+}
+
+// AddZone starts serving a zone, replacing any zone already served with the
+// same origin. When the zone replaces an older version, the changes between
+// them are kept in the journal for IXFR and the secondaries are notified.
+func (s *Server) AddZone(z *Zone) {
+	s.mu.Lock()
+
+	old := s.zones[z.Origin]
+	s.zones[z.Origin] = z
+
+	newer := old != nil && dnsmsg.CompareSerials(z.Serial(), old.Serial()) > 0
+
+	switch {
+	case newer:
+		journal := append(s.journals[z.Origin], diffZones(old, z))
+		if len(journal) > maxJournalChanges {
+			journal = journal[len(journal)-maxJournalChanges:]
+		}
+
+		s.journals[z.Origin] = journal
+
+	case old != nil && old.Serial() != z.Serial():
+		// The changes no longer lead to the zone being served once the
+		// serial goes backwards
+		delete(s.journals, z.Origin)
+	}
+
+	s.mu.Unlock()
+
+	if newer {
+		s.notify(z)
+	}
+}
+
+// notify sends a NOTIFY for the zone to each secondary in the background
+func (s *Server) notify(z *Zone) {
+	soa := z.SOA()
+
+	for _, secondary := range s.Secondaries {
+		go func(secondary string) {
+			client := dnsclient.New(secondary)
+
+			if err := client.Notify(context.Background(), z.Origin, soa); err != nil {
+				s.logf("Failed to notify %s of serial %d for %s: %v", secondary, z.Serial(), z.Origin, err)
+			}
+		}(secondary)
+	}
+}
+
+// logf reports a problem to the error log when there is one
+func (s *Server) logf(format string, v ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, v...)
+	}
+}
+
+// Zone returns the zone served for origin or nil if there is not one
+func (s *Server) Zone(origin string) *Zone {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.zones[canonicalName(origin)]
+}
+
+// findZone returns the most specific zone holding name
+func (s *Server) findZone(name string) *Zone {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for name = canonicalName(name); name != "."; name = dnsmsg.ParentName(name) {
+		if z, ok := s.zones[name]; ok {
+			return z
+		}
+	}
+
+	return s.zones["."]
+}
+
+// ListenAndServe listens on the server address for UDP and TCP and answers
+// queries until the server is closed
+func (s *Server) ListenAndServe() error {
+	pc, err := net.ListenPacket("udp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	// Listening on the address UDP was given means a port of 0 ends up with
+	// the same port for both
+	ln, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		pc.Close()
+		return err
+	}
+
+	return s.Serve(pc, ln)
+}
+
+// Serve answers queries arriving on the given connections until the server is
+// closed or one of them fails
+func (s *Server) Serve(pc net.PacketConn, ln net.Listener) error {
+	s.mu.Lock()
+	s.pc = pc
+	s.ln = ln
+	s.mu.Unlock()
+
+	errc := make(chan error, 2)
+
+	go func() { errc <- s.serveUDP(pc) }()
+	go func() { errc <- s.serveTCP(ln) }()
+
+	err := <-errc
+	s.Close()
+
+	return err
+}
+
+// Close stops the server from listening for queries
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+
+	if s.pc != nil {
+		err = s.pc.Close()
+	}
+
+	if s.ln != nil {
+		if lnErr := s.ln.Close(); err == nil {
+			err = lnErr
+		}
+	}
+
+	return err
+}
+
+func (s *Server) serveUDP(pc net.PacketConn) error {
+	for {
+		buf := make([]byte, dnsmsg.MaxTCPMsgSize)
+
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		go func(data []byte, addr net.Addr) {
+			for _, resp := range s.respond(data, "udp") {
+				pc.WriteTo(resp, addr)
+			}
+		}(buf[:n], addr)
+	}
+}
+
+func (s *Server) serveTCP(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+
+		go s.serveTCPConn(conn)
+	}
+}
+
+// serveTCPConn answers queries on a TCP connection until the client closes it
+// or it sits idle for too long
+func (s *Server) serveTCPConn(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		conn.SetDeadline(time.Now().Add(tcpIdleTimeout))
+
+		data, err := dnsmsg.ReadTCPMessage(conn)
+		if err != nil {
+			return
+		}
+
+		for _, resp := range s.respond(data, "tcp") {
+			// A long transfer gets as long to send each message
+			conn.SetDeadline(time.Now().Add(tcpIdleTimeout))
+
+			if err = dnsmsg.WriteTCPMessage(conn, resp); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// respond decodes a query and encodes the messages of the response to it.
+// Zone transfers are answered with several messages over TCP while every
+// other query gets a single one. Responses which do not fit in a UDP datagram
+// are truncated so the client retries over TCP.
+func (s *Server) respond(data []byte, network string) [][]byte {
+	query := new(dnsmsg.Message)
+
+	if _, err := dnsmsg.DecodeMessage(data, query); err != nil {
+		// Only a query with a readable header can be told it was malformed
+		if _, err := dnsmsg.DecodeHeader(data, 0, &query.Header); err != nil || query.Header.QR != dnsmsg.QRTypeQuery {
+			return nil
+		}
+
+		resp := &dnsmsg.Message{
+			Header: dnsmsg.Header{
+				ID:     query.Header.ID,
+				QR:     dnsmsg.QRTypeResponse,
+				OPCODE: query.Header.OPCODE,
+				RCODE:  dnsmsg.ResponseCodeFormatError,
+			},
+		}
+
+		respBytes, _ := resp.Encode()
+		return [][]byte{respBytes}
+	}
+
+	// Responding to a response could start a loop between two servers
+	if query.Header.QR != dnsmsg.QRTypeQuery {
+		return nil
+	}
+
+	key, requestMAC, tsigErr := s.verifyTSIG(query, data)
+	if tsigErr == dnsmsg.ResponseCodeFormatError {
+		return [][]byte{errorResponse(query, tsigErr)}
+	}
+
+	if tsigErr != dnsmsg.ResponseCodeNoError {
+		return [][]byte{rejectTSIG(query, key, requestMAC, tsigErr)}
+	}
+
+	if key == nil && len(s.Keys) > 0 && isTransfer(query) {
+		return [][]byte{errorResponse(query, dnsmsg.ResponseCodeRefused)}
+	}
+
+	// Signing a response adds the TSIG record after it has been encoded so
+	// room is left for it
+	overhead := 0
+	if key != nil {
+		overhead = tsigSize(key)
+	}
+
+	var msgs [][]byte
+
+	if network == "tcp" {
+		for _, resp := range s.Transfer(query) {
+			msgs = append(msgs, encodeResponse(resp, dnsmsg.MaxTCPMsgSize-overhead))
+		}
+	} else {
+		resp := s.Handle(query)
+		if resp == nil {
+			return nil
+		}
+
+		maxSize := maxUDPMsgSize
+		if e := query.EDNS(); e != nil && int(e.UDPSize) > maxSize {
+			maxSize = int(e.UDPSize)
+		}
+
+		msgs = [][]byte{encodeResponse(resp, maxSize-overhead)}
+	}
+
+	if key != nil {
+		return s.signResponses(msgs, key, requestMAC)
+	}
+
+	return msgs
+}
+
+// encodeResponse encodes a response, replacing it with a SERVER FAILURE when
+// it cannot be encoded and truncating it when it is larger than maxSize
+func encodeResponse(resp *dnsmsg.Message, maxSize int) []byte {
+	respBytes, err := resp.Encode()
+	if err != nil {
+		resp = &dnsmsg.Message{Header: resp.Header, Questions: resp.Questions}
+		resp.Header.AA = 0
+		resp.Header.RCODE = dnsmsg.ResponseCodeServerFailure
+		respBytes, _ = resp.Encode()
+	}
+
+	if len(respBytes) > maxSize {
+		truncated := &dnsmsg.Message{Header: resp.Header, Questions: resp.Questions}
+		truncated.Header.TC = 1
+
+		if e := resp.EDNS(); e != nil {
+			truncated.SetEDNS(*e)
+		}
+
+		respBytes, _ = truncated.Encode()
+	}
+
+	return respBytes
+}
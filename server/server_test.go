@@ -0,0 +1,377 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+const testZone = `$TTL 300
+@		IN	SOA	ns1 host 2024010101 3600 600 86400 60
+@		IN	NS	ns1
+@		IN	MX	10 mail
+ns1		IN	A	192.0.2.53
+mail		IN	A	192.0.2.25
+www		IN	A	192.0.2.80
+		IN	AAAA	2001:db8::80
+alias		IN	CNAME	chain
+chain		IN	CNAME	www
+outside		IN	CNAME	www.example.org.
+host.deep	IN	A	192.0.2.81
+*.wild		IN	TXT	"wildcard"
+sub		IN	NS	ns.sub
+ns.sub		IN	A	192.0.2.54
+`
+
+// newTestServer serves testZone as example.test.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	rrs, err := dnsmsg.ParseZone(strings.NewReader(testZone), "example.test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := NewZone("example.test.", rrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New("")
+	s.AddZone(z)
+
+	return s
+}
+
+// respondAll encodes query, hands it to the server as if it came over network
+// and decodes every message of the response
+func respondAll(t *testing.T, s *Server, query *dnsmsg.Message, network string) []*dnsmsg.Message {
+	t.Helper()
+
+	data, err := query.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msgs []*dnsmsg.Message
+
+	for _, respBytes := range s.respond(data, network) {
+		resp := new(dnsmsg.Message)
+		if _, err := dnsmsg.DecodeMessage(respBytes, resp); err != nil {
+			t.Fatal(err)
+		}
+
+		msgs = append(msgs, resp)
+	}
+
+	return msgs
+}
+
+// respondTo is respondAll for queries answered with a single message
+func respondTo(t *testing.T, s *Server, query *dnsmsg.Message, network string) *dnsmsg.Message {
+	t.Helper()
+
+	msgs := respondAll(t, s, query, network)
+	if len(msgs) != 1 {
+		t.Fatalf("got %d responses, want 1", len(msgs))
+	}
+
+	return msgs[0]
+}
+
+// names lists the owner and type of each record
+func names(rrs []dnsmsg.RR) string {
+	var s []string
+
+	for _, rr := range rrs {
+		s = append(s, rr.NAME+" "+dnsmsg.RecordTypeToStrMap[rr.TYPE])
+	}
+
+	return strings.Join(s, ", ")
+}
+
+func TestHandle(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		name       string
+		typ        dnsmsg.RecordType
+		rcode      dnsmsg.ResponseCode
+		aa         byte
+		answers    string
+		authority  string
+		additional string
+	}{
+		{"www.example.test.", dnsmsg.RecordTypeA, dnsmsg.ResponseCodeNoError, 1,
+			"www.example.test. A", "", ""},
+		{"WWW.Example.Test", dnsmsg.RecordTypeAAAA, dnsmsg.ResponseCodeNoError, 1,
+			"www.example.test. AAAA", "", ""},
+		{"www.example.test.", dnsmsg.RecordTypeWildcard, dnsmsg.ResponseCodeNoError, 1,
+			"www.example.test. A, www.example.test. AAAA", "", ""},
+		{"example.test.", dnsmsg.RecordTypeMX, dnsmsg.ResponseCodeNoError, 1,
+			"example.test. MX", "", "mail.example.test. A"},
+
+		// CNAME chains are followed within the zone but not out of it
+		{"alias.example.test.", dnsmsg.RecordTypeA, dnsmsg.ResponseCodeNoError, 1,
+			"alias.example.test. CNAME, chain.example.test. CNAME, www.example.test. A", "", ""},
+		{"alias.example.test.", dnsmsg.RecordTypeCNAME, dnsmsg.ResponseCodeNoError, 1,
+			"alias.example.test. CNAME", "", ""},
+		{"outside.example.test.", dnsmsg.RecordTypeA, dnsmsg.ResponseCodeNoError, 1,
+			"outside.example.test. CNAME", "", ""},
+
+		// Negative answers carry the SOA record
+		{"nothing.example.test.", dnsmsg.RecordTypeA, dnsmsg.ResponseCodeNameError, 1,
+			"", "example.test. SOA", ""},
+		{"www.example.test.", dnsmsg.RecordTypeMX, dnsmsg.ResponseCodeNoError, 1,
+			"", "example.test. SOA", ""},
+		{"deep.example.test.", dnsmsg.RecordTypeA, dnsmsg.ResponseCodeNoError, 1,
+			"", "example.test. SOA", ""},
+
+		// Names which do not exist below a wildcard are synthesized from it
+		{"anything.wild.example.test.", dnsmsg.RecordTypeTXT, dnsmsg.ResponseCodeNoError, 1,
+			"anything.wild.example.test. TXT", "", ""},
+		{"a.b.wild.example.test.", dnsmsg.RecordTypeTXT, dnsmsg.ResponseCodeNoError, 1,
+			"a.b.wild.example.test. TXT", "", ""},
+		{"anything.wild.example.test.", dnsmsg.RecordTypeA, dnsmsg.ResponseCodeNoError, 1,
+			"", "example.test. SOA", ""},
+		{"wild.example.test.", dnsmsg.RecordTypeTXT, dnsmsg.ResponseCodeNoError, 1,
+			"", "example.test. SOA", ""},
+
+		// Names at or below a zone cut are referred to the child's servers
+		{"www.sub.example.test.", dnsmsg.RecordTypeA, dnsmsg.ResponseCodeNoError, 0,
+			"", "sub.example.test. NS", "ns.sub.example.test. A"},
+		{"sub.example.test.", dnsmsg.RecordTypeNS, dnsmsg.ResponseCodeNoError, 0,
+			"", "sub.example.test. NS", "ns.sub.example.test. A"},
+
+		{"www.example.org.", dnsmsg.RecordTypeA, dnsmsg.ResponseCodeRefused, 0, "", "", ""},
+	}
+
+	for _, tt := range tests {
+		query := dnsmsg.NewQuery(tt.name, tt.typ)
+		resp := s.Handle(query)
+
+		if resp.Header.ID != query.Header.ID || resp.Header.QR != dnsmsg.QRTypeResponse {
+			t.Errorf("%s %s: response header %+v does not answer the query", tt.name, dnsmsg.RecordTypeToStrMap[tt.typ], resp.Header)
+		}
+
+		if resp.Header.RCODE != tt.rcode || resp.Header.AA != tt.aa {
+			t.Errorf("%s %s: RCODE %s with AA %d, want %s with AA %d", tt.name, dnsmsg.RecordTypeToStrMap[tt.typ],
+				dnsmsg.ResponseCodeToStrMap[resp.Header.RCODE], resp.Header.AA, dnsmsg.ResponseCodeToStrMap[tt.rcode], tt.aa)
+		}
+
+		sections := []struct {
+			name      string
+			got, want string
+		}{
+			{"answers", names(resp.Answers), tt.answers},
+			{"authority", names(resp.Authority), tt.authority},
+			{"additional", names(resp.Additional), tt.additional},
+		}
+
+		for _, section := range sections {
+			if section.got != section.want {
+				t.Errorf("%s %s: %s = [%s], want [%s]", tt.name, dnsmsg.RecordTypeToStrMap[tt.typ], section.name, section.got, section.want)
+			}
+		}
+	}
+}
+
+func TestHandleNegativeTTL(t *testing.T) {
+	resp := newTestServer(t).Handle(dnsmsg.NewQuery("nothing.example.test.", dnsmsg.RecordTypeA))
+
+	if len(resp.Authority) != 1 || resp.Authority[0].TTL != 60 {
+		t.Errorf("authority = %v, want the SOA with its TTL capped at the minimum of 60", resp.Authority)
+	}
+}
+
+func TestHandleErrors(t *testing.T) {
+	s := newTestServer(t)
+
+	query := dnsmsg.NewQuery("www.example.test.", dnsmsg.RecordTypeA)
+	query.Header.QR = dnsmsg.QRTypeResponse
+
+	if resp := s.Handle(query); resp != nil {
+		t.Errorf("Handle answered a response with %v", resp)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(query *dnsmsg.Message)
+		want   dnsmsg.ResponseCode
+	}{
+		{"no question", func(query *dnsmsg.Message) { query.Questions = nil }, dnsmsg.ResponseCodeFormatError},
+		{"status opcode", func(query *dnsmsg.Message) { query.Header.OPCODE = dnsmsg.OpcodeStatus }, dnsmsg.ResponseCodeNotImplemented},
+		{"CHAOS class", func(query *dnsmsg.Message) { query.Questions[0].QCLASS = dnsmsg.RecordClassCH }, dnsmsg.ResponseCodeRefused},
+		{"EDNS version 1", func(query *dnsmsg.Message) {
+			query.SetEDNS(dnsmsg.EDNS{UDPSize: dnsmsg.DefaultEDNSUDPSize, Version: 1})
+		}, dnsmsg.ResponseCodeBadVersion},
+	}
+
+	for _, tt := range tests {
+		query := dnsmsg.NewQuery("www.example.test.", dnsmsg.RecordTypeA)
+		tt.modify(query)
+
+		resp := respondTo(t, s, query, "udp")
+		if rcode := resp.ResponseCode(); rcode != tt.want {
+			t.Errorf("%s: RCODE = %s, want %s", tt.name, dnsmsg.ResponseCodeToStrMap[rcode], dnsmsg.ResponseCodeToStrMap[tt.want])
+		}
+	}
+}
+
+func TestRespondMalformed(t *testing.T) {
+	s := newTestServer(t)
+
+	data, err := dnsmsg.NewQuery("www.example.test.", dnsmsg.RecordTypeA).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := s.respond(data[:len(data)-2], "udp")
+	if len(msgs) != 1 {
+		t.Fatalf("got %d responses, want 1", len(msgs))
+	}
+
+	resp := new(dnsmsg.Message)
+	if _, err := dnsmsg.DecodeMessage(msgs[0], resp); err != nil {
+		t.Fatalf("DecodeMessage: %v", err)
+	}
+
+	if resp.Header.RCODE != dnsmsg.ResponseCodeFormatError {
+		t.Errorf("RCODE = %s, want FORMERR", dnsmsg.ResponseCodeToStrMap[resp.Header.RCODE])
+	}
+
+	if s.respond(data[:5], "udp") != nil {
+		t.Error("responded to a message without a full header")
+	}
+}
+
+func TestRespondTruncated(t *testing.T) {
+	text := "big.example.test. 300 IN SOA ns1.example.test. host.example.test. 1 3600 600 86400 60\n"
+	for i := 0; i < 20; i++ {
+		text += `big.example.test. 300 IN TXT "` + strings.Repeat("x", 40) + `"` + "\n"
+	}
+
+	rrs, err := dnsmsg.ParseZone(strings.NewReader(text), "big.example.test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := NewZone("big.example.test.", rrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New("")
+	s.AddZone(z)
+
+	query := dnsmsg.NewQuery("big.example.test.", dnsmsg.RecordTypeTXT)
+
+	if resp := respondTo(t, s, query, "udp"); resp.Header.TC != 1 || len(resp.Answers) != 0 {
+		t.Errorf("UDP response has TC %d and %d answers, want a truncated response", resp.Header.TC, len(resp.Answers))
+	}
+
+	if resp := respondTo(t, s, query, "tcp"); resp.Header.TC != 0 || len(resp.Answers) != 20 {
+		t.Errorf("TCP response has TC %d and %d answers, want 20", resp.Header.TC, len(resp.Answers))
+	}
+
+	query.SetEDNS(dnsmsg.EDNS{UDPSize: dnsmsg.DefaultEDNSUDPSize})
+
+	if resp := respondTo(t, s, query, "udp"); resp.Header.TC != 0 || len(resp.Answers) != 20 {
+		t.Errorf("UDP response with EDNS has TC %d and %d answers, want 20", resp.Header.TC, len(resp.Answers))
+	}
+}
+
+func TestFindZone(t *testing.T) {
+	s := New("")
+
+	for _, origin := range []string{".", "example.", "b.example."} {
+		z, err := NewZone(origin, []dnsmsg.RR{mustParseRR(t, origin+" 300 IN SOA ns.example. host.example. 1 3600 600 86400 60")})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s.AddZone(z)
+	}
+
+	tests := map[string]string{
+		"example.":           "example.",
+		"www.b.example.":     "b.example.",
+		"WWW.B.Example":      "b.example.",
+		"www.example.":       "example.",
+		"com.":               ".",
+		`a\.b.example.`:      "example.",
+		`www.a\.b.example.`:  "example.",
+		`b\\.b.example.`:     "b.example.",
+		`x.b\\.b.example.`:   "b.example.",
+		`x.b\046.example.`:   "example.",
+		`\.b.example.`:       "example.",
+		`x\..b.example.`:     "b.example.",
+		`www\\\.b.example.`:  "example.",
+		`www\\\\.b.example.`: "b.example.",
+	}
+
+	for name, want := range tests {
+		if z := s.findZone(name); z == nil || z.Origin != want {
+			t.Errorf("findZone(%q) = %v, want %s", name, z, want)
+		}
+	}
+}
+
+func mustParseRR(t *testing.T, s string) dnsmsg.RR {
+	t.Helper()
+
+	rr, err := dnsmsg.ParseRR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rr
+}
+
+func TestAncestors(t *testing.T) {
+	tests := []struct {
+		origin, name string
+		want         []string
+	}{
+		{".", ".", []string{"."}},
+		{".", "com.", []string{".", "com."}},
+		{"example.", "example.", []string{"example."}},
+		{"example.", "a.b.example.", []string{"example.", "b.example.", "a.b.example."}},
+		{"example.", `a\.b.example.`, []string{"example.", `a\.b.example.`}},
+	}
+
+	for _, tt := range tests {
+		if got := ancestors(tt.origin, tt.name); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("ancestors(%q, %q) = %q, want %q", tt.origin, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRootZoneApexWildcard(t *testing.T) {
+	rrs, err := dnsmsg.ParseZone(strings.NewReader(`
+.	300	IN	SOA	a.root-servers.net. nstld.verisign-grs.com. 1 1800 900 604800 86400
+.	300	IN	NS	a.root-servers.net.
+*.	300	IN	TXT	"wildcard"
+`), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := NewZone(".", rrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New("")
+	s.AddZone(z)
+
+	resp := s.Handle(dnsmsg.NewQuery("nothing-here.", dnsmsg.RecordTypeTXT))
+	if resp.Header.RCODE != dnsmsg.ResponseCodeNoError || len(resp.Answers) != 1 {
+		t.Fatalf("RCODE = %d with %d answers, want a synthesized answer", resp.Header.RCODE, len(resp.Answers))
+	}
+
+	if resp.Answers[0].NAME != "nothing-here." {
+		t.Errorf("answer owned by %s, want nothing-here.", resp.Answers[0].NAME)
+	}
+}
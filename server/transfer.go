@@ -0,0 +1,202 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+const (
+	// Records are split across messages so each one stays well below the
+	// 65535 octets a TCP message can hold
+	maxTransferMsgSize = 16384
+
+	// The number of changes kept for each zone to answer IXFR from
+	maxJournalChanges = 100
+)
+
+// change holds the difference between two versions of a zone
+type change struct {
+	// The SOA records of the old and new versions
+	from, to dnsmsg.RR
+
+	deleted []dnsmsg.RR
+	added   []dnsmsg.RR
+}
+
+// diffZones works out the records deleted from and added to a zone between
+// two versions of it. The SOA records are kept apart from the other records.
+func diffZones(old, new *Zone) change {
+	c := change{from: old.SOA(), to: new.SOA()}
+
+	oldRecords := recordCounts(old.rrs)
+	newRecords := recordCounts(new.rrs)
+
+	for _, rr := range old.rrs {
+		if key := recordKey(rr); rr.TYPE != dnsmsg.RecordTypeSOA && newRecords[key] == 0 {
+			c.deleted = append(c.deleted, rr)
+		} else {
+			newRecords[key]--
+		}
+	}
+
+	for _, rr := range new.rrs {
+		if key := recordKey(rr); rr.TYPE != dnsmsg.RecordTypeSOA && oldRecords[key] == 0 {
+			c.added = append(c.added, rr)
+		} else {
+			oldRecords[key]--
+		}
+	}
+
+	return c
+}
+
+// recordCounts counts how many times each record appears
+func recordCounts(rrs []dnsmsg.RR) map[string]int {
+	counts := make(map[string]int)
+
+	for _, rr := range rrs {
+		counts[recordKey(rr)]++
+	}
+
+	return counts
+}
+
+// recordKey identifies a record by everything it holds so two versions of a
+// zone can be compared
+func recordKey(rr dnsmsg.RR) string {
+	return fmt.Sprintf("%s %d %d %d %s", canonicalName(rr.NAME), rr.TTL, rr.CLASS, rr.TYPE, rr.RDATA)
+}
+
+// Transfer answers a query with every message of the response to it. Zone
+// transfers are streamed across as many messages as they need, starting and
+// ending with the SOA record of the zone as described in RFC 5936. IXFR is
+// answered with the changes since the serial given in the authority section
+// when they are held in the journal and with the whole zone when they are
+// not, see RFC 1995. Any other query is answered as by Handle.
+func (s *Server) Transfer(query *dnsmsg.Message) []*dnsmsg.Message {
+	resp, zone := s.prepare(query)
+	if resp == nil {
+		return nil
+	}
+
+	if zone == nil {
+		return []*dnsmsg.Message{resp}
+	}
+
+	q := query.Questions[0]
+
+	if q.QTYPE != dnsmsg.RecordTypeAXFR && q.QTYPE != dnsmsg.RecordTypeIXFR {
+		zone.answer(resp, q)
+		return []*dnsmsg.Message{resp}
+	}
+
+	if !zone.isOrigin(q.QNAME) {
+		setResponseCode(resp, dnsmsg.ResponseCodeRefused)
+		return []*dnsmsg.Message{resp}
+	}
+
+	resp.Header.AA = 1
+
+	if q.QTYPE == dnsmsg.RecordTypeAXFR {
+		return splitTransfer(resp, axfrRecords(zone))
+	}
+
+	// The SOA record the client holds gives the serial to send changes from
+	var soa *dnsmsg.RDataSOA
+	if len(query.Authority) == 1 {
+		soa, _ = query.Authority[0].RDATA.(*dnsmsg.RDataSOA)
+	}
+
+	if soa == nil {
+		setResponseCode(resp, dnsmsg.ResponseCodeFormatError)
+		return []*dnsmsg.Message{resp}
+	}
+
+	return splitTransfer(resp, s.ixfrRecords(zone, soa.Serial()))
+}
+
+// axfrRecords lists every record in a zone bracketed by its SOA record
+func axfrRecords(z *Zone) []dnsmsg.RR {
+	soa := z.SOA()
+	rrs := []dnsmsg.RR{soa}
+
+	for _, rr := range z.rrs {
+		if rr.TYPE != dnsmsg.RecordTypeSOA {
+			rrs = append(rrs, rr)
+		}
+	}
+
+	return append(rrs, soa)
+}
+
+// ixfrRecords lists the changes made to a zone since the version with the
+// given serial. A client holding the current version is sent just the SOA
+// record and one holding a version older than the journal goes back to is
+// sent the whole zone.
+func (s *Server) ixfrRecords(z *Zone, serial uint32) []dnsmsg.RR {
+	soa := z.SOA()
+
+	if dnsmsg.CompareSerials(serial, z.Serial()) >= 0 {
+		return []dnsmsg.RR{soa}
+	}
+
+	changes := s.journal(z.Origin, serial)
+	if changes == nil {
+		return axfrRecords(z)
+	}
+
+	rrs := []dnsmsg.RR{soa}
+
+	for _, c := range changes {
+		rrs = append(rrs, c.from)
+		rrs = append(rrs, c.deleted...)
+		rrs = append(rrs, c.to)
+		rrs = append(rrs, c.added...)
+	}
+
+	return append(rrs, soa)
+}
+
+// journal returns the changes made to the zone at origin since the version
+// with the given serial, or nil if they are not all held
+func (s *Server) journal(origin string, serial uint32) []change {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	changes := s.journals[origin]
+
+	for i, c := range changes {
+		if c.from.RDATA.(*dnsmsg.RDataSOA).Serial() == serial {
+			return changes[i:]
+		}
+	}
+
+	return nil
+}
+
+// splitTransfer spreads the records of a transfer across as many messages as
+// needed. Only the first message carries the question.
+func splitTransfer(first *dnsmsg.Message, rrs []dnsmsg.RR) []*dnsmsg.Message {
+	var msgs []*dnsmsg.Message
+
+	msg := first
+	size := 0
+
+	for _, rr := range rrs {
+		// Compression only makes the message smaller so the size of each
+		// record on its own is enough to stay within the limit
+		rrBytes, _ := rr.Encode()
+
+		if len(msg.Answers) > 0 && size+len(rrBytes) > maxTransferMsgSize {
+			msgs = append(msgs, msg)
+			msg = &dnsmsg.Message{Header: first.Header}
+			size = 0
+		}
+
+		msg.Answers = append(msg.Answers, rr)
+		size += len(rrBytes)
+	}
+
+	return append(msgs, msg)
+}
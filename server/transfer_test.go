@@ -0,0 +1,258 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// zoneVersion builds a version of testZone with the serial given and the
+// extra records added
+func zoneVersion(t *testing.T, serial uint32, extra ...string) *Zone {
+	t.Helper()
+
+	text := strings.Replace(testZone, "2024010101", fmt.Sprint(serial), 1) + strings.Join(extra, "\n")
+
+	rrs, err := dnsmsg.ParseZone(strings.NewReader(text), "example.test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := NewZone("example.test.", rrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return z
+}
+
+// transferRecords joins the answers of every message of a transfer
+func transferRecords(msgs []*dnsmsg.Message) []dnsmsg.RR {
+	var rrs []dnsmsg.RR
+
+	for _, m := range msgs {
+		rrs = append(rrs, m.Answers...)
+	}
+
+	return rrs
+}
+
+// serials lists the serial of each SOA record in order
+func serials(rrs []dnsmsg.RR) string {
+	var s []string
+
+	for _, rr := range rrs {
+		if soa, ok := rr.RDATA.(*dnsmsg.RDataSOA); ok {
+			s = append(s, fmt.Sprint(soa.Serial()))
+		}
+	}
+
+	return strings.Join(s, " ")
+}
+
+func TestTransferAXFR(t *testing.T) {
+	var extra []string
+	for i := 0; i < 600; i++ {
+		extra = append(extra, fmt.Sprintf("host%d IN A 192.0.2.%d", i, i%256))
+	}
+
+	z := zoneVersion(t, 1, extra...)
+
+	s := New("")
+	s.AddZone(z)
+
+	msgs := respondAll(t, s, dnsmsg.NewQuery("example.test.", dnsmsg.RecordTypeAXFR), "tcp")
+	if len(msgs) < 2 {
+		t.Fatalf("got %d messages, want the zone split across several", len(msgs))
+	}
+
+	for i, m := range msgs {
+		if m.Header.RCODE != dnsmsg.ResponseCodeNoError || m.Header.AA != 1 {
+			t.Errorf("message %d has RCODE %d and AA %d, want NOERROR and AA", i, m.Header.RCODE, m.Header.AA)
+		}
+
+		// Only the first message echoes the question
+		if want := i == 0; (len(m.Questions) == 1) != want {
+			t.Errorf("message %d has %d questions", i, len(m.Questions))
+		}
+	}
+
+	rrs := transferRecords(msgs)
+
+	if len(rrs) != len(z.Records())+1 {
+		t.Errorf("transfer holds %d records, want the %d in the zone and the closing SOA", len(rrs), len(z.Records()))
+	}
+
+	if got := serials(rrs); got != "1 1" {
+		t.Errorf("SOA serials = %s, want 1 1", got)
+	}
+
+	if rrs[0].TYPE != dnsmsg.RecordTypeSOA || rrs[len(rrs)-1].TYPE != dnsmsg.RecordTypeSOA {
+		t.Errorf("transfer runs from %s to %s, want SOA to SOA", &rrs[0], &rrs[len(rrs)-1])
+	}
+}
+
+func TestTransferErrors(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		name  string
+		query *dnsmsg.Message
+		want  dnsmsg.ResponseCode
+	}{
+		{"AXFR below the origin", dnsmsg.NewQuery("www.example.test.", dnsmsg.RecordTypeAXFR), dnsmsg.ResponseCodeRefused},
+		{"AXFR of another zone", dnsmsg.NewQuery("example.org.", dnsmsg.RecordTypeAXFR), dnsmsg.ResponseCodeRefused},
+		{"IXFR without an SOA", dnsmsg.NewQuery("example.test.", dnsmsg.RecordTypeIXFR), dnsmsg.ResponseCodeFormatError},
+	}
+
+	for _, tt := range tests {
+		if resp := respondTo(t, s, tt.query, "tcp"); resp.Header.RCODE != tt.want {
+			t.Errorf("%s: RCODE = %s, want %s", tt.name, dnsmsg.ResponseCodeToStrMap[resp.Header.RCODE], dnsmsg.ResponseCodeToStrMap[tt.want])
+		}
+	}
+}
+
+func TestTransferIXFR(t *testing.T) {
+	s := New("")
+	s.AddZone(zoneVersion(t, 1))
+	s.AddZone(zoneVersion(t, 2, "new1 IN A 192.0.2.101"))
+	s.AddZone(zoneVersion(t, 3, "new1 IN A 192.0.2.101", "new2 IN A 192.0.2.102"))
+
+	tests := []struct {
+		name    string
+		serial  uint32
+		serials string
+		full    bool
+		added   string
+	}{
+		// Each change is the old SOA, the deletions, the new SOA and the
+		// additions, bracketed by the current SOA
+		{"journaled serial", 1, "3 1 2 2 3 3", false, "new1.example.test. A, new2.example.test. A"},
+		{"latest change", 2, "3 2 3 3", false, "new2.example.test. A"},
+
+		// Without the changes the whole zone is sent as for AXFR
+		{"unknown serial", 0, "3 3", true, ""},
+
+		// A client holding the current version is sent just the SOA
+		{"up to date", 3, "3", false, ""},
+		{"newer serial", 4, "3", false, ""},
+	}
+
+	for _, tt := range tests {
+		query := dnsmsg.NewQuery("example.test.", dnsmsg.RecordTypeIXFR)
+		query.Authority = []dnsmsg.RR{mustParseRR(t, fmt.Sprintf("example.test. 0 IN SOA . . %d 0 0 0 0", tt.serial))}
+
+		rrs := transferRecords(respondAll(t, s, query, "tcp"))
+
+		if got := serials(rrs); got != tt.serials {
+			t.Errorf("%s: SOA serials = %s, want %s", tt.name, got, tt.serials)
+		}
+
+		if tt.full {
+			if len(rrs) != len(s.Zone("example.test.").Records())+1 {
+				t.Errorf("%s: sent %d records, want the whole zone", tt.name, len(rrs))
+			}
+
+			continue
+		}
+
+		var changed []dnsmsg.RR
+		for _, rr := range rrs {
+			if rr.TYPE != dnsmsg.RecordTypeSOA {
+				changed = append(changed, rr)
+			}
+		}
+
+		if got := names(changed); got != tt.added {
+			t.Errorf("%s: changed records = [%s], want [%s]", tt.name, got, tt.added)
+		}
+	}
+}
+
+// Replacing a zone with a newer version sends a NOTIFY to each secondary
+func TestNotifySecondaries(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	received := make(chan *dnsmsg.Message, 1)
+
+	go func() {
+		buf := make([]byte, 512)
+
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		m := new(dnsmsg.Message)
+		if _, err := dnsmsg.DecodeMessage(buf[:n], m); err != nil {
+			return
+		}
+
+		received <- m
+
+		// Acknowledge the NOTIFY so the server does not retry
+		ack := &dnsmsg.Message{Header: m.Header, Questions: m.Questions}
+		ack.Header.QR = dnsmsg.QRTypeResponse
+
+		if data, err := ack.Encode(); err == nil {
+			pc.WriteTo(data, addr)
+		}
+	}()
+
+	s := New("")
+	s.Secondaries = []string{pc.LocalAddr().String()}
+
+	// Loading the first version is not a change
+	s.AddZone(zoneVersion(t, 1))
+	s.AddZone(zoneVersion(t, 2))
+
+	select {
+	case m := <-received:
+		if m.Header.OPCODE != dnsmsg.OpcodeNotify || m.Header.AA != 1 {
+			t.Errorf("received OPCODE %d with AA %d, want NOTIFY with AA", m.Header.OPCODE, m.Header.AA)
+		}
+
+		if len(m.Questions) != 1 || m.Questions[0].QNAME != "example.test." || m.Questions[0].QTYPE != dnsmsg.RecordTypeSOA {
+			t.Errorf("questions = %v, want example.test. SOA", m.Questions)
+		}
+
+		if got := serials(m.Answers); got != "2" {
+			t.Errorf("answers hold SOA serials %s, want 2", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("secondary received no NOTIFY")
+	}
+
+	// A NOTIFY sent to the server itself is not something it handles
+	query := dnsmsg.NewQuery("example.test.", dnsmsg.RecordTypeSOA)
+	query.Header.OPCODE = dnsmsg.OpcodeNotify
+
+	if resp := respondTo(t, s, query, "udp"); resp.Header.RCODE != dnsmsg.ResponseCodeNotImplemented {
+		t.Errorf("RCODE = %s, want NOTIMP", dnsmsg.ResponseCodeToStrMap[resp.Header.RCODE])
+	}
+}
+
+// An IXFR whose SOA record arrives without RDATA does not give a serial
+func TestTransferIXFREmptySOA(t *testing.T) {
+	s := newTestServer(t)
+
+	query := dnsmsg.NewQuery("example.test.", dnsmsg.RecordTypeIXFR)
+	query.Authority = []dnsmsg.RR{{
+		NAME:  "example.test.",
+		TYPE:  dnsmsg.RecordTypeSOA,
+		CLASS: dnsmsg.RecordClassWildcard,
+		RDATA: &dnsmsg.RDataEmpty{},
+	}}
+
+	if resp := respondTo(t, s, query, "tcp"); resp.Header.RCODE != dnsmsg.ResponseCodeFormatError {
+		t.Errorf("RCODE = %s, want FORMERR", dnsmsg.ResponseCodeToStrMap[resp.Header.RCODE])
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// verifyTSIG checks the signature of a query when it carries one, returning
+// the key it was signed with and its MAC so the response can be signed in
+// turn. When the signature cannot be verified the TSIG error to report is
+// returned instead, or FORMERR when the TSIG record is malformed, see RFC 8945
+// section 5.2.
+func (s *Server) verifyTSIG(query *dnsmsg.Message, data []byte) (*dnsmsg.TSIGKey, []byte, dnsmsg.ResponseCode) {
+	n := len(query.Additional)
+	if n == 0 || query.Additional[n-1].TYPE != dnsmsg.RecordTypeTSIG {
+		return nil, nil, dnsmsg.ResponseCodeNoError
+	}
+
+	rr := query.Additional[n-1]
+	rdata, ok := rr.RDATA.(*dnsmsg.RDataTSIG)
+	if !ok {
+		return nil, nil, dnsmsg.ResponseCodeFormatError
+	}
+
+	key := s.findKey(rr.NAME, rdata.Algorithm())
+	if key == nil {
+		// The key is unknown so the response can only name it
+		return &dnsmsg.TSIGKey{Name: rr.NAME, Algorithm: rdata.Algorithm()}, nil, dnsmsg.ResponseCodeBadKey
+	}
+
+	mac, err := key.Verify(data, nil)
+
+	switch err {
+	case nil:
+		return key, mac, dnsmsg.ResponseCodeNoError
+	case dnsmsg.ErrTSIGBadTime:
+		// The MAC checked out so the response is signed over it
+		return key, rdata.MAC(), dnsmsg.ResponseCodeBadTime
+	default:
+		return key, nil, dnsmsg.ResponseCodeBadSig
+	}
+}
+
+// findKey returns the key with the given name and algorithm or nil if the
+// server does not have it
+func (s *Server) findKey(name, algorithm string) *dnsmsg.TSIGKey {
+	for _, key := range s.Keys {
+		if strings.EqualFold(key.Name, dnsmsg.Fqdn(name)) && strings.EqualFold(key.Algorithm, algorithm) {
+			return key
+		}
+	}
+
+	return nil
+}
+
+// rejectTSIG encodes a NOT AUTHORITATIVE response to a query whose signature
+// could not be verified, with a TSIG record holding the reason
+func rejectTSIG(query *dnsmsg.Message, key *dnsmsg.TSIGKey, requestMAC []byte, code dnsmsg.ResponseCode) []byte {
+	respBytes := errorResponse(query, dnsmsg.ResponseCodeNotAuth)
+
+	signed, err := key.SignError(respBytes, requestMAC, code)
+	if err != nil {
+		return respBytes
+	}
+
+	return signed
+}
+
+// isTransfer reports if a query asks for a zone transfer
+func isTransfer(query *dnsmsg.Message) bool {
+	for _, q := range query.Questions {
+		if q.QTYPE == dnsmsg.RecordTypeAXFR || q.QTYPE == dnsmsg.RecordTypeIXFR {
+			return true
+		}
+	}
+
+	return false
+}
+
+// errorResponse encodes a response to a query holding just the question and
+// the response code
+func errorResponse(query *dnsmsg.Message, rcode dnsmsg.ResponseCode) []byte {
+	resp := &dnsmsg.Message{
+		Header: dnsmsg.Header{
+			ID:     query.Header.ID,
+			QR:     dnsmsg.QRTypeResponse,
+			OPCODE: query.Header.OPCODE,
+			RCODE:  rcode,
+		},
+		Questions: query.Questions,
+	}
+
+	respBytes, _ := resp.Encode()
+
+	return respBytes
+}
+
+// signResponses signs each message of the response to a signed query. The
+// messages after the first carry on from the signature before them.
+func (s *Server) signResponses(msgs [][]byte, key *dnsmsg.TSIGKey, requestMAC []byte) [][]byte {
+	stream := dnsmsg.NewTSIGStream(key, requestMAC)
+	signed := make([][]byte, 0, len(msgs))
+
+	for _, msg := range msgs {
+		signedMsg, err := stream.Sign(msg)
+		if err != nil {
+			s.logf("Failed to sign response with TSIG key %s: %v", key.Name, err)
+			return nil
+		}
+
+		signed = append(signed, signedMsg)
+	}
+
+	return signed
+}
+
+// tsigSize is how many octets signing a message with key adds to it
+func tsigSize(key *dnsmsg.TSIGKey) int {
+	header, _ := dnsmsg.Header{}.Encode()
+
+	signed, _, err := key.Sign(header, nil)
+	if err != nil {
+		return 0
+	}
+
+	return len(signed) - len(header)
+}
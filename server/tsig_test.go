@@ -0,0 +1,139 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// signQuery encodes and signs a query, returning the signed query and its MAC
+func signQuery(t *testing.T, key *dnsmsg.TSIGKey, query *dnsmsg.Message) ([]byte, []byte) {
+	t.Helper()
+
+	data, err := query.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, mac, err := key.Sign(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed, mac
+}
+
+func TestRespondTSIG(t *testing.T) {
+	key, err := dnsmsg.NewTSIGKey("transfer-key", dnsmsg.HmacSHA256, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrongSecret, err := dnsmsg.NewTSIGKey("transfer-key", dnsmsg.HmacSHA256, []byte("guess"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknown, err := dnsmsg.NewTSIGKey("other-key", dnsmsg.HmacSHA256, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer(t)
+	s.Keys = []*dnsmsg.TSIGKey{key}
+
+	tests := []struct {
+		name    string
+		signer  *dnsmsg.TSIGKey
+		tsigErr dnsmsg.ResponseCode
+	}{
+		{"signed", key, dnsmsg.ResponseCodeNoError},
+		{"bad signature", wrongSecret, dnsmsg.ResponseCodeBadSig},
+		{"unknown key", unknown, dnsmsg.ResponseCodeBadKey},
+	}
+
+	for _, tt := range tests {
+		data, requestMAC := signQuery(t, tt.signer, dnsmsg.NewQuery("www.example.test.", dnsmsg.RecordTypeA))
+
+		msgs := s.respond(data, "udp")
+		if len(msgs) != 1 {
+			t.Fatalf("%s: got %d responses, want 1", tt.name, len(msgs))
+		}
+
+		resp := new(dnsmsg.Message)
+		if _, err := dnsmsg.DecodeMessage(msgs[0], resp); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := tt.signer.Verify(msgs[0], requestMAC)
+
+		if tt.tsigErr == dnsmsg.ResponseCodeNoError {
+			if err != nil || resp.Header.RCODE != dnsmsg.ResponseCodeNoError || len(resp.Answers) != 1 {
+				t.Errorf("%s: RCODE %d with %d answers and signature error %v, want a signed answer", tt.name, resp.Header.RCODE, len(resp.Answers), err)
+			}
+
+			continue
+		}
+
+		if resp.Header.RCODE != dnsmsg.ResponseCodeNotAuth {
+			t.Errorf("%s: RCODE = %s, want NOTAUTH", tt.name, dnsmsg.ResponseCodeToStrMap[resp.Header.RCODE])
+		}
+
+		if tsigErr, ok := err.(*dnsmsg.TSIGError); !ok || tsigErr.Code != tt.tsigErr {
+			t.Errorf("%s: Verify of the response = %v, want TSIG error %d", tt.name, err, tt.tsigErr)
+		}
+	}
+}
+
+func TestRespondTSIGTransfer(t *testing.T) {
+	key, err := dnsmsg.NewTSIGKey("transfer-key", dnsmsg.HmacSHA256, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer(t)
+	s.Keys = []*dnsmsg.TSIGKey{key}
+
+	query := dnsmsg.NewQuery("example.test.", dnsmsg.RecordTypeAXFR)
+
+	// Transfers must be signed once the server has keys
+	if resp := respondTo(t, s, query, "tcp"); resp.Header.RCODE != dnsmsg.ResponseCodeRefused {
+		t.Errorf("unsigned AXFR answered with %s, want REFUSED", dnsmsg.ResponseCodeToStrMap[resp.Header.RCODE])
+	}
+
+	data, requestMAC := signQuery(t, key, query)
+
+	msgs := s.respond(data, "tcp")
+	if len(msgs) == 0 {
+		t.Fatal("got no response to the signed AXFR")
+	}
+
+	stream := dnsmsg.NewTSIGStream(key, requestMAC)
+
+	for i, msg := range msgs {
+		if err := stream.Verify(msg); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+
+	if err := stream.Done(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A TSIG record without TSIG RDATA is malformed rather than badly signed
+func TestRespondEmptyTSIG(t *testing.T) {
+	s := newTestServer(t)
+
+	query := dnsmsg.NewQuery("www.example.test.", dnsmsg.RecordTypeA)
+	query.Additional = append(query.Additional, dnsmsg.RR{
+		NAME:  "key.example.test.",
+		TYPE:  dnsmsg.RecordTypeTSIG,
+		CLASS: dnsmsg.RecordClassWildcard,
+		RDATA: &dnsmsg.RDataEmpty{},
+	})
+
+	if resp := respondTo(t, s, query, "udp"); resp.Header.RCODE != dnsmsg.ResponseCodeFormatError {
+		t.Errorf("RCODE = %s, want FORMERR", dnsmsg.ResponseCodeToStrMap[resp.Header.RCODE])
+	}
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// Zone holds the records a server is authoritative for below an origin
+type Zone struct {
+	// The fully qualified domain name at the top of the zone
+	Origin string
+
+	// records in the order they were given
+	rrs []dnsmsg.RR
+
+	// records indexed by their lowercased owner name
+	records map[string][]dnsmsg.RR
+
+	// every name in the zone, including the empty non-terminals between the
+	// origin and the owner names which hold no records of their own
+	names map[string]bool
+
+	// the owners of the NSEC records in canonical order, or the NSEC3 hashes
+	// in order along with the parameters they were made with, when the zone
+	// is signed
+	nsecOwners  []string
+	nsec3       []nsec3Entry
+	nsec3Params *dnsmsg.RDataNSEC3
+}
+
+// NewZone creates a Zone from its records. Every record must fall under the
+// origin and there must be a single SOA record at the origin.
+func NewZone(origin string, rrs []dnsmsg.RR) (*Zone, error) {
+	z := &Zone{
+		Origin:  canonicalName(origin),
+		records: make(map[string][]dnsmsg.RR),
+		names:   make(map[string]bool),
+	}
+
+	for _, rr := range rrs {
+		owner := canonicalName(rr.NAME)
+
+		if !dnsmsg.IsSubDomain(z.Origin, owner) {
+			return nil, fmt.Errorf("Record owned by %s is outside of zone %s", rr.NAME, z.Origin)
+		}
+
+		z.rrs = append(z.rrs, rr)
+		z.records[owner] = append(z.records[owner], rr)
+
+		for _, name := range ancestors(z.Origin, owner) {
+			z.names[name] = true
+		}
+	}
+
+	if soas := filterType(z.records[z.Origin], dnsmsg.RecordTypeSOA); len(soas) != 1 {
+		return nil, fmt.Errorf("Zone %s must have exactly one SOA record at its origin, found %d", z.Origin, len(soas))
+	}
+
+	z.indexDenial()
+
+	return z, nil
+}
+
+// LoadZoneFile reads a zone from a master file. Relative names in the file are
+// completed with origin. When origin is empty, names must be fully qualified
+// or follow a $ORIGIN directive and the owner of the SOA record in the file is
+// used as the origin of the zone.
+func LoadZoneFile(path, origin string) (*Zone, error) {
+	rrs, err := dnsmsg.ParseZoneFile(path, origin)
+	if err != nil {
+		return nil, err
+	}
+
+	if origin == "" {
+		for _, rr := range rrs {
+			if rr.TYPE == dnsmsg.RecordTypeSOA {
+				origin = rr.NAME
+				break
+			}
+		}
+	}
+
+	if origin == "" {
+		return nil, fmt.Errorf("%s: no SOA record found to take the origin from", path)
+	}
+
+	return NewZone(origin, rrs)
+}
+
+// SOA returns the SOA record at the origin of the zone
+func (z *Zone) SOA() dnsmsg.RR {
+	return filterType(z.records[z.Origin], dnsmsg.RecordTypeSOA)[0]
+}
+
+// Serial returns the serial number of the version of the zone
+func (z *Zone) Serial() uint32 {
+	return z.SOA().RDATA.(*dnsmsg.RDataSOA).Serial()
+}
+
+// isOrigin checks if name is the origin of the zone
+func (z *Zone) isOrigin(name string) bool {
+	return canonicalName(name) == z.Origin
+}
+
+// Records returns every record in the zone in the order they were given
+func (z *Zone) Records() []dnsmsg.RR {
+	return z.rrs
+}
+
+// Lookup returns the records owned by name
+func (z *Zone) Lookup(name string) []dnsmsg.RR {
+	return z.records[canonicalName(name)]
+}
+
+// canonicalName lowercases a name and makes it fully qualified so it can be
+// used as a key
+func canonicalName(name string) string {
+	return strings.ToLower(dnsmsg.Fqdn(name))
+}
+
+// ancestors returns the names from the one directly below origin down to and
+// including name. The origin itself is included first.
+func ancestors(origin, name string) []string {
+	below := dnsmsg.CountLabels(name) - dnsmsg.CountLabels(origin)
+	if below < 0 {
+		below = 0
+	}
+
+	names := make([]string, below+1)
+	names[0] = origin
+
+	for i := below; i > 0; i-- {
+		names[i] = name
+		name = dnsmsg.ParentName(name)
+	}
+
+	return names
+}
+
+// wildcardOf returns the name of the wildcard directly below name
+func wildcardOf(name string) string {
+	if name == "." {
+		return "*."
+	}
+
+	return "*." + name
+}
+
+// filterType returns the records of type typ
+func filterType(rrs []dnsmsg.RR, typ dnsmsg.RecordType) []dnsmsg.RR {
+	var filtered []dnsmsg.RR
+
+	for _, rr := range rrs {
+		if rr.TYPE == typ {
+			filtered = append(filtered, rr)
+		}
+	}
+
+	return filtered
+}
+
+// signaturesFor returns the RRSIG records among rrs which cover the records of
+// type typ
+func signaturesFor(rrs []dnsmsg.RR, typ dnsmsg.RecordType) []dnsmsg.RR {
+	var sigs []dnsmsg.RR
+
+	for _, rr := range rrs {
+		if sig, ok := rr.RDATA.(*dnsmsg.RDataRRSIG); ok && sig.TypeCovered() == typ {
+			sigs = append(sigs, rr)
+		}
+	}
+
+	return sigs
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// sigTimeLayout is the YYYYMMDDHHmmSS form signature times may be given in
+const sigTimeLayout = "20060102150405"
+
+// runSign signs a zone file with the keys given, adding an NSEC or NSEC3 chain
+// and the RRSIG records over each RRset, and writes out the signed zone. With
+// -generate a new key for the zone is written to a pair of key files instead.
+func runSign(args []string) {
+	var keyFiles repeatedFlag
+
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	zoneFile := fs.String("zone", "", "Zone file to sign.")
+	origin := fs.String("origin", "", "Name of the zone. This is required.")
+	fs.Var(&keyFiles, "key", "Key file written by dnssec-keygen or -generate, with or without the .key or .private extension. Can be repeated.")
+	output := fs.String("o", "-", "File to write the signed zone to. Standard output is used when \"-\".")
+	inception := fs.String("inception", "-1h", "Start of the validity period of the signatures, as YYYYMMDDHHmmSS in UTC or relative to now such as -1h.")
+	expiration := fs.String("expiration", "+720h", "End of the validity period of the signatures, as YYYYMMDDHHmmSS in UTC or relative to now such as +720h.")
+	useNSEC3 := fs.Bool("nsec3", false, "Prove names do not exist with an NSEC3 chain instead of NSEC records.")
+	iterations := fs.Uint("iterations", 0, "Extra iterations of the NSEC3 hash. RFC 9276 recommends none.")
+	salt := fs.String("salt", "-", "NSEC3 salt in hex. No salt is used when \"-\".")
+	optOut := fs.Bool("opt-out", false, "Leave delegations without DS records out of the NSEC3 chain. Implies -nsec3.")
+	generate := fs.String("generate", "", "Generate a key for the zone with this algorithm, such as ECDSAP256SHA256, instead of signing.")
+	ksk := fs.Bool("ksk", false, "Make the key created by -generate a key signing key.")
+	keyDir := fs.String("key-dir", ".", "Directory the key files created by -generate are written to.")
+	fs.Parse(args)
+
+	if *origin == "" {
+		log.Fatalf("error: %v", "'origin' is required")
+	}
+
+	if *generate != "" {
+		generateKey(*origin, *generate, *ksk, *keyDir)
+		return
+	}
+
+	if *zoneFile == "" || len(keyFiles) == 0 {
+		log.Fatalf("error: %v", "'zone' and at least one 'key' are required")
+	}
+
+	opts := dnsmsg.SignOptions{
+		NSEC3:  *useNSEC3 || *optOut,
+		OptOut: *optOut,
+	}
+
+	var err error
+
+	if opts.Inception, err = parseSignTime(*inception); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	if opts.Expiration, err = parseSignTime(*expiration); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	if !opts.Expiration.After(opts.Inception) {
+		log.Fatalf("error: %v", "the signatures would expire before their inception")
+	}
+
+	if *iterations > 0xffff {
+		log.Fatalf("error: %v", "'iterations' must fit in 16 bits")
+	}
+
+	opts.Iterations = uint16(*iterations)
+
+	if *salt != "-" {
+		if opts.Salt, err = hex.DecodeString(*salt); err != nil || len(opts.Salt) > 255 {
+			log.Fatalf("error: invalid salt '%s'", *salt)
+		}
+	}
+
+	var keys []*dnsmsg.SigningKey
+
+	for _, path := range keyFiles {
+		key, err := dnsmsg.LoadSigningKey(path)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	rrs, err := dnsmsg.ParseZoneFile(*zoneFile, dnsmsg.Fqdn(*origin))
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	signed, err := dnsmsg.SignZone(*origin, rrs, keys, opts)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	out := os.Stdout
+
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+
+		defer f.Close()
+		out = f
+	}
+
+	if err := dnsmsg.WriteZone(out, *origin, signed); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	// The parent zone needs the DS records of the keys signing the DNSKEY
+	// RRset to complete the chain of trust, which are every key when none
+	// are key signing keys
+	hasKSK := false
+	for _, key := range keys {
+		hasKSK = hasKSK || key.IsKSK()
+	}
+
+	for _, key := range keys {
+		if key.IsKSK() || !hasKSK {
+			printDS(key)
+		}
+	}
+}
+
+// generateKey creates a key for a zone and writes it to a pair of key files,
+// printing the path they share
+func generateKey(origin, algorithmName string, ksk bool, dir string) {
+	algorithm, err := dnsmsg.ParseDNSSECAlgorithm(algorithmName)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	flags := dnsmsg.DNSKEYFlagZone
+	if ksk {
+		flags |= dnsmsg.DNSKEYFlagSEP
+	}
+
+	key, err := dnsmsg.GenerateSigningKey(origin, algorithm, flags)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	base, err := key.WriteFiles(dir)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	fmt.Println(base)
+
+	if ksk {
+		printDS(key)
+	}
+}
+
+// printDS writes the DS record referring to a key to standard error so it
+// stays out of the signed zone
+func printDS(key *dnsmsg.SigningKey) {
+	ds, err := key.DS(dnsmsg.DigestTypeSHA256)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s %d IN DS %s\n", ds.NAME, ds.TTL, ds.RDATA)
+}
+
+// parseSignTime reads a signature time given either as YYYYMMDDHHmmSS in UTC
+// or as a duration relative to now starting with a sign
+func parseSignTime(s string) (time.Time, error) {
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid signature time '%s'", s)
+		}
+
+		return time.Now().Add(d), nil
+	}
+
+	t, err := time.Parse(sigTimeLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid signature time '%s'", s)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+	"github.com/dansackett/dns-client/resolver"
+)
+
+// runTrace resolves the domain iteratively from the root servers rather than
+// asking a recursive server, printing every delegation followed on the way.
+func runTrace(domain string, recordType dnsmsg.RecordType) {
+	r := resolver.New()
+	r.Timeout = *timeoutFlagVal
+	r.Retries = *retriesFlagVal
+	r.Port = *tracePortFlagVal
+
+	if *rootServersFlagVal != "" {
+		r.Roots = nil
+
+		for _, addr := range strings.Split(*rootServersFlagVal, ",") {
+			addr = strings.TrimSpace(addr)
+			r.Roots = append(r.Roots, resolver.NameServer{Name: addr, Addr: addr})
+		}
+	}
+
+	var lastStep resolver.Step
+
+	r.Trace = func(step resolver.Step) {
+		fmt.Println(step)
+		lastStep = step
+	}
+
+	startQueryTime := time.Now()
+	msg, err := r.Resolve(context.Background(), domain, recordType)
+
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	fmt.Println(dnsmsg.Format(msg, dnsmsg.QueryInfo{
+		Server:    lastStep.Server.Addr,
+		QueryTime: time.Since(startQueryTime),
+		When:      time.Now(),
+	}))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/dansackett/dns-client/dnsclient"
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// runTransfer transfers the whole zone from the server and prints its records
+// either as text or as a zone file which can be served again.
+func runTransfer(client *dnsclient.Client, zone string) {
+	rrs, info, err := client.AXFR(context.Background(), zone)
+
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	if *formatFlagVal == "zone" {
+		if err := dnsmsg.WriteZone(os.Stdout, zone, rrs); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+
+		return
+	}
+
+	fmt.Printf("\n> [ Simple DNS Client ] >>> %s AXFR\n\n", dnsmsg.Fqdn(zone))
+
+	for _, rr := range rrs {
+		fmt.Println(rr.String())
+	}
+
+	fmt.Printf("\n> Records: %d", len(rrs))
+	fmt.Println(info)
+}
+
+// runIncrementalTransfer asks the server for the changes made to the zone
+// since the version with the given serial and prints them as a diff. Servers
+// which send the whole zone instead have it printed as for AXFR.
+func runIncrementalTransfer(client *dnsclient.Client, zone string, serial uint32) {
+	result, info, err := client.IXFR(context.Background(), zone, serial)
+
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	current := result.SOA.RDATA.(*dnsmsg.RDataSOA).Serial()
+
+	if result.Full && *formatFlagVal == "zone" {
+		if err := dnsmsg.WriteZone(os.Stdout, zone, result.Zone); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+
+		return
+	}
+
+	fmt.Printf("\n> [ Simple DNS Client ] >>> %s IXFR from serial %d\n", dnsmsg.Fqdn(zone), serial)
+
+	switch {
+	case result.Full:
+		fmt.Printf("\n> The server sent the whole zone at serial %d:\n\n", current)
+
+		for _, rr := range result.Zone {
+			fmt.Println(rr.String())
+		}
+
+	case len(result.Diffs) == 0:
+		fmt.Printf("\n> The zone is up to date at serial %d\n", current)
+
+	default:
+		for _, diff := range result.Diffs {
+			fmt.Printf("\n> Serial %d -> %d\n", diff.FromSerial, diff.ToSerial)
+
+			for _, rr := range diff.Deleted {
+				fmt.Printf("- %s\n", rr.String())
+			}
+
+			for _, rr := range diff.Added {
+				fmt.Printf("+ %s\n", rr.String())
+			}
+		}
+	}
+
+	fmt.Println(info)
+}
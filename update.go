@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/dansackett/dns-client/dnsclient"
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// runUpdate sends the dynamic updates described in a batch file to the primary
+// server of a zone, printing the response to each one. The batch file holds
+// one command per line in the style of nsupdate:
+//
+//     zone example.com.
+//     prereq nxdomain new.example.com.
+//     update add new.example.com. 300 IN A 192.0.2.10
+//     update delete old.example.com. A
+//     send
+func runUpdate(args []string) {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	serverAddr := fs.String("server-addr", "127.0.0.1:53", "IP and Port of the primary server for the zone.")
+	batchFile := fs.String("file", "-", "Batch file of update commands. Standard input is read when \"-\".")
+	timeout := fs.Duration("timeout", dnsclient.DefaultTimeout, "How long to wait for a response before retrying.")
+	useTCP := fs.Bool("tcp", false, "Send the updates over TCP instead of UDP.")
+	keyStr := fs.String("key", "", "TSIG key to sign the updates with as name:algorithm:secret, with the secret in base64.")
+	keyFile := fs.String("key-file", "", "File holding the TSIG key to sign the updates with.")
+	fs.Parse(args)
+
+	key, err := loadTSIGKey(*keyStr, *keyFile)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	r := os.Stdin
+
+	if *batchFile != "-" {
+		f, err := os.Open(*batchFile)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+
+		defer f.Close()
+		r = f
+	}
+
+	updates, err := parseUpdateBatch(r)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	client := dnsclient.New(*serverAddr)
+	client.Timeout = *timeout
+	client.ForceTCP = *useTCP
+	client.TSIG = key
+
+	failed := false
+
+	for _, m := range updates {
+		resp, info, err := client.ExchangeWithInfo(context.Background(), m)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+
+		fmt.Println(dnsmsg.Format(resp, info))
+
+		if resp.ResponseCode() != dnsmsg.ResponseCodeNoError {
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// parseUpdateBatch reads the UPDATE messages described by a batch file. Each
+// message is sent when a send command is reached or the file ends. Names which
+// are not fully qualified are relative to the zone.
+func parseUpdateBatch(r io.Reader) ([]*dnsmsg.Message, error) {
+	var updates []*dnsmsg.Message
+	var m *dnsmsg.Message
+
+	zone := ""
+	scanner := bufio.NewScanner(r)
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+
+		fields, err := dnsmsg.SplitZoneFields(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		command := strings.ToLower(fields[0])
+
+		switch command {
+		case "zone":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: Zone expects a single name", lineNum)
+			}
+
+			if m != nil {
+				return nil, fmt.Errorf("line %d: Send the pending update before changing zone", lineNum)
+			}
+
+			zone = dnsmsg.Fqdn(fields[1])
+
+		case "send":
+			if m != nil {
+				updates = append(updates, m)
+				m = nil
+			}
+
+		case "prereq", "update":
+			if zone == "" {
+				return nil, fmt.Errorf("line %d: No zone given before the first %s", lineNum, command)
+			}
+
+			if m == nil {
+				m = dnsmsg.NewUpdate(zone)
+			}
+
+			// Records are handed to the zone parser exactly as written
+			_, args := cutField(line)
+
+			if command == "prereq" {
+				err = addPrerequisite(m, zone, fields[1:], args)
+			} else {
+				err = addUpdate(m, zone, fields[1:], args)
+			}
+
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+
+		default:
+			return nil, fmt.Errorf("line %d: Unknown command '%s'", lineNum, fields[0])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if m != nil {
+		updates = append(updates, m)
+	}
+
+	return updates, nil
+}
+
+// addPrerequisite adds the prerequisite described by one of the forms below.
+// The fields are those of args, which holds the text of the prerequisite.
+//
+//     nxdomain <name>
+//     yxdomain <name>
+//     nxrrset <name> [class] <type>
+//     yxrrset <name> [class] <type> [<rdata>]
+func addPrerequisite(m *dnsmsg.Message, zone string, fields []string, args string) error {
+	if len(fields) < 2 {
+		return errors.New("Prereq expects a condition and a name")
+	}
+
+	condition := strings.ToLower(fields[0])
+	name := qualifyName(fields[1], zone)
+	rest := skipClass(fields[2:])
+
+	switch {
+	case condition == "nxdomain" && len(rest) == 0:
+		m.NameNotInUse(name)
+
+	case condition == "yxdomain" && len(rest) == 0:
+		m.NameInUse(name)
+
+	case condition == "nxrrset" && len(rest) == 1:
+		typ, err := dnsmsg.ParseRecordType(rest[0])
+		if err != nil {
+			return err
+		}
+
+		m.RRsetNotExists(name, typ)
+
+	case condition == "yxrrset" && len(rest) == 1:
+		typ, err := dnsmsg.ParseRecordType(rest[0])
+		if err != nil {
+			return err
+		}
+
+		m.RRsetExists(name, typ)
+
+	case condition == "yxrrset" && len(rest) > 1:
+		_, record := cutField(args)
+
+		rr, err := dnsmsg.ParseRRWithOrigin(record, zone)
+		if err != nil {
+			return err
+		}
+
+		m.RRsetExistsWithData(rr)
+
+	default:
+		return fmt.Errorf("Invalid prerequisite '%s'", strings.TrimSpace(args))
+	}
+
+	return nil
+}
+
+// addUpdate adds the update described by one of the forms below. The fields
+// are those of args, which holds the text of the update.
+//
+//     add <name> [ttl] [class] <type> <rdata>
+//     delete <name>
+//     delete <name> [class] <type>
+//     delete <name> [class] <type> <rdata>
+func addUpdate(m *dnsmsg.Message, zone string, fields []string, args string) error {
+	if len(fields) < 2 {
+		return errors.New("Update expects add or delete and a name")
+	}
+
+	action := strings.ToLower(fields[0])
+	name := qualifyName(fields[1], zone)
+	rest := skipClass(fields[2:])
+
+	_, record := cutField(args)
+
+	switch {
+	case action == "add":
+		rr, err := dnsmsg.ParseRRWithOrigin(record, zone)
+		if err != nil {
+			return err
+		}
+
+		m.Insert(rr)
+
+	case action == "delete" && len(rest) == 0:
+		m.RemoveName(name)
+
+	case action == "delete" && len(rest) == 1:
+		typ, err := dnsmsg.ParseRecordType(rest[0])
+		if err != nil {
+			return err
+		}
+
+		m.RemoveRRset(name, typ)
+
+	case action == "delete":
+		rr, err := dnsmsg.ParseRRWithOrigin(record, zone)
+		if err != nil {
+			return err
+		}
+
+		m.Remove(rr)
+
+	default:
+		return fmt.Errorf("Unknown update '%s', expected add or delete", fields[0])
+	}
+
+	return nil
+}
+
+// cutField splits the first field from a line, returning the rest of the
+// line exactly as written. It is only used to skip keywords, which never hold
+// quotes or escapes.
+func cutField(line string) (string, string) {
+	line = strings.TrimLeft(line, " \t")
+
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		return line[:i], line[i:]
+	}
+
+	return line, ""
+}
+
+// skipClass drops a leading IN class which may be given ahead of the type
+func skipClass(fields []string) []string {
+	if len(fields) > 0 && strings.EqualFold(fields[0], "IN") {
+		return fields[1:]
+	}
+
+	return fields
+}
+
+// qualifyName completes a name relative to the zone
+func qualifyName(name, zone string) string {
+	switch {
+	case name == "@":
+		return zone
+	case strings.HasSuffix(name, "."):
+		return name
+	default:
+		return name + "." + zone
+	}
+}
+
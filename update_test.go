@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// describeRRs lists records in the order given, one field per column
+func describeRRs(rrs []dnsmsg.RR) []string {
+	var s []string
+
+	for _, rr := range rrs {
+		s = append(s, strings.TrimSpace(fmt.Sprintf("%s %d %s %s %s", rr.NAME, rr.TTL,
+			dnsmsg.RecordClassToStrMap[rr.CLASS], dnsmsg.RecordTypeString(rr.TYPE), rr.RDATA)))
+	}
+
+	return s
+}
+
+func TestParseUpdateBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		batch   string
+		prereqs []string
+		updates []string
+	}{
+		{"nxdomain", "prereq nxdomain new", []string{`new.example.com. 0 NONE ANY \# 0`}, nil},
+		{"yxdomain", "prereq yxdomain www.example.com.", []string{`www.example.com. 0 * ANY \# 0`}, nil},
+		{"nxrrset", "prereq nxrrset www IN AAAA", []string{`www.example.com. 0 NONE AAAA \# 0`}, nil},
+		{"yxrrset", "prereq yxrrset www A", []string{`www.example.com. 0 * A \# 0`}, nil},
+		{"yxrrset with data", "prereq yxrrset www 300 IN A 192.0.2.1",
+			[]string{"www.example.com. 0 IN A 192.0.2.1"}, nil},
+
+		{"add", "update add new 300 IN A 192.0.2.10", nil, []string{"new.example.com. 300 IN A 192.0.2.10"}},
+		{"add at the origin", "update add @ 300 MX 10 mail", nil, []string{"example.com. 300 IN MX 10 mail.example.com."}},
+		{"delete name", "update delete old", nil, []string{`old.example.com. 0 * ANY \# 0`}},
+		{"delete RRset", "update delete old A", nil, []string{`old.example.com. 0 * A \# 0`}},
+		{"delete RRset with class", "update delete old IN A", nil, []string{`old.example.com. 0 * A \# 0`}},
+		{"delete record", "update delete old IN A 192.0.2.9", nil, []string{"old.example.com. 0 NONE A 192.0.2.9"}},
+
+		// The text of a record reaches the zone parser as written
+		{"quoted TXT", `update add txt 300 TXT "two  spaces; not a comment"`, nil,
+			[]string{`txt.example.com. 300 IN TXT "two  spaces; not a comment"`}},
+		{"escaped quote in TXT", `update add txt 300 TXT "say \"hi\"; still text" ; comment`, nil,
+			[]string{`txt.example.com. 300 IN TXT "say \"hi\"; still text"`}},
+		{"delete quoted TXT", `update delete txt TXT "a;b"`, nil,
+			[]string{`txt.example.com. 0 NONE TXT "a;b"`}},
+		{"comment", "update delete old A ; remove the A records", nil, []string{`old.example.com. 0 * A \# 0`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updates, err := parseUpdateBatch(strings.NewReader("; batch\nzone example.com\n\n" + tt.batch + "\n"))
+			if err != nil {
+				t.Fatalf("parseUpdateBatch: %v", err)
+			}
+
+			if len(updates) != 1 {
+				t.Fatalf("got %d updates, want 1", len(updates))
+			}
+
+			m := updates[0]
+
+			if m.Header.OPCODE != dnsmsg.OpcodeUpdate || len(m.Questions) != 1 || m.Questions[0].QNAME != "example.com." {
+				t.Errorf("header %+v with zone %v, want an UPDATE of example.com.", m.Header, m.Questions)
+			}
+
+			if got := describeRRs(m.Answers); strings.Join(got, "\n") != strings.Join(tt.prereqs, "\n") {
+				t.Errorf("prerequisites = %q, want %q", got, tt.prereqs)
+			}
+
+			if got := describeRRs(m.Authority); strings.Join(got, "\n") != strings.Join(tt.updates, "\n") {
+				t.Errorf("updates = %q, want %q", got, tt.updates)
+			}
+		})
+	}
+}
+
+func TestParseUpdateBatchSend(t *testing.T) {
+	batch := `zone example.com.
+prereq nxdomain new
+update add new 300 IN A 192.0.2.10
+send
+send
+zone example.org.
+update delete old.example.org.
+`
+
+	updates, err := parseUpdateBatch(strings.NewReader(batch))
+	if err != nil {
+		t.Fatalf("parseUpdateBatch: %v", err)
+	}
+
+	// A send without anything pending sends nothing and the last update is
+	// sent at the end of the file
+	if len(updates) != 2 {
+		t.Fatalf("got %d updates, want 2", len(updates))
+	}
+
+	if updates[0].Questions[0].QNAME != "example.com." || len(updates[0].Answers) != 1 || len(updates[0].Authority) != 1 {
+		t.Errorf("first update = %v, want a prerequisite and an update for example.com.", updates[0])
+	}
+
+	if updates[1].Questions[0].QNAME != "example.org." || len(updates[1].Authority) != 1 {
+		t.Errorf("second update = %v, want a single update for example.org.", updates[1])
+	}
+}
+
+func TestParseUpdateBatchErrors(t *testing.T) {
+	tests := []struct {
+		batch string
+		line  int
+	}{
+		{"update add new 300 IN A 192.0.2.1", 1},
+		{"zone example.com\nzone", 2},
+		{"zone example.com\nprereq nxdomain new\nzone example.org", 3},
+		{"zone example.com\nlookup www", 2},
+		{"zone example.com\nprereq", 2},
+		{"zone example.com\nprereq exists www", 2},
+		{"zone example.com\nprereq nxdomain www A", 2},
+		{"zone example.com\nprereq nxrrset www BOGUS", 2},
+		{"zone example.com\nupdate add", 2},
+		{"zone example.com\nupdate replace www A 192.0.2.1", 2},
+		{"zone example.com\nupdate add www 300 IN A", 2},
+		{"zone example.com\nupdate add www 300 IN A 192.0.2.300", 2},
+		{"zone example.com\nupdate delete www BOGUS", 2},
+		{"zone example.com\n\nupdate add txt 300 TXT \"unterminated", 3},
+		{"zone example.com\nupdate add www 300 IN A ( 192.0.2.1", 2},
+	}
+
+	for _, tt := range tests {
+		_, err := parseUpdateBatch(strings.NewReader(tt.batch))
+		if err == nil {
+			t.Errorf("parseUpdateBatch(%q) succeeded", tt.batch)
+			continue
+		}
+
+		if want := fmt.Sprintf("line %d:", tt.line); !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("parseUpdateBatch(%q) error = %q, want it to start with %q", tt.batch, err, want)
+		}
+	}
+}
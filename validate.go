@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/dansackett/dns-client/dnsclient"
+	"github.com/dansackett/dns-client/dnsmsg"
+	"github.com/dansackett/dns-client/validator"
+)
+
+// runValidate checks the DNSSEC signatures of a response, asking the same
+// server for the keys needed to build the chain of trust, and prints the
+// outcome for each RRset. The exit status is 1 when the response is bogus.
+func runValidate(client *dnsclient.Client, msg *dnsmsg.Message) {
+	v := validator.New(client)
+
+	if *trustAnchorFlagVal != "" {
+		anchors, err := validator.LoadTrustAnchors(*trustAnchorFlagVal)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+
+		v.TrustAnchors = anchors
+	}
+
+	result := v.Validate(context.Background(), msg)
+
+	// Zone output is kept loadable so the outcome goes to standard error
+	out := os.Stdout
+	if *formatFlagVal == "zone" {
+		out = os.Stderr
+	}
+
+	fmt.Fprintln(out, result)
+
+	if result.Status == validator.StatusBogus {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,47 @@
+package validator
+
+import (
+	"errors"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// RootAnchors are the DS records of the root zone's key signing keys which
+// validation starts from by default. See
+// https://data.iana.org/root-anchors/root-anchors.xml
+var RootAnchors = []dnsmsg.RR{
+	mustParseRR(". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D"),
+	mustParseRR(". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16"),
+}
+
+// LoadTrustAnchors reads the DS and DNSKEY records held in a zone file to use
+// as trust anchors. Records of other types are ignored.
+func LoadTrustAnchors(path string) ([]dnsmsg.RR, error) {
+	rrs, err := dnsmsg.ParseZoneFile(path, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var anchors []dnsmsg.RR
+
+	for _, rr := range rrs {
+		if rr.TYPE == dnsmsg.RecordTypeDS || rr.TYPE == dnsmsg.RecordTypeDNSKEY {
+			anchors = append(anchors, rr)
+		}
+	}
+
+	if len(anchors) == 0 {
+		return nil, errors.New("No DS or DNSKEY records found to use as trust anchors")
+	}
+
+	return anchors, nil
+}
+
+func mustParseRR(s string) dnsmsg.RR {
+	rr, err := dnsmsg.ParseRR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return rr
+}
@@ -0,0 +1,606 @@
+package validator
+
+import (
+	"bytes"
+	"encoding/base32"
+	"fmt"
+	"strings"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// NSEC3 records with more iterations than this are treated as insecure since
+// checking them costs too much, see RFC 9276 section 3.2
+const maxNSEC3Iterations = 150
+
+// base32Hex presents NSEC3 hashes the way they appear in owner names
+var base32Hex = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// nsecRecord is an NSEC record along with its owner and the zone which signed
+// it
+type nsecRecord struct {
+	owner string
+	zone  string
+	rdata *dnsmsg.RDataNSEC
+}
+
+func (r nsecRecord) String() string {
+	return fmt.Sprintf("NSEC %s -> %s", r.owner, r.rdata.NextDomain())
+}
+
+// nsec3Record is an NSEC3 record along with the hash held in its owner name
+// and the zone which signed it
+type nsec3Record struct {
+	owner string
+	zone  string
+	hash  []byte
+	rdata *dnsmsg.RDataNSEC3
+}
+
+func (r nsec3Record) String() string {
+	return fmt.Sprintf("NSEC3 %s -> %s", strings.ToLower(base32Hex.EncodeToString(r.hash)),
+		strings.ToLower(base32Hex.EncodeToString(r.rdata.NextHashedOwner())))
+}
+
+// denial checks the proofs made by the NSEC and NSEC3 records of a response,
+// explaining which record proves what as it goes
+type denial struct {
+	nsec  []nsecRecord
+	nsec3 []nsec3Record
+	proof []string
+}
+
+// newDenial collects the NSEC and NSEC3 records of a response, validating
+// each RRset first. Records which are not secure cannot prove anything so the
+// status of the first one found is returned instead.
+func (s *session) newDenial(rrs []dnsmsg.RR) (*denial, Status, string) {
+	d := &denial{}
+
+	for _, set := range groupRRsets(rrs) {
+		if set.typ != dnsmsg.RecordTypeNSEC && set.typ != dnsmsg.RecordTypeNSEC3 {
+			continue
+		}
+
+		status, reason := s.validateRRset(set)
+		if status != StatusSecure {
+			return nil, status, fmt.Sprintf("%s %s is %s: %s", dnsmsg.RecordTypeString(set.typ), set.name, status, reason)
+		}
+
+		zone := dnsmsg.Fqdn(set.sigs[0].SignerName())
+
+		for _, rr := range set.records {
+			switch rdata := rr.RDATA.(type) {
+			case *dnsmsg.RDataNSEC:
+				d.nsec = append(d.nsec, nsecRecord{owner: dnsmsg.Fqdn(rr.NAME), zone: zone, rdata: rdata})
+			case *dnsmsg.RDataNSEC3:
+				hash, err := dnsmsg.HashedOwner(rr.NAME)
+				if err != nil {
+					return nil, StatusBogus, err.Error()
+				}
+
+				if rdata.Iterations() > maxNSEC3Iterations {
+					return nil, StatusInsecure, fmt.Sprintf("NSEC3 %s uses %d iterations, more than the %d which are checked", rr.NAME, rdata.Iterations(), maxNSEC3Iterations)
+				}
+
+				d.nsec3 = append(d.nsec3, nsec3Record{owner: dnsmsg.Fqdn(rr.NAME), zone: zone, hash: hash, rdata: rdata})
+			}
+		}
+	}
+
+	return d, StatusSecure, ""
+}
+
+// checkDenial checks the NSEC or NSEC3 records of a response prove what it
+// claims does not exist: the name for a NAME ERROR, the type for an empty
+// answer, and the name asked for when an answer was expanded from a wildcard.
+// The steps of the proof are returned along with its outcome, or nil when the
+// response has nothing to prove.
+func (s *session) checkDenial(resp *dnsmsg.Message) (Status, []string) {
+	q := resp.Questions[0]
+	sets := groupRRsets(resp.Answers)
+
+	// An alias leads the rest of the answer to the name it points to
+	name := dnsmsg.Fqdn(q.QNAME)
+	answered := q.QTYPE == dnsmsg.RecordTypeWildcard && len(sets) > 0
+
+	for i := 0; i <= len(sets) && !answered; i++ {
+		if findRRset(resp.Answers, name, q.QTYPE) != nil {
+			answered = true
+			break
+		}
+
+		cname := findRRset(resp.Answers, name, dnsmsg.RecordTypeCNAME)
+		if cname == nil {
+			break
+		}
+
+		target, ok := cname.records[0].RDATA.(*dnsmsg.RDataCNAME)
+		if !ok {
+			return StatusBogus, []string{fmt.Sprintf("the CNAME record of %s has no RDATA", name)}
+		}
+
+		name = dnsmsg.Fqdn(target.Domain())
+	}
+
+	var nameError, noData bool
+	var referral string
+
+	switch {
+	case resp.ResponseCode() == dnsmsg.ResponseCodeNameError:
+		nameError = true
+	case answered:
+	case findRRsetOfType(resp.Authority, dnsmsg.RecordTypeSOA) != nil:
+		noData = true
+	case findRRsetOfType(resp.Authority, dnsmsg.RecordTypeDS) == nil:
+		// A referral without DS records has to prove the delegation is
+		// unsigned
+		if ns := findRRsetOfType(resp.Authority, dnsmsg.RecordTypeNS); ns != nil {
+			referral = ns.name
+		}
+	}
+
+	var wildcards []*rrset
+
+	for _, set := range sets {
+		if len(set.sigs) > 0 && int(set.sigs[0].Labels()) < dnsmsg.CountLabels(set.name) && !strings.HasPrefix(set.name, "*.") {
+			wildcards = append(wildcards, set)
+		}
+	}
+
+	if !nameError && !noData && referral == "" && len(wildcards) == 0 {
+		return StatusSecure, nil
+	}
+
+	d, status, reason := s.newDenial(resp.Authority)
+	if status != StatusSecure {
+		return status, []string{reason}
+	}
+
+	result := StatusSecure
+
+	for _, set := range wildcards {
+		// The labels the signature was made over are those of the wildcard's
+		// parent, which is the closest encloser of the name
+		encloser := set.name
+		for i := int(set.sigs[0].Labels()); i < dnsmsg.CountLabels(set.name); i++ {
+			encloser = dnsmsg.ParentName(encloser)
+		}
+
+		if status, reason := d.proveWildcardAnswer(set.name, encloser); status > result {
+			result = status
+			d.note("%s", reason)
+		}
+	}
+
+	switch {
+	case nameError:
+		status, reason = d.proveNameError(name)
+	case noData:
+		status, reason = d.proveNoData(name, q.QTYPE)
+	case referral != "":
+		status, reason = d.proveNoData(referral, dnsmsg.RecordTypeDS)
+	}
+
+	if status > result {
+		result = status
+		d.note("%s", reason)
+	}
+
+	return result, d.proof
+}
+
+// note records a step of the proof
+func (d *denial) note(format string, v ...interface{}) {
+	d.proof = append(d.proof, fmt.Sprintf(format, v...))
+}
+
+// proveNameError checks the name does not exist and that no wildcard could
+// have been used to answer for it instead
+func (d *denial) proveNameError(name string) (Status, string) {
+	switch {
+	case len(d.nsec3) > 0:
+		return d.nsec3NameError(name)
+	case len(d.nsec) > 0:
+		return d.nsecNameError(name)
+	default:
+		return StatusBogus, "no NSEC or NSEC3 records prove the name does not exist"
+	}
+}
+
+// proveNoData checks the name exists without records of type typ, either on
+// its own or through a wildcard
+func (d *denial) proveNoData(name string, typ dnsmsg.RecordType) (Status, string) {
+	switch {
+	case len(d.nsec3) > 0:
+		return d.nsec3NoData(name, typ)
+	case len(d.nsec) > 0:
+		return d.nsecNoData(name, typ)
+	default:
+		return StatusBogus, fmt.Sprintf("no NSEC or NSEC3 records prove there are no %s records", dnsmsg.RecordTypeString(typ))
+	}
+}
+
+// proveWildcardAnswer checks an answer expanded from the wildcard below
+// encloser was given for a name which does not exist
+func (d *denial) proveWildcardAnswer(name, encloser string) (Status, string) {
+	switch {
+	case len(d.nsec3) > 0:
+		return d.nsec3WildcardAnswer(name, encloser)
+	case len(d.nsec) > 0:
+		return d.nsecWildcardAnswer(name, encloser)
+	default:
+		return StatusBogus, fmt.Sprintf("no NSEC or NSEC3 records prove %s does not exist, which an answer from *.%s needs", name, trimRoot(encloser))
+	}
+}
+
+//-----------------------------------------------------------------------------
+// NSEC proofs, see RFC 4035 section 5.4
+//-----------------------------------------------------------------------------
+
+func (d *denial) nsecNameError(name string) (Status, string) {
+	cover := d.nsecCovering(name)
+	if cover == nil {
+		return StatusBogus, fmt.Sprintf("no NSEC record covers %s", name)
+	}
+
+	d.note("%s covers %s, so the name does not exist", cover, name)
+
+	wildcard := wildcardOf(cover.closestEncloser(name))
+
+	if match := d.nsecMatching(wildcard); match != nil {
+		return StatusBogus, fmt.Sprintf("%s shows %s exists, so it should have answered", match, wildcard)
+	}
+
+	wildcardCover := d.nsecCovering(wildcard)
+	if wildcardCover == nil {
+		return StatusBogus, fmt.Sprintf("no NSEC record proves the wildcard %s does not exist", wildcard)
+	}
+
+	d.note("%s covers %s, so no wildcard could answer instead", wildcardCover, wildcard)
+
+	return StatusSecure, ""
+}
+
+func (d *denial) nsecNoData(name string, typ dnsmsg.RecordType) (Status, string) {
+	if match := d.nsecMatching(name); match != nil {
+		if status, reason := checkTypes(match.String(), match.rdata.Types(), typ); status != StatusSecure {
+			return status, reason
+		}
+
+		d.note("%s matches %s and lists %s, so there are no %s records", match, name, typesString(match.rdata.Types()), dnsmsg.RecordTypeString(typ))
+
+		return StatusSecure, ""
+	}
+
+	cover := d.nsecCovering(name)
+	if cover == nil {
+		return StatusBogus, fmt.Sprintf("no NSEC record matches or covers %s", name)
+	}
+
+	// A name with no records of its own but names below it is an empty
+	// non-terminal, which falls between the previous name and the next
+	if next := cover.rdata.NextDomain(); dnsmsg.IsSubDomain(name, next) && !strings.EqualFold(next, name) {
+		d.note("%s covers %s and the next name is below it, so it is an empty non-terminal without records", cover, name)
+		return StatusSecure, ""
+	}
+
+	d.note("%s covers %s, so the name does not exist on its own", cover, name)
+
+	wildcard := wildcardOf(cover.closestEncloser(name))
+
+	match := d.nsecMatching(wildcard)
+	if match == nil {
+		return StatusBogus, fmt.Sprintf("no NSEC record matches the wildcard %s which the name would be answered from", wildcard)
+	}
+
+	if status, reason := checkTypes(match.String(), match.rdata.Types(), typ); status != StatusSecure {
+		return status, reason
+	}
+
+	d.note("%s matches the wildcard %s and lists %s, so there are no %s records", match, wildcard, typesString(match.rdata.Types()), dnsmsg.RecordTypeString(typ))
+
+	return StatusSecure, ""
+}
+
+func (d *denial) nsecWildcardAnswer(name, encloser string) (Status, string) {
+	cover := d.nsecCovering(name)
+	if cover == nil {
+		return StatusBogus, fmt.Sprintf("no NSEC record proves %s does not exist, which an answer from %s needs", name, wildcardOf(encloser))
+	}
+
+	d.note("%s covers %s, so the answer was rightly expanded from %s", cover, name, wildcardOf(encloser))
+
+	return StatusSecure, ""
+}
+
+// closestEncloser returns the longest name above name which exists, given
+// this record covers name. That is the longest name shared by name and either
+// end of the record.
+func (r nsecRecord) closestEncloser(name string) string {
+	encloser := commonAncestor(name, r.owner)
+
+	if next := commonAncestor(name, r.rdata.NextDomain()); dnsmsg.CountLabels(next) > dnsmsg.CountLabels(encloser) {
+		encloser = next
+	}
+
+	return encloser
+}
+
+// nsecMatching returns the NSEC record owned by name
+func (d *denial) nsecMatching(name string) *nsecRecord {
+	for i, r := range d.nsec {
+		if strings.EqualFold(r.owner, name) {
+			return &d.nsec[i]
+		}
+	}
+
+	return nil
+}
+
+// nsecCovering returns the NSEC record whose owner sorts before name and whose
+// next name sorts after it. The last record of a zone points back to the
+// origin so it covers every name after its owner.
+func (d *denial) nsecCovering(name string) *nsecRecord {
+	for i, r := range d.nsec {
+		if !dnsmsg.IsSubDomain(r.zone, name) {
+			continue
+		}
+
+		next := r.rdata.NextDomain()
+		afterOwner := dnsmsg.CompareNames(r.owner, name) < 0
+		beforeNext := dnsmsg.CompareNames(name, next) < 0
+
+		if dnsmsg.CompareNames(r.owner, next) < 0 {
+			if afterOwner && beforeNext {
+				return &d.nsec[i]
+			}
+		} else if afterOwner {
+			return &d.nsec[i]
+		}
+	}
+
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// NSEC3 proofs, see RFC 5155 section 8
+//-----------------------------------------------------------------------------
+
+func (d *denial) nsec3NameError(name string) (Status, string) {
+	encloser, nextCloser, cover, status, reason := d.closestEncloserProof(name)
+	if status != StatusSecure {
+		return status, reason
+	}
+
+	if nextCloser == "" {
+		return StatusBogus, fmt.Sprintf("an NSEC3 record matches %s, so the name exists", name)
+	}
+
+	wildcard := wildcardOf(encloser)
+
+	if match := d.nsec3Matching(wildcard); match != nil {
+		return StatusBogus, fmt.Sprintf("%s matches %s, so the wildcard should have answered", match, wildcard)
+	}
+
+	wildcardCover := d.nsec3Covering(wildcard)
+	if wildcardCover == nil {
+		return StatusBogus, fmt.Sprintf("no NSEC3 record proves the wildcard %s does not exist", wildcard)
+	}
+
+	d.note("%s covers the hash of %s, so no wildcard could answer instead", wildcardCover, wildcard)
+
+	// The hash of an unsigned delegation may fall within the gap
+	if cover.rdata.OptOut() {
+		return StatusInsecure, fmt.Sprintf("%s has the opt-out flag, so %s may be an unsigned delegation", cover, nextCloser)
+	}
+
+	return StatusSecure, ""
+}
+
+func (d *denial) nsec3NoData(name string, typ dnsmsg.RecordType) (Status, string) {
+	if match := d.nsec3Matching(name); match != nil {
+		if status, reason := checkTypes(match.String(), match.rdata.Types(), typ); status != StatusSecure {
+			return status, reason
+		}
+
+		d.note("%s matches the hash of %s and lists %s, so there are no %s records", match, name, typesString(match.rdata.Types()), dnsmsg.RecordTypeString(typ))
+
+		return StatusSecure, ""
+	}
+
+	encloser, nextCloser, cover, status, reason := d.closestEncloserProof(name)
+	if status != StatusSecure {
+		return status, reason
+	}
+
+	// Without a record of its own, a delegation is only left out of the
+	// chain when it is unsigned, see RFC 5155 section 8.6
+	if typ == dnsmsg.RecordTypeDS && strings.EqualFold(nextCloser, name) {
+		if !cover.rdata.OptOut() {
+			return StatusBogus, fmt.Sprintf("no NSEC3 record matches %s and %s does not have the opt-out flag", name, cover)
+		}
+
+		return StatusInsecure, fmt.Sprintf("%s has the opt-out flag, so %s is an unsigned delegation", cover, name)
+	}
+
+	wildcard := wildcardOf(encloser)
+
+	match := d.nsec3Matching(wildcard)
+	if match == nil {
+		return StatusBogus, fmt.Sprintf("no NSEC3 record matches %s or the wildcard %s", name, wildcard)
+	}
+
+	if status, reason := checkTypes(match.String(), match.rdata.Types(), typ); status != StatusSecure {
+		return status, reason
+	}
+
+	d.note("%s matches the hash of the wildcard %s and lists %s, so there are no %s records", match, wildcard, typesString(match.rdata.Types()), dnsmsg.RecordTypeString(typ))
+
+	return StatusSecure, ""
+}
+
+func (d *denial) nsec3WildcardAnswer(name, encloser string) (Status, string) {
+	nextCloser := name
+	for !strings.EqualFold(dnsmsg.ParentName(nextCloser), encloser) && nextCloser != "." {
+		nextCloser = dnsmsg.ParentName(nextCloser)
+	}
+
+	cover := d.nsec3Covering(nextCloser)
+	if cover == nil {
+		return StatusBogus, fmt.Sprintf("no NSEC3 record proves %s does not exist, which an answer from %s needs", nextCloser, wildcardOf(encloser))
+	}
+
+	d.note("%s covers the hash of %s, so the answer was rightly expanded from %s", cover, nextCloser, wildcardOf(encloser))
+
+	return StatusSecure, ""
+}
+
+// closestEncloserProof finds the longest name above name which an NSEC3 record
+// matches, and the NSEC3 record covering the name one label below it on the
+// way to name, see RFC 5155 section 8.3. The next closer name is empty when
+// name itself is matched.
+func (d *denial) closestEncloserProof(name string) (string, string, *nsec3Record, Status, string) {
+	nextCloser := ""
+
+	for candidate := name; ; candidate = dnsmsg.ParentName(candidate) {
+		if match := d.nsec3Matching(candidate); match != nil {
+			if nextCloser == "" {
+				return candidate, "", nil, StatusSecure, ""
+			}
+
+			cover := d.nsec3Covering(nextCloser)
+			if cover == nil {
+				return "", "", nil, StatusBogus, fmt.Sprintf("no NSEC3 record covers the hash of the next closer name %s", nextCloser)
+			}
+
+			d.note("%s matches the hash of %s, the closest encloser", match, candidate)
+			d.note("%s covers the hash of %s, the next closer name, so it does not exist", cover, nextCloser)
+
+			return candidate, nextCloser, cover, StatusSecure, ""
+		}
+
+		if candidate == "." {
+			return "", "", nil, StatusBogus, fmt.Sprintf("no NSEC3 record matches a name above %s to prove its closest encloser", name)
+		}
+
+		nextCloser = candidate
+	}
+}
+
+// nsec3Matching returns the NSEC3 record holding the hash of name
+func (d *denial) nsec3Matching(name string) *nsec3Record {
+	for i, r := range d.nsec3 {
+		if hash := r.hashOf(name); hash != nil && bytes.Equal(r.hash, hash) {
+			return &d.nsec3[i]
+		}
+	}
+
+	return nil
+}
+
+// nsec3Covering returns the NSEC3 record whose hash sorts before the hash of
+// name and whose next hash sorts after it, wrapping around at the end of the
+// chain
+func (d *denial) nsec3Covering(name string) *nsec3Record {
+	for i, r := range d.nsec3 {
+		hash := r.hashOf(name)
+		if hash == nil {
+			continue
+		}
+
+		next := r.rdata.NextHashedOwner()
+		afterOwner := bytes.Compare(r.hash, hash) < 0
+		beforeNext := bytes.Compare(hash, next) < 0
+
+		if bytes.Compare(r.hash, next) < 0 {
+			if afterOwner && beforeNext {
+				return &d.nsec3[i]
+			}
+		} else if afterOwner || beforeNext {
+			return &d.nsec3[i]
+		}
+	}
+
+	return nil
+}
+
+// hashOf hashes name with the parameters of the record, or returns nil when
+// the name is outside of its zone or the hash algorithm is unknown
+func (r nsec3Record) hashOf(name string) []byte {
+	if !dnsmsg.IsSubDomain(r.zone, name) || r.rdata.HashAlgorithm() != dnsmsg.NSEC3HashSHA1 {
+		return nil
+	}
+
+	hash, err := dnsmsg.HashName(name, r.rdata.Iterations(), r.rdata.Salt())
+	if err != nil {
+		return nil
+	}
+
+	return hash
+}
+
+// checkTypes checks the types listed by the NSEC or NSEC3 record matching a
+// name do not include typ, or a CNAME which would have been followed. Records
+// from the parent side of a delegation only prove there are no DS records.
+func checkTypes(record string, types []dnsmsg.RecordType, typ dnsmsg.RecordType) (Status, string) {
+	has := func(t dnsmsg.RecordType) bool {
+		for _, listed := range types {
+			if listed == t {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	switch {
+	case has(typ):
+		return StatusBogus, fmt.Sprintf("%s lists %s records which were not returned", record, dnsmsg.RecordTypeString(typ))
+	case has(dnsmsg.RecordTypeCNAME):
+		return StatusBogus, fmt.Sprintf("%s lists a CNAME record which was not returned", record)
+	case typ != dnsmsg.RecordTypeDS && has(dnsmsg.RecordTypeNS) && !has(dnsmsg.RecordTypeSOA):
+		return StatusBogus, fmt.Sprintf("%s is from the parent side of a delegation, so it only proves there are no DS records", record)
+	}
+
+	return StatusSecure, ""
+}
+
+// commonAncestor returns the longest name which name and other both fall
+// under
+func commonAncestor(name, other string) string {
+	ancestor := name
+
+	for !dnsmsg.IsSubDomain(ancestor, other) {
+		ancestor = dnsmsg.ParentName(ancestor)
+	}
+
+	return ancestor
+}
+
+// wildcardOf returns the wildcard name directly below name
+func wildcardOf(name string) string {
+	return "*." + trimRoot(name)
+}
+
+// trimRoot drops the root from a name so labels can be added in front of it
+func trimRoot(name string) string {
+	if name == "." {
+		return ""
+	}
+
+	return name
+}
+
+// typesString lists record types for a proof
+func typesString(types []dnsmsg.RecordType) string {
+	if len(types) == 0 {
+		return "no types"
+	}
+
+	names := make([]string, len(types))
+	for i, typ := range types {
+		names[i] = dnsmsg.RecordTypeString(typ)
+	}
+
+	return "only " + strings.Join(names, " ")
+}
@@ -0,0 +1,386 @@
+package validator
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+	"github.com/dansackett/dns-client/server"
+)
+
+// The zone the proofs of non-existence are made for. It holds a wildcard, an
+// empty non-terminal and an unsigned delegation.
+const denialZone = `
+$TTL 300
+@		SOA	ns hostmaster 1 3600 600 86400 300
+@		NS	ns
+ns		A	192.0.2.53
+www		A	192.0.2.1
+*.wild		TXT	"from the wildcard"
+host.empty	A	192.0.2.2
+unsigned	NS	ns.unsigned
+ns.unsigned	A	192.0.2.54
+`
+
+// The salt and iterations of the NSEC3 test chains
+const (
+	testSalt       = "aabbccdd"
+	testIterations = 1
+)
+
+// zoneOwners returns the names a zone is authoritative for in canonical
+// order, along with the types each holds and which of them are delegations
+func zoneOwners(origin string, rrs []dnsmsg.RR) ([]string, map[string][]dnsmsg.RecordType, map[string]bool) {
+	cuts := make(map[string]bool)
+	for _, rr := range rrs {
+		if rr.TYPE == dnsmsg.RecordTypeNS && rr.NAME != origin {
+			cuts[rr.NAME] = true
+		}
+	}
+
+	var owners []string
+	types := make(map[string][]dnsmsg.RecordType)
+
+	for _, rr := range rrs {
+		glue := false
+		for cut := range cuts {
+			if dnsmsg.IsSubDomain(cut, rr.NAME) && rr.NAME != cut {
+				glue = true
+			}
+		}
+
+		if glue {
+			continue
+		}
+
+		if types[rr.NAME] == nil {
+			owners = append(owners, rr.NAME)
+		}
+
+		types[rr.NAME] = append(types[rr.NAME], rr.TYPE)
+	}
+
+	sort.Slice(owners, func(i, j int) bool {
+		return dnsmsg.CompareNames(owners[i], owners[j]) < 0
+	})
+
+	return owners, types, cuts
+}
+
+// typeList lists types in numeric order without repeats
+func typeList(types []dnsmsg.RecordType) string {
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	var names []string
+	for i, typ := range types {
+		if i == 0 || typ != types[i-1] {
+			names = append(names, dnsmsg.RecordTypeToStrMap[typ])
+		}
+	}
+
+	return strings.Join(names, " ")
+}
+
+// addNSEC adds the NSEC chain of a zone, which links each name to the next in
+// canonical order and the last back to the origin
+func addNSEC(t *testing.T, origin string, rrs []dnsmsg.RR) []dnsmsg.RR {
+	t.Helper()
+
+	owners, types, _ := zoneOwners(origin, rrs)
+
+	for i, owner := range owners {
+		next := owners[(i+1)%len(owners)]
+		list := typeList(append(types[owner], dnsmsg.RecordTypeRRSIG, dnsmsg.RecordTypeNSEC))
+
+		rr, err := dnsmsg.ParseRR(fmt.Sprintf("%s 300 IN NSEC %s %s", owner, next, list))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rrs = append(rrs, rr)
+	}
+
+	return rrs
+}
+
+// addNSEC3 adds the NSEC3 chain of a zone, which links the hashes of its
+// names including empty non-terminals. With optOut unsigned delegations are
+// left out of the chain, and flag sets the opt-out flag saying so.
+func addNSEC3(t *testing.T, origin string, rrs []dnsmsg.RR, optOut, flag bool) []dnsmsg.RR {
+	t.Helper()
+
+	owners, types, cuts := zoneOwners(origin, rrs)
+
+	// Names between the origin and an owner exist without records
+	names := make(map[string][]dnsmsg.RecordType)
+	for _, owner := range owners {
+		for name := dnsmsg.ParentName(owner); name != origin && dnsmsg.IsSubDomain(origin, name); name = dnsmsg.ParentName(name) {
+			if names[name] == nil {
+				names[name] = []dnsmsg.RecordType{}
+			}
+		}
+	}
+
+	for _, owner := range owners {
+		unsigned := cuts[owner] && len(types[owner]) == 1
+
+		switch {
+		case unsigned && optOut:
+			delete(names, owner)
+			continue
+		case unsigned:
+			names[owner] = types[owner]
+		default:
+			names[owner] = append(types[owner], dnsmsg.RecordTypeRRSIG)
+		}
+	}
+
+	salt, _ := hex.DecodeString(testSalt)
+
+	type hashed struct {
+		hash  string
+		types []dnsmsg.RecordType
+	}
+
+	var chain []hashed
+	for name, types := range names {
+		hash, err := dnsmsg.HashName(name, testIterations, salt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		chain = append(chain, hashed{strings.ToLower(base32Hex.EncodeToString(hash)), types})
+	}
+
+	sort.Slice(chain, func(i, j int) bool { return chain[i].hash < chain[j].hash })
+
+	flags := 0
+	if flag {
+		flags = 1
+	}
+
+	for i, h := range chain {
+		next := chain[(i+1)%len(chain)].hash
+
+		rr, err := dnsmsg.ParseRR(fmt.Sprintf("%s.%s 300 IN NSEC3 1 %d %d %s %s %s",
+			h.hash, origin, flags, testIterations, testSalt, next, typeList(h.types)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rrs = append(rrs, rr)
+	}
+
+	return rrs
+}
+
+// newDenialChain serves the denial test zone as example. with the chain of
+// proofs named by kind
+func newDenialChain(t *testing.T, kind string) *testChain {
+	t.Helper()
+
+	rrs, err := dnsmsg.ParseZone(strings.NewReader(denialZone), "example.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := newTestKey(t, "example.")
+	rrs = append(rrs, key.dnskey)
+
+	switch kind {
+	case "NSEC":
+		rrs = addNSEC(t, "example.", rrs)
+	case "NSEC3":
+		rrs = addNSEC3(t, "example.", rrs, false, false)
+	case "opt-out":
+		rrs = addNSEC3(t, "example.", rrs, true, true)
+	case "opt-out without the flag":
+		rrs = addNSEC3(t, "example.", rrs, true, false)
+	}
+
+	z, err := server.NewZone("example.", signZone(t, key, rrs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &testChain{server: server.New(""), anchor: key.ds(t)}
+	c.server.AddZone(z)
+
+	return c
+}
+
+// dropDenial removes the NSEC and NSEC3 records from the authority section
+// along with their signatures
+func dropDenial(resp *dnsmsg.Message) {
+	var kept []dnsmsg.RR
+
+	for _, rr := range resp.Authority {
+		typ := rr.TYPE
+		if sig, ok := rr.RDATA.(*dnsmsg.RDataRRSIG); ok {
+			typ = sig.TypeCovered()
+		}
+
+		if typ != dnsmsg.RecordTypeNSEC && typ != dnsmsg.RecordTypeNSEC3 {
+			kept = append(kept, rr)
+		}
+	}
+
+	resp.Authority = kept
+}
+
+// askFor changes the question a response claims to answer
+func askFor(name string, typ dnsmsg.RecordType) func(*dnsmsg.Message) {
+	return func(resp *dnsmsg.Message) {
+		resp.Questions[0].QNAME = name
+		resp.Questions[0].QTYPE = typ
+	}
+}
+
+func TestValidateDenial(t *testing.T) {
+	type denialTest struct {
+		desc   string
+		name   string
+		typ    dnsmsg.RecordType
+		modify func(*dnsmsg.Message)
+		want   Status
+	}
+
+	// Each proof is checked as served and once broken
+	common := []denialTest{
+		{"NXDOMAIN", "nothing.example.", dnsmsg.RecordTypeA, nil, StatusSecure},
+		{"NXDOMAIN for a name which exists", "nothing.example.", dnsmsg.RecordTypeA, askFor("www.example.", dnsmsg.RecordTypeA), StatusBogus},
+		{"NXDOMAIN without proof", "nothing.example.", dnsmsg.RecordTypeA, dropDenial, StatusBogus},
+		{"NODATA", "www.example.", dnsmsg.RecordTypeMX, nil, StatusSecure},
+		{"NODATA for a type which exists", "www.example.", dnsmsg.RecordTypeMX, askFor("www.example.", dnsmsg.RecordTypeA), StatusBogus},
+		{"NODATA at an empty non-terminal", "empty.example.", dnsmsg.RecordTypeA, nil, StatusSecure},
+		{"NODATA at an empty non-terminal without proof", "empty.example.", dnsmsg.RecordTypeA, dropDenial, StatusBogus},
+		{"wildcard expansion", "host.wild.example.", dnsmsg.RecordTypeTXT, nil, StatusSecure},
+		{"wildcard expansion without proof", "host.wild.example.", dnsmsg.RecordTypeTXT, dropDenial, StatusBogus},
+		{"wildcard NODATA", "host.wild.example.", dnsmsg.RecordTypeA, nil, StatusSecure},
+		{"wildcard NODATA without proof", "host.wild.example.", dnsmsg.RecordTypeA, dropDenial, StatusBogus},
+	}
+
+	tests := map[string][]denialTest{
+		"NSEC": append(common,
+			denialTest{"no DS at a delegation", "unsigned.example.", dnsmsg.RecordTypeDS, nil, StatusSecure},
+			denialTest{"no DS without proof", "unsigned.example.", dnsmsg.RecordTypeDS, dropDenial, StatusBogus},
+		),
+		"NSEC3": append(common,
+			denialTest{"no DS at a delegation", "unsigned.example.", dnsmsg.RecordTypeDS, nil, StatusSecure},
+			denialTest{"no DS without proof", "unsigned.example.", dnsmsg.RecordTypeDS, dropDenial, StatusBogus},
+		),
+
+		// Names within the span of an opt-out record may be unsigned
+		// delegations, so their absence is not proven
+		"opt-out": {
+			{"no DS at an unsigned delegation", "unsigned.example.", dnsmsg.RecordTypeDS, nil, StatusInsecure},
+			{"no DS without proof", "unsigned.example.", dnsmsg.RecordTypeDS, dropDenial, StatusBogus},
+			{"NXDOMAIN", "nothing.example.", dnsmsg.RecordTypeA, nil, StatusInsecure},
+			{"NODATA", "www.example.", dnsmsg.RecordTypeMX, nil, StatusSecure},
+		},
+		"opt-out without the flag": {
+			{"no DS at a delegation left out of the chain", "unsigned.example.", dnsmsg.RecordTypeDS, nil, StatusBogus},
+		},
+	}
+
+	for kind, kindTests := range tests {
+		c := newDenialChain(t, kind)
+
+		for _, tt := range kindTests {
+			resp := c.query(tt.name, tt.typ)
+			if tt.modify != nil {
+				tt.modify(resp)
+			}
+
+			result := c.validator().Validate(context.Background(), resp)
+			if result.Status != tt.want {
+				t.Errorf("%s %s: status = %s, want %s\n%s", kind, tt.desc, result.Status, tt.want, result)
+				continue
+			}
+
+			// Proofs explain which record proves what
+			if tt.want != StatusBogus && len(result.Proof) == 0 {
+				t.Errorf("%s %s: no proof given\n%s", kind, tt.desc, result)
+			}
+		}
+	}
+}
+
+// Zones signed by the sign subcommand validate, whichever chain they use
+func TestValidateSignedZone(t *testing.T) {
+	rrs, err := dnsmsg.ParseZone(strings.NewReader(denialZone), "example.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ksk, err := dnsmsg.GenerateSigningKey("example.", dnsmsg.AlgorithmECDSAP256SHA256, dnsmsg.DNSKEYFlagZone|dnsmsg.DNSKEYFlagSEP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zsk, err := dnsmsg.GenerateSigningKey("example.", dnsmsg.AlgorithmRSASHA256, dnsmsg.DNSKEYFlagZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anchor, err := ksk.DS(dnsmsg.DigestTypeSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	salt, _ := hex.DecodeString(testSalt)
+
+	tests := []struct {
+		opts       dnsmsg.SignOptions
+		nameError  Status
+		delegation Status
+	}{
+		{dnsmsg.SignOptions{}, StatusSecure, StatusSecure},
+		{dnsmsg.SignOptions{NSEC3: true, Iterations: testIterations, Salt: salt}, StatusSecure, StatusSecure},
+		{dnsmsg.SignOptions{NSEC3: true, Iterations: testIterations, Salt: salt, OptOut: true}, StatusInsecure, StatusInsecure},
+	}
+
+	for _, tt := range tests {
+		tt.opts.Inception = testNow.Add(-time.Hour)
+		tt.opts.Expiration = testNow.Add(time.Hour)
+
+		signed, err := dnsmsg.SignZone("example.", rrs, []*dnsmsg.SigningKey{ksk, zsk}, tt.opts)
+		if err != nil {
+			t.Fatalf("SignZone: %v", err)
+		}
+
+		z, err := server.NewZone("example.", signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := &testChain{server: server.New(""), anchor: anchor}
+		c.server.AddZone(z)
+
+		queries := []struct {
+			name string
+			typ  dnsmsg.RecordType
+			want Status
+		}{
+			{"www.example.", dnsmsg.RecordTypeA, StatusSecure},
+			{"example.", dnsmsg.RecordTypeDNSKEY, StatusSecure},
+			{"host.wild.example.", dnsmsg.RecordTypeTXT, StatusSecure},
+			{"www.example.", dnsmsg.RecordTypeMX, StatusSecure},
+			{"empty.example.", dnsmsg.RecordTypeA, StatusSecure},
+			{"nothing.example.", dnsmsg.RecordTypeA, tt.nameError},
+			{"unsigned.example.", dnsmsg.RecordTypeDS, tt.delegation},
+		}
+
+		for _, q := range queries {
+			if result := c.validator().Validate(context.Background(), c.query(q.name, q.typ)); result.Status != q.want {
+				t.Errorf("NSEC3 %v, opt-out %v: %s %s: status = %s, want %s\n%s", tt.opts.NSEC3, tt.opts.OptOut,
+					q.name, dnsmsg.RecordTypeToStrMap[q.typ], result.Status, q.want, result)
+			}
+		}
+	}
+}
@@ -0,0 +1,704 @@
+// Package validator checks the DNSSEC signatures held in responses. The chain
+// of trust is built from a trust anchor down to the zone which signed each
+// RRset by fetching the DNSKEY and DS records of every zone on the way, in the
+// same way a validating resolver does, see RFC 4035 section 5.
+package validator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dansackett/dns-client/dnsclient"
+	"github.com/dansackett/dns-client/dnsmsg"
+)
+
+// sigTimeFormat is how the validity period of a signature is presented
+const sigTimeFormat = "2006-01-02 15:04:05 UTC"
+
+// Status is the outcome of validating records, see RFC 4035 section 4.3
+type Status int
+
+// These are ordered so the status of several RRsets together is the largest
+// of them
+const (
+	// StatusSecure means a chain of signatures leads from a trust anchor to
+	// the records
+	StatusSecure Status = iota
+
+	// StatusInsecure means the chain of trust proves the records are in a
+	// zone which is not signed
+	StatusInsecure
+
+	// StatusIndeterminate means no trust anchor covers the records
+	StatusIndeterminate
+
+	// StatusBogus means the records should be signed but the signatures are
+	// missing, expired or do not verify
+	StatusBogus
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusSecure:
+		return "secure"
+	case StatusInsecure:
+		return "insecure"
+	case StatusIndeterminate:
+		return "indeterminate"
+	default:
+		return "bogus"
+	}
+}
+
+// RRsetResult is the outcome of validating a single RRset of a response
+type RRsetResult struct {
+	// The owner name and type of the RRset
+	Name string
+	Type dnsmsg.RecordType
+
+	Status Status
+
+	// Which key signed the RRset or why it could not be validated
+	Reason string
+}
+
+func (r RRsetResult) String() string {
+	return fmt.Sprintf("%s %s: %s, %s", r.Name, dnsmsg.RecordTypeString(r.Type), r.Status, r.Reason)
+}
+
+// Link is the outcome of validating the keys of one zone in the chain of trust
+type Link struct {
+	Zone   string
+	Status Status
+
+	// How the keys of the zone were reached from the zone above or why they
+	// could not be
+	Reason string
+}
+
+func (l Link) String() string {
+	return fmt.Sprintf("%s: %s, %s", l.Zone, l.Status, l.Reason)
+}
+
+// Result is the outcome of validating a response
+type Result struct {
+	// The status of the response as a whole, which is the worst status of
+	// its RRsets
+	Status Status
+
+	// The outcome for each RRset of the answer section, or of the authority
+	// section when there are no answers
+	RRsets []RRsetResult
+
+	// The zones whose keys were checked, from the trust anchor down
+	Chain []Link
+
+	// How the NSEC or NSEC3 records prove the name or type asked for does
+	// not exist, for negative answers and answers expanded from a wildcard
+	Proof []string
+}
+
+func (r *Result) String() string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("> DNSSEC: %s\n", r.Status))
+
+	for _, rrset := range r.RRsets {
+		sb.WriteString(fmt.Sprintf(">   %s\n", rrset))
+	}
+
+	if len(r.Proof) > 0 {
+		sb.WriteString("> Proof of non-existence:\n")
+
+		for _, step := range r.Proof {
+			sb.WriteString(fmt.Sprintf(">   %s\n", step))
+		}
+	}
+
+	if len(r.Chain) > 0 {
+		sb.WriteString("> Chain of trust:\n")
+
+		for _, link := range r.Chain {
+			sb.WriteString(fmt.Sprintf(">   %s\n", link))
+		}
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// Validator validates responses against a set of trust anchors
+type Validator struct {
+	// Asks for the DNSKEY, DS and SOA records needed to build the chain of
+	// trust. The responses must hold the RRSIG records covering them.
+	Query func(ctx context.Context, name string, typ dnsmsg.RecordType) (*dnsmsg.Message, error)
+
+	// DS or DNSKEY records of the zones which are trusted without proof.
+	// RootAnchors are used when empty.
+	TrustAnchors []dnsmsg.RR
+
+	// The time signatures must be valid at. The current time is used when
+	// zero.
+	Now time.Time
+}
+
+// New creates a Validator which asks client for the records it needs. Queries
+// set the DO bit to receive signatures and the CD bit so a validating server
+// hands over records it considers bogus for them to be diagnosed.
+func New(client *dnsclient.Client) *Validator {
+	return &Validator{
+		Query: func(ctx context.Context, name string, typ dnsmsg.RecordType) (*dnsmsg.Message, error) {
+			m := dnsmsg.NewQuery(name, typ)
+			m.Header.Z |= dnsmsg.ZFlagCD
+			m.SetEDNS(dnsmsg.EDNS{UDPSize: dnsmsg.DefaultEDNSUDPSize, Flags: dnsmsg.EDNSFlagDO})
+
+			resp, _, err := client.Exchange(ctx, m)
+
+			return resp, err
+		},
+		TrustAnchors: RootAnchors,
+	}
+}
+
+// Validate checks the signatures over the RRsets of the answer section of a
+// response, or of the authority section when there are no answers. The
+// response must have been asked for with the DO bit set.
+func (v *Validator) Validate(ctx context.Context, resp *dnsmsg.Message) *Result {
+	s := &session{
+		v:       v,
+		ctx:     ctx,
+		now:     v.Now,
+		anchors: v.TrustAnchors,
+		zones:   make(map[string]*zoneResult),
+		queries: make(map[string]*dnsmsg.Message),
+	}
+
+	if s.now.IsZero() {
+		s.now = time.Now()
+	}
+
+	if len(s.anchors) == 0 {
+		s.anchors = RootAnchors
+	}
+
+	rrs := resp.Answers
+
+	if len(rrs) == 0 {
+		// NS records in the authority section of a referral are not signed
+		for _, rr := range resp.Authority {
+			if rr.TYPE != dnsmsg.RecordTypeNS {
+				rrs = append(rrs, rr)
+			}
+		}
+	}
+
+	result := &Result{Status: StatusIndeterminate}
+
+	for i, set := range groupRRsets(rrs) {
+		status, reason := s.validateRRset(set)
+
+		if i == 0 || status > result.Status {
+			result.Status = status
+		}
+
+		result.RRsets = append(result.RRsets, RRsetResult{
+			Name:   set.name,
+			Type:   set.typ,
+			Status: status,
+			Reason: reason,
+		})
+	}
+
+	// Signed records can still hide a missing name or type, which only the
+	// NSEC or NSEC3 records can rule out
+	if result.Status == StatusSecure && len(resp.Questions) > 0 {
+		status, proof := s.checkDenial(resp)
+
+		result.Status = status
+		result.Proof = proof
+	}
+
+	result.Chain = s.chain
+
+	return result
+}
+
+// rrset is the records of one type owned by a name along with the signatures
+// covering them
+type rrset struct {
+	name    string
+	typ     dnsmsg.RecordType
+	records []dnsmsg.RR
+	sigs    []*dnsmsg.RDataRRSIG
+
+	// malformed is set when a record of the RRset has no RDATA of its type
+	malformed bool
+}
+
+// groupRRsets collects records into RRsets in the order they first appear and
+// attaches the RRSIG records covering each one. An RRSIG record without a
+// signature cannot say what it covers so it forms an RRset of its own, which
+// is marked as malformed.
+func groupRRsets(rrs []dnsmsg.RR) []*rrset {
+	var sets []*rrset
+
+	find := func(name string, typ dnsmsg.RecordType) *rrset {
+		for _, set := range sets {
+			if set.typ == typ && strings.EqualFold(set.name, name) {
+				return set
+			}
+		}
+
+		set := &rrset{name: name, typ: typ}
+		sets = append(sets, set)
+
+		return set
+	}
+
+	for _, rr := range rrs {
+		switch rr.TYPE {
+		case dnsmsg.RecordTypeOPT, dnsmsg.RecordTypeTSIG:
+		case dnsmsg.RecordTypeRRSIG:
+			if sig, ok := rr.RDATA.(*dnsmsg.RDataRRSIG); ok {
+				set := find(rr.NAME, sig.TypeCovered())
+				set.sigs = append(set.sigs, sig)
+				break
+			}
+
+			fallthrough
+		default:
+			set := find(rr.NAME, rr.TYPE)
+			set.records = append(set.records, rr)
+
+			// Only UPDATE messages hold records without RDATA
+			if _, empty := rr.RDATA.(*dnsmsg.RDataEmpty); empty || rr.TYPE == dnsmsg.RecordTypeRRSIG {
+				set.malformed = true
+			}
+		}
+	}
+
+	// Signatures on their own do not form an RRset to validate
+	var complete []*rrset
+
+	for _, set := range sets {
+		if len(set.records) > 0 {
+			complete = append(complete, set)
+		}
+	}
+
+	return complete
+}
+
+// findRRset returns the RRset of type typ owned by name among rrs or nil if
+// there are no such records
+func findRRset(rrs []dnsmsg.RR, name string, typ dnsmsg.RecordType) *rrset {
+	for _, set := range groupRRsets(rrs) {
+		if set.typ == typ && strings.EqualFold(set.name, name) {
+			return set
+		}
+	}
+
+	return nil
+}
+
+// findRRsetOfType returns the first RRset of type typ among rrs or nil if
+// there are no such records
+func findRRsetOfType(rrs []dnsmsg.RR, typ dnsmsg.RecordType) *rrset {
+	for _, set := range groupRRsets(rrs) {
+		if set.typ == typ {
+			return set
+		}
+	}
+
+	return nil
+}
+
+// zoneResult is the outcome of validating the keys of a zone
+type zoneResult struct {
+	status Status
+	reason string
+
+	// The keys of the zone which may sign its records, set when it is secure
+	keys []*dnsmsg.RDataDNSKEY
+}
+
+// session holds what has been learned while validating a single response so
+// each zone is only checked once
+type session struct {
+	v       *Validator
+	ctx     context.Context
+	now     time.Time
+	anchors []dnsmsg.RR
+	zones   map[string]*zoneResult
+	queries map[string]*dnsmsg.Message
+	chain   []Link
+}
+
+// query asks for the records of type typ owned by name, reusing an earlier
+// response to the same question
+func (s *session) query(name string, typ dnsmsg.RecordType) (*dnsmsg.Message, error) {
+	key := fmt.Sprintf("%s/%d", strings.ToLower(name), typ)
+
+	if resp, ok := s.queries[key]; ok {
+		return resp, nil
+	}
+
+	resp, err := s.v.Query(s.ctx, name, typ)
+	if err != nil {
+		return nil, err
+	}
+
+	s.queries[key] = resp
+
+	return resp, nil
+}
+
+// validateRRset checks the signatures over an RRset until one is found which
+// verifies with a key of a secure zone
+func (s *session) validateRRset(set *rrset) (Status, string) {
+	if set.malformed {
+		return StatusBogus, fmt.Sprintf("a %s record of %s has no RDATA", dnsmsg.RecordTypeToStrMap[set.typ], set.name)
+	}
+
+	if len(set.sigs) == 0 {
+		return s.validateUnsigned(set.name)
+	}
+
+	var reason, uncovered string
+
+	for _, sig := range set.sigs {
+		signer := dnsmsg.Fqdn(sig.SignerName())
+
+		if !dnsmsg.IsSubDomain(signer, set.name) {
+			reason = fmt.Sprintf("signer %s is not an ancestor of the owner", signer)
+			continue
+		}
+
+		zone := s.zoneKeys(signer)
+
+		switch zone.status {
+		case StatusSecure:
+		case StatusInsecure:
+			return StatusInsecure, fmt.Sprintf("zone %s is not secured by the chain of trust", signer)
+		case StatusIndeterminate:
+			uncovered = fmt.Sprintf("no trust anchor covers zone %s", signer)
+			continue
+		default:
+			reason = fmt.Sprintf("keys of %s are %s", signer, zone.status)
+			continue
+		}
+
+		status, why := s.checkSignature(sig, set, zone.keys)
+		if status == StatusSecure {
+			return status, why
+		}
+
+		reason = why
+	}
+
+	// Records signed by a zone outside every trust anchor cannot be shown to
+	// be bogus either
+	if uncovered != "" {
+		return StatusIndeterminate, uncovered
+	}
+
+	return StatusBogus, reason
+}
+
+// checkSignature verifies a signature over an RRset using the key it names
+// among keys
+func (s *session) checkSignature(sig *dnsmsg.RDataRRSIG, set *rrset, keys []*dnsmsg.RDataDNSKEY) (Status, string) {
+	signer := dnsmsg.Fqdn(sig.SignerName())
+	reason := fmt.Sprintf("no DNSKEY of %s has key tag %d", signer, sig.KeyTag())
+
+	for _, key := range keys {
+		if key.KeyTag() != sig.KeyTag() || key.Algorithm() != sig.Algorithm() {
+			continue
+		}
+
+		if err := sig.Verify(key, set.records); err != nil {
+			reason = fmt.Sprintf("RRSIG by %s key %d: %v", signer, sig.KeyTag(), err)
+			continue
+		}
+
+		if !sig.ValidAt(s.now) {
+			return StatusBogus, fmt.Sprintf("RRSIG by %s key %d is only valid from %s to %s", signer, sig.KeyTag(),
+				formatSigTime(sig.Inception()), formatSigTime(sig.Expiration()))
+		}
+
+		return StatusSecure, fmt.Sprintf("signed by %s key %d", signer, sig.KeyTag())
+	}
+
+	return StatusBogus, reason
+}
+
+// validateUnsigned decides whether records without signatures are expected to
+// be unsigned. They are insecure when the chain of trust ends at a zone cut
+// above them and bogus when every zone above them is secure.
+func (s *session) validateUnsigned(name string) (Status, string) {
+	anchor := s.closestAnchor(name)
+	if anchor == "" {
+		return StatusIndeterminate, "no trust anchor covers the name"
+	}
+
+	// Walk down from the trust anchor looking for the zone where the chain
+	// of trust ends
+	zones := []string{name}
+
+	for zone := name; !strings.EqualFold(zone, anchor); {
+		zone = dnsmsg.ParentName(zone)
+		zones = append([]string{zone}, zones...)
+	}
+
+	lastSecure := anchor
+
+	for i, zone := range zones {
+		if i > 0 {
+			resp, err := s.query(zone, dnsmsg.RecordTypeSOA)
+			if err != nil {
+				return StatusBogus, fmt.Sprintf("checking for a zone cut at %s: %v", zone, err)
+			}
+
+			if findRRset(resp.Answers, zone, dnsmsg.RecordTypeSOA) == nil {
+				continue
+			}
+		}
+
+		z := s.zoneKeys(zone)
+		if z.status != StatusSecure {
+			return z.status, fmt.Sprintf("records are not signed and zone %s is %s", zone, z.status)
+		}
+
+		lastSecure = zone
+	}
+
+	return StatusBogus, fmt.Sprintf("records are not signed although zone %s is secure", lastSecure)
+}
+
+// zoneKeys returns the outcome of validating the DNSKEY RRset of a zone,
+// checking it the first time the zone is reached
+func (s *session) zoneKeys(zone string) *zoneResult {
+	zone = strings.ToLower(dnsmsg.Fqdn(zone))
+
+	if z, ok := s.zones[zone]; ok {
+		return z
+	}
+
+	// The entry is in place while the zone is checked so a chain leading
+	// back to it is caught
+	z := &zoneResult{status: StatusBogus, reason: "chain of trust loops back on itself"}
+	s.zones[zone] = z
+
+	*z = s.checkZone(zone)
+	s.chain = append(s.chain, Link{Zone: zone, Status: z.status, Reason: z.reason})
+
+	return z
+}
+
+// checkZone finds the keys of a zone which are trusted, either because they
+// match a trust anchor or a DS record of the secure parent zone, and checks
+// they sign the DNSKEY RRset
+func (s *session) checkZone(zone string) zoneResult {
+	var dsRecords []*dnsmsg.RDataDS
+	var anchorKeys []*dnsmsg.RDataDNSKEY
+	var source, via string
+
+	for _, rr := range s.anchors {
+		if !strings.EqualFold(dnsmsg.Fqdn(rr.NAME), zone) {
+			continue
+		}
+
+		switch rdata := rr.RDATA.(type) {
+		case *dnsmsg.RDataDS:
+			dsRecords = append(dsRecords, rdata)
+		case *dnsmsg.RDataDNSKEY:
+			anchorKeys = append(anchorKeys, rdata)
+		}
+	}
+
+	if len(dsRecords) > 0 || len(anchorKeys) > 0 {
+		source, via = "the trust anchor", "the trust anchor"
+	} else {
+		if s.closestAnchor(zone) == "" {
+			return zoneResult{status: StatusIndeterminate, reason: "no trust anchor covers the zone"}
+		}
+
+		resp, err := s.query(zone, dnsmsg.RecordTypeDS)
+		if err != nil {
+			return zoneResult{status: StatusBogus, reason: fmt.Sprintf("querying DS records: %v", err)}
+		}
+
+		set := findRRset(resp.Answers, zone, dnsmsg.RecordTypeDS)
+		if set == nil {
+			return s.checkNoDS(zone, resp)
+		}
+
+		status, reason := s.validateRRset(set)
+		if status != StatusSecure {
+			return zoneResult{status: status, reason: fmt.Sprintf("DS records are %s: %s", status, reason)}
+		}
+
+		for _, rr := range set.records {
+			ds, ok := rr.RDATA.(*dnsmsg.RDataDS)
+			if !ok {
+				return zoneResult{status: StatusBogus, reason: "a DS record has no RDATA"}
+			}
+
+			if dnsmsg.SupportsAlgorithm(ds.Algorithm()) && supportsDigest(ds.DigestType()) {
+				dsRecords = append(dsRecords, ds)
+			}
+		}
+
+		// A zone signed only with algorithms which cannot be checked is
+		// treated as unsigned, see RFC 4035 section 5.2
+		if len(dsRecords) == 0 {
+			return zoneResult{status: StatusInsecure, reason: "no DS record uses a supported algorithm and digest"}
+		}
+
+		source, via = "the DS records", fmt.Sprintf("a DS record %s", reason)
+	}
+
+	resp, err := s.query(zone, dnsmsg.RecordTypeDNSKEY)
+	if err != nil {
+		return zoneResult{status: StatusBogus, reason: fmt.Sprintf("querying DNSKEY records: %v", err)}
+	}
+
+	set := findRRset(resp.Answers, zone, dnsmsg.RecordTypeDNSKEY)
+	if set == nil {
+		return zoneResult{status: StatusBogus, reason: "no DNSKEY records found"}
+	}
+
+	var keys, entryKeys []*dnsmsg.RDataDNSKEY
+
+	for _, rr := range set.records {
+		key, ok := rr.RDATA.(*dnsmsg.RDataDNSKEY)
+		if !ok {
+			return zoneResult{status: StatusBogus, reason: "a DNSKEY record has no RDATA"}
+		}
+
+		if key.Flags()&dnsmsg.DNSKEYFlagZone == 0 || key.Flags()&dnsmsg.DNSKEYFlagRevoke != 0 {
+			continue
+		}
+
+		keys = append(keys, key)
+
+		if matchesDS(zone, key, dsRecords) || matchesKey(key, anchorKeys) {
+			entryKeys = append(entryKeys, key)
+		}
+	}
+
+	if len(entryKeys) == 0 {
+		return zoneResult{status: StatusBogus, reason: "no DNSKEY matches " + source}
+	}
+
+	reason := "the DNSKEY RRset is not signed"
+
+	for _, sig := range set.sigs {
+		if !strings.EqualFold(dnsmsg.Fqdn(sig.SignerName()), zone) {
+			continue
+		}
+
+		status, why := s.checkSignature(sig, set, entryKeys)
+		if status == StatusSecure {
+			return zoneResult{
+				status: StatusSecure,
+				reason: fmt.Sprintf("DNSKEY RRset signed by key %d which matches %s", sig.KeyTag(), via),
+				keys:   keys,
+			}
+		}
+
+		reason = why
+	}
+
+	return zoneResult{status: StatusBogus, reason: reason}
+}
+
+// checkNoDS decides what a response without DS records for a zone means. The
+// delegation is insecure when the secure parent zone proves there are no DS
+// records with NSEC or NSEC3 records, see RFC 4035 section 5.2.
+func (s *session) checkNoDS(zone string, resp *dnsmsg.Message) zoneResult {
+	soa := findRRsetOfType(resp.Authority, dnsmsg.RecordTypeSOA)
+
+	if soa == nil || strings.EqualFold(soa.name, zone) || !dnsmsg.IsSubDomain(soa.name, zone) {
+		return zoneResult{status: StatusBogus, reason: "no DS records and no signed response from the parent zone"}
+	}
+
+	if status, reason := s.validateRRset(soa); status != StatusSecure {
+		return zoneResult{status: status, reason: fmt.Sprintf("response without DS records is %s: %s", status, reason)}
+	}
+
+	d, status, reason := s.newDenial(resp.Authority)
+	if status != StatusSecure {
+		return zoneResult{status: status, reason: fmt.Sprintf("records proving there are no DS records are %s: %s", status, reason)}
+	}
+
+	status, reason = d.proveNoData(zone, dnsmsg.RecordTypeDS)
+	if status == StatusInsecure {
+		d.note("%s", reason)
+	}
+
+	switch status {
+	case StatusSecure, StatusInsecure:
+		proof := strings.Join(d.proof, "; ")
+		return zoneResult{status: StatusInsecure, reason: fmt.Sprintf("no DS records in the secure parent zone %s: %s", soa.name, proof)}
+	default:
+		return zoneResult{status: status, reason: fmt.Sprintf("no DS records and no proof from %s that the delegation is unsigned: %s", soa.name, reason)}
+	}
+}
+
+// closestAnchor returns the closest enclosing zone of name which has a trust
+// anchor or an empty string if there is none
+func (s *session) closestAnchor(name string) string {
+	closest := ""
+
+	for _, rr := range s.anchors {
+		owner := strings.ToLower(dnsmsg.Fqdn(rr.NAME))
+
+		if dnsmsg.IsSubDomain(owner, name) && (closest == "" || dnsmsg.CountLabels(owner) > dnsmsg.CountLabels(closest)) {
+			closest = owner
+		}
+	}
+
+	return closest
+}
+
+// matchesDS reports if any of the DS records refers to key
+func matchesDS(zone string, key *dnsmsg.RDataDNSKEY, dsRecords []*dnsmsg.RDataDS) bool {
+	for _, ds := range dsRecords {
+		if ds.Matches(zone, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesKey reports if key is one of the given keys
+func matchesKey(key *dnsmsg.RDataDNSKEY, keys []*dnsmsg.RDataDNSKEY) bool {
+	rdata, _ := key.Encode()
+
+	for _, k := range keys {
+		if other, _ := k.Encode(); bytes.Equal(rdata, other) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// supportsDigest reports if DS records with the digest type can be checked
+func supportsDigest(digestType dnsmsg.DigestType) bool {
+	switch digestType {
+	case dnsmsg.DigestTypeSHA1, dnsmsg.DigestTypeSHA256, dnsmsg.DigestTypeSHA384:
+		return true
+	default:
+		return false
+	}
+}
+
+// formatSigTime presents an RRSIG time
+func formatSigTime(t uint32) string {
+	return time.Unix(int64(t), 0).UTC().Format(sigTimeFormat)
+}
@@ -0,0 +1,358 @@
+package validator
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dansackett/dns-client/dnsmsg"
+	"github.com/dansackett/dns-client/server"
+)
+
+// The zones of the test chain. example. is the trust anchor and delegates to
+// a signed child with DS records, an unsigned child without them and a signed
+// child whose DS records refer to a key it does not use.
+var testZones = map[string]string{
+	"example.": `
+@		SOA	ns hostmaster 1 3600 600 86400 300
+@		NS	ns
+ns		A	192.0.2.53
+www		A	192.0.2.1
+secure		NS	ns.secure
+ns.secure	A	192.0.2.54
+insecure	NS	ns.insecure
+ns.insecure	A	192.0.2.55
+broken		NS	ns.broken
+ns.broken	A	192.0.2.56
+`,
+	"secure.example.": `
+@	SOA	ns hostmaster 1 3600 600 86400 300
+@	NS	ns
+ns	A	192.0.2.54
+www	A	192.0.2.2
+`,
+	"insecure.example.": `
+@	SOA	ns hostmaster 1 3600 600 86400 300
+@	NS	ns
+ns	A	192.0.2.55
+www	A	192.0.2.3
+`,
+	"broken.example.": `
+@	SOA	ns hostmaster 1 3600 600 86400 300
+@	NS	ns
+ns	A	192.0.2.56
+www	A	192.0.2.4
+`,
+}
+
+// The time the test zones are signed at, with signatures valid for an hour
+// either side
+var testNow = time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+// testKey is an Ed25519 key signing the records of a test zone
+type testKey struct {
+	origin  string
+	private ed25519.PrivateKey
+	dnskey  dnsmsg.RR
+}
+
+func newTestKey(t *testing.T, origin string) *testKey {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dnskey, err := dnsmsg.ParseRR(fmt.Sprintf("%s 300 IN DNSKEY 257 3 15 %s", origin, base64.StdEncoding.EncodeToString(public)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testKey{origin: origin, private: private, dnskey: dnskey}
+}
+
+// ds returns the DS record the parent zone holds for the key
+func (k *testKey) ds(t *testing.T) dnsmsg.RR {
+	t.Helper()
+
+	ds, err := k.dnskey.RDATA.(*dnsmsg.RDataDNSKEY).ToDS(k.origin, dnsmsg.DigestTypeSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dnsmsg.RR{NAME: k.origin, TYPE: dnsmsg.RecordTypeDS, CLASS: dnsmsg.RecordClassIN, TTL: 300, RDATA: ds}
+}
+
+// sign returns the RRSIG record of the key over rrset, which must be written
+// in lowercase so its records are already in canonical form
+func (k *testKey) sign(t *testing.T, rrset []dnsmsg.RR) dnsmsg.RR {
+	t.Helper()
+
+	owner := rrset[0].NAME
+	keyTag := k.dnskey.RDATA.(*dnsmsg.RDataDNSKEY).KeyTag()
+
+	// The labels of a wildcard leave out the asterisk
+	labels := dnsmsg.CountLabels(owner)
+	if strings.HasPrefix(owner, "*.") {
+		labels--
+	}
+
+	rrsig := func(signature []byte) dnsmsg.RR {
+		rr, err := dnsmsg.ParseRR(fmt.Sprintf("%s %d IN RRSIG %s 15 %d %d %s %s %d %s %s",
+			owner, rrset[0].TTL, dnsmsg.RecordTypeToStrMap[rrset[0].TYPE], labels, rrset[0].TTL,
+			testNow.Add(time.Hour).Format("20060102150405"), testNow.Add(-time.Hour).Format("20060102150405"),
+			keyTag, k.origin, base64.StdEncoding.EncodeToString(signature)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return rr
+	}
+
+	// The signed data is the RRSIG RDATA without its signature followed by
+	// the records of the RRset ordered by their RDATA
+	placeholder := make([]byte, ed25519.SignatureSize)
+
+	data, err := rrsig(placeholder).RDATA.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data = data[:len(data)-len(placeholder)]
+
+	sorted := append([]dnsmsg.RR{}, rrset...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, _ := sorted[i].RDATA.Encode()
+		b, _ := sorted[j].RDATA.Encode()
+
+		return string(a) < string(b)
+	})
+
+	for _, rr := range sorted {
+		wire, err := rr.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data = append(data, wire...)
+	}
+
+	return rrsig(ed25519.Sign(k.private, data))
+}
+
+// signZone signs every RRset the zone of key is authoritative for
+func signZone(t *testing.T, key *testKey, rrs []dnsmsg.RR) []dnsmsg.RR {
+	t.Helper()
+
+	cuts := make(map[string]bool)
+	for _, rr := range rrs {
+		if rr.TYPE == dnsmsg.RecordTypeNS && rr.NAME != key.origin {
+			cuts[rr.NAME] = true
+		}
+	}
+
+	type setKey struct {
+		name string
+		typ  dnsmsg.RecordType
+	}
+
+	var order []setKey
+	sets := make(map[setKey][]dnsmsg.RR)
+
+	for _, rr := range rrs {
+		// Delegations and glue belong to the child, only the DS and NSEC
+		// records at a cut are signed by the parent
+		delegated := false
+		for cut := range cuts {
+			atCut := rr.NAME == cut && (rr.TYPE == dnsmsg.RecordTypeDS || rr.TYPE == dnsmsg.RecordTypeNSEC)
+			if dnsmsg.IsSubDomain(cut, rr.NAME) && !atCut {
+				delegated = true
+			}
+		}
+
+		if delegated {
+			continue
+		}
+
+		k := setKey{rr.NAME, rr.TYPE}
+		if sets[k] == nil {
+			order = append(order, k)
+		}
+
+		sets[k] = append(sets[k], rr)
+	}
+
+	signed := append([]dnsmsg.RR{}, rrs...)
+	for _, k := range order {
+		signed = append(signed, key.sign(t, sets[k]))
+	}
+
+	return signed
+}
+
+// testChain is a server holding the test zones along with the DS record of
+// example. to use as the trust anchor
+type testChain struct {
+	server *server.Server
+	anchor dnsmsg.RR
+}
+
+func newTestChain(t *testing.T) *testChain {
+	t.Helper()
+
+	zones := make(map[string][]dnsmsg.RR)
+
+	for origin, text := range testZones {
+		rrs, err := dnsmsg.ParseZone(strings.NewReader("$TTL 300\n"+text), origin)
+		if err != nil {
+			t.Fatalf("zone %s: %v", origin, err)
+		}
+
+		zones[origin] = rrs
+	}
+
+	c := &testChain{server: server.New("")}
+
+	// Children are signed first so their DS records can be added to the
+	// parent before it is signed
+	for _, origin := range []string{"secure.example.", "broken.example.", "example."} {
+		key := newTestKey(t, origin)
+		ds := key.ds(t)
+
+		if origin == "broken.example." {
+			ds = newTestKey(t, origin).ds(t)
+		}
+
+		if origin == "example." {
+			c.anchor = ds
+		} else {
+			zones["example."] = append(zones["example."], ds)
+		}
+
+		zones[origin] = signZone(t, key, addNSEC(t, origin, append(zones[origin], key.dnskey)))
+	}
+
+	for origin, rrs := range zones {
+		z, err := server.NewZone(origin, rrs)
+		if err != nil {
+			t.Fatalf("zone %s: %v", origin, err)
+		}
+
+		c.server.AddZone(z)
+	}
+
+	return c
+}
+
+// query asks the test server a question with the DO bit set
+func (c *testChain) query(name string, typ dnsmsg.RecordType) *dnsmsg.Message {
+	m := dnsmsg.NewQuery(name, typ)
+	m.SetEDNS(dnsmsg.EDNS{UDPSize: dnsmsg.DefaultEDNSUDPSize, Flags: dnsmsg.EDNSFlagDO})
+
+	return c.server.Handle(m)
+}
+
+// validator returns a Validator asking the test server for the records it
+// needs and trusting the keys of example.
+func (c *testChain) validator() *Validator {
+	return &Validator{
+		Query: func(ctx context.Context, name string, typ dnsmsg.RecordType) (*dnsmsg.Message, error) {
+			return c.query(name, typ), nil
+		},
+		TrustAnchors: []dnsmsg.RR{c.anchor},
+		Now:          testNow,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := newTestChain(t)
+
+	tests := []struct {
+		name string
+		typ  dnsmsg.RecordType
+		want Status
+	}{
+		{"www.example.", dnsmsg.RecordTypeA, StatusSecure},
+		{"example.", dnsmsg.RecordTypeNS, StatusSecure},
+		{"example.", dnsmsg.RecordTypeDNSKEY, StatusSecure},
+		{"www.secure.example.", dnsmsg.RecordTypeA, StatusSecure},
+		{"www.insecure.example.", dnsmsg.RecordTypeA, StatusInsecure},
+		{"www.broken.example.", dnsmsg.RecordTypeA, StatusBogus},
+	}
+
+	for _, tt := range tests {
+		resp := c.query(tt.name, tt.typ)
+		if resp.Header.RCODE != dnsmsg.ResponseCodeNoError || len(resp.Answers) == 0 {
+			t.Fatalf("%s %s: server responded with %s and %d answers", tt.name, dnsmsg.RecordTypeToStrMap[tt.typ],
+				dnsmsg.ResponseCodeToStrMap[resp.Header.RCODE], len(resp.Answers))
+		}
+
+		if result := c.validator().Validate(context.Background(), resp); result.Status != tt.want {
+			t.Errorf("%s %s: status = %s, want %s\n%s", tt.name, dnsmsg.RecordTypeToStrMap[tt.typ], result.Status, tt.want, result)
+		}
+	}
+}
+
+func TestValidateBogus(t *testing.T) {
+	c := newTestChain(t)
+
+	tests := []struct {
+		name   string
+		modify func(v *Validator, resp *dnsmsg.Message)
+	}{
+		{"signatures expired", func(v *Validator, resp *dnsmsg.Message) {
+			v.Now = testNow.Add(2 * time.Hour)
+		}},
+		{"signatures not yet valid", func(v *Validator, resp *dnsmsg.Message) {
+			v.Now = testNow.Add(-2 * time.Hour)
+		}},
+		{"answer altered", func(v *Validator, resp *dnsmsg.Message) {
+			rr, _ := dnsmsg.ParseRR("www.example. 300 IN A 203.0.113.1")
+			resp.Answers[0].RDATA = rr.RDATA
+		}},
+		{"signatures removed", func(v *Validator, resp *dnsmsg.Message) {
+			resp.Answers = resp.Answers[:1]
+		}},
+		{"answer without RDATA", func(v *Validator, resp *dnsmsg.Message) {
+			resp.Answers[0].RDATA = &dnsmsg.RDataEmpty{}
+		}},
+		{"signature without RDATA", func(v *Validator, resp *dnsmsg.Message) {
+			resp.Answers[1].RDATA = &dnsmsg.RDataEmpty{}
+		}},
+		{"trust anchor for another key", func(v *Validator, resp *dnsmsg.Message) {
+			v.TrustAnchors = []dnsmsg.RR{newTestKey(t, "example.").ds(t)}
+		}},
+	}
+
+	for _, tt := range tests {
+		resp := c.query("www.example.", dnsmsg.RecordTypeA)
+		if len(resp.Answers) != 2 || resp.Answers[1].TYPE != dnsmsg.RecordTypeRRSIG {
+			t.Fatalf("answer = %v, want an A record and its RRSIG", resp.Answers)
+		}
+
+		v := c.validator()
+		tt.modify(v, resp)
+
+		if result := v.Validate(context.Background(), resp); result.Status != StatusBogus {
+			t.Errorf("%s: status = %s, want bogus\n%s", tt.name, result.Status, result)
+		}
+	}
+}
+
+func TestValidateIndeterminate(t *testing.T) {
+	c := newTestChain(t)
+
+	v := c.validator()
+	v.TrustAnchors = []dnsmsg.RR{mustParseRR("other. IN DS 1 15 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D")}
+
+	if result := v.Validate(context.Background(), c.query("www.example.", dnsmsg.RecordTypeA)); result.Status != StatusIndeterminate {
+		t.Errorf("status = %s, want indeterminate\n%s", result.Status, result)
+	}
+}